@@ -3,34 +3,207 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/tony/ess-three/internal/lifecycle"
 	"github.com/tony/ess-three/internal/server"
 	"github.com/tony/ess-three/internal/storage"
 )
 
 func main() {
 	port := flag.String("port", "9300", "Port to run the server on")
+	websitePort := flag.String("website-port", "", "Port to serve buckets' static websites on; empty disables the website endpoint")
+	storageBackend := flag.String("storage", "filesystem", "Storage backend: filesystem, or memory to keep everything in process memory")
 	dataDir := flag.String("data-dir", "/data", "Directory to store bucket data")
+	rebuildIndex := flag.Bool("rebuild-index", false, "Rebuild the key index of every bucket in --data-dir from the metadata on disk, then exit")
+	memoryLimit := flag.String("memory-limit", "", "Cap on the data held by -storage=memory, such as 512MB or 2GiB; empty means unlimited")
+	minPartSize := flag.String("min-part-size", "5MiB", "Smallest size of a multipart upload part other than the last, such as 5MiB; 0 accepts parts of any size")
+	authCredentials := flag.String("auth-credentials", "", "Comma-separated ACCESS_KEY:SECRET pairs; enables SigV4 authentication when set")
+	identities := flag.String("identities", "", "Comma-separated ACCESS_KEY=ARN pairs naming the IAM principal bucket policies see for each key; a bare user name expands to an IAM user ARN")
+	region := flag.String("region", "us-east-1", "Region requests are signed for")
+	lifecycleInterval := flag.Duration("lifecycle-interval", time.Minute, "How often lifecycle rules are applied; 0 disables the lifecycle worker")
+	lifecycleDay := flag.Duration("lifecycle-day", 24*time.Hour, "Length of one lifecycle rule day; shorten it to test expiration")
+	restoreDelay := flag.Duration("restore-delay", 0, "How long a restore of a GLACIER or DEEP_ARCHIVE object takes before the object can be read, such as 30s")
+	staleUploadAge := flag.Duration("stale-upload-age", 0, "Abort multipart uploads left incomplete for longer than this, such as 24h, in every bucket; 0 keeps them until a lifecycle rule aborts them")
+	baseDomains := flag.String("base-domains", "localhost,s3.local", "Comma-separated base domains for virtual-hosted-style requests (<bucket>.<domain>)")
+	sqsEndpoint := flag.String("sqs-endpoint", "http://ess-queue-ess:9320", "SQS endpoint that receives bucket event notifications")
+	snsEndpoint := flag.String("sns-endpoint", "http://ess-enn-ess:9330", "SNS endpoint that receives bucket event notifications")
 	flag.Parse()
 
+	credentials, err := parseCredentials(*authCredentials)
+	if err != nil {
+		log.Fatalf("Invalid --auth-credentials: %v", err)
+	}
+
+	principals, err := parseIdentities(*identities)
+	if err != nil {
+		log.Fatalf("Invalid --identities: %v", err)
+	}
+
+	if *rebuildIndex {
+		fsStore, err := storage.NewFileSystemStorage(*dataDir, storage.Config{})
+		if err != nil {
+			log.Fatalf("Failed to initialize storage: %v", err)
+		}
+		buckets, err := fsStore.RebuildIndexes()
+		if err != nil {
+			log.Fatalf("Failed to rebuild key indexes: %v", err)
+		}
+		for _, bucket := range buckets {
+			log.Printf("Rebuilt key index of %s: %d objects", bucket.Name, bucket.ObjectCount)
+		}
+		fsStore.Close()
+		return
+	}
+
+	maxBytes, err := parseByteSize(*memoryLimit)
+	if err != nil {
+		log.Fatalf("Invalid --memory-limit: %v", err)
+	}
+	minPartBytes, err := parseByteSize(*minPartSize)
+	if err != nil {
+		log.Fatalf("Invalid --min-part-size: %v", err)
+	}
+
 	// Create storage backend
-	store, err := storage.NewFileSystemStorage(*dataDir)
+	storageConfig := storage.Config{MinPartSize: minPartBytes}
+	var store storage.Storage
+	switch *storageBackend {
+	case "filesystem":
+		store, err = storage.NewFileSystemStorage(*dataDir, storageConfig)
+	case "memory":
+		store, err = storage.NewMemoryStorage(maxBytes, storageConfig)
+	default:
+		log.Fatalf("Invalid --storage: expected filesystem or memory, got %q", *storageBackend)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
 	// Create and configure server
-	srv := server.NewServer(store)
+	srv := server.NewServer(store, server.Config{
+		Credentials:  credentials,
+		Identities:   principals,
+		Region:       *region,
+		BaseDomains:  strings.Split(*baseDomains, ","),
+		SQSEndpoint:  *sqsEndpoint,
+		SNSEndpoint:  *snsEndpoint,
+		RestoreDelay: *restoreDelay,
+	})
+
+	if *lifecycleInterval > 0 {
+		worker := lifecycle.NewWorker(store, *lifecycleInterval, *lifecycleDay, *staleUploadAge)
+		go worker.Run(context.Background())
+	}
 
 	addr := fmt.Sprintf(":%s", *port)
 	log.Printf("Starting ess-three S3 emulator on %s", addr)
-	log.Printf("Data directory: %s", *dataDir)
+	switch {
+	case *storageBackend == "memory" && maxBytes > 0:
+		log.Printf("In-memory storage limited to %d bytes", maxBytes)
+	case *storageBackend == "memory":
+		log.Printf("In-memory storage; data is lost on exit")
+	default:
+		log.Printf("Data directory: %s", *dataDir)
+	}
+	if len(credentials) > 0 {
+		log.Printf("SigV4 authentication enabled for %d access key(s) in %s", len(credentials), *region)
+	}
+
+	if *websitePort != "" {
+		websiteAddr := fmt.Sprintf(":%s", *websitePort)
+		log.Printf("Serving static websites on %s", websiteAddr)
+		go func() {
+			if err := http.ListenAndServe(websiteAddr, srv.WebsiteRouter()); err != nil {
+				log.Fatalf("Website endpoint failed: %v", err)
+			}
+		}()
+	}
 
 	if err := http.ListenAndServe(addr, srv.Router()); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// parseCredentials parses comma-separated ACCESS_KEY:SECRET pairs
+func parseCredentials(value string) (map[string]string, error) {
+	credentials := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		accessKey, secret, found := strings.Cut(pair, ":")
+		if !found || accessKey == "" || secret == "" {
+			return nil, fmt.Errorf("expected ACCESS_KEY:SECRET, got %q", pair)
+		}
+		credentials[accessKey] = secret
+	}
+	return credentials, nil
+}
+
+// byteUnits maps size suffixes to multipliers, longest suffixes first
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as 1048576, 512MB or 2GiB. An empty
+// value is zero.
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(number), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a size such as 512MB, got %q", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size must be at most %d bytes", int64(math.MaxInt64))
+	}
+	return n * multiplier, nil
+}
+
+// parseIdentities parses comma-separated ACCESS_KEY=ARN pairs. A value that
+// is not an ARN names an IAM user in the emulated account.
+func parseIdentities(value string) (map[string]string, error) {
+	identities := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		accessKey, arn, found := strings.Cut(pair, "=")
+		if !found || accessKey == "" || arn == "" {
+			return nil, fmt.Errorf("expected ACCESS_KEY=ARN, got %q", pair)
+		}
+		if !strings.HasPrefix(arn, "arn:") {
+			arn = "arn:aws:iam::000000000000:user/" + arn
+		}
+		identities[accessKey] = arn
+	}
+	return identities, nil
+}
@@ -2,4 +2,9 @@ module github.com/tony/ess-three
 
 go 1.23
 
-require github.com/go-chi/chi/v5 v5.2.4
+require (
+	github.com/go-chi/chi/v5 v5.2.4
+	go.etcd.io/bbolt v1.3.11
+)
+
+require golang.org/x/sys v0.22.0 // indirect
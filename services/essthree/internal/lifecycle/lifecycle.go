@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lifecycle applies bucket lifecycle rules in the background.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// listPageSize is the number of versions or uploads fetched per listing call
+const listPageSize = 1000
+
+// Worker periodically expires objects, noncurrent versions and incomplete
+// multipart uploads according to each bucket's lifecycle rules, and reaps
+// uploads left incomplete for longer than a server-wide maximum age
+type Worker struct {
+	store    storage.Storage
+	interval time.Duration
+
+	// dayLength is the duration of one lifecycle "day". It is 24 hours
+	// unless shortened to exercise retention logic in tests.
+	dayLength time.Duration
+
+	// pageSize is the number of versions or uploads fetched per listing
+	// call. It is listPageSize unless shortened to exercise paging in tests.
+	pageSize int
+
+	// uploadMaxAge is how long an upload may stay incomplete in any bucket,
+	// regardless of its rules; zero keeps uploads until a rule aborts them
+	uploadMaxAge time.Duration
+
+	now func() time.Time
+}
+
+// Stats counts the changes made by one sweep
+type Stats struct {
+	Expired             int
+	DeleteMarkersPurged int
+	NoncurrentExpired   int
+	UploadsAborted      int
+}
+
+// NewWorker creates a lifecycle worker that sweeps every interval. A
+// non-positive dayLength defaults to 24 hours; a non-positive uploadMaxAge
+// disables reaping stale uploads.
+func NewWorker(store storage.Storage, interval, dayLength, uploadMaxAge time.Duration) *Worker {
+	if dayLength <= 0 {
+		dayLength = 24 * time.Hour
+	}
+	if uploadMaxAge < 0 {
+		uploadMaxAge = 0
+	}
+	return &Worker{
+		store:        store,
+		interval:     interval,
+		dayLength:    dayLength,
+		pageSize:     listPageSize,
+		uploadMaxAge: uploadMaxAge,
+		now:          time.Now,
+	}
+}
+
+// Run sweeps on every tick until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats, err := w.Sweep()
+			if err != nil {
+				log.Printf("Lifecycle sweep failed: %v", err)
+			}
+			if stats != (Stats{}) {
+				log.Printf("Lifecycle sweep: expired %d objects, purged %d delete markers, expired %d noncurrent versions, aborted %d uploads",
+					stats.Expired, stats.DeleteMarkersPurged, stats.NoncurrentExpired, stats.UploadsAborted)
+			}
+		}
+	}
+}
+
+// Sweep applies the lifecycle rules of every bucket once. Errors in one
+// bucket do not stop the others; they are joined into the returned error.
+func (w *Worker) Sweep() (Stats, error) {
+	var stats Stats
+
+	buckets, err := w.store.ListBuckets()
+	if err != nil {
+		return stats, err
+	}
+
+	var errs []error
+	for _, bucket := range buckets {
+		if err := w.sweepBucket(bucket.Name, &stats); err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucket.Name, err))
+		}
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// sweepBucket applies one bucket's enabled rules and reaps its stale uploads
+func (w *Worker) sweepBucket(bucket string, stats *Stats) error {
+	info, err := w.store.HeadBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	var rules []storage.LifecycleRule
+	for _, rule := range info.LifecycleRules {
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 && w.uploadMaxAge == 0 {
+		return nil
+	}
+
+	now := w.now()
+
+	if expiresVersions(rules, info.Versioning) {
+		err := w.walkVersions(bucket, func(versions []storage.ObjectVersion) error {
+			return w.sweepKey(bucket, versions, rules, now, stats)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	uploads, err := w.listUploads(bucket)
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if w.uploadExpired(upload, rules, now) {
+			if err := w.store.AbortMultipartUpload(bucket, upload.Key, upload.UploadID); err != nil {
+				return err
+			}
+			stats.UploadsAborted++
+		}
+	}
+
+	return nil
+}
+
+// expiresVersions reports whether any rule could expire a version in a
+// bucket with the given versioning status. Noncurrent versions and delete
+// markers only exist once versioning has been enabled.
+func expiresVersions(rules []storage.LifecycleRule, versioning string) bool {
+	for _, rule := range rules {
+		if rule.ExpirationDays > 0 || rule.ExpirationDate != nil {
+			return true
+		}
+		if versioning != "" && (rule.NoncurrentVersionExpirationDays > 0 || rule.ExpiredObjectDeleteMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadExpired reports whether an incomplete upload is past the maximum
+// upload age or a matching rule's AbortIncompleteMultipartUpload action
+func (w *Worker) uploadExpired(upload storage.MultipartUpload, rules []storage.LifecycleRule, now time.Time) bool {
+	if w.uploadMaxAge > 0 && !now.Before(upload.Created.Add(w.uploadMaxAge)) {
+		return true
+	}
+	for _, rule := range rules {
+		if rule.AbortIncompleteMultipartUploadDays == 0 || !rule.Matches(upload.Key, nil) {
+			continue
+		}
+		if !now.Before(upload.Created.Add(w.days(rule.AbortIncompleteMultipartUploadDays))) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepKey applies the rules to every version of one key. versions are
+// ordered newest first, as ListObjectVersions returns them.
+func (w *Worker) sweepKey(bucket string, versions []storage.ObjectVersion, rules []storage.LifecycleRule, now time.Time, stats *Stats) error {
+	key := versions[0].Key
+	noncurrent := versions
+	if versions[0].IsLatest {
+		noncurrent = versions[1:]
+	}
+
+	if latest := versions[0]; latest.IsLatest {
+		switch {
+		case latest.DeleteMarker && len(noncurrent) == 0:
+			// A delete marker with no versions behind it is expired
+			for _, rule := range rules {
+				if rule.ExpiredObjectDeleteMarker && rule.Matches(key, nil) {
+					if _, err := w.store.DeleteObject(bucket, key, latest.VersionID, storage.DeleteOptions{}); err != nil {
+						return err
+					}
+					stats.DeleteMarkersPurged++
+					break
+				}
+			}
+		case !latest.DeleteMarker:
+			for _, rule := range rules {
+				if rule.Matches(key, latest.Tags) && w.currentExpired(rule, latest.LastModified, now) {
+					// Object Lock outranks lifecycle: a locked object is
+					// left for a later sweep
+					if _, err := w.store.DeleteObject(bucket, key, "", storage.DeleteOptions{}); errors.Is(err, storage.ErrObjectLocked) {
+						break
+					} else if err != nil {
+						return err
+					}
+					stats.Expired++
+					break
+				}
+			}
+		}
+	}
+
+	// A version becomes noncurrent when the next newer version is written,
+	// so that version's timestamp starts the noncurrent clock
+	offset := len(versions) - len(noncurrent)
+	for i, version := range noncurrent {
+		noncurrentSince := version.LastModified
+		if newer := offset + i - 1; newer >= 0 {
+			noncurrentSince = versions[newer].LastModified
+		}
+		for _, rule := range rules {
+			if rule.NoncurrentVersionExpirationDays == 0 || !rule.Matches(key, version.Tags) {
+				continue
+			}
+			if i < rule.NewerNoncurrentVersions {
+				continue
+			}
+			if !now.Before(noncurrentSince.Add(w.days(rule.NoncurrentVersionExpirationDays))) {
+				if _, err := w.store.DeleteObject(bucket, key, version.VersionID, storage.DeleteOptions{}); errors.Is(err, storage.ErrObjectLocked) {
+					break
+				} else if err != nil {
+					return err
+				}
+				stats.NoncurrentExpired++
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// currentExpired reports whether a rule's Expiration action applies to a
+// current version last modified at lastModified
+func (w *Worker) currentExpired(rule storage.LifecycleRule, lastModified, now time.Time) bool {
+	if rule.ExpirationDate != nil && !now.Before(*rule.ExpirationDate) {
+		return true
+	}
+	return rule.ExpirationDays > 0 && !now.Before(lastModified.Add(w.days(rule.ExpirationDays)))
+}
+
+// days converts a rule's day count into a duration
+func (w *Worker) days(n int) time.Duration {
+	return time.Duration(n) * w.dayLength
+}
+
+// walkVersions lists a bucket's versions a page at a time and calls fn with
+// the versions of each key in turn. The versions of the last key on a page
+// may continue on the next, so they are held until that page is fetched;
+// fn may then delete versions without disturbing the listing markers.
+func (w *Worker) walkVersions(bucket string, fn func(versions []storage.ObjectVersion) error) error {
+	var pending []storage.ObjectVersion
+	keyMarker, versionIDMarker := "", ""
+	for {
+		page, err := w.store.ListObjectVersions(bucket, "", "", keyMarker, versionIDMarker, w.pageSize)
+		if err != nil {
+			return err
+		}
+		for _, version := range page.Versions {
+			if len(pending) > 0 && version.Key != pending[0].Key {
+				if err := fn(pending); err != nil {
+					return err
+				}
+				pending = nil
+			}
+			pending = append(pending, version)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		keyMarker, versionIDMarker = page.NextKeyMarker, page.NextVersionIDMarker
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	return fn(pending)
+}
+
+// listUploads returns every incomplete multipart upload in a bucket
+func (w *Worker) listUploads(bucket string) ([]storage.MultipartUpload, error) {
+	var all []storage.MultipartUpload
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		page, err := w.store.ListMultipartUploads(bucket, "", "", keyMarker, uploadIDMarker, w.pageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Uploads...)
+		if !page.IsTruncated {
+			return all, nil
+		}
+		keyMarker, uploadIDMarker = page.NextKeyMarker, page.NextUploadIDMarker
+	}
+}
@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package lifecycle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func newTestStorage(t *testing.T) *storage.FileSystemStorage {
+	tempDir, err := os.MkdirTemp("", "ess-three-lifecycle-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	store, err := storage.NewFileSystemStorage(tempDir, storage.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return store
+}
+
+func setRules(t *testing.T, store storage.Storage, bucket string, rules ...storage.LifecycleRule) {
+	if _, err := store.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.LifecycleRules = rules
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+}
+
+func put(t *testing.T, store storage.Storage, bucket, key string, tags map[string]string) {
+	if _, err := store.PutObject(bucket, key, bytes.NewReader([]byte(key)), nil, "text/plain", storage.PutOptions{Tags: tags}); err != nil {
+		t.Fatalf("PutObject %s failed: %v", key, err)
+	}
+}
+
+func TestSweepExpiration(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "expiring-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	put(t, store, bucket, "logs/old.txt", nil)
+	put(t, store, bucket, "logs/tagged.txt", map[string]string{"keep": "true"})
+	put(t, store, bucket, "data/other.txt", nil)
+	setRules(t, store, bucket,
+		storage.LifecycleRule{ID: "logs", Enabled: true, Prefix: "logs/", ExpirationDays: 1},
+		storage.LifecycleRule{ID: "disabled", Enabled: false, ExpirationDays: 1},
+	)
+
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+
+	t.Run("BeforeExpiry", func(t *testing.T) {
+		stats, err := worker.Sweep()
+		if err != nil {
+			t.Fatalf("Sweep failed: %v", err)
+		}
+		if stats.Expired != 0 {
+			t.Errorf("Expected nothing expired yet, got %d", stats.Expired)
+		}
+	})
+
+	t.Run("AfterExpiry", func(t *testing.T) {
+		worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		stats, err := worker.Sweep()
+		if err != nil {
+			t.Fatalf("Sweep failed: %v", err)
+		}
+		if stats.Expired != 2 {
+			t.Errorf("Expected 2 expired objects, got %d", stats.Expired)
+		}
+		if _, err := store.HeadObject(bucket, "logs/old.txt", ""); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("Expected logs/old.txt to be expired, got %v", err)
+		}
+		if _, err := store.HeadObject(bucket, "data/other.txt", ""); err != nil {
+			t.Errorf("Expected data/other.txt to be kept, got %v", err)
+		}
+	})
+}
+
+func TestSweepTagFilter(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "tagged-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	put(t, store, bucket, "a.txt", map[string]string{"class": "temp"})
+	put(t, store, bucket, "b.txt", map[string]string{"class": "archive"})
+	setRules(t, store, bucket, storage.LifecycleRule{
+		ID: "temp", Enabled: true, Tags: map[string]string{"class": "temp"}, ExpirationDays: 1,
+	})
+
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+	worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := worker.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+
+	if _, err := store.HeadObject(bucket, "a.txt", ""); err == nil {
+		t.Error("Expected a.txt to be expired")
+	}
+	if _, err := store.HeadObject(bucket, "b.txt", ""); err != nil {
+		t.Errorf("Expected b.txt to be kept, got %v", err)
+	}
+}
+
+func TestSweepNoncurrentVersionsAndUploads(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "versioned-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Versioning = storage.VersioningEnabled
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		put(t, store, bucket, "doc.txt", nil)
+	}
+	if _, err := store.CreateMultipartUpload(bucket, "big.bin", "application/octet-stream", nil, storage.PutOptions{}); err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	setRules(t, store, bucket, storage.LifecycleRule{
+		ID:                                 "cleanup",
+		Enabled:                            true,
+		NoncurrentVersionExpirationDays:    1,
+		NewerNoncurrentVersions:            1,
+		AbortIncompleteMultipartUploadDays: 1,
+	})
+
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+	worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	stats, err := worker.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+
+	if stats.NoncurrentExpired != 1 {
+		t.Errorf("Expected 1 noncurrent version expired, got %d", stats.NoncurrentExpired)
+	}
+	if stats.UploadsAborted != 1 {
+		t.Errorf("Expected 1 upload aborted, got %d", stats.UploadsAborted)
+	}
+
+	versions, err := store.ListObjectVersions(bucket, "", "", "", "", 100)
+	if err != nil {
+		t.Fatalf("ListObjectVersions failed: %v", err)
+	}
+	if len(versions.Versions) != 2 {
+		t.Errorf("Expected current version plus 1 retained noncurrent version, got %d", len(versions.Versions))
+	}
+}
+
+func TestSweepStaleUploads(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "ruleless-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	stale, err := store.CreateMultipartUpload(bucket, "stale.bin", "application/octet-stream", nil, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	worker := NewWorker(store, time.Minute, time.Hour, 3*time.Hour)
+	worker.now = func() time.Time { return stale.Created.Add(2 * time.Hour) }
+	if stats, err := worker.Sweep(); err != nil || stats.UploadsAborted != 0 {
+		t.Fatalf("Expected no uploads aborted before the maximum age, got %d (%v)", stats.UploadsAborted, err)
+	}
+
+	worker.now = func() time.Time { return stale.Created.Add(3 * time.Hour) }
+	stats, err := worker.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if stats.UploadsAborted != 1 {
+		t.Errorf("Expected 1 upload aborted, got %d", stats.UploadsAborted)
+	}
+
+	uploads, err := store.ListMultipartUploads(bucket, "", "", "", "", 1000)
+	if err != nil {
+		t.Fatalf("ListMultipartUploads failed: %v", err)
+	}
+	if len(uploads.Uploads) != 0 {
+		t.Errorf("Expected no uploads left, got %d", len(uploads.Uploads))
+	}
+}
+
+func TestSweepSkipsLockedObjects(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "locked-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	put(t, store, bucket, "free.txt", nil)
+	if _, err := store.PutObject(bucket, "held.txt", bytes.NewReader([]byte("held")), nil, "text/plain", storage.PutOptions{LegalHold: true}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	setRules(t, store, bucket, storage.LifecycleRule{ID: "all", Enabled: true, ExpirationDays: 1})
+
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+	worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	stats, err := worker.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if stats.Expired != 1 {
+		t.Errorf("Expected 1 expired object, got %d", stats.Expired)
+	}
+	if _, err := store.HeadObject(bucket, "held.txt", ""); err != nil {
+		t.Errorf("Expected held.txt to be kept, got %v", err)
+	}
+}
+
+func TestSweepPagedVersions(t *testing.T) {
+	store := newTestStorage(t)
+	bucket := "paged-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Versioning = storage.VersioningEnabled
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		for i := 0; i < 3; i++ {
+			put(t, store, bucket, key, nil)
+		}
+	}
+	put(t, store, bucket, "c.txt", nil)
+	setRules(t, store, bucket, storage.LifecycleRule{
+		ID:                              "noncurrent",
+		Enabled:                         true,
+		NoncurrentVersionExpirationDays: 1,
+		NewerNoncurrentVersions:         1,
+	})
+
+	// Pages of two split the versions of a.txt and b.txt across pages
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+	worker.pageSize = 2
+	worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	stats, err := worker.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if stats.NoncurrentExpired != 2 {
+		t.Errorf("Expected the oldest version of a.txt and b.txt expired, got %d", stats.NoncurrentExpired)
+	}
+
+	versions, err := store.ListObjectVersions(bucket, "", "", "", "", 100)
+	if err != nil {
+		t.Fatalf("ListObjectVersions failed: %v", err)
+	}
+	if len(versions.Versions) != 5 {
+		t.Errorf("Expected 5 versions left, got %d", len(versions.Versions))
+	}
+}
+
+// versionLister counts the version listings a sweep makes
+type versionLister struct {
+	storage.Storage
+	calls int
+}
+
+func (l *versionLister) ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) (*storage.VersionListResult, error) {
+	l.calls++
+	return l.Storage.ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker, maxKeys)
+}
+
+func TestSweepSkipsUnmatchableBuckets(t *testing.T) {
+	store := &versionLister{Storage: newTestStorage(t)}
+	bucket := "unversioned-bucket"
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	put(t, store, bucket, "doc.txt", nil)
+
+	// Without versioning there are no noncurrent versions or delete markers
+	setRules(t, store, bucket, storage.LifecycleRule{
+		ID:                              "versions",
+		Enabled:                         true,
+		ExpiredObjectDeleteMarker:       true,
+		NoncurrentVersionExpirationDays: 1,
+	})
+
+	worker := NewWorker(store, time.Minute, time.Hour, 0)
+	worker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := worker.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if store.calls != 0 {
+		t.Errorf("Expected no version listing, got %d", store.calls)
+	}
+
+	setRules(t, store, bucket, storage.LifecycleRule{ID: "expire", Enabled: true, ExpirationDays: 1})
+	stats, err := worker.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if store.calls == 0 || stats.Expired != 1 {
+		t.Errorf("Expected doc.txt to be listed and expired, got %d listings and %d expired", store.calls, stats.Expired)
+	}
+}
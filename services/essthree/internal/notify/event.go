@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// eventTimeFormat is the millisecond-precision timestamp S3 uses in events
+const eventTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Event is the message body S3 sends for object events
+type Event struct {
+	Records []Record `json:"Records"`
+}
+
+// Record describes one object event
+type Record struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AWSRegion         string            `json:"awsRegion"`
+	EventTime         string            `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      Identity          `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                S3Entity          `json:"s3"`
+}
+
+// Identity names the principal behind a request
+type Identity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+// S3Entity identifies the bucket and object an event is about
+type S3Entity struct {
+	SchemaVersion   string       `json:"s3SchemaVersion"`
+	ConfigurationID string       `json:"configurationId"`
+	Bucket          BucketEntity `json:"bucket"`
+	Object          ObjectEntity `json:"object"`
+}
+
+type BucketEntity struct {
+	Name          string   `json:"name"`
+	OwnerIdentity Identity `json:"ownerIdentity"`
+	ARN           string   `json:"arn"`
+}
+
+// ObjectEntity describes the object. Size and ETag are omitted for removals.
+type ObjectEntity struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer"`
+}
+
+// TestEvent is sent to each destination when a configuration is set
+type TestEvent struct {
+	Service   string `json:"Service"`
+	Event     string `json:"Event"`
+	Time      string `json:"Time"`
+	Bucket    string `json:"Bucket"`
+	RequestID string `json:"RequestId"`
+	HostID    string `json:"HostId"`
+}
+
+// ObjectInfo holds the details of the object an event refers to
+type ObjectInfo struct {
+	Key       string
+	Size      int64
+	ETag      string
+	VersionID string
+}
+
+// RequestInfo holds the details of the request that caused an event
+type RequestInfo struct {
+	Region      string
+	PrincipalID string
+	SourceIP    string
+	RequestID   string
+	Time        time.Time
+}
+
+// NewRecord builds the record for an event such as ObjectCreated:Put
+func NewRecord(eventName, configurationID, bucket string, object ObjectInfo, req RequestInfo) Record {
+	return Record{
+		EventVersion: "2.1",
+		EventSource:  "aws:s3",
+		AWSRegion:    req.Region,
+		EventTime:    req.Time.UTC().Format(eventTimeFormat),
+		EventName:    eventName,
+		UserIdentity: Identity{PrincipalID: req.PrincipalID},
+		RequestParameters: map[string]string{
+			"sourceIPAddress": req.SourceIP,
+		},
+		ResponseElements: map[string]string{
+			"x-amz-request-id": req.RequestID,
+			"x-amz-id-2":       req.RequestID,
+		},
+		S3: S3Entity{
+			SchemaVersion:   "1.0",
+			ConfigurationID: configurationID,
+			Bucket: BucketEntity{
+				Name:          bucket,
+				OwnerIdentity: Identity{PrincipalID: req.PrincipalID},
+				ARN:           "arn:aws:s3:::" + bucket,
+			},
+			Object: ObjectEntity{
+				Key:       EncodeKey(object.Key),
+				Size:      object.Size,
+				ETag:      strings.Trim(object.ETag, `"`),
+				VersionID: object.VersionID,
+				Sequencer: sequencer(req.Time),
+			},
+		},
+	}
+}
+
+// NewTestEvent builds the s3:TestEvent message for a bucket
+func NewTestEvent(bucket string, req RequestInfo) TestEvent {
+	return TestEvent{
+		Service:   "Amazon S3",
+		Event:     "s3:TestEvent",
+		Time:      req.Time.UTC().Format(eventTimeFormat),
+		Bucket:    bucket,
+		RequestID: req.RequestID,
+		HostID:    req.RequestID,
+	}
+}
+
+// EncodeKey URL-encodes an object key the way S3 does in event records:
+// spaces become '+' and slashes are kept
+func EncodeKey(key string) string {
+	return strings.ReplaceAll(url.QueryEscape(key), "%2F", "/")
+}
+
+// sequencer orders events for the same key. S3 only promises that later
+// events compare greater as hex strings of equal length.
+func sequencer(t time.Time) string {
+	return fmt.Sprintf("%016X", t.UnixNano())
+}
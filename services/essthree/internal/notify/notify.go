@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package notify delivers S3 event notifications to the SQS and SNS
+// emulators of the local stack.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// deliveryTimeout bounds a single delivery attempt
+const deliveryTimeout = 10 * time.Second
+
+// Dispatcher posts event messages to queue and topic destinations
+type Dispatcher struct {
+	client      *http.Client
+	sqsEndpoint string
+	snsEndpoint string
+}
+
+// NewDispatcher creates a dispatcher for the SQS and SNS endpoints, e.g.
+// http://ess-queue-ess:9320 and http://ess-enn-ess:9330
+func NewDispatcher(sqsEndpoint, snsEndpoint string) *Dispatcher {
+	return &Dispatcher{
+		client:      &http.Client{Timeout: deliveryTimeout},
+		sqsEndpoint: strings.TrimSuffix(sqsEndpoint, "/"),
+		snsEndpoint: strings.TrimSuffix(snsEndpoint, "/"),
+	}
+}
+
+// Publish delivers a message in the background, logging failures. Event
+// notifications are best effort, as they are in S3.
+func (d *Dispatcher) Publish(target storage.NotificationTarget, message any) {
+	go func() {
+		if err := d.Deliver(context.Background(), target, message); err != nil {
+			log.Printf("Event notification to %s failed: %v", target.ARN, err)
+		}
+	}()
+}
+
+// Deliver sends a message, encoded as JSON, to a destination and waits for
+// it to be accepted
+func (d *Dispatcher) Deliver(ctx context.Context, target storage.NotificationTarget, message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	form := url.Values{}
+	var endpoint string
+	switch target.Type {
+	case storage.NotificationQueue:
+		name, err := ResourceName(target.ARN)
+		if err != nil {
+			return err
+		}
+		endpoint = d.sqsEndpoint
+		form.Set("Action", "SendMessage")
+		form.Set("QueueUrl", d.sqsEndpoint+"/"+name)
+		form.Set("MessageBody", string(body))
+	case storage.NotificationTopic:
+		endpoint = d.snsEndpoint
+		form.Set("Action", "Publish")
+		form.Set("TopicArn", target.ARN)
+		form.Set("Subject", "Amazon S3 Notification")
+		form.Set("Message", string(body))
+	default:
+		return fmt.Errorf("unknown destination type %q", target.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "ess-three")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("endpoint returned status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// ResourceName returns the queue or topic name at the end of an ARN such as
+// arn:aws:sqs:us-east-1:000000000000:uploads
+func ResourceName(arn string) (string, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[5] == "" {
+		return "", fmt.Errorf("invalid ARN %q", arn)
+	}
+	return parts[5], nil
+}
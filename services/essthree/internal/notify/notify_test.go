@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestDeliverToQueue(t *testing.T) {
+	var form map[string]string
+	sqs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = map[string]string{
+			"Action":      r.FormValue("Action"),
+			"QueueUrl":    r.FormValue("QueueUrl"),
+			"MessageBody": r.FormValue("MessageBody"),
+		}
+	}))
+	defer sqs.Close()
+
+	d := NewDispatcher(sqs.URL, "")
+	target := storage.NotificationTarget{
+		ID:   "uploads",
+		Type: storage.NotificationQueue,
+		ARN:  "arn:aws:sqs:us-east-1:000000000000:uploads",
+	}
+	req := RequestInfo{Region: "us-east-1", PrincipalID: "AKID", RequestID: "req-1", Time: time.Unix(0, 0)}
+	record := NewRecord("ObjectCreated:Put", target.ID, "photos", ObjectInfo{
+		Key:  "2024/cat picture.jpg",
+		Size: 42,
+		ETag: `"abc"`,
+	}, req)
+
+	if err := d.Deliver(context.Background(), target, Event{Records: []Record{record}}); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	if form["Action"] != "SendMessage" {
+		t.Errorf("Expected SendMessage, got %q", form["Action"])
+	}
+	if want := sqs.URL + "/uploads"; form["QueueUrl"] != want {
+		t.Errorf("Expected queue URL %s, got %s", want, form["QueueUrl"])
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(form["MessageBody"]), &event); err != nil {
+		t.Fatalf("Message body is not an event: %v", err)
+	}
+	if len(event.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(event.Records))
+	}
+	got := event.Records[0]
+	if got.EventName != "ObjectCreated:Put" || got.EventTime != "1970-01-01T00:00:00.000Z" {
+		t.Errorf("Unexpected event name or time: %s %s", got.EventName, got.EventTime)
+	}
+	if got.S3.Object.Key != "2024/cat+picture.jpg" {
+		t.Errorf("Expected encoded key 2024/cat+picture.jpg, got %s", got.S3.Object.Key)
+	}
+	if got.S3.Object.ETag != "abc" {
+		t.Errorf("Expected unquoted ETag abc, got %s", got.S3.Object.ETag)
+	}
+	if got.S3.Bucket.ARN != "arn:aws:s3:::photos" {
+		t.Errorf("Expected bucket ARN arn:aws:s3:::photos, got %s", got.S3.Bucket.ARN)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	sns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "NotFound: Topic not found", http.StatusNotFound)
+	}))
+	defer sns.Close()
+
+	d := NewDispatcher("", sns.URL)
+	target := storage.NotificationTarget{
+		Type: storage.NotificationTopic,
+		ARN:  "arn:aws:sns:us-east-1:000000000000:missing",
+	}
+	if err := d.Deliver(context.Background(), target, TestEvent{}); err == nil {
+		t.Error("Expected an error for a rejected message, got nil")
+	}
+}
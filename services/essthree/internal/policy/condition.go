@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operatorFunc compares a request value against one policy value
+type operatorFunc func(value, policyValue string) bool
+
+// operators maps condition operators to their comparison. Negated operators
+// are listed by their positive form in negatedOperators.
+var operators = map[string]operatorFunc{
+	"StringEquals":             func(v, p string) bool { return v == p },
+	"StringEqualsIgnoreCase":   strings.EqualFold,
+	"StringLike":               like,
+	"ArnEquals":                func(v, p string) bool { return v == p },
+	"ArnLike":                  like,
+	"NumericEquals":            numeric(func(v, p float64) bool { return v == p }),
+	"NumericLessThan":          numeric(func(v, p float64) bool { return v < p }),
+	"NumericLessThanEquals":    numeric(func(v, p float64) bool { return v <= p }),
+	"NumericGreaterThan":       numeric(func(v, p float64) bool { return v > p }),
+	"NumericGreaterThanEquals": numeric(func(v, p float64) bool { return v >= p }),
+	"DateEquals":               date(func(v, p time.Time) bool { return v.Equal(p) }),
+	"DateLessThan":             date(func(v, p time.Time) bool { return v.Before(p) }),
+	"DateLessThanEquals":       date(func(v, p time.Time) bool { return !v.After(p) }),
+	"DateGreaterThan":          date(func(v, p time.Time) bool { return v.After(p) }),
+	"DateGreaterThanEquals":    date(func(v, p time.Time) bool { return !v.Before(p) }),
+	"Bool":                     strings.EqualFold,
+	"IpAddress":                ipAddress,
+}
+
+// negatedOperators maps each negated operator to its positive form
+var negatedOperators = map[string]string{
+	"StringNotEquals":           "StringEquals",
+	"StringNotEqualsIgnoreCase": "StringEqualsIgnoreCase",
+	"StringNotLike":             "StringLike",
+	"ArnNotEquals":              "ArnEquals",
+	"ArnNotLike":                "ArnLike",
+	"NumericNotEquals":          "NumericEquals",
+	"DateNotEquals":             "DateEquals",
+	"NotIpAddress":              "IpAddress",
+}
+
+// parseOperator resolves a condition operator such as StringNotLikeIfExists
+// into its comparison, whether it is negated and whether it tolerates a
+// missing key
+func parseOperator(op string) (fn operatorFunc, negated, ifExists bool, err error) {
+	name, ifExists := strings.CutSuffix(op, "IfExists")
+	if name == "Null" {
+		return nil, false, false, nil
+	}
+	if positive, ok := negatedOperators[name]; ok {
+		name, negated = positive, true
+	}
+	fn, ok := operators[name]
+	if !ok {
+		return nil, false, false, fmt.Errorf("Invalid Condition type : %s", op)
+	}
+	return fn, negated, ifExists, nil
+}
+
+// evaluateCondition checks one key of a condition block. The condition
+// holds when any policy value matches, or, for negated operators, when none
+// does.
+func evaluateCondition(op, key string, values []string, conditions map[string]string) bool {
+	value, present := conditions[strings.ToLower(key)]
+
+	if strings.TrimSuffix(op, "IfExists") == "Null" {
+		for _, v := range values {
+			if strings.EqualFold(v, "true") == present {
+				return false
+			}
+		}
+		return true
+	}
+
+	fn, negated, ifExists, err := parseOperator(op)
+	if err != nil {
+		return false
+	}
+	if !present {
+		// A missing key never matches, so negated operators hold
+		return ifExists || negated
+	}
+
+	matched := false
+	for _, v := range values {
+		if fn(value, v) {
+			matched = true
+			break
+		}
+	}
+	return matched != negated
+}
+
+// like matches a value against a policy pattern with '*' and '?' wildcards
+func like(value, pattern string) bool {
+	return wildcardMatch(pattern, value)
+}
+
+// numeric builds an operator comparing values as numbers
+func numeric(cmp func(v, p float64) bool) operatorFunc {
+	return func(value, policyValue string) bool {
+		v, err1 := strconv.ParseFloat(value, 64)
+		p, err2 := strconv.ParseFloat(policyValue, 64)
+		return err1 == nil && err2 == nil && cmp(v, p)
+	}
+}
+
+// date builds an operator comparing values as ISO 8601 timestamps or epoch
+// seconds
+func date(cmp func(v, p time.Time) bool) operatorFunc {
+	return func(value, policyValue string) bool {
+		v, ok1 := parseTime(value)
+		p, ok2 := parseTime(policyValue)
+		return ok1 && ok2 && cmp(v, p)
+	}
+}
+
+// parseTime parses a condition date value
+func parseTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
+// ipAddress reports whether an address lies in a CIDR block or equals a
+// single address
+func ipAddress(value, policyValue string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	if _, block, err := net.ParseCIDR(policyValue); err == nil {
+		return block.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(policyValue))
+}
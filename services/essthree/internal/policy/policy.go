@@ -0,0 +1,344 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package policy parses and evaluates S3 bucket policies.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxSize is the S3 limit on the size of a bucket policy document
+const MaxSize = 20 * 1024
+
+// Decision is the outcome of evaluating a policy for a request
+type Decision int
+
+const (
+	// NotApplicable means no statement matched; the default applies
+	NotApplicable Decision = iota
+	Allow
+	Deny
+)
+
+// Policy is a parsed bucket policy document
+type Policy struct {
+	Version    string      `json:"Version"`
+	ID         string      `json:"Id,omitempty"`
+	Statements []Statement `json:"Statement"`
+}
+
+// Statement is one Allow or Deny statement. Exactly one of each pair such as
+// Action and NotAction is set.
+type Statement struct {
+	Sid          string                          `json:"Sid,omitempty"`
+	Effect       string                          `json:"Effect"`
+	Principal    *Principal                      `json:"Principal,omitempty"`
+	NotPrincipal *Principal                      `json:"NotPrincipal,omitempty"`
+	Action       stringSet                       `json:"Action,omitempty"`
+	NotAction    stringSet                       `json:"NotAction,omitempty"`
+	Resource     stringSet                       `json:"Resource,omitempty"`
+	NotResource  stringSet                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]stringSet `json:"Condition,omitempty"`
+}
+
+// Principal is the Principal element: "*" or a map such as {"AWS": [...]}.
+// Only AWS principals can match requests.
+type Principal struct {
+	Wildcard bool
+	AWS      stringSet
+}
+
+// UnmarshalJSON accepts "*" or an object of principal types
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "*" {
+			return fmt.Errorf("invalid principal %q", s)
+		}
+		p.Wildcard = true
+		return nil
+	}
+
+	var types map[string]stringSet
+	if err := json.Unmarshal(data, &types); err != nil {
+		return errors.New("invalid principal")
+	}
+	p.AWS = types["AWS"]
+	return nil
+}
+
+// stringSet is a policy value given as a single string or an array. Numbers
+// and booleans are accepted as condition values.
+type stringSet []string
+
+// UnmarshalJSON accepts a scalar or an array of scalars
+func (s *stringSet) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	values, isArray := value.([]any)
+	if !isArray {
+		values = []any{value}
+	}
+
+	result := make(stringSet, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			result = append(result, v)
+		case bool:
+			result = append(result, strconv.FormatBool(v))
+		case float64:
+			result = append(result, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("unsupported value %v", v)
+		}
+	}
+	*s = result
+	return nil
+}
+
+// Request is the context a policy is evaluated against
+type Request struct {
+	// Principal is the caller's ARN and Account its account ID. Both are
+	// empty for anonymous requests.
+	Principal string
+	Account   string
+
+	// Action is an S3 action such as s3:GetObject and Resource the ARN of
+	// the bucket or object
+	Action   string
+	Resource string
+
+	// Conditions holds the values of condition keys such as aws:SourceIp,
+	// keyed in lower case. Absent keys are not present in the request.
+	Conditions map[string]string
+}
+
+// Parse decodes a policy document for bucket and validates it against the
+// rules S3 applies to bucket policies. Errors are suitable for a
+// MalformedPolicy response.
+func Parse(document []byte, bucket string) (*Policy, error) {
+	if len(document) > MaxSize {
+		return nil, errors.New("Policies must be less than 20 KB")
+	}
+
+	var p Policy
+	if err := json.Unmarshal(document, &p); err != nil {
+		return nil, errors.New("Policies must be valid JSON and the first byte must be '{'")
+	}
+
+	if p.Version != "" && p.Version != "2012-10-17" && p.Version != "2008-10-17" {
+		return nil, errors.New("Policy has an invalid version")
+	}
+	if len(p.Statements) == 0 {
+		return nil, errors.New("Could not parse the policy: Statement is empty!")
+	}
+
+	bucketARN := "arn:aws:s3:::" + bucket
+	for _, stmt := range p.Statements {
+		if stmt.Effect != "Allow" && stmt.Effect != "Deny" {
+			return nil, fmt.Errorf("Invalid effect: %s", stmt.Effect)
+		}
+		if (stmt.Principal == nil) == (stmt.NotPrincipal == nil) {
+			return nil, errors.New("Missing required field Principal")
+		}
+		if (len(stmt.Action) == 0) == (len(stmt.NotAction) == 0) {
+			return nil, errors.New("Missing required field Action")
+		}
+		if (len(stmt.Resource) == 0) == (len(stmt.NotResource) == 0) {
+			return nil, errors.New("Missing required field Resource")
+		}
+
+		for _, action := range append(stmt.Action, stmt.NotAction...) {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+				return nil, errors.New("Policy has invalid action")
+			}
+		}
+		for _, resource := range append(stmt.Resource, stmt.NotResource...) {
+			if resource != bucketARN && !strings.HasPrefix(resource, bucketARN+"/") {
+				return nil, errors.New("Policy has invalid resource")
+			}
+		}
+		for op := range stmt.Condition {
+			if _, _, _, err := parseOperator(op); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &p, nil
+}
+
+// Evaluate applies the policy to a request. An explicit Deny wins over any
+// Allow.
+func (p *Policy) Evaluate(req Request) Decision {
+	decision := NotApplicable
+	for _, stmt := range p.Statements {
+		if !stmt.matches(req) {
+			continue
+		}
+		if stmt.Effect == "Deny" {
+			return Deny
+		}
+		decision = Allow
+	}
+	return decision
+}
+
+// IsPublic reports whether the policy allows access to anyone, following the
+// S3 rule that a wildcard principal is only non-public when a condition pins
+// the caller to fixed sources or accounts
+func (p *Policy) IsPublic() bool {
+	for _, stmt := range p.Statements {
+		if stmt.Effect != "Allow" || stmt.Principal == nil || !stmt.Principal.matchesEveryone() {
+			continue
+		}
+		if !stmt.restrictsCaller() {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictingKeys are condition keys that make a wildcard principal non-public
+var restrictingKeys = map[string]bool{
+	"aws:sourceip":         true,
+	"aws:sourcevpc":        true,
+	"aws:sourcevpce":       true,
+	"aws:sourcearn":        true,
+	"aws:sourceaccount":    true,
+	"aws:sourceowner":      true,
+	"aws:principalaccount": true,
+	"aws:principalarn":     true,
+	"aws:principalorgid":   true,
+	"aws:userid":           true,
+}
+
+// restrictsCaller reports whether a statement has a positive condition on a
+// key that identifies where the caller comes from
+func (stmt *Statement) restrictsCaller() bool {
+	for op, conditions := range stmt.Condition {
+		_, negated, _, _ := parseOperator(op)
+		if negated {
+			continue
+		}
+		for key := range conditions {
+			if restrictingKeys[strings.ToLower(key)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether every element of the statement applies to req
+func (stmt *Statement) matches(req Request) bool {
+	switch {
+	case stmt.Principal != nil && !stmt.Principal.matches(req):
+		return false
+	case stmt.NotPrincipal != nil && stmt.NotPrincipal.matches(req):
+		return false
+	}
+
+	switch {
+	case len(stmt.Action) > 0 && !matchAny(stmt.Action, req.Action, true):
+		return false
+	case len(stmt.NotAction) > 0 && matchAny(stmt.NotAction, req.Action, true):
+		return false
+	}
+
+	switch {
+	case len(stmt.Resource) > 0 && !matchAny(stmt.Resource, req.Resource, false):
+		return false
+	case len(stmt.NotResource) > 0 && matchAny(stmt.NotResource, req.Resource, false):
+		return false
+	}
+
+	for op, conditions := range stmt.Condition {
+		for key, values := range conditions {
+			if !evaluateCondition(op, key, values, req.Conditions) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesEveryone reports whether the principal includes anonymous callers
+func (p *Principal) matchesEveryone() bool {
+	if p.Wildcard {
+		return true
+	}
+	for _, aws := range p.AWS {
+		if aws == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the principal names the caller. An account ID or
+// account root ARN names every identity in that account.
+func (p *Principal) matches(req Request) bool {
+	if p.matchesEveryone() {
+		return true
+	}
+	if req.Principal == "" {
+		return false
+	}
+	for _, aws := range p.AWS {
+		if aws == req.Principal || aws == req.Account || aws == "arn:aws:iam::"+req.Account+":root" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether value matches any of the wildcard patterns
+func matchAny(patterns []string, value string, ignoreCase bool) bool {
+	if ignoreCase {
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches value against a pattern where '*' matches any run of
+// characters and '?' any single character
+func wildcardMatch(pattern, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			mark++
+			p, v = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import "testing"
+
+const testPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "PublicRead",
+      "Effect": "Allow",
+      "Principal": "*",
+      "Action": "s3:GetObject",
+      "Resource": "arn:aws:s3:::photos/public/*"
+    },
+    {
+      "Sid": "AliceWrites",
+      "Effect": "Allow",
+      "Principal": {"AWS": ["arn:aws:iam::000000000000:user/alice"]},
+      "Action": ["s3:Put*", "s3:ListBucket"],
+      "Resource": ["arn:aws:s3:::photos", "arn:aws:s3:::photos/*"]
+    },
+    {
+      "Sid": "TLSOnly",
+      "Effect": "Deny",
+      "Principal": "*",
+      "Action": "s3:*",
+      "Resource": "arn:aws:s3:::photos/*",
+      "Condition": {"Bool": {"aws:SecureTransport": false}}
+    },
+    {
+      "Sid": "OfficeOnly",
+      "Effect": "Deny",
+      "Principal": {"AWS": "000000000000"},
+      "Action": "s3:DeleteObject",
+      "Resource": "arn:aws:s3:::photos/*",
+      "Condition": {"NotIpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+    }
+  ]
+}`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy), "photos")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	alice := "arn:aws:iam::000000000000:user/alice"
+	secure := map[string]string{"aws:securetransport": "true", "aws:sourceip": "10.1.2.3"}
+
+	tests := []struct {
+		name      string
+		principal string
+		action    string
+		resource  string
+		cond      map[string]string
+		want      Decision
+	}{
+		{"anonymous public read", "", "s3:GetObject", "arn:aws:s3:::photos/public/cat.jpg", secure, Allow},
+		{"anonymous private read", "", "s3:GetObject", "arn:aws:s3:::photos/private/cat.jpg", secure, NotApplicable},
+		{"action wildcard", alice, "s3:PutObject", "arn:aws:s3:::photos/a.jpg", secure, Allow},
+		{"actions ignore case", alice, "S3:listbucket", "arn:aws:s3:::photos", secure, Allow},
+		{"other user", "arn:aws:iam::000000000000:user/bob", "s3:PutObject", "arn:aws:s3:::photos/a.jpg", secure, NotApplicable},
+		{"deny without TLS", "", "s3:GetObject", "arn:aws:s3:::photos/public/cat.jpg", map[string]string{"aws:securetransport": "false"}, Deny},
+		{"account principal outside network", alice, "s3:DeleteObject", "arn:aws:s3:::photos/a.jpg", map[string]string{"aws:securetransport": "true", "aws:sourceip": "192.168.1.1"}, Deny},
+		{"account principal inside network", alice, "s3:DeleteObject", "arn:aws:s3:::photos/a.jpg", secure, NotApplicable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := Request{
+				Principal:  tc.principal,
+				Action:     tc.action,
+				Resource:   tc.resource,
+				Conditions: tc.cond,
+			}
+			if tc.principal != "" {
+				req.Account = "000000000000"
+			}
+			if got := p.Evaluate(req); got != tc.want {
+				t.Errorf("Expected decision %d, got %d", tc.want, got)
+			}
+		})
+	}
+
+	if !p.IsPublic() {
+		t.Error("Expected a policy with a wildcard Allow to be public")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid JSON":        `{"Statement": [`,
+		"missing principal":   `{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::photos/*"}]}`,
+		"foreign resource":    `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::other/*"}]}`,
+		"non-S3 action":       `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "sqs:SendMessage", "Resource": "arn:aws:s3:::photos/*"}]}`,
+		"unknown operator":    `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::photos/*", "Condition": {"StringSounds": {"aws:UserAgent": "x"}}}]}`,
+		"invalid effect":      `{"Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::photos/*"}]}`,
+		"empty statement":     `{"Version": "2012-10-17", "Statement": []}`,
+		"unsupported version": `{"Version": "2020-01-01", "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::photos/*"}]}`,
+	}
+
+	for name, document := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(document), "photos"); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestIsPublicWithSourceRestriction(t *testing.T) {
+	p, err := Parse([]byte(`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+		"Resource": "arn:aws:s3:::photos/*", "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}]}`), "photos")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if p.IsPublic() {
+		t.Error("Expected a wildcard Allow pinned to a source network not to be public")
+	}
+}
@@ -0,0 +1,807 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Values are nil for NULL and MISSING, bool, int64, float64, string, *object
+// or []any.
+
+// object is a JSON object that keeps the order of its keys
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+// get returns the value of key. Unquoted names fall back to a case
+// insensitive match.
+func (o *object) get(key string, quoted bool) (any, bool) {
+	if v, ok := o.values[key]; ok {
+		return v, true
+	}
+	if !quoted {
+		for _, k := range o.keys {
+			if strings.EqualFold(k, key) {
+				return o.values[k], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// record is one row of input: the fields of a CSV line or a JSON value
+type record struct {
+	fields  []string
+	columns *csvColumns
+	value   any
+}
+
+// csvColumns are the names the header line of a CSV object gives its fields
+type csvColumns struct {
+	names []string
+	index map[string]int
+}
+
+// field returns the CSV field named by a column reference
+func (r *record) field(name string, quoted bool) (any, bool) {
+	if !quoted && strings.HasPrefix(name, "_") {
+		if n, err := strconv.Atoi(name[1:]); err == nil && n > 0 {
+			if n > len(r.fields) {
+				return nil, false
+			}
+			return r.fields[n-1], true
+		}
+	}
+	if r.columns == nil {
+		return nil, false
+	}
+	i, ok := r.columns.index[name]
+	if !ok && !quoted {
+		for j, column := range r.columns.names {
+			if strings.EqualFold(column, name) {
+				i, ok = j, true
+				break
+			}
+		}
+	}
+	if !ok || i >= len(r.fields) {
+		return nil, false
+	}
+	return r.fields[i], true
+}
+
+// whole returns the record as a single value; CSV records become objects
+// keyed by their column names
+func (r *record) whole() any {
+	if r.fields == nil {
+		return r.value
+	}
+	obj := &object{values: make(map[string]any, len(r.fields))}
+	for i, field := range r.fields {
+		name := "_" + strconv.Itoa(i+1)
+		if r.columns != nil && i < len(r.columns.names) {
+			name = r.columns.names[i]
+		}
+		if _, dup := obj.values[name]; !dup {
+			obj.keys = append(obj.keys, name)
+		}
+		obj.values[name] = field
+	}
+	return obj
+}
+
+// expr is a node of a parsed expression
+type expr interface {
+	eval(r *record) (any, error)
+}
+
+type literal struct {
+	value any
+}
+
+func (l *literal) eval(*record) (any, error) {
+	return l.value, nil
+}
+
+// pathElement is one name of a column reference; quoted names are matched
+// case sensitively
+type pathElement struct {
+	name   string
+	quoted bool
+}
+
+// column references a field of the record. bind removes the S3Object alias
+// from its path, leaving an empty path for the whole record.
+type column struct {
+	path []pathElement
+}
+
+func (c *column) eval(r *record) (any, error) {
+	if len(c.path) == 0 {
+		return r.whole(), nil
+	}
+
+	var value any
+	if r.fields != nil {
+		if len(c.path) > 1 {
+			return nil, nil
+		}
+		value, _ = r.field(c.path[0].name, c.path[0].quoted)
+		return value, nil
+	}
+
+	value = r.value
+	for _, elem := range c.path {
+		obj, ok := value.(*object)
+		if !ok {
+			return nil, nil
+		}
+		if value, ok = obj.get(elem.name, elem.quoted); !ok {
+			return nil, nil
+		}
+	}
+	return value, nil
+}
+
+// name is the key a projection of the column gets in JSON output
+func (c *column) name() string {
+	if len(c.path) == 0 {
+		return ""
+	}
+	return c.path[len(c.path)-1].name
+}
+
+type logical struct {
+	op          string
+	left, right expr
+}
+
+func (l *logical) eval(r *record) (any, error) {
+	left, err := evalBool(l.left, r)
+	if err != nil {
+		return nil, err
+	}
+	if l.op == "AND" && left == false || l.op == "OR" && left == true {
+		return left, nil
+	}
+	right, err := evalBool(l.right, r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case left == nil && right == nil:
+		return nil, nil
+	case left == nil:
+		if l.op == "AND" && right == false || l.op == "OR" && right == true {
+			return right, nil
+		}
+		return nil, nil
+	default:
+		return right, nil
+	}
+}
+
+type not struct {
+	x expr
+}
+
+func (n *not) eval(r *record) (any, error) {
+	v, err := evalBool(n.x, r)
+	if v == nil || err != nil {
+		return nil, err
+	}
+	return !v.(bool), nil
+}
+
+// evalBool evaluates e as a condition, which is true, false or nil when
+// unknown
+func evalBool(e expr, r *record) (any, error) {
+	v, err := e.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil, bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b, nil
+		}
+	}
+	return nil, newError("InvalidDataType", fmt.Sprintf("Expected a boolean, got %s", formatValue(v)))
+}
+
+type comparison struct {
+	op          string
+	left, right expr
+}
+
+func (c *comparison) eval(r *record) (any, error) {
+	left, err := c.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.eval(r)
+	if err != nil || left == nil || right == nil {
+		return nil, err
+	}
+	cmp := compareValues(left, right)
+	switch c.op {
+	case "=":
+		return cmp == 0, nil
+	case "!=", "<>":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// compareValues orders two non-null values. A number compared with a string
+// converts the string, so CSV fields compare numerically with numbers;
+// anything else compares as text.
+func compareValues(a, b any) int {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return compareNumbers(x, y)
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := toBool(b); ok {
+			return compareBools(x, y)
+		}
+	}
+	if y, ok := b.(bool); ok {
+		if x, ok := toBool(a); ok {
+			return compareBools(x, y)
+		}
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+func compareNumbers(a, b any) int {
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+type isNull struct {
+	x      expr
+	negate bool
+}
+
+func (n *isNull) eval(r *record) (any, error) {
+	v, err := n.x.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != n.negate, nil
+}
+
+type like struct {
+	x, pattern, escape expr
+	negate             bool
+
+	// compiled caches the regular expression of the last pattern
+	source   string
+	compiled *regexp.Regexp
+}
+
+func (l *like) eval(r *record) (any, error) {
+	v, err := l.x.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := l.pattern.eval(r)
+	if err != nil || v == nil || pattern == nil {
+		return nil, err
+	}
+	escape := ""
+	if l.escape != nil {
+		e, err := l.escape.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if escape = formatValue(e); len([]rune(escape)) != 1 {
+			return nil, newError("LikeInvalidInputs", "The LIKE escape must be a single character.")
+		}
+	}
+
+	source := escape + "\x00" + formatValue(pattern)
+	if l.compiled == nil || l.source != source {
+		l.compiled = compileLike(formatValue(pattern), escape)
+		l.source = source
+	}
+	return l.compiled.MatchString(formatValue(v)) != l.negate, nil
+}
+
+// compileLike translates a LIKE pattern, where % matches any run of
+// characters and _ exactly one, to an anchored regular expression
+func compileLike(pattern, escape string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("(?s)^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case escape != "" && string(c) == escape:
+			escaped = true
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+type between struct {
+	x, low, high expr
+	negate       bool
+}
+
+func (b *between) eval(r *record) (any, error) {
+	values := make([]any, 3)
+	for i, e := range []expr{b.x, b.low, b.high} {
+		v, err := e.eval(r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	in := compareValues(values[0], values[1]) >= 0 && compareValues(values[0], values[2]) <= 0
+	return in != b.negate, nil
+}
+
+type inList struct {
+	x      expr
+	list   []expr
+	negate bool
+}
+
+func (in *inList) eval(r *record) (any, error) {
+	v, err := in.x.eval(r)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	for _, e := range in.list {
+		candidate, err := e.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if candidate != nil && compareValues(v, candidate) == 0 {
+			return !in.negate, nil
+		}
+	}
+	return in.negate, nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right expr
+}
+
+func (a *arithmetic) eval(r *record) (any, error) {
+	left, err := a.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	right, err := a.right.eval(r)
+	if err != nil || left == nil || right == nil {
+		return nil, err
+	}
+	if a.op == "||" {
+		return formatValue(left) + formatValue(right), nil
+	}
+
+	x, ok := toNumber(left)
+	if !ok {
+		return nil, castFailed(left, "a number")
+	}
+	y, ok := toNumber(right)
+	if !ok {
+		return nil, castFailed(right, "a number")
+	}
+
+	if i, ok := x.(int64); ok {
+		if j, ok := y.(int64); ok {
+			switch a.op {
+			case "+":
+				return i + j, nil
+			case "-":
+				return i - j, nil
+			case "*":
+				return i * j, nil
+			}
+			if j == 0 {
+				return nil, newError("EvaluatorInvalidArguments", "Division by zero.")
+			}
+			if a.op == "/" {
+				return i / j, nil
+			}
+			return i % j, nil
+		}
+	}
+
+	f, g := toFloat(x), toFloat(y)
+	switch a.op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	}
+	if g == 0 {
+		return nil, newError("EvaluatorInvalidArguments", "Division by zero.")
+	}
+	if a.op == "/" {
+		return f / g, nil
+	}
+	return math.Mod(f, g), nil
+}
+
+type cast struct {
+	x   expr
+	typ string
+}
+
+func (c *cast) eval(r *record) (any, error) {
+	v, err := c.x.eval(r)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	switch c.typ {
+	case "INT":
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, castFailed(v, "INT")
+		}
+		if f, isFloat := n.(float64); isFloat {
+			return int64(f), nil
+		}
+		return n, nil
+	case "FLOAT":
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, castFailed(v, "FLOAT")
+		}
+		return toFloat(n), nil
+	case "BOOL":
+		b, ok := toBool(v)
+		if !ok {
+			return nil, castFailed(v, "BOOL")
+		}
+		return b, nil
+	default:
+		return formatValue(v), nil
+	}
+}
+
+// scalarFunctions maps the supported scalar functions to their minimum and
+// maximum number of arguments; -1 means any number
+var scalarFunctions = map[string][2]int{
+	"LOWER":            {1, 1},
+	"UPPER":            {1, 1},
+	"TRIM":             {1, 1},
+	"CHAR_LENGTH":      {1, 1},
+	"CHARACTER_LENGTH": {1, 1},
+	"SUBSTRING":        {2, 3},
+	"COALESCE":         {1, -1},
+	"NULLIF":           {2, 2},
+}
+
+type call struct {
+	fn   string
+	args []expr
+}
+
+func (c *call) eval(r *record) (any, error) {
+	args := make([]any, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(r)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch c.fn {
+	case "COALESCE":
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "NULLIF":
+		if args[0] != nil && args[1] != nil && compareValues(args[0], args[1]) == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	}
+
+	if args[0] == nil {
+		return nil, nil
+	}
+	s := formatValue(args[0])
+	switch c.fn {
+	case "LOWER":
+		return strings.ToLower(s), nil
+	case "UPPER":
+		return strings.ToUpper(s), nil
+	case "TRIM":
+		return strings.TrimSpace(s), nil
+	case "CHAR_LENGTH", "CHARACTER_LENGTH":
+		return int64(len([]rune(s))), nil
+	}
+
+	// SUBSTRING(s, start[, length]) counts characters from 1
+	runes := []rune(s)
+	bounds := make([]int64, len(args)-1)
+	for i, v := range args[1:] {
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, castFailed(v, "INT")
+		}
+		bounds[i] = int64(toFloat(n))
+	}
+	start, end := bounds[0]-1, int64(len(runes))
+	if len(bounds) > 1 {
+		end = min(end, start+bounds[1])
+	}
+	start = max(start, 0)
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start:end]), nil
+}
+
+// aggregateFunctions are the supported aggregate functions
+var aggregateFunctions = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// aggregate accumulates an aggregate function over the matching records.
+// Evaluating it returns the result over the records seen so far.
+type aggregate struct {
+	fn       string
+	arg      expr
+	countAll bool
+
+	count    int64
+	sumInt   int64
+	sumFloat float64
+	isFloat  bool
+	extreme  any
+}
+
+// add accumulates the record r
+func (a *aggregate) add(r *record) error {
+	if a.countAll {
+		a.count++
+		return nil
+	}
+	v, err := a.arg.eval(r)
+	if err != nil || v == nil {
+		return err
+	}
+
+	switch a.fn {
+	case "COUNT":
+	case "MIN", "MAX":
+		if n, ok := toNumber(v); ok {
+			v = n
+		}
+		if a.extreme == nil {
+			a.extreme = v
+		} else if cmp := compareValues(v, a.extreme); a.fn == "MIN" && cmp < 0 || a.fn == "MAX" && cmp > 0 {
+			a.extreme = v
+		}
+	default:
+		n, ok := toNumber(v)
+		if !ok {
+			return castFailed(v, "a number")
+		}
+		if i, isInt := n.(int64); isInt && !a.isFloat {
+			a.sumInt += i
+		} else {
+			if !a.isFloat {
+				a.sumFloat, a.isFloat = float64(a.sumInt), true
+			}
+			a.sumFloat += toFloat(n)
+		}
+	}
+	a.count++
+	return nil
+}
+
+func (a *aggregate) eval(*record) (any, error) {
+	switch a.fn {
+	case "COUNT":
+		return a.count, nil
+	case "MIN", "MAX":
+		return a.extreme, nil
+	}
+	if a.count == 0 {
+		return nil, nil
+	}
+	if a.fn == "SUM" {
+		if a.isFloat {
+			return a.sumFloat, nil
+		}
+		return a.sumInt, nil
+	}
+	if a.isFloat {
+		return a.sumFloat / float64(a.count), nil
+	}
+	return float64(a.sumInt) / float64(a.count), nil
+}
+
+// walk calls fn for e and every expression below it, stopping at nodes for
+// which fn returns false
+func walk(e expr, fn func(expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	var children []expr
+	switch e := e.(type) {
+	case *logical:
+		children = []expr{e.left, e.right}
+	case *not:
+		children = []expr{e.x}
+	case *comparison:
+		children = []expr{e.left, e.right}
+	case *isNull:
+		children = []expr{e.x}
+	case *like:
+		children = []expr{e.x, e.pattern, e.escape}
+	case *between:
+		children = []expr{e.x, e.low, e.high}
+	case *inList:
+		children = append([]expr{e.x}, e.list...)
+	case *arithmetic:
+		children = []expr{e.left, e.right}
+	case *cast:
+		children = []expr{e.x}
+	case *call:
+		children = e.args
+	case *aggregate:
+		children = []expr{e.arg}
+	}
+	for _, child := range children {
+		walk(child, fn)
+	}
+}
+
+// refersToRecord reports whether e reads the record outside of an aggregate
+func refersToRecord(e expr) bool {
+	found := false
+	walk(e, func(e expr) bool {
+		switch e.(type) {
+		case *aggregate:
+			return false
+		case *column:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// bind strips the S3Object alias, or S3Object itself, from the start of
+// column references
+func bind(e expr, alias string) {
+	walk(e, func(e expr) bool {
+		c, ok := e.(*column)
+		if !ok {
+			return true
+		}
+		first := c.path[0]
+		switch {
+		case alias != "" && (first.name == alias || !first.quoted && strings.EqualFold(first.name, alias)):
+		case len(c.path) > 1 && !first.quoted && strings.EqualFold(first.name, "S3Object"):
+		default:
+			return true
+		}
+		c.path = c.path[1:]
+		return true
+	})
+}
+
+// toNumber converts v to an int64 or float64. Strings are parsed.
+func toNumber(v any) (any, bool) {
+	switch v := v.(type) {
+	case int64, float64:
+		return v, true
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toFloat(n any) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+func toBool(v any) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+func castFailed(v any, typ string) error {
+	return newError("CastFailed", fmt.Sprintf("Cannot convert %q to %s.", formatValue(v), typ))
+}
+
+// formatValue renders v as text, as it appears in CSV output
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return string(appendJSON(nil, v))
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// headerTypeString is the event stream type code of string header values
+const headerTypeString = 7
+
+// header is a name and string value of an event stream message
+type header struct {
+	name  string
+	value string
+}
+
+// writeMessage frames headers and payload as one event stream message: a
+// prelude of the total and header lengths with its CRC32, the headers, the
+// payload and a CRC32 of everything before it
+func writeMessage(w io.Writer, headers []header, payload []byte) error {
+	var encoded []byte
+	for _, h := range headers {
+		encoded = append(encoded, byte(len(h.name)))
+		encoded = append(encoded, h.name...)
+		encoded = append(encoded, headerTypeString)
+		encoded = binary.BigEndian.AppendUint16(encoded, uint16(len(h.value)))
+		encoded = append(encoded, h.value...)
+	}
+
+	total := 12 + len(encoded) + len(payload) + 4
+	message := make([]byte, 0, total)
+	message = binary.BigEndian.AppendUint32(message, uint32(total))
+	message = binary.BigEndian.AppendUint32(message, uint32(len(encoded)))
+	message = binary.BigEndian.AppendUint32(message, crc32.ChecksumIEEE(message))
+	message = append(message, encoded...)
+	message = append(message, payload...)
+	message = binary.BigEndian.AppendUint32(message, crc32.ChecksumIEEE(message))
+
+	_, err := w.Write(message)
+	return err
+}
+
+// writeEvent writes an event message such as Records or Stats. End events
+// have neither a content type nor a payload.
+func writeEvent(w io.Writer, eventType, contentType string, payload []byte) error {
+	headers := []header{{":event-type", eventType}}
+	if contentType != "" {
+		headers = append(headers, header{":content-type", contentType})
+	}
+	headers = append(headers, header{":message-type", "event"})
+	return writeMessage(w, headers, payload)
+}
+
+// writeError writes an error message, which ends the stream
+func writeError(w io.Writer, code, message string) error {
+	return writeMessage(w, []header{
+		{":error-code", code},
+		{":error-message", message},
+		{":message-type", "error"},
+	}, nil)
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// recordReader yields the records of an object, returning io.EOF after the
+// last one
+type recordReader interface {
+	read() (*record, error)
+}
+
+// newCSVReader reads CSV records. The first line is skipped for
+// FileHeaderInfo IGNORE and names the columns for USE.
+func newCSVReader(r io.Reader, input *CSVInput) (recordReader, error) {
+	// encoding/csv only splits lines on \n and \r\n, so other record
+	// delimiters are translated first
+	if delimiter := input.recordDelimiter(); delimiter != "\n" && delimiter != "\r\n" {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(bytes.ReplaceAll(data, []byte(delimiter), []byte("\n")))
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.Comma = firstRune(input.FieldDelimiter, ',')
+	if input.Comments != "" {
+		reader.Comment = firstRune(input.Comments, '#')
+	}
+	return &csvReader{reader: reader, header: input.FileHeaderInfo}, nil
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	header  string
+	columns *csvColumns
+	started bool
+}
+
+func (c *csvReader) read() (*record, error) {
+	fields, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, newError("CSVParsingError", fmt.Sprintf("Failed to parse CSV on line %d: %v", parseErr.Line, parseErr.Err))
+		}
+		return nil, err
+	}
+
+	if !c.started {
+		c.started = true
+		switch c.header {
+		case "USE":
+			c.columns = &csvColumns{names: fields, index: make(map[string]int, len(fields))}
+			for i, name := range fields {
+				if _, dup := c.columns.index[name]; !dup {
+					c.columns.index[name] = i
+				}
+			}
+			return c.read()
+		case "IGNORE":
+			return c.read()
+		}
+	}
+	return &record{fields: fields, columns: c.columns}, nil
+}
+
+// newJSONReader reads a stream of JSON values. Both DOCUMENT and LINES
+// objects are a sequence of values, so they are read the same way. When
+// path is set, records are read from that path of every value, and with
+// iterate the elements of arrays found there are records of their own.
+func newJSONReader(r io.Reader, path []string, iterate bool) recordReader {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return &jsonReader{decoder: decoder, path: path, iterate: iterate}
+}
+
+type jsonReader struct {
+	decoder *json.Decoder
+	path    []string
+	iterate bool
+	pending []any
+}
+
+func (j *jsonReader) read() (*record, error) {
+	for len(j.pending) == 0 {
+		value, err := decodeValue(j.decoder)
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, newError("JSONParsingError", fmt.Sprintf("Failed to parse JSON: %v", err))
+		}
+
+		found := true
+		for _, name := range j.path {
+			obj, ok := value.(*object)
+			if !ok {
+				found = false
+				break
+			}
+			if value, ok = obj.get(name, false); !ok {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		if elements, ok := value.([]any); ok && j.iterate {
+			j.pending = append(j.pending, elements...)
+		} else {
+			j.pending = append(j.pending, value)
+		}
+	}
+
+	value := j.pending[0]
+	j.pending = j.pending[1:]
+	return &record{value: value}, nil
+}
+
+// decodeValue decodes the next JSON value, keeping the key order of objects
+func decodeValue(decoder *json.Decoder) (any, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '[' {
+			elements := []any{}
+			for decoder.More() {
+				v, err := decodeValue(decoder)
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				elements = append(elements, v)
+			}
+			_, err := decoder.Token()
+			return elements, unexpectedEOF(err)
+		}
+
+		obj := &object{values: make(map[string]any)}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			v, err := decodeValue(decoder)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			name := key.(string)
+			if _, dup := obj.values[name]; !dup {
+				obj.keys = append(obj.keys, name)
+			}
+			obj.values[name] = v
+		}
+		_, err := decoder.Token()
+		return obj, unexpectedEOF(err)
+
+	case json.Number:
+		if i, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+
+	default:
+		return t, nil
+	}
+}
+
+// unexpectedEOF reports the end of input inside a value as an error rather
+// than the end of the stream
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// firstRune returns the single character of s, or fallback when s is empty
+func firstRune(s string, fallback rune) rune {
+	if s == "" {
+		return fallback
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
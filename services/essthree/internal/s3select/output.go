@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// recordWriter serializes result records. names holds the JSON key of each
+// value.
+type recordWriter interface {
+	write(buf *bytes.Buffer, names []string, values []any)
+}
+
+// csvWriter writes records as delimited text
+type csvWriter struct {
+	fieldDelimiter  string
+	recordDelimiter string
+	quote           string
+	escape          string
+	always          bool
+}
+
+func newCSVWriter(output *CSVOutput) *csvWriter {
+	w := &csvWriter{
+		fieldDelimiter:  ",",
+		recordDelimiter: "\n",
+		quote:           `"`,
+		always:          output.QuoteFields == "ALWAYS",
+	}
+	if output.FieldDelimiter != "" {
+		w.fieldDelimiter = output.FieldDelimiter
+	}
+	if output.RecordDelimiter != "" {
+		w.recordDelimiter = output.RecordDelimiter
+	}
+	if output.QuoteCharacter != "" {
+		w.quote = output.QuoteCharacter
+	}
+	w.escape = w.quote
+	if output.QuoteEscapeCharacter != "" {
+		w.escape = output.QuoteEscapeCharacter
+	}
+	return w
+}
+
+func (w *csvWriter) write(buf *bytes.Buffer, _ []string, values []any) {
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteString(w.fieldDelimiter)
+		}
+		field := formatValue(v)
+		if !w.always && !w.needsQuotes(field) {
+			buf.WriteString(field)
+			continue
+		}
+		buf.WriteString(w.quote)
+		buf.WriteString(strings.ReplaceAll(field, w.quote, w.escape+w.quote))
+		buf.WriteString(w.quote)
+	}
+	buf.WriteString(w.recordDelimiter)
+}
+
+// needsQuotes reports whether field contains a delimiter, quote or line
+// break
+func (w *csvWriter) needsQuotes(field string) bool {
+	return strings.Contains(field, w.fieldDelimiter) ||
+		strings.Contains(field, w.recordDelimiter) ||
+		strings.Contains(field, w.quote) ||
+		strings.ContainsAny(field, "\r\n")
+}
+
+// jsonWriter writes every record as a JSON object
+type jsonWriter struct {
+	recordDelimiter string
+}
+
+func newJSONWriter(output *JSONOutput) *jsonWriter {
+	w := &jsonWriter{recordDelimiter: "\n"}
+	if output.RecordDelimiter != "" {
+		w.recordDelimiter = output.RecordDelimiter
+	}
+	return w
+}
+
+func (w *jsonWriter) write(buf *bytes.Buffer, names []string, values []any) {
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(appendJSON(nil, names[i]))
+		buf.WriteByte(':')
+		buf.Write(appendJSON(nil, v))
+	}
+	buf.WriteByte('}')
+	buf.WriteString(w.recordDelimiter)
+}
+
+// appendJSON appends the JSON encoding of v to buf
+func appendJSON(buf []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return append(buf, "null"...)
+		}
+		return strconv.AppendFloat(buf, v, 'f', -1, 64)
+	case string:
+		encoded, _ := json.Marshal(v)
+		return append(buf, encoded...)
+	case []any:
+		buf = append(buf, '[')
+		for i, element := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSON(buf, element)
+		}
+		return append(buf, ']')
+	case *object:
+		buf = append(buf, '{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSON(buf, key)
+			buf = append(buf, ':')
+			buf = appendJSON(buf, v.values[key])
+		}
+		return append(buf, '}')
+	default:
+		return append(buf, "null"...)
+	}
+}
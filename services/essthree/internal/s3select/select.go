@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package s3select evaluates S3 Select SQL expressions over CSV and JSON
+// objects and frames the results as an event stream.
+package s3select
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// recordsChunkSize is the amount of output buffered before it is sent as a
+// Records event
+const recordsChunkSize = 64 * 1024
+
+// Error is a failed select, with the S3 error code it is reported as
+type Error struct {
+	Code    string
+	Message string
+}
+
+func newError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Request is a SelectObjectContent request
+type Request struct {
+	Expression     string
+	ExpressionType string
+	Input          InputSerialization
+	Output         OutputSerialization
+
+	// Progress requests a Progress event before the Stats event
+	Progress bool
+}
+
+// InputSerialization describes the format of the object. Exactly one of CSV
+// and JSON is set.
+type InputSerialization struct {
+	CompressionType string     `xml:"CompressionType,omitempty"`
+	CSV             *CSVInput  `xml:"CSV"`
+	JSON            *JSONInput `xml:"JSON"`
+	Parquet         *struct{}  `xml:"Parquet"`
+}
+
+// CSVInput describes a CSV object. FileHeaderInfo is NONE, IGNORE to skip
+// the first line, or USE to name the columns after it.
+type CSVInput struct {
+	FileHeaderInfo             string `xml:"FileHeaderInfo,omitempty"`
+	Comments                   string `xml:"Comments,omitempty"`
+	QuoteEscapeCharacter       string `xml:"QuoteEscapeCharacter,omitempty"`
+	RecordDelimiter            string `xml:"RecordDelimiter,omitempty"`
+	FieldDelimiter             string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter             string `xml:"QuoteCharacter,omitempty"`
+	AllowQuotedRecordDelimiter bool   `xml:"AllowQuotedRecordDelimiter,omitempty"`
+}
+
+// recordDelimiter returns the line separator, \n by default
+func (c *CSVInput) recordDelimiter() string {
+	if c.RecordDelimiter == "" {
+		return "\n"
+	}
+	return c.RecordDelimiter
+}
+
+// JSONInput describes a JSON object: a DOCUMENT or LINES of JSON values
+type JSONInput struct {
+	Type string `xml:"Type"`
+}
+
+// OutputSerialization describes the format of the results. Exactly one of
+// CSV and JSON is set.
+type OutputSerialization struct {
+	CSV  *CSVOutput  `xml:"CSV"`
+	JSON *JSONOutput `xml:"JSON"`
+}
+
+// CSVOutput describes CSV results. QuoteFields is ASNEEDED or ALWAYS.
+type CSVOutput struct {
+	QuoteFields          string `xml:"QuoteFields,omitempty"`
+	QuoteEscapeCharacter string `xml:"QuoteEscapeCharacter,omitempty"`
+	RecordDelimiter      string `xml:"RecordDelimiter,omitempty"`
+	FieldDelimiter       string `xml:"FieldDelimiter,omitempty"`
+	QuoteCharacter       string `xml:"QuoteCharacter,omitempty"`
+}
+
+// JSONOutput describes JSON results, one object per record
+type JSONOutput struct {
+	RecordDelimiter string `xml:"RecordDelimiter,omitempty"`
+}
+
+// Stats are the byte counts reported at the end of a select
+type Stats struct {
+	XMLName        xml.Name `xml:"Stats"`
+	BytesScanned   int64    `xml:"BytesScanned"`
+	BytesProcessed int64    `xml:"BytesProcessed"`
+	BytesReturned  int64    `xml:"BytesReturned"`
+}
+
+// Select is a validated request ready to run against an object
+type Select struct {
+	query    *query
+	input    InputSerialization
+	writer   recordWriter
+	progress bool
+}
+
+// Prepare parses the expression of req and validates its serialization.
+// Errors are *Error.
+func Prepare(req Request) (*Select, error) {
+	if req.ExpressionType != "SQL" {
+		return nil, newError("InvalidExpressionType", "The ExpressionType is invalid. Only SQL expressions are supported.")
+	}
+	if req.Expression == "" {
+		return nil, newError("MissingRequiredParameter", "The SelectRequest entity is missing a required parameter: Expression.")
+	}
+	if err := validateInput(&req.Input); err != nil {
+		return nil, err
+	}
+
+	s := &Select{input: req.Input, progress: req.Progress}
+	switch output := req.Output; {
+	case output.CSV != nil && output.JSON != nil:
+		return nil, newError("ObjectSerializationConflict", "OutputSerialization specifies more than one format.")
+	case output.CSV != nil:
+		if err := validateCSVOutput(output.CSV); err != nil {
+			return nil, err
+		}
+		s.writer = newCSVWriter(output.CSV)
+	case output.JSON != nil:
+		s.writer = newJSONWriter(output.JSON)
+	default:
+		return nil, newError("MissingRequiredParameter", "The SelectRequest entity is missing a required parameter: OutputSerialization.")
+	}
+
+	q, err := parse(req.Expression)
+	if err != nil {
+		return nil, err
+	}
+	for _, proj := range q.projections {
+		bind(proj.expr, q.alias)
+	}
+	bind(q.where, q.alias)
+	s.query = q
+	return s, nil
+}
+
+// validateInput checks the compression and format of the object
+func validateInput(input *InputSerialization) error {
+	switch input.CompressionType {
+	case "", "NONE", "GZIP", "BZIP2":
+	default:
+		return invalidParameter("CompressionType", input.CompressionType)
+	}
+
+	switch {
+	case input.CSV != nil && input.JSON != nil:
+		return newError("ObjectSerializationConflict", "InputSerialization specifies more than one format.")
+	case input.CSV != nil:
+		csv := input.CSV
+		switch csv.FileHeaderInfo {
+		case "", "NONE", "IGNORE", "USE":
+		default:
+			return invalidParameter("FileHeaderInfo", csv.FileHeaderInfo)
+		}
+		for name, value := range map[string]string{"FieldDelimiter": csv.FieldDelimiter, "Comments": csv.Comments} {
+			if value != "" && utf8.RuneCountInString(value) != 1 {
+				return invalidParameter(name, value)
+			}
+		}
+		// encoding/csv only understands quotes escaped by doubling them
+		for name, value := range map[string]string{"QuoteCharacter": csv.QuoteCharacter, "QuoteEscapeCharacter": csv.QuoteEscapeCharacter} {
+			if value != "" && value != `"` {
+				return invalidParameter(name, value)
+			}
+		}
+	case input.JSON != nil:
+		if input.JSON.Type != "DOCUMENT" && input.JSON.Type != "LINES" {
+			return invalidParameter("JSON Type", input.JSON.Type)
+		}
+	default:
+		return newError("MissingRequiredParameter", "The SelectRequest entity is missing a required parameter: InputSerialization.")
+	}
+	return nil
+}
+
+func validateCSVOutput(csv *CSVOutput) error {
+	if csv.QuoteFields != "" && csv.QuoteFields != "ASNEEDED" && csv.QuoteFields != "ALWAYS" {
+		return invalidParameter("QuoteFields", csv.QuoteFields)
+	}
+	for name, value := range map[string]string{"QuoteCharacter": csv.QuoteCharacter, "QuoteEscapeCharacter": csv.QuoteEscapeCharacter} {
+		if value != "" && utf8.RuneCountInString(value) != 1 {
+			return invalidParameter(name, value)
+		}
+	}
+	return nil
+}
+
+func invalidParameter(name, value string) error {
+	return newError("InvalidRequestParameter", "The value "+strconv.Quote(value)+" of "+name+" is invalid.")
+}
+
+// Run evaluates the select over object and writes the results to w as an
+// event stream: Records events, an optional Progress event, then Stats and
+// End events. Failures while reading the object end the stream with an
+// error message; only write errors are returned.
+func (s *Select) Run(w io.Writer, object io.Reader) error {
+	scanned := &countingReader{reader: object}
+	var source io.Reader = scanned
+	switch s.input.CompressionType {
+	case "GZIP":
+		gz, err := gzip.NewReader(scanned)
+		if err != nil {
+			return writeError(w, "InvalidCompressionFormat", "The file is not in a supported compression format. Only GZIP and BZIP2 are supported.")
+		}
+		defer gz.Close()
+		source = gz
+	case "BZIP2":
+		source = bzip2.NewReader(scanned)
+	}
+	processed := &countingReader{reader: source}
+
+	var reader recordReader
+	if s.input.CSV != nil {
+		var err error
+		if reader, err = newCSVReader(processed, s.input.CSV); err != nil {
+			return s.fail(w, err)
+		}
+	} else {
+		reader = newJSONReader(processed, s.query.path, s.query.iterate)
+	}
+
+	q := s.query
+	var out bytes.Buffer
+	var returned, emitted int64
+	flush := func() error {
+		if out.Len() == 0 {
+			return nil
+		}
+		returned += int64(out.Len())
+		err := writeEvent(w, "Records", "application/octet-stream", out.Bytes())
+		out.Reset()
+		return err
+	}
+
+	for len(q.aggregates) > 0 || q.limit < 0 || emitted < q.limit {
+		rec, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+			return s.fail(w, err)
+		}
+
+		if q.where != nil {
+			match, err := evalBool(q.where, rec)
+			if err != nil {
+				if flushErr := flush(); flushErr != nil {
+					return flushErr
+				}
+				return s.fail(w, err)
+			}
+			if match != true {
+				continue
+			}
+		}
+
+		if len(q.aggregates) > 0 {
+			for _, a := range q.aggregates {
+				if err := a.add(rec); err != nil {
+					return s.fail(w, err)
+				}
+			}
+			continue
+		}
+
+		if err := s.writeRecord(&out, rec); err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+			return s.fail(w, err)
+		}
+		emitted++
+		if out.Len() >= recordsChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(q.aggregates) > 0 && q.limit != 0 {
+		if err := s.writeRecord(&out, nil); err != nil {
+			return s.fail(w, err)
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	stats := Stats{BytesScanned: scanned.count, BytesProcessed: processed.count, BytesReturned: returned}
+	if s.progress {
+		payload, _ := xml.Marshal(struct {
+			XMLName xml.Name `xml:"Progress"`
+			Stats
+		}{Stats: stats})
+		if err := writeEvent(w, "Progress", "text/xml", payload); err != nil {
+			return err
+		}
+	}
+	payload, _ := xml.Marshal(stats)
+	if err := writeEvent(w, "Stats", "text/xml", payload); err != nil {
+		return err
+	}
+	return writeEvent(w, "End", "", nil)
+}
+
+// writeRecord evaluates the select list for rec and writes the result.
+// Aggregate queries write their single record with a nil rec.
+func (s *Select) writeRecord(out *bytes.Buffer, rec *record) error {
+	q := s.query
+	if q.star {
+		if rec.fields != nil && isCSV(s.writer) {
+			s.writer.write(out, nil, fieldValues(rec.fields))
+			return nil
+		}
+		value := rec.whole()
+		obj, ok := value.(*object)
+		if !ok {
+			s.writer.write(out, []string{"_1"}, []any{value})
+			return nil
+		}
+		values := make([]any, len(obj.keys))
+		for i, key := range obj.keys {
+			values[i] = obj.values[key]
+		}
+		s.writer.write(out, obj.keys, values)
+		return nil
+	}
+
+	names := make([]string, len(q.projections))
+	values := make([]any, len(q.projections))
+	for i, proj := range q.projections {
+		v, err := proj.expr.eval(rec)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+
+		names[i] = proj.alias
+		if c, ok := proj.expr.(*column); ok && names[i] == "" {
+			names[i] = c.name()
+		}
+		if names[i] == "" {
+			names[i] = "_" + strconv.Itoa(i+1)
+		}
+	}
+	s.writer.write(out, names, values)
+	return nil
+}
+
+func isCSV(w recordWriter) bool {
+	_, ok := w.(*csvWriter)
+	return ok
+}
+
+func fieldValues(fields []string) []any {
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		values[i] = field
+	}
+	return values
+}
+
+// fail ends the stream with an error message for err
+func (s *Select) fail(w io.Writer, err error) error {
+	var selectErr *Error
+	if errors.As(err, &selectErr) {
+		return writeError(w, selectErr.Code, selectErr.Message)
+	}
+	return writeError(w, "InternalError", err.Error())
+}
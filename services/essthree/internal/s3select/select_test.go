@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const people = `name,age,city
+Alice,34,Berlin
+Bob,27,"Paris, France"
+Carol,45,Berlin
+Dan,,Oslo
+`
+
+const orders = `{"id": 1, "customer": {"name": "Alice"}, "total": 12.5, "items": ["a", "b"]}
+{"id": 2, "customer": {"name": "Bob"}, "total": 30}
+{"id": 3, "customer": {"name": "alice"}, "total": 7.5, "status": null}
+`
+
+// message is a decoded event stream message
+type message struct {
+	headers map[string]string
+	payload []byte
+}
+
+// decodeMessages splits an event stream into messages, checking the framing
+// and both checksums
+func decodeMessages(t *testing.T, data []byte) []message {
+	t.Helper()
+	var messages []message
+	for len(data) > 0 {
+		if len(data) < 16 {
+			t.Fatalf("Expected a complete prelude, got %d bytes", len(data))
+		}
+		total := int(binary.BigEndian.Uint32(data[0:4]))
+		headersLen := int(binary.BigEndian.Uint32(data[4:8]))
+		if crc32.ChecksumIEEE(data[:8]) != binary.BigEndian.Uint32(data[8:12]) {
+			t.Fatal("Prelude checksum mismatch")
+		}
+		if crc32.ChecksumIEEE(data[:total-4]) != binary.BigEndian.Uint32(data[total-4:total]) {
+			t.Fatal("Message checksum mismatch")
+		}
+
+		m := message{headers: make(map[string]string), payload: data[12+headersLen : total-4]}
+		headers := data[12 : 12+headersLen]
+		for len(headers) > 0 {
+			nameLen := int(headers[0])
+			name := string(headers[1 : 1+nameLen])
+			if headers[1+nameLen] != headerTypeString {
+				t.Fatalf("Expected string header %s, got type %d", name, headers[1+nameLen])
+			}
+			valueLen := int(binary.BigEndian.Uint16(headers[2+nameLen:]))
+			m.headers[name] = string(headers[4+nameLen : 4+nameLen+valueLen])
+			headers = headers[4+nameLen+valueLen:]
+		}
+		messages = append(messages, m)
+		data = data[total:]
+	}
+	return messages
+}
+
+// run prepares and runs req over data, returning the concatenated records
+// and the messages of the stream
+func run(t *testing.T, req Request, data []byte) (string, []message) {
+	t.Helper()
+	s, err := Prepare(req)
+	if err != nil {
+		t.Fatalf("Prepare(%q) failed: %v", req.Expression, err)
+	}
+	var out bytes.Buffer
+	if err := s.Run(&out, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	messages := decodeMessages(t, out.Bytes())
+	var records strings.Builder
+	for _, m := range messages {
+		if m.headers[":event-type"] == "Records" {
+			records.Write(m.payload)
+		}
+	}
+	return records.String(), messages
+}
+
+func csvRequest(expression, header string) Request {
+	return Request{
+		Expression:     expression,
+		ExpressionType: "SQL",
+		Input:          InputSerialization{CSV: &CSVInput{FileHeaderInfo: header}},
+		Output:         OutputSerialization{CSV: &CSVOutput{}},
+	}
+}
+
+func jsonRequest(expression, typ string) Request {
+	return Request{
+		Expression:     expression,
+		ExpressionType: "SQL",
+		Input:          InputSerialization{JSON: &JSONInput{Type: typ}},
+		Output:         OutputSerialization{JSON: &JSONOutput{}},
+	}
+}
+
+func TestSelectCSV(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		header     string
+		want       string
+	}{
+		{"Star", "SELECT * FROM S3Object", "USE", "Alice,34,Berlin\nBob,27,\"Paris, France\"\nCarol,45,Berlin\nDan,,Oslo\n"},
+		{"NoHeader", "SELECT s._1 FROM S3Object s LIMIT 2", "NONE", "name\nAlice\n"},
+		{"IgnoreHeader", "SELECT _1, _3 FROM S3Object LIMIT 1", "IGNORE", "Alice,Berlin\n"},
+		{"Named", "SELECT s.name, s.city FROM S3Object s WHERE s.city = 'Berlin'", "USE", "Alice,Berlin\nCarol,Berlin\n"},
+		{"NumericComparison", "SELECT name FROM S3Object WHERE age > 30", "USE", "Alice\nCarol\n"},
+		{"Cast", "SELECT name FROM S3Object WHERE age <> '' AND CAST(age AS INT) BETWEEN 20 AND 40", "USE", "Alice\nBob\n"},
+		{"AndOr", "SELECT name FROM S3Object WHERE city = 'Oslo' OR age < 30 AND name <> 'Alice'", "USE", "Bob\nDan\n"},
+		{"Like", "SELECT name FROM S3Object WHERE city LIKE 'Par%' OR name LIKE '_a%'", "USE", "Bob\nCarol\nDan\n"},
+		{"NotLike", "SELECT name FROM S3Object WHERE name NOT LIKE '%o%'", "USE", "Alice\nDan\n"},
+		{"In", "SELECT name FROM S3Object WHERE name IN ('Bob', 'Dan')", "USE", "Bob\nDan\n"},
+		{"Empty", "SELECT name FROM S3Object WHERE age = ''", "USE", "Dan\n"},
+		{"Limit", "SELECT name FROM S3Object LIMIT 3", "USE", "Alice\nBob\nCarol\n"},
+		{"Functions", "SELECT UPPER(name), CHAR_LENGTH(city), age * 2 FROM S3Object LIMIT 1", "USE", "ALICE,6,68\n"},
+		{"Count", "SELECT COUNT(*) FROM S3Object WHERE city = 'Berlin'", "USE", "2\n"},
+		{"Aggregates", "SELECT COUNT(age), SUM(CAST(age AS INT)), AVG(age), MIN(age), MAX(age) FROM S3Object WHERE age <> ''", "USE", "3,106,35.333333333333336,27,45\n"},
+		{"EmptyAggregate", "SELECT COUNT(*), SUM(age) FROM S3Object WHERE name = 'Zed'", "USE", "0,\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _ := run(t, csvRequest(tc.expression, tc.header), []byte(people))
+			if got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSelectCSVOptions(t *testing.T) {
+	t.Run("Delimiters", func(t *testing.T) {
+		req := Request{
+			Expression:     "SELECT * FROM S3Object s WHERE s._2 = 'b'",
+			ExpressionType: "SQL",
+			Input:          InputSerialization{CSV: &CSVInput{FieldDelimiter: "|", RecordDelimiter: ";", Comments: "#"}},
+			Output:         OutputSerialization{CSV: &CSVOutput{FieldDelimiter: "\t", QuoteFields: "ALWAYS", RecordDelimiter: "\r\n"}},
+		}
+		got, _ := run(t, req, []byte("#comment;1|b;2|c;3|b"))
+		if want := "\"1\"\t\"b\"\r\n\"3\"\t\"b\"\r\n"; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("JSONOutput", func(t *testing.T) {
+		req := csvRequest("SELECT s.name AS who, age FROM S3Object s LIMIT 1", "USE")
+		req.Output = OutputSerialization{JSON: &JSONOutput{}}
+		got, _ := run(t, req, []byte(people))
+		if want := "{\"who\":\"Alice\",\"age\":\"34\"}\n"; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+
+		req.Expression = "SELECT * FROM S3Object LIMIT 1"
+		got, _ = run(t, req, []byte(people))
+		if want := "{\"name\":\"Alice\",\"age\":\"34\",\"city\":\"Berlin\"}\n"; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write([]byte(people))
+		gz.Close()
+
+		req := csvRequest("SELECT COUNT(*) FROM S3Object", "USE")
+		req.Input.CompressionType = "GZIP"
+		got, messages := run(t, req, compressed.Bytes())
+		if got != "4\n" {
+			t.Errorf("Expected 4 records, got %q", got)
+		}
+
+		stats := messages[len(messages)-2]
+		if stats.headers[":event-type"] != "Stats" {
+			t.Fatalf("Expected a Stats event before End, got %v", stats.headers)
+		}
+		want := "<Stats><BytesScanned>" + strconv.Itoa(compressed.Len()) + "</BytesScanned><BytesProcessed>" + strconv.Itoa(len(people)) + "</BytesProcessed><BytesReturned>2</BytesReturned></Stats>"
+		if string(stats.payload) != want {
+			t.Errorf("Expected %s, got %s", want, stats.payload)
+		}
+	})
+}
+
+func TestSelectJSON(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		want       string
+	}{
+		{"Star", "SELECT * FROM S3Object s WHERE s.id = 2", "{\"id\":2,\"customer\":{\"name\":\"Bob\"},\"total\":30}\n"},
+		{"Nested", "SELECT s.id, s.customer.name FROM S3Object s WHERE s.total >= 12.5", "{\"id\":1,\"name\":\"Alice\"}\n{\"id\":2,\"name\":\"Bob\"}\n"},
+		{"CaseInsensitiveLike", "SELECT s.id FROM S3Object s WHERE LOWER(s.customer.name) LIKE 'ali%'", "{\"id\":1}\n{\"id\":3}\n"},
+		{"Missing", "SELECT s.id FROM S3Object s WHERE s.status IS NULL AND s.items IS NOT MISSING", "{\"id\":1}\n"},
+		{"Whole", "SELECT s.items FROM S3Object s WHERE s.id = 1", "{\"items\":[\"a\",\"b\"]}\n"},
+		{"Sum", "SELECT SUM(s.total) AS total, AVG(s.id) FROM S3Object s", "{\"total\":50,\"_2\":2}\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _ := run(t, jsonRequest(tc.expression, "LINES"), []byte(orders))
+			if got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("Document", func(t *testing.T) {
+		document := `{"rows": [{"n": 1}, {"n": 2}, {"n": 3}]}`
+		req := jsonRequest("SELECT r.n FROM S3Object[*].rows r WHERE r.n > 1", "DOCUMENT")
+		req.Output = OutputSerialization{CSV: &CSVOutput{}}
+		got, _ := run(t, req, []byte(document))
+		if got != "2\n3\n" {
+			t.Errorf("Expected 2 and 3, got %q", got)
+		}
+	})
+}
+
+func TestSelectErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		code       string
+	}{
+		{"Syntax", "SELECT FROM S3Object", "ParseUnexpectedToken"},
+		{"MissingFrom", "SELECT *", "ParseSelectMissingFrom"},
+		{"DataSource", "SELECT * FROM table", "InvalidDataSource"},
+		{"Asterisk", "SELECT *, name FROM S3Object", "ParseAsteriskIsNotAloneInSelectList"},
+		{"Function", "SELECT MEDIAN(age) FROM S3Object", "UnsupportedFunction"},
+		{"MixedAggregate", "SELECT name, COUNT(*) FROM S3Object", "ParseUnsupportedSyntax"},
+		{"AggregateInWhere", "SELECT name FROM S3Object WHERE COUNT(*) > 1", "ParseUnsupportedSyntax"},
+		{"CastType", "SELECT CAST(age AS BLOB) FROM S3Object", "ParseExpectedTypeName"},
+		{"Unterminated", "SELECT * FROM S3Object WHERE name = 'Alice", "ParseUnexpectedToken"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Prepare(csvRequest(tc.expression, "USE"))
+			var selectErr *Error
+			if !errors.As(err, &selectErr) || selectErr.Code != tc.code {
+				t.Errorf("Expected %s, got %v", tc.code, err)
+			}
+		})
+	}
+
+	t.Run("Serialization", func(t *testing.T) {
+		req := csvRequest("SELECT * FROM S3Object", "MAYBE")
+		if _, err := Prepare(req); err == nil || err.(*Error).Code != "InvalidRequestParameter" {
+			t.Errorf("Expected InvalidRequestParameter, got %v", err)
+		}
+		req = csvRequest("SELECT * FROM S3Object", "USE")
+		req.ExpressionType = "XPATH"
+		if _, err := Prepare(req); err == nil || err.(*Error).Code != "InvalidExpressionType" {
+			t.Errorf("Expected InvalidExpressionType, got %v", err)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		got, messages := run(t, csvRequest("SELECT name FROM S3Object WHERE CAST(age AS INT) > 30", "USE"), []byte(people))
+		if got != "Alice\nCarol\n" {
+			t.Errorf("Expected the records before the error, got %q", got)
+		}
+		last := messages[len(messages)-1]
+		if last.headers[":message-type"] != "error" || last.headers[":error-code"] != "CastFailed" {
+			t.Errorf("Expected a CastFailed error message, got %v", last.headers)
+		}
+	})
+}
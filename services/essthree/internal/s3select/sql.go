@@ -0,0 +1,689 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package s3select
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxExpressionSize is the longest SQL expression S3 accepts
+const MaxExpressionSize = 256 * 1024
+
+// tokenKind classifies a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+// token is one lexical token of an expression
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// symbols are the operators and punctuation the lexer recognizes, longest
+// first
+var symbols = []string{"<=", ">=", "<>", "!=", "||", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ".", "[", "]"}
+
+// lex splits an expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'':
+			var text strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i >= len(input) {
+					return nil, newError("ParseUnexpectedToken", fmt.Sprintf("Unterminated string at position %d", start))
+				}
+				if input[i] == '\'' {
+					if i+1 < len(input) && input[i+1] == '\'' {
+						text.WriteByte('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteByte(input[i])
+			}
+			tokens = append(tokens, token{tokenString, text.String(), start})
+
+		case c == '"':
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, newError("ParseUnexpectedToken", fmt.Sprintf("Unterminated identifier at position %d", i))
+			}
+			tokens = append(tokens, token{tokenQuotedIdent, input[i+1 : i+1+end], i})
+			i += end + 2
+
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			start := i
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				i++
+				if i < len(input) && (input[i] == '+' || input[i] == '-') {
+					i++
+				}
+				for i < len(input) && isDigit(input[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, input[start:i], start})
+
+		case isIdentStart(c):
+			start := i
+			for i < len(input) && (isIdentStart(input[i]) || isDigit(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, input[start:i], start})
+
+		default:
+			matched := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(input[i:], symbol) {
+					tokens = append(tokens, token{tokenSymbol, symbol, i})
+					i += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, newError("ParseUnexpectedToken", fmt.Sprintf("Unexpected character %q at position %d", c, i))
+			}
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(input)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// query is a parsed SELECT statement
+type query struct {
+	// star is set for SELECT *; otherwise projections lists the selected
+	// expressions
+	star        bool
+	projections []projection
+
+	// alias is the name the FROM clause gives S3Object. iterate is set by
+	// S3Object[*], and path is the JSON path after it that records are read
+	// from.
+	alias   string
+	iterate bool
+	path    []string
+
+	where expr
+	limit int64
+
+	// aggregates holds every aggregate function of the select list; a
+	// query with any returns a single record
+	aggregates []*aggregate
+}
+
+// projection is one expression of the select list
+type projection struct {
+	expr  expr
+	alias string
+}
+
+// parser is a recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens     []token
+	pos        int
+	aggregates []*aggregate
+}
+
+// parse parses a SELECT statement
+func parse(sql string) (*query, error) {
+	if len(sql) > MaxExpressionSize {
+		return nil, newError("ExpressionTooLong", "The SQL expression is too long.")
+	}
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.parseQuery()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword reports whether t is the unquoted keyword kw
+func (t token) isKeyword(kw string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, kw)
+}
+
+func (t token) isSymbol(s string) bool {
+	return t.kind == tokenSymbol && t.text == s
+}
+
+// acceptKeyword consumes the next token if it is the keyword kw
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.peek().isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// acceptSymbol consumes the next token if it is the symbol s
+func (p *parser) acceptSymbol(s string) bool {
+	if p.peek().isSymbol(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.unexpected(kw)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return p.unexpected(s)
+	}
+	return nil
+}
+
+// unexpected reports the next token where want was expected
+func (p *parser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return newError("ParseUnexpectedToken", fmt.Sprintf("Expected %s at end of expression", want))
+	}
+	return newError("ParseUnexpectedToken", fmt.Sprintf("Expected %s but found %q at position %d", want, t.text, t.pos))
+}
+
+var errAsteriskNotAlone = newError("ParseAsteriskIsNotAloneInSelectList", "Other expressions are not allowed in the select list when '*' is used.")
+
+// reserved are the keywords that cannot be used as bare aliases
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "LIMIT": true, "AS": true,
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "ESCAPE": true,
+	"IS": true, "IN": true, "BETWEEN": true, "NULL": true, "MISSING": true,
+	"TRUE": true, "FALSE": true, "CAST": true,
+}
+
+// parseAlias parses an optional [AS] alias
+func (p *parser) parseAlias() (string, error) {
+	if p.acceptKeyword("AS") {
+		t := p.next()
+		if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+			p.pos--
+			return "", p.unexpected("an alias")
+		}
+		return t.text, nil
+	}
+	t := p.peek()
+	if t.kind == tokenQuotedIdent || (t.kind == tokenIdent && !reserved[strings.ToUpper(t.text)]) {
+		p.pos++
+		return t.text, nil
+	}
+	return "", nil
+}
+
+func (p *parser) parseQuery() (*query, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	q := &query{limit: -1}
+	if p.acceptSymbol("*") {
+		q.star = true
+		if p.peek().isSymbol(",") {
+			return nil, errAsteriskNotAlone
+		}
+	} else {
+		for {
+			if p.peek().isSymbol("*") {
+				return nil, errAsteriskNotAlone
+			}
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			alias, err := p.parseAlias()
+			if err != nil {
+				return nil, err
+			}
+			q.projections = append(q.projections, projection{e, alias})
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		q.aggregates = p.aggregates
+	}
+
+	if !p.peek().isKeyword("FROM") {
+		return nil, newError("ParseSelectMissingFrom", "The SQL expression is missing the FROM clause.")
+	}
+	p.pos++
+	if err := p.parseFrom(q); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("WHERE") {
+		p.aggregates = nil
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if len(p.aggregates) > 0 {
+			return nil, newError("ParseUnsupportedSyntax", "Aggregate functions are not allowed in the WHERE clause.")
+		}
+		q.where = where
+	}
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if t.kind != tokenNumber || err != nil || n < 0 {
+			p.pos--
+			return nil, p.unexpected("a non-negative integer LIMIT")
+		}
+		q.limit = n
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, newError("ParseUnexpectedToken", fmt.Sprintf("Unexpected %q at position %d", t.text, t.pos))
+	}
+
+	return q, q.validate()
+}
+
+// parseFrom parses S3Object, an optional [*] JSON path and an optional alias
+func (p *parser) parseFrom(q *query) error {
+	t := p.next()
+	if !t.isKeyword("S3Object") {
+		return newError("InvalidDataSource", "The data source must be S3Object.")
+	}
+	if p.acceptSymbol("[") {
+		if err := p.expectSymbol("*"); err != nil {
+			return err
+		}
+		if err := p.expectSymbol("]"); err != nil {
+			return err
+		}
+		q.iterate = true
+		for p.acceptSymbol(".") {
+			t := p.next()
+			if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+				p.pos--
+				return p.unexpected("a path element")
+			}
+			q.path = append(q.path, t.text)
+		}
+	}
+
+	alias, err := p.parseAlias()
+	if err != nil {
+		return err
+	}
+	q.alias = alias
+	return nil
+}
+
+// validate rejects select lists that mix aggregates with plain columns
+func (q *query) validate() error {
+	if len(q.aggregates) == 0 {
+		return nil
+	}
+	for _, proj := range q.projections {
+		if refersToRecord(proj.expr) {
+			return newError("ParseUnsupportedSyntax", "The select list cannot mix aggregate functions with columns outside of them.")
+		}
+	}
+	return nil
+}
+
+// parseExpr parses an expression of the lowest precedence
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps are the binary comparison operators
+var comparisonOps = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind == tokenSymbol && comparisonOps[t.text] {
+		p.pos++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{op: t.text, left: left, right: right}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		negate := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") && !p.acceptKeyword("MISSING") {
+			return nil, p.unexpected("NULL")
+		}
+		return &isNull{x: left, negate: negate}, nil
+	}
+
+	negate := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		l := &like{x: left, pattern: pattern, negate: negate}
+		if p.acceptKeyword("ESCAPE") {
+			if l.escape, err = p.parseAdditive(); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &between{x: left, low: low, high: high, negate: negate}, nil
+
+	case p.acceptKeyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &inList{x: left, negate: negate}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, e)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		return in, p.expectSymbol(")")
+
+	case negate:
+		return nil, p.unexpected("LIKE, BETWEEN or IN")
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isSymbol("+") && !t.isSymbol("-") && !t.isSymbol("||") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isSymbol("*") && !t.isSymbol("/") && !t.isSymbol("%") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptSymbol("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmetic{op: "-", left: &literal{int64(0)}, right: x}, nil
+	}
+	p.acceptSymbol("+")
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, newError("ParseUnexpectedToken", fmt.Sprintf("Invalid number %q at position %d", t.text, t.pos))
+		}
+		return &literal{f}, nil
+
+	case tokenString:
+		return &literal{t.text}, nil
+
+	case tokenSymbol:
+		if t.text == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectSymbol(")")
+		}
+
+	case tokenQuotedIdent:
+		return p.parseColumn(t)
+
+	case tokenIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL", "MISSING":
+			return &literal{nil}, nil
+		case "TRUE":
+			return &literal{true}, nil
+		case "FALSE":
+			return &literal{false}, nil
+		case "CAST":
+			return p.parseCast()
+		}
+		if p.peek().isSymbol("(") {
+			return p.parseCall(t)
+		}
+		if reserved[strings.ToUpper(t.text)] {
+			break
+		}
+		return p.parseColumn(t)
+	}
+
+	p.pos--
+	return nil, p.unexpected("an expression")
+}
+
+// parseColumn parses a column reference such as s._1, name or s.a."b"
+func (p *parser) parseColumn(first token) (expr, error) {
+	c := &column{path: []pathElement{{first.text, first.kind == tokenQuotedIdent}}}
+	for p.acceptSymbol(".") {
+		t := p.next()
+		if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+			p.pos--
+			return nil, p.unexpected("a column name")
+		}
+		c.path = append(c.path, pathElement{t.text, t.kind == tokenQuotedIdent})
+	}
+	return c, nil
+}
+
+// castTypes maps the type names CAST accepts to the type they convert to
+var castTypes = map[string]string{
+	"INT": "INT", "INTEGER": "INT", "BIGINT": "INT", "SMALLINT": "INT",
+	"FLOAT": "FLOAT", "REAL": "FLOAT", "DOUBLE": "FLOAT", "DECIMAL": "FLOAT", "NUMERIC": "FLOAT",
+	"STRING": "STRING", "VARCHAR": "STRING", "CHAR": "STRING",
+	"BOOL": "BOOL", "BOOLEAN": "BOOL",
+}
+
+func (p *parser) parseCast() (expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	typ, ok := castTypes[strings.ToUpper(t.text)]
+	if t.kind != tokenIdent || !ok {
+		return nil, newError("ParseExpectedTypeName", fmt.Sprintf("Unsupported type %q in CAST", t.text))
+	}
+	return &cast{x: x, typ: typ}, p.expectSymbol(")")
+}
+
+// parseCall parses a scalar or aggregate function call
+func (p *parser) parseCall(name token) (expr, error) {
+	fn := strings.ToUpper(name.text)
+	p.pos++ // (
+
+	if aggregateFunctions[fn] {
+		a := &aggregate{fn: fn}
+		if fn == "COUNT" && p.acceptSymbol("*") {
+			a.countAll = true
+		} else {
+			outer := p.aggregates
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if len(p.aggregates) > len(outer) {
+				return nil, newError("ParseUnsupportedSyntax", "Aggregate functions cannot be nested.")
+			}
+			a.arg = arg
+		}
+		p.aggregates = append(p.aggregates, a)
+		return a, p.expectSymbol(")")
+	}
+
+	arity, ok := scalarFunctions[fn]
+	if !ok {
+		return nil, newError("UnsupportedFunction", fmt.Sprintf("Function %s is not supported.", name.text))
+	}
+	c := &call{fn: fn}
+	if !p.peek().isSymbol(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if len(c.args) < arity[0] || arity[1] >= 0 && len(c.args) > arity[1] {
+		return nil, newError("IncorrectSqlFunctionArgumentType", fmt.Sprintf("Wrong number of arguments to %s.", name.text))
+	}
+	return c, nil
+}
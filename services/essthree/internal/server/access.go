@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tony/ess-three/internal/policy"
+	"github.com/tony/ess-three/internal/sigv4"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// accountID is the single emulated AWS account that owns every bucket
+const accountID = "000000000000"
+
+// rootPrincipal is the account root, used for callers without a configured
+// identity
+const rootPrincipal = "arn:aws:iam::" + accountID + ":root"
+
+// subresourceAction maps a query subresource to the S3 action it requires.
+// An empty query matches requests without any of the listed subresources.
+type subresourceAction struct {
+	query  string
+	action string
+}
+
+// bucketActions and objectActions list, per method, the action each request
+// form needs, in the order the router dispatches them
+var bucketActions = map[string][]subresourceAction{
+	http.MethodGet: {
+		{"acl", "s3:GetBucketAcl"},
+		{"policy", "s3:GetBucketPolicy"},
+		{"policyStatus", "s3:GetBucketPolicyStatus"},
+		{"publicAccessBlock", "s3:GetBucketPublicAccessBlock"},
+		{"encryption", "s3:GetEncryptionConfiguration"},
+		{"versioning", "s3:GetBucketVersioning"},
+		{"lifecycle", "s3:GetLifecycleConfiguration"},
+		{"cors", "s3:GetBucketCORS"},
+		{"notification", "s3:GetBucketNotification"},
+		{"object-lock", "s3:GetBucketObjectLockConfiguration"},
+		{"website", "s3:GetBucketWebsite"},
+		{"versions", "s3:ListBucketVersions"},
+		{"uploads", "s3:ListBucketMultipartUploads"},
+		{"", "s3:ListBucket"},
+	},
+	http.MethodHead: {
+		{"", "s3:ListBucket"},
+	},
+	http.MethodPut: {
+		{"acl", "s3:PutBucketAcl"},
+		{"policy", "s3:PutBucketPolicy"},
+		{"publicAccessBlock", "s3:PutBucketPublicAccessBlock"},
+		{"encryption", "s3:PutEncryptionConfiguration"},
+		{"versioning", "s3:PutBucketVersioning"},
+		{"lifecycle", "s3:PutLifecycleConfiguration"},
+		{"cors", "s3:PutBucketCORS"},
+		{"notification", "s3:PutBucketNotification"},
+		{"object-lock", "s3:PutBucketObjectLockConfiguration"},
+		{"website", "s3:PutBucketWebsite"},
+		{"", "s3:CreateBucket"},
+	},
+	http.MethodDelete: {
+		{"policy", "s3:DeleteBucketPolicy"},
+		{"publicAccessBlock", "s3:PutBucketPublicAccessBlock"},
+		{"encryption", "s3:PutEncryptionConfiguration"},
+		{"lifecycle", "s3:PutLifecycleConfiguration"},
+		{"cors", "s3:PutBucketCORS"},
+		{"website", "s3:DeleteBucketWebsite"},
+		{"", "s3:DeleteBucket"},
+	},
+}
+
+var objectActions = map[string][]subresourceAction{
+	http.MethodGet: {
+		{"tagging", "s3:GetObjectTagging"},
+		{"acl", "s3:GetObjectAcl"},
+		{"retention", "s3:GetObjectRetention"},
+		{"legal-hold", "s3:GetObjectLegalHold"},
+		{"uploadId", "s3:ListMultipartUploadParts"},
+		{"", "s3:GetObject"},
+	},
+	http.MethodHead: {
+		{"", "s3:GetObject"},
+	},
+	http.MethodPut: {
+		{"tagging", "s3:PutObjectTagging"},
+		{"acl", "s3:PutObjectAcl"},
+		{"retention", "s3:PutObjectRetention"},
+		{"legal-hold", "s3:PutObjectLegalHold"},
+		{"", "s3:PutObject"},
+	},
+	http.MethodPost: {
+		{"select", "s3:GetObject"},
+		{"restore", "s3:RestoreObject"},
+		{"", "s3:PutObject"},
+	},
+	http.MethodDelete: {
+		{"tagging", "s3:DeleteObjectTagging"},
+		{"uploadId", "s3:AbortMultipartUpload"},
+		{"", "s3:DeleteObject"},
+	},
+}
+
+// versionedActions have a separate action when a versionId is given
+var versionedActions = map[string]string{
+	"s3:GetObject":           "s3:GetObjectVersion",
+	"s3:DeleteObject":        "s3:DeleteObjectVersion",
+	"s3:GetObjectTagging":    "s3:GetObjectVersionTagging",
+	"s3:PutObjectTagging":    "s3:PutObjectVersionTagging",
+	"s3:DeleteObjectTagging": "s3:DeleteObjectVersionTagging",
+	"s3:GetObjectAcl":        "s3:GetObjectVersionAcl",
+	"s3:PutObjectAcl":        "s3:PutObjectVersionAcl",
+}
+
+// policyActions stay available to the account root even when a bucket policy
+// denies them, so a bad policy cannot lock the owner out
+var policyActions = map[string]bool{
+	"s3:GetBucketPolicy":    true,
+	"s3:PutBucketPolicy":    true,
+	"s3:DeleteBucketPolicy": true,
+}
+
+// Actions the public-read and public-read-write canned ACLs grant to
+// anonymous callers
+var (
+	bucketReadActions = map[string]bool{
+		"s3:ListBucket":                 true,
+		"s3:ListBucketVersions":         true,
+		"s3:ListBucketMultipartUploads": true,
+	}
+	bucketWriteActions = map[string]bool{
+		"s3:PutObject":           true,
+		"s3:DeleteObject":        true,
+		"s3:DeleteObjectVersion": true,
+	}
+	objectReadActions = map[string]bool{
+		"s3:GetObject":        true,
+		"s3:GetObjectVersion": true,
+	}
+)
+
+// principal identifies the caller of a request
+type principal struct {
+	// arn is empty for anonymous callers
+	arn     string
+	account string
+}
+
+func (p principal) anonymous() bool {
+	return p.arn == ""
+}
+
+// accessControlEnabled reports whether anonymous callers are restricted.
+// Without credentials or identities every caller acts as the account root,
+// as ess-three always has, and only explicit Deny statements apply.
+func (s *Server) accessControlEnabled() bool {
+	return s.authEnabled() || len(s.config.Identities) > 0
+}
+
+// requestPrincipal resolves the caller from the verified signature, or, when
+// authentication is off, from the access key named in the Authorization
+// header or presigned URL
+func (s *Server) requestPrincipal(r *http.Request) principal {
+	var accessKey string
+	if auth := authFromContext(r.Context()); auth != nil {
+		accessKey = auth.AccessKeyID
+	} else if !s.authEnabled() {
+		accessKey = unverifiedAccessKey(r)
+	}
+
+	if accessKey == "" {
+		if s.accessControlEnabled() {
+			return principal{}
+		}
+		return principal{arn: rootPrincipal, account: accountID}
+	}
+
+	arn, ok := s.config.Identities[accessKey]
+	if !ok {
+		return principal{arn: rootPrincipal, account: accountID}
+	}
+	account := accountID
+	if parts := strings.Split(arn, ":"); len(parts) >= 5 && parts[4] != "" {
+		account = parts[4]
+	}
+	return principal{arn: arn, account: account}
+}
+
+// unverifiedAccessKey returns the access key a request claims to be signed
+// with, without checking the signature
+func unverifiedAccessKey(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if auth, err := sigv4.ParseAuthorization(header); err == nil {
+			return auth.AccessKeyID
+		}
+		return ""
+	}
+	if sigv4.IsPresigned(r.URL.Query()) {
+		if presigned, err := sigv4.ParsePresigned(r.URL.Query()); err == nil {
+			return presigned.AccessKeyID
+		}
+	}
+	return ""
+}
+
+// authorize enforces bucket policies, canned ACLs and public access blocks.
+// It runs after virtual-hosted-style rewriting, so the bucket and key come
+// from the path.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isServiceRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		action := requestAction(r, bucket, key)
+		if action != "" && !s.checkAccess(r, action, bucket, key) {
+			s.sendError(w, r, "AccessDenied", "Access Denied", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAction returns the S3 action a request needs, or "" when the
+// handler authorizes it itself, as DeleteObjects does for each key
+func requestAction(r *http.Request, bucket, key string) string {
+	if bucket == "" {
+		return "s3:ListAllMyBuckets"
+	}
+
+	actions := bucketActions
+	if key != "" {
+		actions = objectActions
+	}
+
+	for _, candidate := range actions[r.Method] {
+		if candidate.query == "" || hasQuery(r, candidate.query) {
+			action := candidate.action
+			if versioned, ok := versionedActions[action]; ok && r.URL.Query().Get("versionId") != "" {
+				action = versioned
+			}
+			return action
+		}
+	}
+	return ""
+}
+
+// checkAccess decides whether the caller may perform action on a bucket or
+// object. Explicit Deny statements always apply; otherwise identities of the
+// account are allowed, and anonymous callers need a policy Allow or a public
+// canned ACL.
+func (s *Server) checkAccess(r *http.Request, action, bucket, key string) bool {
+	caller := s.requestPrincipal(r)
+
+	if bucket == "" {
+		return !caller.anonymous()
+	}
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		// Missing buckets are reported by the handler. Anonymous callers
+		// only get that far on reads, since writes such as PutObject would
+		// create the bucket.
+		return !caller.anonymous() || readAction(action)
+	}
+
+	block := info.PublicAccessBlock
+	if block == nil {
+		block = &storage.PublicAccessBlock{}
+	}
+
+	if info.Policy != "" {
+		p, err := policy.Parse([]byte(info.Policy), bucket)
+		if err != nil {
+			log.Printf("Ignoring invalid policy of bucket %s: %v", bucket, err)
+		} else {
+			resource := "arn:aws:s3:::" + bucket
+			if key != "" {
+				resource += "/" + key
+			}
+			req := policy.Request{
+				Principal:  caller.arn,
+				Account:    caller.account,
+				Action:     action,
+				Resource:   resource,
+				Conditions: conditionValues(r, caller),
+			}
+			switch p.Evaluate(req) {
+			case policy.Deny:
+				if !(caller.arn == rootPrincipal && policyActions[action]) {
+					return false
+				}
+			case policy.Allow:
+				// RestrictPublicBuckets limits a public policy to callers
+				// from the owning account
+				if !(caller.anonymous() && block.RestrictPublicBuckets && p.IsPublic()) {
+					return s.checkPublicACLWrite(r, action, block)
+				}
+			}
+		}
+	}
+
+	if !caller.anonymous() {
+		return s.checkPublicACLWrite(r, action, block)
+	}
+
+	if block.IgnorePublicAcls {
+		return false
+	}
+	switch {
+	case bucketReadActions[action]:
+		return isPublicACL(info.ACL)
+	case bucketWriteActions[action] && info.ACL == aclPublicReadWrite:
+		return s.checkPublicACLWrite(r, action, block)
+	case objectReadActions[action]:
+		meta, err := s.storage.HeadObject(bucket, key, r.URL.Query().Get("versionId"))
+		return err == nil && isPublicACL(meta.ACL)
+	}
+	return false
+}
+
+// readAction reports whether action only reads buckets or objects
+func readAction(action string) bool {
+	return strings.HasPrefix(action, "s3:Get") || strings.HasPrefix(action, "s3:List")
+}
+
+// checkPublicACLWrite applies BlockPublicAcls, which rejects requests that
+// set a public canned ACL
+func (s *Server) checkPublicACLWrite(r *http.Request, action string, block *storage.PublicAccessBlock) bool {
+	switch action {
+	case "s3:PutObject", "s3:PutObjectAcl", "s3:PutObjectVersionAcl", "s3:PutBucketAcl":
+		return !(block.BlockPublicAcls && isPublicACL(r.Header.Get("x-amz-acl")))
+	}
+	return true
+}
+
+// conditionValues collects the condition keys a policy can test, keyed in
+// lower case
+func conditionValues(r *http.Request, caller principal) map[string]string {
+	now := time.Now().UTC()
+	values := map[string]string{
+		"aws:securetransport": strconv.FormatBool(r.TLS != nil),
+		"aws:currenttime":     now.Format(time.RFC3339),
+		"aws:epochtime":       strconv.FormatInt(now.Unix(), 10),
+	}
+
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	values["aws:sourceip"] = sourceIP
+
+	if caller.anonymous() {
+		values["aws:principaltype"] = "Anonymous"
+	} else {
+		values["aws:principalarn"] = caller.arn
+		values["aws:principalaccount"] = caller.account
+		values["aws:principaltype"] = "Account"
+		if name, ok := strings.CutPrefix(caller.arn, "arn:aws:iam::"+caller.account+":user/"); ok {
+			values["aws:principaltype"] = "User"
+			values["aws:username"] = name
+		}
+	}
+
+	for header, key := range map[string]string{
+		"User-Agent":                   "aws:useragent",
+		"Referer":                      "aws:referer",
+		"x-amz-acl":                    "s3:x-amz-acl",
+		"x-amz-copy-source":            "s3:x-amz-copy-source",
+		"x-amz-metadata-directive":     "s3:x-amz-metadata-directive",
+		"x-amz-server-side-encryption": "s3:x-amz-server-side-encryption",
+		"x-amz-server-side-encryption-aws-kms-key-id": "s3:x-amz-server-side-encryption-aws-kms-key-id",
+		"x-amz-storage-class":                         "s3:x-amz-storage-class",
+		"x-amz-content-sha256":                        "s3:x-amz-content-sha256",
+	} {
+		if value := r.Header.Get(header); value != "" {
+			values[key] = value
+		}
+	}
+
+	query := r.URL.Query()
+	for param, key := range map[string]string{
+		"prefix":    "s3:prefix",
+		"delimiter": "s3:delimiter",
+		"max-keys":  "s3:max-keys",
+		"versionId": "s3:versionid",
+	} {
+		if _, ok := query[param]; ok {
+			values[key] = query.Get(param)
+		}
+	}
+
+	return values
+}
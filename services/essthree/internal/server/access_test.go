@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestAuthorizeAnonymous(t *testing.T) {
+	handler, store := newTestServer(t, authConfig())
+
+	t.Run("ServicePathsAreBuckets", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodPut, "/health", nil, nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodPut, "/admin/secret.txt", strings.NewReader("data"), nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodGet, "/admin/secret.txt", nil, nil), http.StatusNotFound, "NoSuchBucket")
+		for _, bucket := range []string{"health", "admin"} {
+			if _, err := store.HeadBucket(bucket); err == nil {
+				t.Errorf("Expected no bucket %s to be created", bucket)
+			}
+		}
+	})
+
+	t.Run("MissingBucketWrite", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodPut, "/newbucket/key.txt", strings.NewReader("data"), nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodPost, "/newbucket/key.txt?uploads", nil, nil), http.StatusForbidden, "AccessDenied")
+		if _, err := store.HeadBucket("newbucket"); err == nil {
+			t.Error("Expected newbucket not to be created")
+		}
+	})
+
+	t.Run("MissingBucketRead", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodGet, "/newbucket/key.txt", nil, nil), http.StatusNotFound, "NoSuchBucket")
+	})
+
+	t.Run("SignedWrite", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, presign(t, http.MethodPut, "http://localhost/newbucket/key.txt"), strings.NewReader("data"), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestAuthorizeACL(t *testing.T) {
+	handler, store := newTestServer(t, authConfig())
+	if err := store.CreateBucket("acl-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	for key, acl := range map[string]string{"public.txt": aclPublicRead, "private.txt": ""} {
+		if _, err := store.PutObject("acl-bucket", key, strings.NewReader("data"), nil, "text/plain", storage.PutOptions{ACL: acl}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	setBucket := func(t *testing.T, update func(info *storage.BucketInfo)) {
+		t.Helper()
+		if _, err := store.UpdateBucket("acl-bucket", func(info *storage.BucketInfo) error {
+			update(info)
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
+		}
+	}
+
+	t.Run("PrivateBucket", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodGet, "/acl-bucket", nil, nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodGet, "/acl-bucket/private.txt", nil, nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodPut, "/acl-bucket/new.txt", strings.NewReader("data"), nil), http.StatusForbidden, "AccessDenied")
+	})
+
+	t.Run("PublicObject", func(t *testing.T) {
+		if rec := do(handler, http.MethodGet, "/acl-bucket/public.txt", nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("PublicReadBucket", func(t *testing.T) {
+		setBucket(t, func(info *storage.BucketInfo) { info.ACL = aclPublicRead })
+		if rec := do(handler, http.MethodGet, "/acl-bucket", nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		expectError(t, do(handler, http.MethodPut, "/acl-bucket/new.txt", strings.NewReader("data"), nil), http.StatusForbidden, "AccessDenied")
+	})
+
+	t.Run("IgnorePublicAcls", func(t *testing.T) {
+		setBucket(t, func(info *storage.BucketInfo) {
+			info.PublicAccessBlock = &storage.PublicAccessBlock{IgnorePublicAcls: true}
+		})
+		expectError(t, do(handler, http.MethodGet, "/acl-bucket", nil, nil), http.StatusForbidden, "AccessDenied")
+		expectError(t, do(handler, http.MethodGet, "/acl-bucket/public.txt", nil, nil), http.StatusForbidden, "AccessDenied")
+	})
+
+	t.Run("BlockPublicAcls", func(t *testing.T) {
+		setBucket(t, func(info *storage.BucketInfo) {
+			info.PublicAccessBlock = &storage.PublicAccessBlock{BlockPublicAcls: true}
+		})
+		target := presign(t, http.MethodPut, "http://localhost/acl-bucket/new.txt")
+		headers := map[string]string{"x-amz-acl": aclPublicRead}
+		expectError(t, do(handler, http.MethodPut, target, strings.NewReader("data"), headers), http.StatusForbidden, "AccessDenied")
+		if rec := do(handler, http.MethodPut, target, strings.NewReader("data"), nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected a private upload to succeed, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestAuthorizePolicy(t *testing.T) {
+	handler, store := newTestServer(t, authConfig())
+	if err := store.CreateBucket("policy-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.PutObject("policy-bucket", "doc.txt", strings.NewReader("data"), nil, "text/plain", storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	document := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::policy-bucket/*"},
+			{"Effect": "Deny", "Principal": "*", "Action": "s3:DeleteObject", "Resource": "arn:aws:s3:::policy-bucket/*"}
+		]
+	}`
+	if _, err := store.UpdateBucket("policy-bucket", func(info *storage.BucketInfo) error {
+		info.Policy = document
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+
+	t.Run("AnonymousAllow", func(t *testing.T) {
+		if rec := do(handler, http.MethodGet, "/policy-bucket/doc.txt", nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("SignedDeny", func(t *testing.T) {
+		target := presign(t, http.MethodDelete, "http://localhost/policy-bucket/doc.txt")
+		expectError(t, do(handler, http.MethodDelete, target, nil, nil), http.StatusForbidden, "AccessDenied")
+	})
+
+	t.Run("RestrictPublicBuckets", func(t *testing.T) {
+		if _, err := store.UpdateBucket("policy-bucket", func(info *storage.BucketInfo) error {
+			info.PublicAccessBlock = &storage.PublicAccessBlock{RestrictPublicBuckets: true}
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
+		}
+		expectError(t, do(handler, http.MethodGet, "/policy-bucket/doc.txt", nil, nil), http.StatusForbidden, "AccessDenied")
+	})
+}
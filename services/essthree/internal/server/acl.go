@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// Canned ACLs. bucket-owner-read and bucket-owner-full-control are accepted
+// and behave like private, since every object belongs to the bucket owner.
+const (
+	aclPrivate                = "private"
+	aclPublicRead             = "public-read"
+	aclPublicReadWrite        = "public-read-write"
+	aclAuthenticatedRead      = "authenticated-read"
+	aclBucketOwnerRead        = "bucket-owner-read"
+	aclBucketOwnerFullControl = "bucket-owner-full-control"
+)
+
+// Grantee group URIs
+const (
+	allUsersGroup           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// errUnsupportedACL marks canned ACLs S3 knows but ess-three does not emulate
+var errUnsupportedACL = errors.New("unsupported canned ACL")
+
+type AccessControlPolicy struct {
+	XMLName           xml.Name `xml:"AccessControlPolicy"`
+	Xmlns             string   `xml:"xmlns,attr,omitempty"`
+	Owner             Owner    `xml:"Owner"`
+	AccessControlList []Grant  `xml:"AccessControlList>Grant"`
+}
+
+type Grant struct {
+	Grantee    Grantee `xml:"Grantee"`
+	Permission string  `xml:"Permission"`
+}
+
+type Grantee struct {
+	XmlnsXsi    string `xml:"xmlns:xsi,attr"`
+	Type        string `xml:"xsi:type,attr"`
+	ID          string `xml:"ID,omitempty"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+	URI         string `xml:"URI,omitempty"`
+}
+
+// parseCannedACL validates an x-amz-acl header value. An empty value means
+// the default, private.
+func parseCannedACL(value string) (string, error) {
+	switch value {
+	case "", aclPrivate, aclPublicRead, aclPublicReadWrite, aclAuthenticatedRead, aclBucketOwnerRead, aclBucketOwnerFullControl:
+		return value, nil
+	case "aws-exec-read", "log-delivery-write":
+		return "", errUnsupportedACL
+	default:
+		return "", errors.New("invalid canned ACL")
+	}
+}
+
+// isPublicACL reports whether a canned ACL grants access to anonymous callers
+func isPublicACL(acl string) bool {
+	return acl == aclPublicRead || acl == aclPublicReadWrite
+}
+
+// requestACL reads the canned ACL of a request, writing an error and
+// returning false when it is invalid or uses explicit grants
+func (s *Server) requestACL(w http.ResponseWriter, r *http.Request) (string, bool) {
+	for name := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-grant-") {
+			s.sendError(w, r, "NotImplemented", "Explicit grants are not supported; use a canned ACL in x-amz-acl", http.StatusNotImplemented)
+			return "", false
+		}
+	}
+
+	acl, err := parseCannedACL(r.Header.Get("x-amz-acl"))
+	if errors.Is(err, errUnsupportedACL) {
+		s.sendError(w, r, "NotImplemented", "The canned ACL "+r.Header.Get("x-amz-acl")+" is not supported", http.StatusNotImplemented)
+		return "", false
+	}
+	if err != nil {
+		s.sendError(w, r, "InvalidArgument", "Invalid canned ACL: "+r.Header.Get("x-amz-acl"), http.StatusBadRequest)
+		return "", false
+	}
+	return acl, true
+}
+
+// cannedACLGrants expands a canned ACL into the grants S3 reports for it
+func cannedACLGrants(acl string) []Grant {
+	const xsi = "http://www.w3.org/2001/XMLSchema-instance"
+	grants := []Grant{{
+		Grantee:    Grantee{XmlnsXsi: xsi, Type: "CanonicalUser", ID: ownerID, DisplayName: ownerDisplayName},
+		Permission: "FULL_CONTROL",
+	}}
+
+	group := func(uri, permission string) Grant {
+		return Grant{Grantee: Grantee{XmlnsXsi: xsi, Type: "Group", URI: uri}, Permission: permission}
+	}
+	switch acl {
+	case aclPublicRead:
+		grants = append(grants, group(allUsersGroup, "READ"))
+	case aclPublicReadWrite:
+		grants = append(grants, group(allUsersGroup, "READ"), group(allUsersGroup, "WRITE"))
+	case aclAuthenticatedRead:
+		grants = append(grants, group(authenticatedUsersGroup, "READ"))
+	}
+	return grants
+}
+
+// writeACL writes the AccessControlPolicy document for a canned ACL
+func writeACL(w http.ResponseWriter, acl string) {
+	result := AccessControlPolicy{
+		Xmlns:             "http://s3.amazonaws.com/doc/2006-03-01/",
+		Owner:             Owner{ID: ownerID, DisplayName: ownerDisplayName},
+		AccessControlList: cannedACLGrants(acl),
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// putACLRequest reads the canned ACL of a PutBucketAcl or PutObjectAcl
+// request. Only x-amz-acl is supported; access control lists in the body are
+// rejected.
+func (s *Server) putACLRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if body, _ := io.ReadAll(io.LimitReader(r.Body, 1)); len(body) > 0 {
+		s.sendError(w, r, "NotImplemented", "Access control lists in the request body are not supported; use a canned ACL in x-amz-acl", http.StatusNotImplemented)
+		return "", false
+	}
+	if r.Header.Get("x-amz-acl") == "" {
+		s.sendError(w, r, "MissingSecurityHeader", "Your request was missing a required header: x-amz-acl", http.StatusBadRequest)
+		return "", false
+	}
+	return s.requestACL(w, r)
+}
+
+// handleGetBucketAcl handles GET /{bucket}?acl
+func (s *Server) handleGetBucketAcl(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	writeACL(w, info.ACL)
+}
+
+// handlePutBucketAcl handles PUT /{bucket}?acl
+func (s *Server) handlePutBucketAcl(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	acl, ok := s.putACLRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.ACL = acl
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetObjectAcl handles GET /{bucket}/{key}?acl
+func (s *Server) handleGetObjectAcl(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	meta, err := s.storage.HeadObject(bucket, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	writeACL(w, meta.ACL)
+}
+
+// handlePutObjectAcl handles PUT /{bucket}/{key}?acl
+func (s *Server) handlePutObjectAcl(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	acl, ok := s.putACLRequest(w, r)
+	if !ok {
+		return
+	}
+
+	meta, err := s.storage.PutObjectACL(bucket, key, r.URL.Query().Get("versionId"), acl)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	w.WriteHeader(http.StatusOK)
+}
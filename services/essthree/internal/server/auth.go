@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tony/ess-three/internal/sigv4"
+)
+
+// maxRequestSkew is how far a request timestamp may drift from the server clock
+const maxRequestSkew = 15 * time.Minute
+
+// errContentSHA256Mismatch is returned while reading a body whose SHA-256
+// does not match the signed x-amz-content-sha256 header
+var errContentSHA256Mismatch = errors.New("x-amz-content-sha256 does not match the request body")
+
+// payloadHashPattern matches a hex SHA-256 payload hash
+var payloadHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type contextKey string
+
+const authContextKey contextKey = "auth"
+
+// authContext describes the verified signature of a request
+type authContext struct {
+	AccessKeyID   string
+	Authorization *sigv4.Authorization
+	AmzDate       string
+	SigningKey    []byte
+}
+
+// authFromContext returns the verified signature of a request, or nil for
+// anonymous requests and servers without authentication
+func authFromContext(ctx context.Context) *authContext {
+	auth, _ := ctx.Value(authContextKey).(*authContext)
+	return auth
+}
+
+// authEnabled reports whether requests must be signed
+func (s *Server) authEnabled() bool {
+	return len(s.config.Credentials) > 0
+}
+
+// authenticate verifies AWS Signature Version 4 header or presigned URL
+// authentication when credentials are configured. Unsigned requests continue
+// as anonymous and are left to authorize. Health and admin endpoints stay
+// open.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authEnabled() || s.isServiceRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		presigned := sigv4.IsPresigned(r.URL.Query())
+
+		var auth *authContext
+		var ok bool
+		switch {
+		case header != "" && presigned:
+			s.sendError(w, r, "InvalidArgument", "Only one auth mechanism allowed; only the X-Amz-Algorithm query parameter, Signature query string parameter or the Authorization header should be specified", http.StatusBadRequest)
+			return
+		case presigned:
+			auth, ok = s.verifyPresignedSignature(w, r)
+		case header != "":
+			auth, ok = s.verifyHeaderSignature(w, r, header)
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey, auth)))
+	})
+}
+
+// verifyHeaderSignature checks an Authorization header signature, writing an
+// S3 error response and returning false when verification fails
+func (s *Server) verifyHeaderSignature(w http.ResponseWriter, r *http.Request, header string) (*authContext, bool) {
+	if strings.HasPrefix(header, "AWS ") {
+		s.sendError(w, r, "InvalidRequest", "The authorization mechanism you have provided is not supported. Please use AWS4-HMAC-SHA256.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	auth, err := sigv4.ParseAuthorization(header)
+	if err != nil {
+		s.sendError(w, r, "AuthorizationHeaderMalformed", "The authorization header is malformed; "+malformedDetail(err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	secret, ok := s.config.Credentials[auth.AccessKeyID]
+	if !ok {
+		s.sendError(w, r, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records.", http.StatusForbidden)
+		return nil, false
+	}
+
+	if !s.checkCredentialScope(w, r, auth, "AuthorizationHeaderMalformed", "The authorization header is malformed;") {
+		return nil, false
+	}
+
+	amzDate := r.Header.Get("x-amz-date")
+	requestTime, err := time.Parse(sigv4.TimeFormat, amzDate)
+	if err != nil {
+		// Fall back to the standard Date header
+		requestTime, err = http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			s.sendError(w, r, "AccessDenied", "AWS authentication requires a valid Date or x-amz-date header", http.StatusForbidden)
+			return nil, false
+		}
+		amzDate = requestTime.UTC().Format(sigv4.TimeFormat)
+	}
+
+	if !strings.HasPrefix(amzDate, auth.Date) {
+		s.sendError(w, r, "AuthorizationHeaderMalformed", fmt.Sprintf("The authorization header is malformed; Invalid credential date. Date is not the same as X-Amz-Date: \"%s\".", auth.Date), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if skew := time.Since(requestTime); skew > maxRequestSkew || skew < -maxRequestSkew {
+		s.sendError(w, r, "RequestTimeTooSkewed", "The difference between the request time and the current time is too large.", http.StatusForbidden)
+		return nil, false
+	}
+
+	if !containsString(auth.SignedHeaders, "host") {
+		s.sendError(w, r, "AuthorizationHeaderMalformed", "The authorization header is malformed; the host header must be signed", http.StatusBadRequest)
+		return nil, false
+	}
+
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if payloadHash == "" {
+		s.sendError(w, r, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return s.checkSignature(w, r, auth, secret, amzDate, payloadHash)
+}
+
+// verifyPresignedSignature checks the X-Amz-* query parameters of a
+// presigned URL, including its expiry
+func (s *Server) verifyPresignedSignature(w http.ResponseWriter, r *http.Request) (*authContext, bool) {
+	query := r.URL.Query()
+	presigned, err := sigv4.ParsePresigned(query)
+	if err != nil {
+		s.sendError(w, r, "AuthorizationQueryParametersError", malformedDetail(err), http.StatusBadRequest)
+		return nil, false
+	}
+	auth := &presigned.Authorization
+
+	secret, ok := s.config.Credentials[auth.AccessKeyID]
+	if !ok {
+		s.sendError(w, r, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records.", http.StatusForbidden)
+		return nil, false
+	}
+
+	if !s.checkCredentialScope(w, r, auth, "AuthorizationQueryParametersError", "Error parsing the X-Amz-Credential parameter;") {
+		return nil, false
+	}
+
+	if !strings.HasPrefix(presigned.AmzDate, auth.Date) {
+		s.sendError(w, r, "AuthorizationQueryParametersError", "Invalid credential date. Date is not the same as X-Amz-Date.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	now := time.Now()
+	if presigned.RequestTime.After(now.Add(maxRequestSkew)) {
+		s.sendError(w, r, "AccessDenied", "Request is not valid yet", http.StatusForbidden)
+		return nil, false
+	}
+	if now.After(presigned.RequestTime.Add(presigned.Expires)) {
+		s.sendError(w, r, "AccessDenied", "Request has expired", http.StatusForbidden)
+		return nil, false
+	}
+
+	if !containsString(auth.SignedHeaders, "host") {
+		s.sendError(w, r, "AuthorizationQueryParametersError", "X-Amz-SignedHeaders must include the host header", http.StatusBadRequest)
+		return nil, false
+	}
+
+	payloadHash := query.Get(sigv4.QueryContentSHA256)
+	if payloadHash == "" {
+		payloadHash = sigv4.UnsignedPayload
+	}
+
+	return s.checkSignature(w, r, auth, secret, presigned.AmzDate, payloadHash, sigv4.QuerySignature)
+}
+
+// checkSignature recomputes the request signature and compares it with the
+// one provided. Query parameters named in exclude are not part of the
+// canonical request.
+func (s *Server) checkSignature(w http.ResponseWriter, r *http.Request, auth *sigv4.Authorization, secret, amzDate, payloadHash string, exclude ...string) (*authContext, bool) {
+	canonicalRequest := sigv4.CanonicalRequest(r, auth.SignedHeaders, payloadHash, exclude...)
+	stringToSign := sigv4.StringToSign(amzDate, auth.Scope(), canonicalRequest)
+	signingKey := sigv4.SigningKey(secret, auth.Date, auth.Region, auth.Service)
+
+	if !sigv4.SignaturesEqual(sigv4.Sign(signingKey, stringToSign), auth.Signature) {
+		s.sendSignatureDoesNotMatch(w, r, auth, stringToSign, canonicalRequest)
+		return nil, false
+	}
+
+	// A literal payload hash is verified as the body is read
+	if payloadHashPattern.MatchString(payloadHash) && r.Body != nil {
+		r.Body = &payloadVerifier{body: r.Body, hash: sha256.New(), expected: payloadHash}
+	}
+
+	return &authContext{
+		AccessKeyID:   auth.AccessKeyID,
+		Authorization: auth,
+		AmzDate:       amzDate,
+		SigningKey:    signingKey,
+	}, true
+}
+
+// checkCredentialScope rejects signatures scoped to another region or
+// service, reporting code with the message prefixed by prefix
+func (s *Server) checkCredentialScope(w http.ResponseWriter, r *http.Request, auth *sigv4.Authorization, code, prefix string) bool {
+	if auth.Region != s.config.Region {
+		s.sendError(w, r, code, fmt.Sprintf("%s the region '%s' is wrong; expecting '%s'", prefix, auth.Region, s.config.Region), http.StatusBadRequest)
+		return false
+	}
+	if auth.Service != "s3" {
+		s.sendError(w, r, code, fmt.Sprintf("%s incorrect service \"%s\". This endpoint belongs to \"s3\".", prefix, auth.Service), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// sendSignatureDoesNotMatch reports a signature mismatch, including the
+// string to sign and canonical request the server computed
+func (s *Server) sendSignatureDoesNotMatch(w http.ResponseWriter, r *http.Request, auth *sigv4.Authorization, stringToSign, canonicalRequest string) {
+	errorResp := Error{
+		Code:              "SignatureDoesNotMatch",
+		Message:           "The request signature we calculated does not match the signature you provided. Check your key and signing method.",
+		Resource:          r.URL.Path,
+		RequestId:         r.Header.Get("X-Request-ID"),
+		AWSAccessKeyId:    auth.AccessKeyID,
+		StringToSign:      stringToSign,
+		SignatureProvided: auth.Signature,
+		CanonicalRequest:  canonicalRequest,
+	}
+	s.writeError(w, errorResp, http.StatusForbidden)
+}
+
+// payloadVerifier checks the SHA-256 of a request body once it is fully read
+type payloadVerifier struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (p *payloadVerifier) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+	p.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(p.hash.Sum(nil)) != p.expected {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+func (p *payloadVerifier) Close() error {
+	return p.body.Close()
+}
+
+// malformedDetail returns the detail of a sigv4 parse error without the
+// sentinel prefix
+func malformedDetail(err error) string {
+	return strings.TrimPrefix(err.Error(), sigv4.ErrMalformedAuthorization.Error()+": ")
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
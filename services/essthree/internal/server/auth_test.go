@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tony/ess-three/internal/sigv4"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// authConfig enables authentication with the test credentials and
+// virtual-hosted-style addressing under localhost
+func authConfig() Config {
+	return Config{
+		Credentials: map[string]string{testAccessKey: testSecretKey},
+		BaseDomains: []string{"localhost"},
+	}
+}
+
+// presign returns target presigned for method with the test credentials
+func presign(t *testing.T, method, target string) string {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", target, err)
+	}
+	return sigv4.PresignURL(method, u, testAccessKey, testSecretKey, defaultRegion, time.Now(), time.Minute)
+}
+
+func TestAuthenticateServiceRoutes(t *testing.T) {
+	handler, store := newTestServer(t, authConfig())
+	if err := store.CreateBucket("bkt"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+
+	t.Run("AdminOpen", func(t *testing.T) {
+		if rec := do(handler, http.MethodGet, "http://localhost/admin/api/buckets", nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := do(handler, http.MethodGet, "http://localhost/health", nil, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("VirtualHostedAdminKey", func(t *testing.T) {
+		target := presign(t, http.MethodPut, "http://bkt.localhost/admin/x.txt")
+		if rec := do(handler, http.MethodPut, target, strings.NewReader("data"), nil); rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if _, err := store.HeadObject("bkt", "admin/x.txt", ""); err != nil {
+			t.Errorf("Expected admin/x.txt to be stored, got %v", err)
+		}
+	})
+
+	t.Run("AdminPathSignatureChecked", func(t *testing.T) {
+		target := presign(t, http.MethodPut, "http://localhost/admin/x.txt")
+		target = strings.Replace(target, "X-Amz-Signature=", "X-Amz-Signature=0", 1)
+		expectError(t, do(handler, http.MethodPut, target, strings.NewReader("data"), nil), http.StatusForbidden, "SignatureDoesNotMatch")
+	})
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+const (
+	// ownerID and ownerDisplayName identify the single emulated account
+	ownerID          = "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a"
+	ownerDisplayName = "ess-three"
+
+	// defaultRegion is reported as the location of every bucket unless
+	// another region is configured
+	defaultRegion = "us-east-1"
+)
+
+type ListAllMyBucketsResult struct {
+	XMLName xml.Name       `xml:"ListAllMyBucketsResult"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	Owner   Owner          `xml:"Owner"`
+	Buckets []BucketResult `xml:"Buckets>Bucket"`
+}
+
+type Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type BucketResult struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+type CreateBucketConfiguration struct {
+	XMLName            xml.Name `xml:"CreateBucketConfiguration"`
+	LocationConstraint string   `xml:"LocationConstraint"`
+}
+
+// handleListBuckets handles GET / - ListBuckets
+func (s *Server) handleListBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets, err := s.storage.ListBuckets()
+	if err != nil {
+		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := ListAllMyBucketsResult{
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Owner: Owner{ID: ownerID, DisplayName: ownerDisplayName},
+	}
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, BucketResult{
+			Name:         bucket.Name,
+			CreationDate: bucket.CreationDate,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleCreateBucket handles PUT /{bucket} - CreateBucket
+func (s *Server) handleCreateBucket(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	// The location constraint is optional and only validated for well-formedness
+	if r.ContentLength > 0 {
+		var config CreateBucketConfiguration
+		if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+			s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+			return
+		}
+	}
+
+	acl, ok := s.requestACL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.storage.CreateBucket(bucket); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	// A bucket created with Object Lock has versioning enabled for good
+	objectLock := strings.EqualFold(r.Header.Get("x-amz-bucket-object-lock-enabled"), "true")
+	if acl != "" || objectLock {
+		_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+			info.ACL = acl
+			if objectLock {
+				info.Versioning = storage.VersioningEnabled
+				info.ObjectLock = &storage.ObjectLockConfig{}
+			}
+			return nil
+		})
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Location", "/"+bucket)
+	w.Header().Set("Server", "ess-three")
+	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleHeadBucket handles HEAD /{bucket} - HeadBucket
+func (s *Server) handleHeadBucket(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	if _, err := s.storage.HeadBucket(bucket); err != nil {
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("x-amz-bucket-region", s.config.Region)
+	w.Header().Set("Server", "ess-three")
+	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleDeleteBucket handles DELETE /{bucket} - DeleteBucket
+func (s *Server) handleDeleteBucket(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	if err := s.storage.DeleteBucket(bucket); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
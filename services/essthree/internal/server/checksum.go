@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// Checksum headers
+const (
+	headerChecksumPrefix       = "x-amz-checksum-"
+	headerChecksumAlgorithm    = "x-amz-checksum-algorithm"
+	headerChecksumType         = "x-amz-checksum-type"
+	headerChecksumMode         = "x-amz-checksum-mode"
+	headerSDKChecksumAlgorithm = "x-amz-sdk-checksum-algorithm"
+	headerTrailer              = "x-amz-trailer"
+)
+
+// errBadDigest is returned while reading a body whose MD5 does not match
+// its Content-MD5 header
+var errBadDigest = errors.New("Content-MD5 does not match the request body")
+
+// checksumMismatchError is returned while reading a body whose checksum does
+// not match its x-amz-checksum-* header or trailer
+type checksumMismatchError struct {
+	algorithm string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum does not match the request body", e.algorithm)
+}
+
+// checksumHeader returns the header carrying a checksum of algorithm
+func checksumHeader(algorithm string) string {
+	return headerChecksumPrefix + strings.ToLower(algorithm)
+}
+
+// decodeChecksum decodes a base64 checksum value, checking its size
+func decodeChecksum(algorithm, value string) ([]byte, bool) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) != storage.ChecksumSize(algorithm) {
+		return nil, false
+	}
+	return raw, true
+}
+
+// requestBody returns the body of an object or part upload, decoding
+// aws-chunked framing and verifying chunk signatures, Content-MD5 and any
+// x-amz-checksum-* header or trailer as it is read. It also returns the checksum algorithm
+// the request used, if any. Invalid headers are answered here; a body that
+// does not match them fails the read with errBadDigest or a
+// checksumMismatchError.
+func (s *Server) requestBody(w http.ResponseWriter, r *http.Request) (io.Reader, string, bool) {
+	verifier := &checksumVerifier{body: r.Body}
+
+	if value := r.Header.Get("Content-MD5"); value != "" {
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(raw) != md5.Size {
+			s.sendError(w, r, "InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest)
+			return nil, "", false
+		}
+		verifier.md5, verifier.expectedMD5 = md5.New(), raw
+	}
+
+	// At most one checksum header may be sent
+	for _, algorithm := range storage.ChecksumAlgorithms {
+		value := r.Header.Get(checksumHeader(algorithm))
+		if value == "" {
+			continue
+		}
+		if verifier.algorithm != "" {
+			s.sendError(w, r, "InvalidRequest", "Expecting a single x-amz-checksum- header. Multiple checksum Types are not allowed.", http.StatusBadRequest)
+			return nil, "", false
+		}
+		raw, ok := decodeChecksum(algorithm, value)
+		if !ok {
+			s.sendError(w, r, "InvalidRequest", fmt.Sprintf("Value for %s header is invalid.", checksumHeader(algorithm)), http.StatusBadRequest)
+			return nil, "", false
+		}
+		verifier.algorithm, verifier.expected = algorithm, raw
+	}
+
+	// A checksum trailer names its algorithm up front in x-amz-trailer
+	chunked := isAWSChunked(r)
+	if name := r.Header.Get(headerTrailer); name != "" {
+		name = strings.ToLower(name)
+		algorithm, err := storage.ParseChecksumAlgorithm(strings.TrimPrefix(name, headerChecksumPrefix))
+		if !strings.HasPrefix(name, headerChecksumPrefix) || err != nil {
+			s.sendError(w, r, "InvalidRequest", "The value specified in the x-amz-trailer header is not supported", http.StatusBadRequest)
+			return nil, "", false
+		}
+		if !chunked {
+			s.sendError(w, r, "InvalidRequest", "The x-amz-trailer header requires an aws-chunked request body.", http.StatusBadRequest)
+			return nil, "", false
+		}
+		if verifier.algorithm != "" {
+			s.sendError(w, r, "InvalidRequest", "Expecting a single x-amz-checksum- header. Multiple checksum Types are not allowed.", http.StatusBadRequest)
+			return nil, "", false
+		}
+		verifier.algorithm, verifier.trailer = algorithm, checksumHeader(algorithm)
+	}
+
+	if name := r.Header.Get(headerSDKChecksumAlgorithm); name != "" {
+		algorithm, err := storage.ParseChecksumAlgorithm(name)
+		if err != nil || verifier.algorithm == "" {
+			s.sendError(w, r, "InvalidRequest", "x-amz-sdk-checksum-algorithm specified, but no corresponding x-amz-checksum-* or x-amz-trailer headers were found.", http.StatusBadRequest)
+			return nil, "", false
+		}
+		if algorithm != verifier.algorithm {
+			s.sendError(w, r, "InvalidRequest", fmt.Sprintf("Value for %s header is invalid.", headerSDKChecksumAlgorithm), http.StatusBadRequest)
+			return nil, "", false
+		}
+	}
+
+	if chunked {
+		if _, err := strconv.ParseInt(r.Header.Get("x-amz-decoded-content-length"), 10, 64); err != nil {
+			s.sendError(w, r, "MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired)
+			return nil, "", false
+		}
+		verifier.chunked = newChunkedReader(r)
+		verifier.body = verifier.chunked
+	}
+	if verifier.algorithm != "" {
+		verifier.checksum = storage.NewChecksumHash(verifier.algorithm)
+	}
+	return verifier, verifier.algorithm, true
+}
+
+// checksumVerifier checks the Content-MD5 and additional checksum of a
+// request body once it is fully read
+type checksumVerifier struct {
+	body    io.Reader
+	chunked *chunkedReader
+
+	md5         hash.Hash
+	expectedMD5 []byte
+
+	// expected is the raw checksum from the request header; trailer names
+	// the trailer carrying it instead
+	algorithm string
+	checksum  hash.Hash
+	expected  []byte
+	trailer   string
+}
+
+func (v *checksumVerifier) Read(b []byte) (int, error) {
+	n, err := v.body.Read(b)
+	if v.md5 != nil {
+		v.md5.Write(b[:n])
+	}
+	if v.checksum != nil {
+		v.checksum.Write(b[:n])
+	}
+	if err == io.EOF {
+		if verifyErr := v.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+// verify compares the digests of the complete body with the expected ones
+func (v *checksumVerifier) verify() error {
+	if v.md5 != nil && string(v.md5.Sum(nil)) != string(v.expectedMD5) {
+		return errBadDigest
+	}
+	if v.checksum == nil {
+		return nil
+	}
+
+	expected := v.expected
+	if v.trailer != "" {
+		raw, ok := decodeChecksum(v.algorithm, v.chunked.Trailer(v.trailer))
+		if !ok {
+			return fmt.Errorf("%w: missing or invalid %s", errMalformedTrailer, v.trailer)
+		}
+		expected = raw
+	}
+	if string(v.checksum.Sum(nil)) != string(expected) {
+		return &checksumMismatchError{algorithm: v.algorithm}
+	}
+	return nil
+}
+
+// requestChecksumAlgorithm reads x-amz-checksum-algorithm, which names the
+// checksum to compute for a multipart upload or copy. It reports false
+// after answering an invalid value.
+func (s *Server) requestChecksumAlgorithm(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.Header.Get(headerChecksumAlgorithm)
+	if name == "" {
+		return "", true
+	}
+	algorithm, err := storage.ParseChecksumAlgorithm(name)
+	if err != nil {
+		s.sendError(w, r, "InvalidRequest", fmt.Sprintf("Value for %s header is invalid.", headerChecksumAlgorithm), http.StatusBadRequest)
+		return "", false
+	}
+	return algorithm, true
+}
+
+// setChecksumHeaders writes an object's checksum headers. Reads only return
+// them when the request sets x-amz-checksum-mode: ENABLED.
+func setChecksumHeaders(w http.ResponseWriter, checksum *storage.Checksum) {
+	if checksum == nil || checksum.Value == "" {
+		return
+	}
+	w.Header().Set(checksumHeader(checksum.Algorithm), checksum.Value)
+	w.Header().Set(headerChecksumType, checksum.Type)
+}
+
+// checksumModeEnabled reports whether a read asks for the object's checksum
+func checksumModeEnabled(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(headerChecksumMode), "ENABLED")
+}
+
+// Checksums holds the additional checksum of an object or part in XML
+// responses; at most one field is set
+type Checksums struct {
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+}
+
+// newChecksums returns the XML fields for a checksum value of algorithm
+func newChecksums(algorithm, value string) Checksums {
+	var c Checksums
+	switch algorithm {
+	case storage.ChecksumCRC32:
+		c.ChecksumCRC32 = value
+	case storage.ChecksumCRC32C:
+		c.ChecksumCRC32C = value
+	case storage.ChecksumCRC64NVME:
+		c.ChecksumCRC64NVME = value
+	case storage.ChecksumSHA1:
+		c.ChecksumSHA1 = value
+	case storage.ChecksumSHA256:
+		c.ChecksumSHA256 = value
+	}
+	return c
+}
+
+// value returns the checksum set in c, with its algorithm
+func (c Checksums) value() (string, string) {
+	switch {
+	case c.ChecksumCRC32 != "":
+		return storage.ChecksumCRC32, c.ChecksumCRC32
+	case c.ChecksumCRC32C != "":
+		return storage.ChecksumCRC32C, c.ChecksumCRC32C
+	case c.ChecksumCRC64NVME != "":
+		return storage.ChecksumCRC64NVME, c.ChecksumCRC64NVME
+	case c.ChecksumSHA1 != "":
+		return storage.ChecksumSHA1, c.ChecksumSHA1
+	case c.ChecksumSHA256 != "":
+		return storage.ChecksumSHA256, c.ChecksumSHA256
+	}
+	return "", ""
+}
@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tony/ess-three/internal/sigv4"
+)
+
+// errIncompleteBody is returned while reading an aws-chunked body that is
+// truncated, not framed as chunks, or not x-amz-decoded-content-length long
+var errIncompleteBody = errors.New("malformed aws-chunked body")
+
+// errMalformedTrailer is returned when the trailer of an aws-chunked body is
+// not well-formed or lacks a declared header
+var errMalformedTrailer = errors.New("malformed trailer")
+
+// errChunkSignatureMismatch is returned while reading a signed aws-chunked
+// body whose chunk or trailer signature does not verify
+var errChunkSignatureMismatch = errors.New("chunk signature does not match")
+
+// maxChunkLine bounds the length of a chunk header or trailer line
+const maxChunkLine = 4096
+
+// trailerSignatureHeader carries the signature of a signed trailer
+const trailerSignatureHeader = "x-amz-trailer-signature"
+
+// isAWSChunked reports whether a request body uses the aws-chunked encoding
+// the SDKs use for streaming uploads
+func isAWSChunked(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") {
+		return true
+	}
+	for _, encoding := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		if strings.TrimSpace(encoding) == "aws-chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkSigner verifies the signature chain of a signed aws-chunked body
+type chunkSigner struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+	trailer  bool
+}
+
+// newChunkSigner returns the verifier for the chunk signatures of r, or nil
+// when r is not signed chunk by chunk or the server does not check
+// signatures
+func newChunkSigner(r *http.Request) *chunkSigner {
+	auth := authFromContext(r.Context())
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if auth == nil || (payloadHash != sigv4.StreamingPayload && payloadHash != sigv4.StreamingPayloadTrailer) {
+		return nil
+	}
+	return &chunkSigner{
+		key:      auth.SigningKey,
+		amzDate:  auth.AmzDate,
+		scope:    auth.Authorization.Scope(),
+		previous: auth.Authorization.Signature,
+		trailer:  payloadHash == sigv4.StreamingPayloadTrailer,
+	}
+}
+
+// verifyChunk checks a chunk signature and advances the chain
+func (s *chunkSigner) verifyChunk(signature string, chunkHash []byte) error {
+	expected := sigv4.Sign(s.key, sigv4.ChunkStringToSign(s.amzDate, s.scope, s.previous, hex.EncodeToString(chunkHash)))
+	if !sigv4.SignaturesEqual(expected, signature) {
+		return errChunkSignatureMismatch
+	}
+	s.previous = signature
+	return nil
+}
+
+// verifyTrailer checks the trailer signature against the trailer lines
+func (s *chunkSigner) verifyTrailer(signature, trailer string) error {
+	expected := sigv4.Sign(s.key, sigv4.TrailerStringToSign(s.amzDate, s.scope, s.previous, trailer))
+	if !sigv4.SignaturesEqual(expected, signature) {
+		return errChunkSignatureMismatch
+	}
+	return nil
+}
+
+// chunkedReader decodes an aws-chunked body. Each chunk is framed as
+// <hex size>[;chunk-signature=<sig>]\r\n<data>\r\n, and a zero-size chunk
+// ends the body, followed by optional trailer headers and an empty line.
+type chunkedReader struct {
+	r       *bufio.Reader
+	signer  *chunkSigner
+	trailer http.Header
+
+	// decodedLength is the expected size of the decoded body, or -1
+	decodedLength int64
+	decoded       int64
+
+	remaining int64
+	signature string
+	hash      hash.Hash
+	done      bool
+	err       error
+}
+
+// newChunkedReader decodes the aws-chunked body of r, checking its chunk
+// signatures when the request was signed with a streaming payload and
+// its size against x-amz-decoded-content-length when given
+func newChunkedReader(r *http.Request) *chunkedReader {
+	c := &chunkedReader{
+		r:             bufio.NewReader(r.Body),
+		signer:        newChunkSigner(r),
+		trailer:       make(http.Header),
+		decodedLength: -1,
+	}
+	if length, err := strconv.ParseInt(r.Header.Get("x-amz-decoded-content-length"), 10, 64); err == nil {
+		c.decodedLength = length
+	}
+	return c
+}
+
+func (c *chunkedReader) Read(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			c.err = err
+			return 0, err
+		}
+	}
+
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.r.Read(b)
+	c.remaining -= int64(n)
+	c.decoded += int64(n)
+	if c.hash != nil {
+		c.hash.Write(b[:n])
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		c.err = fmt.Errorf("%w: %w", errIncompleteBody, err)
+		return n, c.err
+	}
+	if c.remaining == 0 {
+		if err := c.endChunk(); err != nil {
+			c.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// nextChunk reads a chunk header, and for the final chunk the trailer
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errIncompleteBody, err)
+	}
+	sizeField, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%w: invalid chunk size %q", errIncompleteBody, sizeField)
+	}
+	if c.signer != nil {
+		signature, ok := strings.CutPrefix(strings.TrimSpace(extension), "chunk-signature=")
+		if !ok {
+			return fmt.Errorf("%w: chunk without a signature", errChunkSignatureMismatch)
+		}
+		c.signature, c.hash = signature, sha256.New()
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	c.done = true
+	if err := c.endChunk(); err != nil {
+		return err
+	}
+	if c.decodedLength >= 0 && c.decoded != c.decodedLength {
+		return fmt.Errorf("%w: decoded %d bytes, expected %d", errIncompleteBody, c.decoded, c.decodedLength)
+	}
+	return c.readTrailer()
+}
+
+// endChunk consumes the CRLF after a chunk's data and checks its signature
+func (c *chunkedReader) endChunk() error {
+	if !c.done {
+		if err := c.readCRLF(); err != nil {
+			return fmt.Errorf("%w: %w", errIncompleteBody, err)
+		}
+	}
+	if c.signer == nil {
+		return nil
+	}
+	return c.signer.verifyChunk(c.signature, c.hash.Sum(nil))
+}
+
+// readTrailer reads the trailer headers up to the closing empty line. A
+// body that ends right after the last chunk has no trailer. A signed
+// trailer ends with its signature, computed over the lines before it.
+func (c *chunkedReader) readTrailer() error {
+	var signed strings.Builder
+	signature := ""
+	for {
+		line, err := c.readLine()
+		if err == io.EOF && len(c.trailer) == 0 && signature == "" {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", errMalformedTrailer, err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%w: %q", errMalformedTrailer, line)
+		}
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if name == trailerSignatureHeader {
+			signature = value
+			continue
+		}
+		c.trailer.Add(name, value)
+		signed.WriteString(name + ":" + value + "\n")
+	}
+
+	if c.signer == nil || !c.signer.trailer {
+		return nil
+	}
+	if signature == "" {
+		return fmt.Errorf("%w: missing %s", errMalformedTrailer, trailerSignatureHeader)
+	}
+	return c.signer.verifyTrailer(signature, signed.String())
+}
+
+// Trailer returns a trailer header once the body has been read to its end
+func (c *chunkedReader) Trailer(name string) string {
+	return c.trailer.Get(name)
+}
+
+// readLine reads a CRLF-terminated line without its terminator
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		fragment, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, fragment...)
+		if len(line) > maxChunkLine {
+			return "", errors.New("line too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// readCRLF consumes the CRLF that ends a chunk's data
+func (c *chunkedReader) readCRLF() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.r, crlf[:]); err != nil {
+		return err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return errors.New("missing CRLF after chunk data")
+	}
+	return nil
+}
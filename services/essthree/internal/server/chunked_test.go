@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/sigv4"
+)
+
+const (
+	chunkAmzDate = "20130524T000000Z"
+	chunkSeed    = "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+)
+
+// chunkAuth is the verified signature a signed streaming upload starts from
+func chunkAuth() *authContext {
+	return &authContext{
+		AccessKeyID: testAccessKey,
+		Authorization: &sigv4.Authorization{
+			AccessKeyID: testAccessKey,
+			Date:        "20130524",
+			Region:      "us-east-1",
+			Service:     "s3",
+			Signature:   chunkSeed,
+		},
+		AmzDate:    chunkAmzDate,
+		SigningKey: sigv4.SigningKey(testSecretKey, "20130524", "us-east-1", "s3"),
+	}
+}
+
+// signedChunks frames chunks as a signed aws-chunked body, ending with the
+// final empty chunk. It returns the body and the last chunk signature.
+func signedChunks(auth *authContext, chunks ...string) (string, string) {
+	var body strings.Builder
+	previous := auth.Authorization.Signature
+	for _, chunk := range append(chunks, "") {
+		hash := sha256.Sum256([]byte(chunk))
+		previous = sigv4.Sign(auth.SigningKey, sigv4.ChunkStringToSign(auth.AmzDate, auth.Authorization.Scope(), previous, hex.EncodeToString(hash[:])))
+		fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n%s", len(chunk), previous, chunk)
+		if chunk != "" {
+			body.WriteString("\r\n")
+		}
+	}
+	return body.String(), previous
+}
+
+// readChunked decodes body as the aws-chunked body of a request with the
+// given payload hash and decoded length, signed by auth unless it is nil
+func readChunked(body, payloadHash string, decodedLength int, auth *authContext) (string, *chunkedReader, error) {
+	r := httptest.NewRequest(http.MethodPut, "/bucket/key", strings.NewReader(body))
+	r.Header.Set("x-amz-content-sha256", payloadHash)
+	if decodedLength >= 0 {
+		r.Header.Set("x-amz-decoded-content-length", strconv.Itoa(decodedLength))
+	}
+	if auth != nil {
+		r = r.WithContext(context.WithValue(r.Context(), authContextKey, auth))
+	}
+
+	reader := newChunkedReader(r)
+	data, err := io.ReadAll(reader)
+	return string(data), reader, err
+}
+
+func TestChunkedReader(t *testing.T) {
+	t.Run("SignedChunks", func(t *testing.T) {
+		auth := chunkAuth()
+		body, _ := signedChunks(auth, "hello ", "world")
+		data, _, err := readChunked(body, sigv4.StreamingPayload, 11, auth)
+		if err != nil {
+			t.Fatalf("Failed to read chunks: %v", err)
+		}
+		if data != "hello world" {
+			t.Errorf("Expected hello world, got %q", data)
+		}
+	})
+
+	t.Run("SignedTrailer", func(t *testing.T) {
+		auth := chunkAuth()
+		body, previous := signedChunks(auth, "hello")
+		trailer := "x-amz-checksum-crc32:NhCmhg==\n"
+		signature := sigv4.Sign(auth.SigningKey, sigv4.TrailerStringToSign(auth.AmzDate, auth.Authorization.Scope(), previous, trailer))
+		body += "x-amz-checksum-crc32:NhCmhg==\r\nx-amz-trailer-signature:" + signature + "\r\n\r\n"
+
+		_, reader, err := readChunked(body, sigv4.StreamingPayloadTrailer, 5, auth)
+		if err != nil {
+			t.Fatalf("Failed to read chunks: %v", err)
+		}
+		if got := reader.Trailer("x-amz-checksum-crc32"); got != "NhCmhg==" {
+			t.Errorf("Expected the checksum trailer, got %q", got)
+		}
+	})
+
+	t.Run("UnsignedTrailer", func(t *testing.T) {
+		body := "5\r\nhello\r\n0\r\nx-amz-checksum-crc32:NhCmhg==\r\n\r\n"
+		data, reader, err := readChunked(body, sigv4.StreamingUnsignedPayloadTrailer, 5, nil)
+		if err != nil {
+			t.Fatalf("Failed to read chunks: %v", err)
+		}
+		if data != "hello" {
+			t.Errorf("Expected hello, got %q", data)
+		}
+		if got := reader.Trailer("x-amz-checksum-crc32"); got != "NhCmhg==" {
+			t.Errorf("Expected the checksum trailer, got %q", got)
+		}
+	})
+
+	t.Run("BadChunkSignature", func(t *testing.T) {
+		auth := chunkAuth()
+		body, _ := signedChunks(auth, "hello")
+		body = strings.Replace(body, "hello", "jello", 1)
+		if _, _, err := readChunked(body, sigv4.StreamingPayload, 5, auth); !errors.Is(err, errChunkSignatureMismatch) {
+			t.Errorf("Expected errChunkSignatureMismatch, got %v", err)
+		}
+	})
+
+	t.Run("MissingChunkSignature", func(t *testing.T) {
+		body := "5\r\nhello\r\n0\r\n\r\n"
+		if _, _, err := readChunked(body, sigv4.StreamingPayload, 5, chunkAuth()); !errors.Is(err, errChunkSignatureMismatch) {
+			t.Errorf("Expected errChunkSignatureMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		for _, body := range []string{"a\r\nhello", "5\r\nhello", "5\r\nhelloXX0\r\n\r\n", "zz\r\nhello\r\n"} {
+			if _, _, err := readChunked(body, sigv4.StreamingUnsignedPayloadTrailer, -1, nil); !errors.Is(err, errIncompleteBody) {
+				t.Errorf("Expected errIncompleteBody for %q, got %v", body, err)
+			}
+		}
+	})
+
+	t.Run("DecodedLengthMismatch", func(t *testing.T) {
+		body := "5\r\nhello\r\n0\r\n\r\n"
+		if _, _, err := readChunked(body, sigv4.StreamingUnsignedPayloadTrailer, 6, nil); !errors.Is(err, errIncompleteBody) {
+			t.Errorf("Expected errIncompleteBody, got %v", err)
+		}
+	})
+
+	t.Run("MalformedTrailer", func(t *testing.T) {
+		body := "5\r\nhello\r\n0\r\nnot a header\r\n\r\n"
+		if _, _, err := readChunked(body, sigv4.StreamingUnsignedPayloadTrailer, 5, nil); !errors.Is(err, errMalformedTrailer) {
+			t.Errorf("Expected errMalformedTrailer, got %v", err)
+		}
+	})
+}
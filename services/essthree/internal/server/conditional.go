@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// checkReadConditions evaluates If-Match, If-Unmodified-Since, If-None-Match
+// and If-Modified-Since for GET and HEAD. It returns 412, 304 or 0 when the
+// request should proceed. As in S3, a true If-Match overrides a failing
+// If-Unmodified-Since, and a false If-None-Match overrides If-Modified-Since.
+func checkReadConditions(r *http.Request, meta *storage.ObjectMetadata) int {
+	lastModified := meta.LastModified.Truncate(time.Second)
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !storage.ETagMatches(ifMatch, meta.ETag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil {
+		if lastModified.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if storage.ETagMatches(ifNoneMatch, meta.ETag) {
+			return http.StatusNotModified
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		if !lastModified.After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// writeReadConditionFailure responds to a failed GET or HEAD precondition.
+// Not Modified responses carry the validators but no body.
+func (s *Server) writeReadConditionFailure(w http.ResponseWriter, r *http.Request, status int, meta *storage.ObjectMetadata) {
+	if status == http.StatusNotModified {
+		w.Header().Set("ETag", meta.ETag)
+		w.Header().Set("Last-Modified", meta.LastModified.Format(http.TimeFormat))
+		setVersionHeaders(w, meta)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	s.sendError(w, r, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold", status)
+}
+
+// writeCondition reads If-Match and If-None-Match for PutObject and
+// CompleteMultipartUpload. Only If-None-Match: * is supported on writes.
+func (s *Server) writeCondition(w http.ResponseWriter, r *http.Request) (storage.WriteCondition, bool) {
+	cond := storage.WriteCondition{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+	if cond.IfNoneMatch != "" && cond.IfNoneMatch != "*" {
+		s.sendError(w, r, "NotImplemented", "A header you provided implies functionality that is not implemented", http.StatusNotImplemented)
+		return cond, false
+	}
+	return cond, true
+}
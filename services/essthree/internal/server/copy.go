@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+type CopyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Checksums
+}
+
+type CopyPartResult struct {
+	XMLName      xml.Name  `xml:"CopyPartResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Checksums
+}
+
+// copySource identifies the object named by an x-amz-copy-source header
+type copySource struct {
+	Bucket    string
+	Key       string
+	VersionID string
+}
+
+// parseCopySource parses an x-amz-copy-source header of the form
+// [/]bucket/key[?versionId=id] with a URL-encoded key
+func parseCopySource(header string) (*copySource, error) {
+	source := strings.TrimPrefix(header, "/")
+
+	versionID := ""
+	if idx := strings.Index(source, "?"); idx >= 0 {
+		query, err := url.ParseQuery(source[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid copy source query: %w", err)
+		}
+		versionID = query.Get("versionId")
+		source = source[:idx]
+	}
+
+	decoded, err := url.PathUnescape(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid copy source encoding: %w", err)
+	}
+
+	bucket, key, found := strings.Cut(decoded, "/")
+	if !found || bucket == "" || key == "" {
+		return nil, fmt.Errorf("copy source must be of the form bucket/key")
+	}
+
+	return &copySource{Bucket: bucket, Key: key, VersionID: versionID}, nil
+}
+
+// checkCopySourceConditions evaluates the x-amz-copy-source-if-* headers
+// against the source object. A true If-Match overrides a failing
+// If-Unmodified-Since, and a false If-None-Match overrides If-Modified-Since.
+func checkCopySourceConditions(r *http.Request, meta *storage.ObjectMetadata) bool {
+	ifMatch := r.Header.Get("x-amz-copy-source-if-match")
+	ifNoneMatch := r.Header.Get("x-amz-copy-source-if-none-match")
+
+	if ifMatch != "" {
+		if !storage.ETagMatches(ifMatch, meta.ETag) {
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("x-amz-copy-source-if-unmodified-since")); err == nil {
+		if meta.LastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	if ifNoneMatch != "" {
+		if storage.ETagMatches(ifNoneMatch, meta.ETag) {
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("x-amz-copy-source-if-modified-since")); err == nil {
+		if !meta.LastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolveCopySource parses the copy source header and checks its
+// preconditions, writing an error response and returning nil on failure
+func (s *Server) resolveCopySource(w http.ResponseWriter, r *http.Request) (*copySource, *storage.ObjectMetadata) {
+	source, err := parseCopySource(r.Header.Get("x-amz-copy-source"))
+	if err != nil {
+		s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return nil, nil
+	}
+
+	action := "s3:GetObject"
+	if source.VersionID != "" {
+		action = "s3:GetObjectVersion"
+	}
+	if !s.checkAccess(r, action, source.Bucket, source.Key) {
+		s.sendError(w, r, "AccessDenied", "Access Denied", http.StatusForbidden)
+		return nil, nil
+	}
+
+	srcMeta, err := s.storage.HeadObject(source.Bucket, source.Key, source.VersionID)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return nil, nil
+	}
+
+	if !s.checkCustomerKey(w, r, srcMeta.Encryption, true) {
+		return nil, nil
+	}
+
+	if !checkCopySourceConditions(r, srcMeta) {
+		s.sendError(w, r, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold", http.StatusPreconditionFailed)
+		return nil, nil
+	}
+
+	return source, srcMeta
+}
+
+// handleCopyObject handles PUT /{bucket}/{key} with x-amz-copy-source - CopyObject
+func (s *Server) handleCopyObject(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	directive := r.Header.Get("x-amz-metadata-directive")
+	if directive == "" {
+		directive = "COPY"
+	}
+	if directive != "COPY" && directive != "REPLACE" {
+		s.sendError(w, r, "InvalidArgument", "Unknown metadata directive.", http.StatusBadRequest)
+		return
+	}
+
+	taggingDirective := r.Header.Get("x-amz-tagging-directive")
+	if taggingDirective == "" {
+		taggingDirective = "COPY"
+	}
+	if taggingDirective != "COPY" && taggingDirective != "REPLACE" {
+		s.sendError(w, r, "InvalidArgument", "Unknown tagging directive.", http.StatusBadRequest)
+		return
+	}
+
+	source, srcMeta := s.resolveCopySource(w, r)
+	if source == nil {
+		return
+	}
+
+	tags := srcMeta.Tags
+	if taggingDirective == "REPLACE" {
+		var ok bool
+		if tags, ok = s.requestTags(w, r); !ok {
+			return
+		}
+	}
+
+	metadata := srcMeta.Metadata
+	contentType := srcMeta.ContentType
+	if directive == "REPLACE" {
+		metadata = extractMetadata(r)
+		contentType = r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	} else if source.Bucket == bucket && source.Key == key && source.VersionID == "" && taggingDirective == "COPY" && !hasEncryptionHeaders(r) && r.Header.Get(storageClassHeader) == "" {
+		s.sendError(w, r, "InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.", http.StatusBadRequest)
+		return
+	}
+
+	acl, ok := s.requestACL(w, r)
+	if !ok {
+		return
+	}
+
+	enc, ok := s.requestEncryption(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	retention, legalHold, ok := s.requestObjectLock(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	// As in S3, a website redirect is not copied from the source
+	redirect, ok := s.requestWebsiteRedirect(w, r)
+	if !ok {
+		return
+	}
+
+	// As in S3, the copy is STANDARD unless another storage class is asked for
+	class, ok := s.requestStorageClass(w, r)
+	if !ok {
+		return
+	}
+
+	// The copy keeps the source's checksum algorithm unless another is asked for
+	opts := storage.PutOptions{Tags: tags, ACL: acl, Encryption: enc, Retention: retention, LegalHold: legalHold, WebsiteRedirect: redirect, StorageClass: class}
+	algorithm, ok := s.requestChecksumAlgorithm(w, r)
+	if !ok {
+		return
+	}
+	if algorithm == "" && srcMeta.Checksum != nil {
+		algorithm = srcMeta.Checksum.Algorithm
+	}
+	if algorithm != "" {
+		opts.Checksum = &storage.Checksum{Algorithm: algorithm}
+	}
+
+	objMeta, err := s.storage.CopyObject(source.Bucket, source.Key, source.VersionID, bucket, key, metadata, contentType, opts)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	s.notifyEvent(r, bucket, "ObjectCreated:Copy", objectInfo(objMeta))
+
+	result := CopyObjectResult{
+		Xmlns:        "http://s3.amazonaws.com/doc/2006-03-01/",
+		LastModified: objMeta.LastModified,
+		ETag:         objMeta.ETag,
+	}
+	if objMeta.Checksum != nil {
+		result.Checksums = newChecksums(objMeta.Checksum.Algorithm, objMeta.Checksum.Value)
+	}
+
+	if srcMeta.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", srcMeta.VersionID)
+	}
+	setVersionHeaders(w, objMeta)
+	setEncryptionHeaders(w, objMeta.Encryption)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// parseCopySourceRange parses x-amz-copy-source-range, which unlike Range
+// only accepts bytes=first-last with both ends given and first <= last
+func parseCopySourceRange(value string) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(value, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || first == "" || last == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// handleUploadPartCopy handles PUT /{bucket}/{key}?partNumber=X&uploadId=Y
+// with x-amz-copy-source - UploadPartCopy
+func (s *Server) handleUploadPartCopy(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+	uploadID := r.URL.Query().Get("uploadId")
+
+	partNumber, ok := s.partNumberParam(w, r)
+	if !ok {
+		return
+	}
+
+	source, srcMeta := s.resolveCopySource(w, r)
+	if source == nil {
+		return
+	}
+
+	// The copy range must name both ends and lie within the source object
+	rangeStart, rangeEnd := int64(0), int64(-1)
+	if rangeHeader := r.Header.Get("x-amz-copy-source-range"); rangeHeader != "" {
+		var ok bool
+		rangeStart, rangeEnd, ok = parseCopySourceRange(rangeHeader)
+		if !ok {
+			s.sendError(w, r, "InvalidArgument", fmt.Sprintf("Range specified is not valid for source object of size: %d", srcMeta.Size), http.StatusBadRequest)
+			return
+		}
+		if rangeEnd >= srcMeta.Size {
+			s.sendError(w, r, "InvalidRange", "The requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	upload, err := s.storage.GetMultipartUpload(bucket, key, uploadID)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if !s.checkCustomerKey(w, r, upload.Encryption, false) {
+		return
+	}
+
+	part, err := s.storage.UploadPartCopy(bucket, key, uploadID, partNumber, source.Bucket, source.Key, source.VersionID, rangeStart, rangeEnd)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	result := CopyPartResult{
+		Xmlns:        "http://s3.amazonaws.com/doc/2006-03-01/",
+		LastModified: time.Now().UTC(),
+		ETag:         fmt.Sprintf("\"%s\"", part.ETag),
+	}
+	if part.Checksum != "" {
+		result.Checksums = newChecksums(upload.Checksum.Algorithm, part.Checksum)
+	}
+
+	if srcMeta.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", srcMeta.VersionID)
+	}
+	setEncryptionHeaders(w, upload.Encryption)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// readObject returns the body and metadata of the current version of key
+func readObject(t *testing.T, store storage.Storage, bucket, key string) (string, *storage.ObjectMetadata) {
+	t.Helper()
+	reader, meta, err := store.GetObject(bucket, key, "")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", key, err)
+	}
+	return string(data), meta
+}
+
+func TestCopyObject(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	for _, bucket := range []string{"src-bucket", "dst-bucket"} {
+		if err := store.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+	}
+	if _, err := store.UpdateBucket("src-bucket", func(info *storage.BucketInfo) error {
+		info.Versioning = storage.VersioningEnabled
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+
+	srcKey := "dir/my file.txt"
+	first, err := store.PutObject("src-bucket", srcKey, strings.NewReader("first"), map[string]string{"color": "blue"}, "text/plain", storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	current, err := store.PutObject("src-bucket", srcKey, strings.NewReader("second"), map[string]string{"color": "blue"}, "text/plain", storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	source := "/src-bucket/dir/my%20file.txt"
+
+	t.Run("MetadataDirectiveCopy", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/dst-bucket/copy.txt", nil, map[string]string{
+			"x-amz-copy-source": source,
+			"x-amz-meta-color":  "red",
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result CopyObjectResult
+		decodeBody(t, rec, &result)
+		if result.ETag != current.ETag {
+			t.Errorf("Expected ETag %s, got %s", current.ETag, result.ETag)
+		}
+
+		body, meta := readObject(t, store, "dst-bucket", "copy.txt")
+		if body != "second" || meta.ContentType != "text/plain" || meta.Metadata["color"] != "blue" {
+			t.Errorf("Expected the source's body and metadata, got %q, %s and %v", body, meta.ContentType, meta.Metadata)
+		}
+	})
+
+	t.Run("MetadataDirectiveReplace", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/dst-bucket/replaced.txt", nil, map[string]string{
+			"x-amz-copy-source":        source,
+			"x-amz-metadata-directive": "REPLACE",
+			"x-amz-meta-size":          "large",
+			"Content-Type":             "application/json",
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		body, meta := readObject(t, store, "dst-bucket", "replaced.txt")
+		if body != "second" || meta.ContentType != "application/json" {
+			t.Errorf("Expected the source's body as application/json, got %q as %s", body, meta.ContentType)
+		}
+		if len(meta.Metadata) != 1 || meta.Metadata["size"] != "large" {
+			t.Errorf("Expected only the request's metadata, got %v", meta.Metadata)
+		}
+	})
+
+	t.Run("InvalidDirective", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/dst-bucket/bad.txt", nil, map[string]string{
+			"x-amz-copy-source":        source,
+			"x-amz-metadata-directive": "MERGE",
+		})
+		expectError(t, rec, http.StatusBadRequest, "InvalidArgument")
+	})
+
+	t.Run("CopySourceConditions", func(t *testing.T) {
+		past := current.LastModified.Add(-time.Hour).UTC().Format(http.TimeFormat)
+		future := current.LastModified.Add(time.Hour).UTC().Format(http.TimeFormat)
+		cases := []struct {
+			name   string
+			header string
+			value  string
+			status int
+		}{
+			{"IfMatch", "x-amz-copy-source-if-match", current.ETag, http.StatusOK},
+			{"IfMatchFails", "x-amz-copy-source-if-match", `"0123"`, http.StatusPreconditionFailed},
+			{"IfNoneMatch", "x-amz-copy-source-if-none-match", `"0123"`, http.StatusOK},
+			{"IfNoneMatchFails", "x-amz-copy-source-if-none-match", current.ETag, http.StatusPreconditionFailed},
+			{"IfModifiedSince", "x-amz-copy-source-if-modified-since", past, http.StatusOK},
+			{"IfModifiedSinceFails", "x-amz-copy-source-if-modified-since", future, http.StatusPreconditionFailed},
+			{"IfUnmodifiedSince", "x-amz-copy-source-if-unmodified-since", future, http.StatusOK},
+			{"IfUnmodifiedSinceFails", "x-amz-copy-source-if-unmodified-since", past, http.StatusPreconditionFailed},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				rec := do(handler, http.MethodPut, "/dst-bucket/conditional.txt", nil, map[string]string{
+					"x-amz-copy-source": source,
+					tc.header:           tc.value,
+				})
+				if rec.Code != tc.status {
+					t.Fatalf("Expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+				}
+				if tc.status == http.StatusPreconditionFailed {
+					expectError(t, rec, tc.status, "PreconditionFailed")
+				}
+			})
+		}
+	})
+
+	t.Run("EncodedKeyWithVersionID", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/dst-bucket/old.txt", nil, map[string]string{
+			"x-amz-copy-source": source + "?versionId=" + first.VersionID,
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("x-amz-copy-source-version-id"); got != first.VersionID {
+			t.Errorf("Expected source version %s, got %s", first.VersionID, got)
+		}
+		if body, _ := readObject(t, store, "dst-bucket", "old.txt"); body != "first" {
+			t.Errorf("Expected the first version's body, got %q", body)
+		}
+	})
+
+	t.Run("NoSuchKey", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/dst-bucket/missing.txt", nil, map[string]string{
+			"x-amz-copy-source": "/src-bucket/dir/missing.txt",
+		})
+		expectError(t, rec, http.StatusNotFound, "NoSuchKey")
+	})
+}
+
+func TestUploadPartCopy(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("part-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.PutObject("part-bucket", "digits.txt", strings.NewReader("0123456789"), nil, "text/plain", storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	upload, err := store.CreateMultipartUpload("part-bucket", "mp.bin", "", nil, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	target := "/part-bucket/mp.bin?partNumber=1&uploadId=" + upload.UploadID
+
+	copyPart := func(target, copyRange string) *httptest.ResponseRecorder {
+		headers := map[string]string{"x-amz-copy-source": "/part-bucket/digits.txt"}
+		if copyRange != "" {
+			headers["x-amz-copy-source-range"] = copyRange
+		}
+		return do(handler, http.MethodPut, target, nil, headers)
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		rec := copyPart(target, "bytes=2-5")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result CopyPartResult
+		decodeBody(t, rec, &result)
+		sum := md5.Sum([]byte("2345"))
+		if want := `"` + hex.EncodeToString(sum[:]) + `"`; result.ETag != want {
+			t.Errorf("Expected ETag %s, got %s", want, result.ETag)
+		}
+
+		parts, err := store.ListParts("part-bucket", "mp.bin", upload.UploadID, 0, 1000)
+		if err != nil {
+			t.Fatalf("ListParts failed: %v", err)
+		}
+		if len(parts.Parts) != 1 || parts.Parts[0].Size != 4 {
+			t.Errorf("Expected one part of 4 bytes, got %+v", parts.Parts)
+		}
+	})
+
+	t.Run("WholeObject", func(t *testing.T) {
+		if rec := copyPart(target, ""); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("OutOfBounds", func(t *testing.T) {
+		rec := copyPart(target, "bytes=5-10")
+		expectError(t, rec, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+	})
+
+	for _, copyRange := range []string{"bytes=5-", "bytes=-5", "bytes=5-2", "bytes=a-b", "5-6"} {
+		t.Run("Malformed"+copyRange, func(t *testing.T) {
+			expectError(t, copyPart(target, copyRange), http.StatusBadRequest, "InvalidArgument")
+		})
+	}
+
+	t.Run("NoSuchUpload", func(t *testing.T) {
+		expectError(t, copyPart("/part-bucket/mp.bin?partNumber=1&uploadId=missing", ""), http.StatusNotFound, "NoSuchUpload")
+	})
+
+	for _, partNumber := range []string{"0", "10001", "abc"} {
+		t.Run("PartNumber"+partNumber, func(t *testing.T) {
+			rec := copyPart("/part-bucket/mp.bin?partNumber="+partNumber+"&uploadId="+upload.UploadID, "")
+			expectError(t, rec, http.StatusBadRequest, "InvalidArgument")
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// maxCORSRules is the S3 limit on rules per configuration
+const maxCORSRules = 100
+
+// corsMethods are the methods a CORS rule may allow
+var corsMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodHead:   true,
+	http.MethodPost:   true,
+	http.MethodDelete: true,
+}
+
+type CORSConfiguration struct {
+	XMLName xml.Name   `xml:"CORSConfiguration"`
+	Xmlns   string     `xml:"xmlns,attr,omitempty"`
+	Rules   []CORSRule `xml:"CORSRule"`
+}
+
+type CORSRule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedHeaders []string `xml:"AllowedHeader"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+// cors answers preflight OPTIONS requests and adds Access-Control-* headers
+// to requests from an origin allowed by the bucket's CORS rules. It runs
+// before authentication because browsers never sign preflights.
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := s.requestBucket(r)
+		if bucket == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodOptions {
+			s.handlePreflight(w, r, bucket)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if info, err := s.storage.HeadBucket(bucket); err == nil {
+				if rule := matchCORSRule(info.CORSRules, origin, r.Method, nil); rule != nil {
+					setCORSHeaders(w, rule, origin)
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestBucket returns the bucket a request addresses, from a virtual host
+// or the first path segment, or "" for service-level and admin requests
+func (s *Server) requestBucket(r *http.Request) string {
+	if bucket := s.bucketFromHost(r.Host); bucket != "" {
+		return bucket
+	}
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "health" || bucket == "admin" {
+		return ""
+	}
+	return bucket
+}
+
+// handlePreflight handles OPTIONS /{bucket}/{key} - a CORS preflight request
+func (s *Server) handlePreflight(w http.ResponseWriter, r *http.Request, bucket string) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		s.sendError(w, r, "BadRequest", "Insufficient information. Origin request header needed.", http.StatusBadRequest)
+		return
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if method == "" {
+		s.sendError(w, r, "BadRequest", "Invalid Access-Control-Request-Method: null", http.StatusBadRequest)
+		return
+	}
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if len(info.CORSRules) == 0 {
+		s.sendError(w, r, "AccessForbidden", "CORSResponse: CORS is not enabled for this bucket.", http.StatusForbidden)
+		return
+	}
+
+	var headers []string
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+
+	rule := matchCORSRule(info.CORSRules, origin, method, headers)
+	if rule == nil {
+		s.sendError(w, r, "AccessForbidden", "CORSResponse: This CORS request is not allowed. This is usually because the evalution of Origin, request method / Access-Control-Request-Method or Access-Control-Request-Headers are not whitelisted by the resource's CORS spec.", http.StatusForbidden)
+		return
+	}
+
+	setCORSHeaders(w, rule, origin)
+	if len(headers) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// matchCORSRule returns the first rule that allows origin, method and every
+// requested header, or nil
+func matchCORSRule(rules []storage.CORSRule, origin, method string, headers []string) *storage.CORSRule {
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.MatchesOrigin(origin, method) {
+			continue
+		}
+		allowed := true
+		for _, header := range headers {
+			if !rule.AllowsHeader(header) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return rule
+		}
+	}
+	return nil
+}
+
+// setCORSHeaders writes the Access-Control-* headers for a matched rule
+func setCORSHeaders(w http.ResponseWriter, rule *storage.CORSRule, origin string) {
+	h := w.Header()
+	if containsString(rule.AllowedOrigins, "*") {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(rule.ExposeHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+	}
+	if rule.MaxAgeSeconds > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAgeSeconds))
+	}
+	h.Set("Vary", "Origin, Access-Control-Request-Headers, Access-Control-Request-Method")
+}
+
+// parseCORSRule validates one XML rule and converts it to its stored form
+func parseCORSRule(rule CORSRule) (storage.CORSRule, error) {
+	if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+		return storage.CORSRule{}, errMalformedXML
+	}
+	for _, method := range rule.AllowedMethods {
+		if !corsMethods[method] {
+			return storage.CORSRule{}, fmt.Errorf("Found unsupported HTTP method in CORS config. Unsupported method is %s", method)
+		}
+	}
+	for _, origin := range rule.AllowedOrigins {
+		if strings.Count(origin, "*") > 1 {
+			return storage.CORSRule{}, fmt.Errorf("AllowedOrigin %q can not have more than one wildcard.", origin)
+		}
+	}
+	for _, header := range rule.AllowedHeaders {
+		if strings.Count(header, "*") > 1 {
+			return storage.CORSRule{}, fmt.Errorf("AllowedHeader %q can not have more than one wildcard.", header)
+		}
+	}
+	if rule.MaxAgeSeconds < 0 {
+		return storage.CORSRule{}, errMalformedXML
+	}
+
+	return storage.CORSRule{
+		ID:             rule.ID,
+		AllowedOrigins: rule.AllowedOrigins,
+		AllowedMethods: rule.AllowedMethods,
+		AllowedHeaders: rule.AllowedHeaders,
+		ExposeHeaders:  rule.ExposeHeaders,
+		MaxAgeSeconds:  rule.MaxAgeSeconds,
+	}, nil
+}
+
+// handlePutBucketCors handles PUT /{bucket}?cors
+func (s *Server) handlePutBucketCors(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config CORSConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(config.Rules) == 0 || len(config.Rules) > maxCORSRules {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules := make([]storage.CORSRule, 0, len(config.Rules))
+	for _, xmlRule := range config.Rules {
+		rule, err := parseCORSRule(xmlRule)
+		if errors.Is(err, errMalformedXML) {
+			s.sendError(w, r, "MalformedXML", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.sendError(w, r, "InvalidRequest", err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.CORSRules = rules
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketCors handles GET /{bucket}?cors
+func (s *Server) handleGetBucketCors(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if len(info.CORSRules) == 0 {
+		s.sendError(w, r, "NoSuchCORSConfiguration", "The CORS configuration does not exist", http.StatusNotFound)
+		return
+	}
+
+	result := CORSConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	for _, rule := range info.CORSRules {
+		result.Rules = append(result.Rules, CORSRule{
+			ID:             rule.ID,
+			AllowedHeaders: rule.AllowedHeaders,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedOrigins: rule.AllowedOrigins,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteBucketCors handles DELETE /{bucket}?cors
+func (s *Server) handleDeleteBucketCors(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.CORSRules = nil
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestCORS(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	for _, bucket := range []string{"cors-bucket", "plain-bucket"} {
+		if err := store.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+	}
+	if _, err := store.PutObject("cors-bucket", "page.html", strings.NewReader("<html></html>"), nil, "text/html", storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if _, err := store.UpdateBucket("cors-bucket", func(info *storage.BucketInfo) error {
+		info.CORSRules = []storage.CORSRule{
+			{
+				AllowedOrigins: []string{"https://app.example.com"},
+				AllowedMethods: []string{http.MethodGet, http.MethodPut},
+				AllowedHeaders: []string{"content-*"},
+				ExposeHeaders:  []string{"ETag"},
+				MaxAgeSeconds:  600,
+			},
+			{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{http.MethodGet},
+			},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateBucket failed: %v", err)
+	}
+
+	preflight := func(origin, method, headers string) map[string]string {
+		request := map[string]string{"Origin": origin, "Access-Control-Request-Method": method}
+		if headers != "" {
+			request["Access-Control-Request-Headers"] = headers
+		}
+		return request
+	}
+
+	t.Run("AllowedPreflight", func(t *testing.T) {
+		rec := do(handler, http.MethodOptions, "/cors-bucket/page.html", nil, preflight("https://app.example.com", http.MethodPut, "Content-Type"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		for header, want := range map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, PUT",
+			"Access-Control-Allow-Headers":     "Content-Type",
+			"Access-Control-Expose-Headers":    "ETag",
+			"Access-Control-Max-Age":           "600",
+		} {
+			if got := rec.Header().Get(header); got != want {
+				t.Errorf("Expected %s %q, got %q", header, want, got)
+			}
+		}
+	})
+
+	t.Run("WildcardPreflight", func(t *testing.T) {
+		rec := do(handler, http.MethodOptions, "/cors-bucket/page.html", nil, preflight("https://other.example.com", http.MethodGet, ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+		}
+	})
+
+	t.Run("ForbiddenPreflight", func(t *testing.T) {
+		cases := []struct {
+			name    string
+			bucket  string
+			request map[string]string
+		}{
+			{"Method", "cors-bucket", preflight("https://other.example.com", http.MethodPut, "")},
+			{"Header", "cors-bucket", preflight("https://app.example.com", http.MethodPut, "x-custom")},
+			{"NoConfiguration", "plain-bucket", preflight("https://app.example.com", http.MethodGet, "")},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				rec := do(handler, http.MethodOptions, "/"+tc.bucket+"/page.html", nil, tc.request)
+				expectError(t, rec, http.StatusForbidden, "AccessForbidden")
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+				}
+			})
+		}
+	})
+
+	t.Run("PreflightWithoutOrigin", func(t *testing.T) {
+		rec := do(handler, http.MethodOptions, "/cors-bucket/page.html", nil, map[string]string{"Access-Control-Request-Method": http.MethodGet})
+		expectError(t, rec, http.StatusBadRequest, "BadRequest")
+	})
+
+	t.Run("ActualRequest", func(t *testing.T) {
+		rec := do(handler, http.MethodGet, "/cors-bucket/page.html", nil, map[string]string{"Origin": "https://app.example.com"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Expected the origin to be allowed, got %q", got)
+		}
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "ETag" {
+			t.Errorf("Expected ETag to be exposed, got %q", got)
+		}
+	})
+
+	t.Run("ActualRequestNotAllowed", func(t *testing.T) {
+		rec := do(handler, http.MethodGet, "/plain-bucket", nil, map[string]string{"Origin": "https://app.example.com"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Expected no CORS headers, got Access-Control-Allow-Origin %q", got)
+		}
+	})
+}
@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// Server-side encryption headers. The SSE-C headers are named
+// x-amz-copy-source-server-side-encryption-* when they describe the source
+// of a copy.
+const (
+	sseHeader                  = "x-amz-server-side-encryption"
+	sseKMSKeyIDHeader          = "x-amz-server-side-encryption-aws-kms-key-id"
+	sseContextHeader           = "x-amz-server-side-encryption-context"
+	sseBucketKeyHeader         = "x-amz-server-side-encryption-bucket-key-enabled"
+	sseCustomerAlgorithmHeader = "x-amz-server-side-encryption-customer-algorithm"
+	sseCustomerKeyHeader       = "x-amz-server-side-encryption-customer-key"
+	sseCustomerKeyMD5Header    = "x-amz-server-side-encryption-customer-key-MD5"
+)
+
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"ServerSideEncryptionConfiguration"`
+	Xmlns   string                     `xml:"xmlns,attr,omitempty"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault"`
+	BucketKeyEnabled                   bool                           `xml:"BucketKeyEnabled,omitempty"`
+}
+
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   string `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
+
+// isKMSAlgorithm reports whether an SSE algorithm uses KMS keys
+func isKMSAlgorithm(algorithm string) bool {
+	return algorithm == storage.SSEAlgorithmKMS || algorithm == storage.SSEAlgorithmKMSDSSE
+}
+
+// kmsKeyARN expands a KMS key ID or alias into the key ARN S3 reports. An
+// empty ID names the AWS managed key for S3.
+func (s *Server) kmsKeyARN(id string) string {
+	switch {
+	case id == "":
+		return fmt.Sprintf("arn:aws:kms:%s:%s:alias/aws/s3", s.config.Region, accountID)
+	case strings.HasPrefix(id, "arn:"):
+		return id
+	case strings.HasPrefix(id, "alias/"):
+		return fmt.Sprintf("arn:aws:kms:%s:%s:%s", s.config.Region, accountID, id)
+	default:
+		return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", s.config.Region, accountID, id)
+	}
+}
+
+// customerKey is an SSE-C key supplied with a request
+type customerKey struct {
+	key []byte
+	md5 string
+}
+
+// requestCustomerKey reads the SSE-C headers, or their copy source forms,
+// writing an error and returning false when they are incomplete or
+// inconsistent. It returns nil when the request has none of them.
+func (s *Server) requestCustomerKey(w http.ResponseWriter, r *http.Request, copySource bool) (*customerKey, bool) {
+	header := func(name string) string {
+		if copySource {
+			name = "x-amz-copy-source-" + strings.TrimPrefix(name, "x-amz-")
+		}
+		return r.Header.Get(name)
+	}
+	algorithm := header(sseCustomerAlgorithmHeader)
+	encodedKey := header(sseCustomerKeyHeader)
+	keyMD5 := header(sseCustomerKeyMD5Header)
+	if algorithm == "" && encodedKey == "" && keyMD5 == "" {
+		return nil, true
+	}
+
+	switch {
+	case algorithm == "":
+		s.sendError(w, r, "InvalidArgument", "Requests specifying Server Side Encryption with Customer provided keys must provide a valid encryption algorithm.", http.StatusBadRequest)
+		return nil, false
+	case algorithm != storage.SSEAlgorithmAES256:
+		s.sendError(w, r, "InvalidEncryptionAlgorithmError", "The encryption request you specified is not valid. The valid value is AES256.", http.StatusBadRequest)
+		return nil, false
+	case encodedKey == "":
+		s.sendError(w, r, "InvalidArgument", "Requests specifying Server Side Encryption with Customer provided keys must provide an appropriate secret key.", http.StatusBadRequest)
+		return nil, false
+	case keyMD5 == "":
+		s.sendError(w, r, "InvalidArgument", "Requests specifying Server Side Encryption with Customer provided keys must provide the client calculated MD5 of the secret key.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		s.sendError(w, r, "InvalidArgument", "The secret key was invalid for the specified algorithm.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	sum := md5.Sum(key)
+	if expected, err := base64.StdEncoding.DecodeString(keyMD5); err != nil || !bytes.Equal(expected, sum[:]) {
+		s.sendError(w, r, "InvalidArgument", "The calculated MD5 hash of the key did not match the hash that was provided.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &customerKey{key: key, md5: keyMD5}, true
+}
+
+// requestEncryption returns the encryption a write asks for through its SSE
+// or SSE-C headers, falling back to the bucket's default encryption. It
+// returns nil when the object is stored unencrypted, and writes an error
+// and returns false when the headers are invalid.
+func (s *Server) requestEncryption(w http.ResponseWriter, r *http.Request, bucket string) (*storage.Encryption, bool) {
+	ckey, ok := s.requestCustomerKey(w, r, false)
+	if !ok {
+		return nil, false
+	}
+
+	algorithm := r.Header.Get(sseHeader)
+	kmsKeyID := r.Header.Get(sseKMSKeyIDHeader)
+	switch {
+	case ckey != nil && algorithm != "":
+		s.sendError(w, r, "InvalidArgument", "Server Side Encryption with Customer provided key is incompatible with the encryption method specified", http.StatusBadRequest)
+		return nil, false
+	case algorithm != "" && algorithm != storage.SSEAlgorithmAES256 && !isKMSAlgorithm(algorithm):
+		s.sendError(w, r, "InvalidArgument", "The encryption method specified is not supported", http.StatusBadRequest)
+		return nil, false
+	case (kmsKeyID != "" || r.Header.Get(sseContextHeader) != "") && !isKMSAlgorithm(algorithm):
+		s.sendError(w, r, "InvalidArgument", "Server Side Encryption with AWS KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if ckey != nil {
+		return &storage.Encryption{
+			CustomerAlgorithm: storage.SSEAlgorithmAES256,
+			CustomerKeyMD5:    ckey.md5,
+			CustomerKey:       ckey.key,
+		}, true
+	}
+
+	if algorithm == "" {
+		info, err := s.storage.HeadBucket(bucket)
+		if err != nil || info.DefaultEncryption == nil {
+			return nil, true
+		}
+		enc := &storage.Encryption{
+			Algorithm:        info.DefaultEncryption.Algorithm,
+			BucketKeyEnabled: info.DefaultEncryption.BucketKeyEnabled,
+		}
+		if isKMSAlgorithm(enc.Algorithm) {
+			enc.KMSKeyID = s.kmsKeyARN(info.DefaultEncryption.KMSKeyID)
+		}
+		return enc, true
+	}
+
+	enc := &storage.Encryption{Algorithm: algorithm}
+	if isKMSAlgorithm(algorithm) {
+		enc.KMSKeyID = s.kmsKeyARN(kmsKeyID)
+		enc.KMSContext = r.Header.Get(sseContextHeader)
+		enc.BucketKeyEnabled = strings.EqualFold(r.Header.Get(sseBucketKeyHeader), "true")
+	}
+	return enc, true
+}
+
+// hasEncryptionHeaders reports whether a request names an encryption for the
+// object it writes
+func hasEncryptionHeaders(r *http.Request) bool {
+	return r.Header.Get(sseHeader) != "" || r.Header.Get(sseCustomerAlgorithmHeader) != ""
+}
+
+// checkCustomerKey verifies that a request reading an object, or writing a
+// part of an upload, supplies the SSE-C key the data was written with, and
+// no key when it was not. copySource selects the copy source headers. It
+// writes an error and returns false on mismatch.
+func (s *Server) checkCustomerKey(w http.ResponseWriter, r *http.Request, enc *storage.Encryption, copySource bool) bool {
+	ckey, ok := s.requestCustomerKey(w, r, copySource)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case enc.IsCustomerKey() && ckey == nil:
+		s.sendError(w, r, "InvalidRequest", "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.", http.StatusBadRequest)
+		return false
+	case enc.IsCustomerKey() && !enc.MatchesCustomerKey(ckey.key):
+		s.sendError(w, r, "AccessDenied", "Access Denied", http.StatusForbidden)
+		return false
+	case !enc.IsCustomerKey() && ckey != nil:
+		s.sendError(w, r, "InvalidRequest", "The encryption parameters are not applicable to this object.", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// setEncryptionHeaders reports how an object is encrypted
+func setEncryptionHeaders(w http.ResponseWriter, enc *storage.Encryption) {
+	switch {
+	case enc == nil:
+	case enc.IsCustomerKey():
+		w.Header().Set(sseCustomerAlgorithmHeader, enc.CustomerAlgorithm)
+		w.Header().Set(sseCustomerKeyMD5Header, enc.CustomerKeyMD5)
+	default:
+		w.Header().Set(sseHeader, enc.Algorithm)
+		if enc.KMSKeyID != "" {
+			w.Header().Set(sseKMSKeyIDHeader, enc.KMSKeyID)
+		}
+		if enc.KMSContext != "" {
+			w.Header().Set(sseContextHeader, enc.KMSContext)
+		}
+		if enc.BucketKeyEnabled {
+			w.Header().Set(sseBucketKeyHeader, "true")
+		}
+	}
+}
+
+// handlePutBucketEncryption handles PUT /{bucket}?encryption
+func (s *Server) handlePutBucketEncryption(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config ServerSideEncryptionConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(config.Rules) != 1 || config.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule := config.Rules[0]
+	byDefault := rule.ApplyServerSideEncryptionByDefault
+	switch {
+	case byDefault.SSEAlgorithm != storage.SSEAlgorithmAES256 && !isKMSAlgorithm(byDefault.SSEAlgorithm):
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	case byDefault.KMSMasterKeyID != "" && !isKMSAlgorithm(byDefault.SSEAlgorithm):
+		s.sendError(w, r, "InvalidArgument", "a KMSMasterKeyID is not applicable if the default sse algorithm is not aws:kms or aws:kms:dsse", http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.DefaultEncryption = &storage.BucketEncryption{
+			Algorithm:        byDefault.SSEAlgorithm,
+			KMSKeyID:         byDefault.KMSMasterKeyID,
+			BucketKeyEnabled: rule.BucketKeyEnabled,
+		}
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketEncryption handles GET /{bucket}?encryption
+func (s *Server) handleGetBucketEncryption(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	enc := info.DefaultEncryption
+	if enc == nil {
+		s.sendError(w, r, "ServerSideEncryptionConfigurationNotFoundError", "The server side encryption configuration was not found", http.StatusNotFound)
+		return
+	}
+
+	result := ServerSideEncryptionConfiguration{
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Rules: []ServerSideEncryptionRule{{
+			ApplyServerSideEncryptionByDefault: &ServerSideEncryptionByDefault{
+				SSEAlgorithm:   enc.Algorithm,
+				KMSMasterKeyID: enc.KMSKeyID,
+			},
+			BucketKeyEnabled: enc.BucketKeyEnabled,
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteBucketEncryption handles DELETE /{bucket}?encryption
+func (s *Server) handleDeleteBucketEncryption(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.DefaultEncryption = nil
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,9 +4,11 @@ package server
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -18,18 +20,22 @@ import (
 // S3 XML response structures
 
 type ListBucketResult struct {
-	XMLName               xml.Name   `xml:"ListBucketResult"`
-	Xmlns                 string     `xml:"xmlns,attr"`
-	Name                  string     `xml:"Name"`
-	Prefix                string     `xml:"Prefix"`
-	Marker                string     `xml:"Marker,omitempty"`
-	NextMarker            string     `xml:"NextMarker,omitempty"`
-	MaxKeys               int        `xml:"MaxKeys"`
-	IsTruncated           bool       `xml:"IsTruncated"`
-	Contents              []Contents `xml:"Contents"`
-	KeyCount              int        `xml:"KeyCount,omitempty"`
-	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
-	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []Contents     `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
 }
 
 type Contents struct {
@@ -38,6 +44,11 @@ type Contents struct {
 	ETag         string    `xml:"ETag"`
 	Size         int64     `xml:"Size"`
 	StorageClass string    `xml:"StorageClass"`
+	Owner        *Owner    `xml:"Owner,omitempty"`
+}
+
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
 }
 
 type Error struct {
@@ -46,6 +57,12 @@ type Error struct {
 	Message   string   `xml:"Message"`
 	Resource  string   `xml:"Resource"`
 	RequestId string   `xml:"RequestId"`
+
+	// Signature debugging details, only set for SignatureDoesNotMatch
+	AWSAccessKeyId    string `xml:"AWSAccessKeyId,omitempty"`
+	StringToSign      string `xml:"StringToSign,omitempty"`
+	SignatureProvided string `xml:"SignatureProvided,omitempty"`
+	CanonicalRequest  string `xml:"CanonicalRequest,omitempty"`
 }
 
 type InitiateMultipartUploadResult struct {
@@ -64,6 +81,7 @@ type CompleteMultipartUploadRequest struct {
 type CompletePart struct {
 	PartNumber int    `xml:"PartNumber"`
 	ETag       string `xml:"ETag"`
+	Checksums
 }
 
 type CompleteMultipartUploadResult struct {
@@ -73,6 +91,8 @@ type CompleteMultipartUploadResult struct {
 	Bucket   string   `xml:"Bucket"`
 	Key      string   `xml:"Key"`
 	ETag     string   `xml:"ETag"`
+	Checksums
+	ChecksumType string `xml:"ChecksumType,omitempty"`
 }
 
 type DeleteRequest struct {
@@ -82,7 +102,8 @@ type DeleteRequest struct {
 }
 
 type DeleteObject struct {
-	Key string `xml:"Key"`
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId,omitempty"`
 }
 
 type DeleteResult struct {
@@ -93,29 +114,38 @@ type DeleteResult struct {
 }
 
 type DeletedObject struct {
-	Key string `xml:"Key"`
+	Key                   string `xml:"Key"`
+	VersionId             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionId string `xml:"DeleteMarkerVersionId,omitempty"`
 }
 
 type DeleteError struct {
-	Key     string `xml:"Key"`
-	Code    string `xml:"Code"`
-	Message string `xml:"Message"`
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
 }
 
 // handleListObjects handles GET /{bucket} - ListObjects V1 and V2
 func (s *Server) handleListObjects(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	prefix := r.URL.Query().Get("prefix")
-	maxKeysStr := r.URL.Query().Get("max-keys")
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
 
 	// Check if this is V2 or V1
-	listType := r.URL.Query().Get("list-type")
+	listType := query.Get("list-type")
 
-	maxKeys := 1000
-	if maxKeysStr != "" {
-		if mk, err := strconv.Atoi(maxKeysStr); err == nil {
-			maxKeys = mk
-		}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s.sendError(w, r, "InvalidArgument", "Invalid Encoding Method specified in Request", http.StatusBadRequest)
+		return
+	}
+
+	maxKeys, ok := s.maxListEntries(w, r, "max-keys")
+	if !ok {
+		return
 	}
 
 	var result *storage.ListResult
@@ -123,56 +153,75 @@ func (s *Server) handleListObjects(w http.ResponseWriter, r *http.Request) {
 
 	if listType == "2" {
 		// ListObjectsV2
-		continuationToken := r.URL.Query().Get("continuation-token")
-		result, err = s.storage.ListObjectsV2(bucket, prefix, continuationToken, maxKeys)
+		continuationToken := query.Get("continuation-token")
+		startAfter := query.Get("start-after")
+		result, err = s.storage.ListObjectsV2(bucket, prefix, delimiter, continuationToken, startAfter, maxKeys)
 	} else {
 		// ListObjectsV1
-		marker := r.URL.Query().Get("marker")
-		result, err = s.storage.ListObjects(bucket, prefix, marker, maxKeys)
+		marker := query.Get("marker")
+		result, err = s.storage.ListObjects(bucket, prefix, delimiter, marker, maxKeys)
 	}
 
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	// V1 always reports the owner, V2 only when fetch-owner=true
+	var owner *Owner
+	if listType != "2" || query.Get("fetch-owner") == "true" {
+		owner = &Owner{ID: ownerID, DisplayName: ownerDisplayName}
+	}
+
+	encode := func(value string) string {
+		return encodeListValue(value, encodingType)
+	}
+
 	contents := make([]Contents, len(result.Objects))
 	for i, obj := range result.Objects {
 		contents[i] = Contents{
-			Key:          obj.Key,
+			Key:          encode(obj.Key),
 			LastModified: obj.LastModified,
 			ETag:         obj.ETag,
 			Size:         obj.Size,
-			StorageClass: "STANDARD",
+			StorageClass: storageClass(obj.StorageClass),
+			Owner:        owner,
 		}
 	}
 
+	commonPrefixes := make([]CommonPrefix, len(result.CommonPrefixes))
+	for i, commonPrefix := range result.CommonPrefixes {
+		commonPrefixes[i] = CommonPrefix{Prefix: encode(commonPrefix)}
+	}
+
 	response := ListBucketResult{
-		Xmlns:       "http://s3.amazonaws.com/doc/2006-03-01/",
-		Name:        bucket,
-		Prefix:      prefix,
-		MaxKeys:     maxKeys,
-		IsTruncated: result.IsTruncated,
-		Contents:    contents,
+		Xmlns:          "http://s3.amazonaws.com/doc/2006-03-01/",
+		Name:           bucket,
+		Prefix:         encode(prefix),
+		Delimiter:      encode(delimiter),
+		MaxKeys:        maxKeys,
+		EncodingType:   encodingType,
+		IsTruncated:    result.IsTruncated,
+		Contents:       contents,
+		CommonPrefixes: commonPrefixes,
 	}
 
 	if listType == "2" {
 		// V2 specific fields
-		response.KeyCount = len(contents)
+		response.KeyCount = len(contents) + len(commonPrefixes)
 		if result.IsTruncated {
 			response.NextContinuationToken = result.NextContinuationToken
 		}
-		if r.URL.Query().Get("continuation-token") != "" {
-			response.ContinuationToken = r.URL.Query().Get("continuation-token")
+		if query.Get("continuation-token") != "" {
+			response.ContinuationToken = query.Get("continuation-token")
 		}
+		response.StartAfter = encode(query.Get("start-after"))
 	} else {
 		// V1 specific fields
 		if result.IsTruncated {
-			response.NextMarker = result.NextMarker
-		}
-		if r.URL.Query().Get("marker") != "" {
-			response.Marker = r.URL.Query().Get("marker")
+			response.NextMarker = encode(result.NextMarker)
 		}
+		response.Marker = encode(query.Get("marker"))
 	}
 
 	w.Header().Set("Content-Type", "application/xml")
@@ -180,14 +229,28 @@ func (s *Server) handleListObjects(w http.ResponseWriter, r *http.Request) {
 	xml.NewEncoder(w).Encode(response)
 }
 
+// encodeListValue applies encoding-type=url to keys and prefixes in listings
+func encodeListValue(value, encodingType string) string {
+	if encodingType != "url" {
+		return value
+	}
+	return strings.ReplaceAll(url.QueryEscape(value), "%2F", "/")
+}
+
 // handleGetObject handles GET /{bucket}/{key} - GetObject with range support
 func (s *Server) handleGetObject(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
+	versionID := r.URL.Query().Get("versionId")
 
 	// Check for Range header
 	rangeHeader := r.Header.Get("Range")
 
+	partNumber, ok := s.partNumberQuery(w, r)
+	if !ok {
+		return
+	}
+
 	if rangeHeader != "" {
 		// Parse range header
 		rangeStart, rangeEnd, err := parseRangeHeader(rangeHeader)
@@ -196,17 +259,22 @@ func (s *Server) handleGetObject(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		reader, metadata, start, end, err := s.storage.GetObjectRange(bucket, key, rangeStart, rangeEnd)
+		reader, metadata, start, end, err := s.storage.GetObjectRange(bucket, key, versionID, rangeStart, rangeEnd)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				s.sendError(w, r, "NoSuchKey", "The specified key does not exist", http.StatusNotFound)
-			} else {
-				s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
-			}
+			s.sendStorageError(w, r, err)
 			return
 		}
 		defer reader.Close()
 
+		if !s.checkCustomerKey(w, r, metadata.Encryption, false) {
+			return
+		}
+
+		if status := checkReadConditions(r, metadata); status != 0 {
+			s.writeReadConditionFailure(w, r, status, metadata)
+			return
+		}
+
 		// Set headers for partial content
 		w.Header().Set("Content-Type", metadata.ContentType)
 		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, metadata.Size))
@@ -216,6 +284,12 @@ func (s *Server) handleGetObject(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Accept-Ranges", "bytes")
 		w.Header().Set("Server", "ess-three")
 		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		setVersionHeaders(w, metadata)
+		setTaggingCountHeader(w, metadata)
+		setObjectLockHeaders(w, metadata)
+		setWebsiteRedirectHeader(w, metadata)
+		setStorageClassHeaders(w, metadata)
+		setEncryptionHeaders(w, metadata.Encryption)
 
 		// Set custom metadata headers
 		for k, v := range metadata.Metadata {
@@ -227,36 +301,111 @@ func (s *Server) handleGetObject(w http.ResponseWriter, r *http.Request) {
 		io.CopyN(w, reader, end-start+1)
 	} else {
 		// Normal GET (full object)
-		reader, metadata, err := s.storage.GetObject(bucket, key)
+		reader, metadata, err := s.storage.GetObject(bucket, key, versionID)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				s.sendError(w, r, "NoSuchKey", "The specified key does not exist", http.StatusNotFound)
-			} else {
-				s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
-			}
+			s.sendStorageError(w, r, err)
 			return
 		}
 		defer reader.Close()
 
+		if !s.checkCustomerKey(w, r, metadata.Encryption, false) {
+			return
+		}
+
+		if status := checkReadConditions(r, metadata); status != 0 {
+			s.writeReadConditionFailure(w, r, status, metadata)
+			return
+		}
+
+		// A single part is served as the range of the object it covers
+		status, length := http.StatusOK, metadata.Size
+		if partNumber > 0 {
+			start, partLength, err := setPartHeaders(w, metadata, partNumber)
+			if err != nil {
+				s.sendStorageError(w, r, err)
+				return
+			}
+			if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+				s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status, length = http.StatusPartialContent, partLength
+		}
+
 		// Set headers
 		w.Header().Set("Content-Type", metadata.ContentType)
-		w.Header().Set("Content-Length", strconv.FormatInt(metadata.Size, 10))
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
 		w.Header().Set("ETag", metadata.ETag)
 		w.Header().Set("Last-Modified", metadata.LastModified.Format(http.TimeFormat))
 		w.Header().Set("Accept-Ranges", "bytes")
 		w.Header().Set("Server", "ess-three")
 		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
 		w.Header().Set("Connection", "keep-alive")
+		setVersionHeaders(w, metadata)
+		setTaggingCountHeader(w, metadata)
+		setObjectLockHeaders(w, metadata)
+		setWebsiteRedirectHeader(w, metadata)
+		setStorageClassHeaders(w, metadata)
+		setEncryptionHeaders(w, metadata.Encryption)
+		if checksumModeEnabled(r) && partNumber == 0 {
+			setChecksumHeaders(w, metadata.Checksum)
+		}
 
 		// Set custom metadata headers
 		for k, v := range metadata.Metadata {
 			w.Header().Set("x-amz-meta-"+k, v)
 		}
 
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		// Use io.CopyN to respect Content-Length and prevent chunked encoding
-		io.CopyN(w, reader, metadata.Size)
+		io.CopyN(w, reader, length)
+	}
+}
+
+// partNumberQuery parses the partNumber parameter of a GET or HEAD, which
+// selects one part of a multipart object; zero means the whole object
+func (s *Server) partNumberQuery(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.URL.Query().Get("partNumber") == "" {
+		return 0, true
+	}
+
+	partNumber, ok := s.partNumberParam(w, r)
+	if !ok {
+		return 0, false
 	}
+	if r.Header.Get("Range") != "" {
+		s.sendError(w, r, "InvalidRequest", "Cannot specify both Range header and partNumber query parameter", http.StatusBadRequest)
+		return 0, false
+	}
+	return partNumber, true
+}
+
+// partNumberParam parses a required partNumber parameter, which must be
+// between 1 and 10000
+func (s *Server) partNumberParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		s.sendError(w, r, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive", http.StatusBadRequest)
+		return 0, false
+	}
+	return partNumber, true
+}
+
+// setPartHeaders reports the byte range of part partNumber of an object and
+// the object's part count, returning the part's offset and length
+func setPartHeaders(w http.ResponseWriter, meta *storage.ObjectMetadata, partNumber int) (int64, int64, error) {
+	start, end, err := storage.PartRange(meta, partNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(meta.PartSizes) > 0 {
+		w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(len(meta.PartSizes)))
+	}
+	if meta.Size > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, meta.Size))
+	}
+	return start, end - start + 1, nil
 }
 
 // parseRangeHeader parses HTTP Range header
@@ -298,7 +447,7 @@ func parseRangeHeader(rangeHeader string) (int64, int64, error) {
 // handlePutObject handles PUT /{bucket}/{key} - PutObject
 func (s *Server) handlePutObject(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 
 	contentType := r.Header.Get("Content-Type")
 	if contentType == "" {
@@ -306,25 +455,75 @@ func (s *Server) handlePutObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract custom metadata from headers
-	metadata := make(map[string]string)
-	for headerKey, values := range r.Header {
-		if strings.HasPrefix(strings.ToLower(headerKey), "x-amz-meta-") {
-			metaKey := strings.TrimPrefix(strings.ToLower(headerKey), "x-amz-meta-")
-			if len(values) > 0 {
-				metadata[metaKey] = values[0]
-			}
-		}
+	metadata := extractMetadata(r)
+
+	tags, ok := s.requestTags(w, r)
+	if !ok {
+		return
+	}
+
+	acl, ok := s.requestACL(w, r)
+	if !ok {
+		return
 	}
 
-	objMetadata, err := s.storage.PutObject(bucket, key, r.Body, metadata, contentType)
+	enc, ok := s.requestEncryption(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	retention, legalHold, ok := s.requestObjectLock(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	redirect, ok := s.requestWebsiteRedirect(w, r)
+	if !ok {
+		return
+	}
+
+	class, ok := s.requestStorageClass(w, r)
+	if !ok {
+		return
+	}
+
+	cond, ok := s.writeCondition(w, r)
+	if !ok {
+		return
+	}
+
+	body, algorithm, ok := s.requestBody(w, r)
+	if !ok {
+		return
+	}
+	opts := storage.PutOptions{
+		Tags:            tags,
+		ACL:             acl,
+		Encryption:      enc,
+		Condition:       cond,
+		Retention:       retention,
+		LegalHold:       legalHold,
+		WebsiteRedirect: redirect,
+		StorageClass:    class,
+	}
+	if algorithm != "" {
+		opts.Checksum = &storage.Checksum{Algorithm: algorithm}
+	}
+
+	objMetadata, err := s.storage.PutObject(bucket, key, body, metadata, contentType, opts)
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	s.notifyEvent(r, bucket, "ObjectCreated:Put", objectInfo(objMetadata))
+
 	// Set response headers for S3 compatibility
 	w.Header().Set("ETag", objMetadata.ETag)
 	w.Header().Set("x-amz-version-id", "null")
+	setVersionHeaders(w, objMetadata)
+	setEncryptionHeaders(w, objMetadata.Encryption)
+	setChecksumHeaders(w, objMetadata.Checksum)
 	w.Header().Set("Server", "ess-three")
 	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
 	w.Header().Set("Content-Length", "0")
@@ -332,50 +531,115 @@ func (s *Server) handlePutObject(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// extractMetadata collects x-amz-meta-* request headers into user metadata
+func extractMetadata(r *http.Request) map[string]string {
+	metadata := make(map[string]string)
+	for headerKey, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(headerKey), "x-amz-meta-") {
+			metaKey := strings.TrimPrefix(strings.ToLower(headerKey), "x-amz-meta-")
+			if len(values) > 0 {
+				metadata[metaKey] = values[0]
+			}
+		}
+	}
+	return metadata
+}
+
 // handleHeadObject handles HEAD /{bucket}/{key} - HeadObject
 func (s *Server) handleHeadObject(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
+
+	versionID := r.URL.Query().Get("versionId")
 
-	metadata, err := s.storage.HeadObject(bucket, key)
+	partNumber, ok := s.partNumberQuery(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := s.storage.HeadObject(bucket, key, versionID)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		var markerErr *storage.DeleteMarkerError
+		switch {
+		case errors.As(err, &markerErr):
+			w.Header().Set("x-amz-delete-marker", "true")
+			w.Header().Set("x-amz-version-id", markerErr.VersionID)
+			if versionID != "" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case errors.Is(err, storage.ErrObjectNotFound), errors.Is(err, storage.ErrVersionNotFound), errors.Is(err, storage.ErrBucketNotFound):
 			w.WriteHeader(http.StatusNotFound)
-		} else {
+		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 		return
 	}
 
+	if !s.checkCustomerKey(w, r, metadata.Encryption, false) {
+		return
+	}
+
+	if status := checkReadConditions(r, metadata); status != 0 {
+		s.writeReadConditionFailure(w, r, status, metadata)
+		return
+	}
+
+	status, length := http.StatusOK, metadata.Size
+	if partNumber > 0 {
+		_, partLength, err := setPartHeaders(w, metadata, partNumber)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		status, length = http.StatusPartialContent, partLength
+	}
+
 	// Set headers
 	w.Header().Set("Content-Type", metadata.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(metadata.Size, 10))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
 	w.Header().Set("ETag", metadata.ETag)
 	w.Header().Set("Last-Modified", metadata.LastModified.Format(http.TimeFormat))
 	w.Header().Set("Accept-Ranges", "bytes")
 	w.Header().Set("Server", "ess-three")
 	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
 	w.Header().Set("x-amz-version-id", "null")
+	setVersionHeaders(w, metadata)
+	setTaggingCountHeader(w, metadata)
+	setObjectLockHeaders(w, metadata)
+	setWebsiteRedirectHeader(w, metadata)
+	setStorageClassHeaders(w, metadata)
+	setEncryptionHeaders(w, metadata.Encryption)
+	if checksumModeEnabled(r) && partNumber == 0 {
+		setChecksumHeaders(w, metadata.Checksum)
+	}
 
 	// Set custom metadata headers
 	for k, v := range metadata.Metadata {
 		w.Header().Set("x-amz-meta-"+k, v)
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 }
 
 // handleDeleteObject handles DELETE /{bucket}/{key} - DeleteObject
 func (s *Server) handleDeleteObject(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 
-	err := s.storage.DeleteObject(bucket, key)
+	versionID := r.URL.Query().Get("versionId")
+
+	opts := storage.DeleteOptions{BypassGovernance: s.bypassGovernance(r, bucket, key)}
+	deleted, err := s.storage.DeleteObject(bucket, key, versionID, opts)
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	s.notifyDeleted(r, bucket, key, deleted.VersionID, deleted.DeleteMarker)
+
+	setVersionHeaders(w, deleted)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -390,32 +654,63 @@ func (s *Server) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract keys to delete
-	keys := make([]string, len(deleteReq.Objects))
-	for i, obj := range deleteReq.Objects {
-		keys[i] = obj.Key
+	// Extract objects to delete, authorizing each key on its own. GOVERNANCE
+	// retention is bypassed only when that is allowed for every key.
+	opts := storage.DeleteOptions{BypassGovernance: true}
+	objects := make([]storage.ObjectIdentifier, 0, len(deleteReq.Objects))
+	var denied []DeleteError
+	for _, obj := range deleteReq.Objects {
+		action := "s3:DeleteObject"
+		if obj.VersionId != "" {
+			action = "s3:DeleteObjectVersion"
+		}
+		if !s.checkAccess(r, action, bucket, obj.Key) {
+			denied = append(denied, DeleteError{Key: obj.Key, VersionId: obj.VersionId, Code: "AccessDenied", Message: "Access Denied"})
+			continue
+		}
+		objects = append(objects, storage.ObjectIdentifier{Key: obj.Key, VersionID: obj.VersionId})
+		opts.BypassGovernance = opts.BypassGovernance && s.bypassGovernance(r, bucket, obj.Key)
 	}
 
 	// Delete objects
-	deleted, errors := s.storage.DeleteObjects(bucket, keys)
+	deleted, failures := s.storage.DeleteObjects(bucket, objects, opts)
+
+	for _, obj := range deleted {
+		versionID := obj.VersionID
+		if obj.DeleteMarker {
+			versionID = obj.DeleteMarkerVersionID
+		}
+		s.notifyDeleted(r, bucket, obj.Key, versionID, obj.DeleteMarker)
+	}
 
 	// Build response
 	result := DeleteResult{
 		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
 	}
 
-	for _, key := range deleted {
-		result.Deleted = append(result.Deleted, DeletedObject{Key: key})
+	if !deleteReq.Quiet {
+		for _, obj := range deleted {
+			result.Deleted = append(result.Deleted, DeletedObject{
+				Key:                   obj.Key,
+				VersionId:             obj.VersionID,
+				DeleteMarker:          obj.DeleteMarker,
+				DeleteMarkerVersionId: obj.DeleteMarkerVersionID,
+			})
+		}
 	}
 
-	for i, err := range errors {
-		if err != nil {
-			result.Errors = append(result.Errors, DeleteError{
-				Key:     keys[i],
-				Code:    "InternalError",
-				Message: err.Error(),
-			})
+	result.Errors = append(result.Errors, denied...)
+	for _, failure := range failures {
+		code := "InternalError"
+		if errors.Is(failure.Err, storage.ErrObjectLocked) {
+			code = "AccessDenied"
 		}
+		result.Errors = append(result.Errors, DeleteError{
+			Key:       failure.Key,
+			VersionId: failure.VersionID,
+			Code:      code,
+			Message:   failure.Err.Error(),
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/xml")
@@ -426,7 +721,7 @@ func (s *Server) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
 // handleCreateMultipartUpload handles POST /{bucket}/{key}?uploads
 func (s *Server) handleCreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 
 	contentType := r.Header.Get("Content-Type")
 	if contentType == "" {
@@ -434,22 +729,62 @@ func (s *Server) handleCreateMultipartUpload(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Extract metadata
-	metadata := make(map[string]string)
-	for headerKey, values := range r.Header {
-		if strings.HasPrefix(strings.ToLower(headerKey), "x-amz-meta-") {
-			metaKey := strings.TrimPrefix(strings.ToLower(headerKey), "x-amz-meta-")
-			if len(values) > 0 {
-				metadata[metaKey] = values[0]
-			}
-		}
+	metadata := extractMetadata(r)
+
+	tags, ok := s.requestTags(w, r)
+	if !ok {
+		return
+	}
+
+	acl, ok := s.requestACL(w, r)
+	if !ok {
+		return
 	}
 
-	upload, err := s.storage.CreateMultipartUpload(bucket, key, contentType, metadata)
+	enc, ok := s.requestEncryption(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	retention, legalHold, ok := s.requestObjectLock(w, r, bucket)
+	if !ok {
+		return
+	}
+
+	redirect, ok := s.requestWebsiteRedirect(w, r)
+	if !ok {
+		return
+	}
+
+	class, ok := s.requestStorageClass(w, r)
+	if !ok {
+		return
+	}
+
+	opts := storage.PutOptions{Tags: tags, ACL: acl, Encryption: enc, Retention: retention, LegalHold: legalHold, WebsiteRedirect: redirect, StorageClass: class}
+	algorithm, ok := s.requestChecksumAlgorithm(w, r)
+	if !ok {
+		return
+	}
+	if algorithm != "" {
+		opts.Checksum = &storage.Checksum{Algorithm: algorithm, Type: r.Header.Get(headerChecksumType)}
+	} else if r.Header.Get(headerChecksumType) != "" {
+		s.sendError(w, r, "InvalidRequest", "The x-amz-checksum-type header can only be used with the x-amz-checksum-algorithm header.", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := s.storage.CreateMultipartUpload(bucket, key, contentType, metadata, opts)
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	setEncryptionHeaders(w, upload.Encryption)
+	if upload.Checksum != nil {
+		w.Header().Set(headerChecksumAlgorithm, upload.Checksum.Algorithm)
+		w.Header().Set(headerChecksumType, upload.Checksum.Type)
+	}
+
 	result := InitiateMultipartUploadResult{
 		Xmlns:    "http://s3.amazonaws.com/doc/2006-03-01/",
 		Bucket:   bucket,
@@ -465,22 +800,44 @@ func (s *Server) handleCreateMultipartUpload(w http.ResponseWriter, r *http.Requ
 // handleUploadPart handles PUT /{bucket}/{key}?partNumber=X&uploadId=Y
 func (s *Server) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 	uploadID := r.URL.Query().Get("uploadId")
-	partNumberStr := r.URL.Query().Get("partNumber")
 
-	partNumber, err := strconv.Atoi(partNumberStr)
+	partNumber, ok := s.partNumberParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Parts of an SSE-C upload must carry the key it was created with
+	upload, err := s.storage.GetMultipartUpload(bucket, key, uploadID)
 	if err != nil {
-		s.sendError(w, r, "InvalidArgument", "Invalid part number", http.StatusBadRequest)
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if !s.checkCustomerKey(w, r, upload.Encryption, false) {
 		return
 	}
 
-	part, err := s.storage.UploadPart(bucket, key, uploadID, partNumber, r.Body)
+	body, algorithm, ok := s.requestBody(w, r)
+	if !ok {
+		return
+	}
+	if upload.Checksum != nil && algorithm != "" && algorithm != upload.Checksum.Algorithm {
+		s.sendError(w, r, "InvalidRequest", fmt.Sprintf("Checksum Type mismatch occurred, expected checksum Type: %s, actual checksum Type: %s",
+			strings.ToLower(upload.Checksum.Algorithm), strings.ToLower(algorithm)), http.StatusBadRequest)
+		return
+	}
+
+	part, err := s.storage.UploadPart(bucket, key, uploadID, partNumber, body)
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	setEncryptionHeaders(w, upload.Encryption)
+	if part.Checksum != "" {
+		w.Header().Set(checksumHeader(upload.Checksum.Algorithm), part.Checksum)
+	}
 	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", part.ETag))
 	w.WriteHeader(http.StatusOK)
 }
@@ -488,7 +845,7 @@ func (s *Server) handleUploadPart(w http.ResponseWriter, r *http.Request) {
 // handleCompleteMultipartUpload handles POST /{bucket}/{key}?uploadId=X
 func (s *Server) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 	uploadID := r.URL.Query().Get("uploadId")
 
 	// Parse complete request
@@ -497,23 +854,39 @@ func (s *Server) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Re
 		s.sendError(w, r, "MalformedXML", "Invalid XML", http.StatusBadRequest)
 		return
 	}
+	if len(completeReq.Parts) == 0 {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
 
 	// Convert to storage parts
 	parts := make([]storage.Part, len(completeReq.Parts))
 	for i, p := range completeReq.Parts {
+		_, checksum := p.value()
 		parts[i] = storage.Part{
 			PartNumber: p.PartNumber,
 			ETag:       strings.Trim(p.ETag, "\""),
+			Checksum:   checksum,
 		}
 	}
 
+	cond, ok := s.writeCondition(w, r)
+	if !ok {
+		return
+	}
+
 	// Complete the upload
-	objMeta, err := s.storage.CompleteMultipartUpload(bucket, key, uploadID, parts)
+	objMeta, err := s.storage.CompleteMultipartUpload(bucket, key, uploadID, parts, cond)
 	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		s.sendStorageError(w, r, err)
 		return
 	}
 
+	s.notifyEvent(r, bucket, "ObjectCreated:CompleteMultipartUpload", objectInfo(objMeta))
+
+	setVersionHeaders(w, objMeta)
+	setEncryptionHeaders(w, objMeta.Encryption)
+
 	result := CompleteMultipartUploadResult{
 		Xmlns:    "http://s3.amazonaws.com/doc/2006-03-01/",
 		Location: fmt.Sprintf("/%s/%s", bucket, key),
@@ -521,6 +894,10 @@ func (s *Server) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Re
 		Key:      key,
 		ETag:     objMeta.ETag,
 	}
+	if objMeta.Checksum != nil {
+		result.Checksums = newChecksums(objMeta.Checksum.Algorithm, objMeta.Checksum.Value)
+		result.ChecksumType = objMeta.Checksum.Type
+	}
 
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
@@ -530,12 +907,11 @@ func (s *Server) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Re
 // handleAbortMultipartUpload handles DELETE /{bucket}/{key}?uploadId=X
 func (s *Server) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
-	key := chi.URLParam(r, "key")
+	key := objectKey(r)
 	uploadID := r.URL.Query().Get("uploadId")
 
-	err := s.storage.AbortMultipartUpload(bucket, key, uploadID)
-	if err != nil {
-		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+	if err := s.storage.AbortMultipartUpload(bucket, key, uploadID); err != nil {
+		s.sendStorageError(w, r, err)
 		return
 	}
 
@@ -550,10 +926,82 @@ func (s *Server) sendError(w http.ResponseWriter, r *http.Request, code, message
 		Resource:  r.URL.Path,
 		RequestId: r.Header.Get("X-Request-ID"),
 	}
+	s.writeError(w, errorResp, statusCode)
+}
 
+// writeError writes an S3 error document with the given status
+func (s *Server) writeError(w http.ResponseWriter, errorResp Error, statusCode int) {
 	w.Header().Set("Content-Type", "application/xml")
 	w.Header().Set("Server", "ess-three")
 	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
 	w.WriteHeader(statusCode)
 	xml.NewEncoder(w).Encode(errorResp)
 }
+
+// sendStorageError maps a storage error onto the matching S3 error response
+func (s *Server) sendStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	var markerErr *storage.DeleteMarkerError
+	var checksumErr *checksumMismatchError
+	switch {
+	case errors.Is(err, storage.ErrBucketNotFound):
+		s.sendError(w, r, "NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound)
+	case errors.Is(err, storage.ErrBucketAlreadyExists):
+		s.sendError(w, r, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict)
+	case errors.Is(err, storage.ErrBucketNotEmpty):
+		s.sendError(w, r, "BucketNotEmpty", "The bucket you tried to delete is not empty", http.StatusConflict)
+	case errors.Is(err, storage.ErrInvalidBucketName):
+		s.sendError(w, r, "InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest)
+	case errors.As(err, &markerErr):
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", markerErr.VersionID)
+		if r.URL.Query().Get("versionId") != "" {
+			s.sendError(w, r, "MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed)
+		} else {
+			s.sendError(w, r, "NoSuchKey", "The specified key does not exist", http.StatusNotFound)
+		}
+	case errors.Is(err, storage.ErrVersionNotFound):
+		s.sendError(w, r, "NoSuchVersion", "The specified version does not exist.", http.StatusNotFound)
+	case errors.Is(err, storage.ErrObjectNotFound):
+		s.sendError(w, r, "NoSuchKey", "The specified key does not exist", http.StatusNotFound)
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		s.sendError(w, r, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold", http.StatusPreconditionFailed)
+	case errors.Is(err, errPublicPolicyBlocked):
+		s.sendError(w, r, "AccessDenied", "Access Denied", http.StatusForbidden)
+	case errors.Is(err, storage.ErrObjectLocked):
+		s.sendError(w, r, "AccessDenied", "Access Denied because object protected by object lock.", http.StatusForbidden)
+	case errors.Is(err, errLockRequiresVersioning), errors.Is(err, errLockedVersioning):
+		s.sendError(w, r, "InvalidBucketState", err.Error(), http.StatusConflict)
+	case errors.Is(err, storage.ErrInvalidObjectState):
+		s.sendError(w, r, "InvalidObjectState", "The operation is not valid for the object's storage class", http.StatusForbidden)
+	case errors.Is(err, storage.ErrRestoreInProgress):
+		s.sendError(w, r, "RestoreAlreadyInProgress", "Object restore is already in progress", http.StatusConflict)
+	case errors.Is(err, storage.ErrStorageFull):
+		s.sendError(w, r, "InsufficientStorage", "The server has reached its storage limit.", http.StatusInsufficientStorage)
+	case errors.Is(err, storage.ErrUploadNotFound):
+		s.sendError(w, r, "NoSuchUpload", "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.", http.StatusNotFound)
+	case errors.Is(err, storage.ErrInvalidPartOrder):
+		s.sendError(w, r, "InvalidPartOrder", "The list of parts was not in ascending order. Parts must be ordered by part number.", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrEntityTooSmall):
+		s.sendError(w, r, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrInvalidPartNumber):
+		s.sendError(w, r, "InvalidPartNumber", "The requested partnumber is not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+	case errors.Is(err, storage.ErrInvalidPart):
+		s.sendError(w, r, "InvalidPart", "One or more of the specified parts could not be found.  The part may not have been uploaded, or the specified entity tag may not match the part's entity tag.", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrInvalidChecksumType):
+		s.sendError(w, r, "InvalidRequest", "The x-amz-checksum-type header is not supported for the x-amz-checksum-algorithm.", http.StatusBadRequest)
+	case errors.Is(err, errBadDigest):
+		s.sendError(w, r, "BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest)
+	case errors.As(err, &checksumErr):
+		s.sendError(w, r, "BadDigest", fmt.Sprintf("The %s you specified did not match the calculated checksum.", checksumErr.algorithm), http.StatusBadRequest)
+	case errors.Is(err, errMalformedTrailer):
+		s.sendError(w, r, "MalformedTrailerError", "The request contained trailing data that was not well-formed or did not conform to our published schema.", http.StatusBadRequest)
+	case errors.Is(err, errChunkSignatureMismatch):
+		s.sendError(w, r, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided. Check your key and signing method.", http.StatusForbidden)
+	case errors.Is(err, errIncompleteBody):
+		s.sendError(w, r, "IncompleteBody", "The request body terminated unexpectedly", http.StatusBadRequest)
+	case errors.Is(err, errContentSHA256Mismatch):
+		s.sendError(w, r, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest)
+	default:
+		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestHeadObject(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("head-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.PutObject("head-bucket", "found.txt", strings.NewReader("data"), nil, "text/plain", storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"Found", "/head-bucket/found.txt", http.StatusOK},
+		{"NoSuchKey", "/head-bucket/missing.txt", http.StatusNotFound},
+		{"NoSuchVersion", "/head-bucket/found.txt?versionId=missing", http.StatusNotFound},
+		{"NoSuchBucket", "/missing-bucket/found.txt", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(handler, http.MethodHead, tc.target, nil, nil)
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
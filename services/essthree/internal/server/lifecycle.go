@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// maxLifecycleRules is the S3 limit on rules per configuration
+const maxLifecycleRules = 1000
+
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+type LifecycleRule struct {
+	ID                             string                          `xml:"ID,omitempty"`
+	Prefix                         *string                         `xml:"Prefix"`
+	Filter                         *LifecycleFilter                `xml:"Filter"`
+	Status                         string                          `xml:"Status"`
+	Expiration                     *LifecycleExpiration            `xml:"Expiration"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload"`
+}
+
+type LifecycleFilter struct {
+	Prefix *string       `xml:"Prefix"`
+	Tag    *Tag          `xml:"Tag"`
+	And    *LifecycleAnd `xml:"And"`
+}
+
+type LifecycleAnd struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tags   []Tag  `xml:"Tag"`
+}
+
+type LifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// errMalformedXML marks configuration validation errors reported as MalformedXML
+var errMalformedXML = errors.New("The XML you provided was not well-formed or did not validate against our published schema")
+
+// parseLifecycleRule validates one XML rule and converts it to its stored form
+func parseLifecycleRule(rule LifecycleRule) (storage.LifecycleRule, error) {
+	result := storage.LifecycleRule{ID: rule.ID}
+
+	switch rule.Status {
+	case "Enabled":
+		result.Enabled = true
+	case "Disabled":
+	default:
+		return result, errMalformedXML
+	}
+
+	// Filter: the legacy rule-level Prefix, or exactly one of Prefix, Tag and And
+	switch {
+	case rule.Prefix != nil && rule.Filter != nil:
+		return result, errMalformedXML
+	case rule.Prefix != nil:
+		result.Prefix = *rule.Prefix
+	case rule.Filter != nil:
+		f := rule.Filter
+		set := 0
+		if f.Prefix != nil {
+			set++
+			result.Prefix = *f.Prefix
+		}
+		if f.Tag != nil {
+			set++
+			result.Tags = map[string]string{f.Tag.Key: f.Tag.Value}
+		}
+		if f.And != nil {
+			set++
+			result.Prefix = f.And.Prefix
+			tags, err := validateTags(f.And.Tags)
+			if err != nil {
+				return result, err
+			}
+			if len(tags) > 0 {
+				result.Tags = tags
+			}
+		}
+		if set > 1 {
+			return result, errMalformedXML
+		}
+	}
+
+	if exp := rule.Expiration; exp != nil {
+		set := 0
+		if exp.Days != 0 {
+			set++
+			if exp.Days < 0 {
+				return result, errors.New("'Days' for Expiration action must be a positive integer")
+			}
+			result.ExpirationDays = exp.Days
+		}
+		if exp.Date != "" {
+			set++
+			date, err := time.Parse(time.RFC3339, exp.Date)
+			if err != nil || !date.Equal(date.UTC().Truncate(24*time.Hour)) {
+				return result, errors.New("'Date' must be at midnight GMT")
+			}
+			result.ExpirationDate = &date
+		}
+		if exp.ExpiredObjectDeleteMarker {
+			set++
+			if len(result.Tags) > 0 {
+				return result, errors.New("ExpiredObjectDeleteMarker cannot be specified with Tags.")
+			}
+			result.ExpiredObjectDeleteMarker = true
+		}
+		if set != 1 {
+			return result, errMalformedXML
+		}
+	}
+
+	if nve := rule.NoncurrentVersionExpiration; nve != nil {
+		if nve.NoncurrentDays <= 0 {
+			return result, errors.New("'NoncurrentDays' for NoncurrentVersionExpiration action must be a positive integer")
+		}
+		if nve.NewerNoncurrentVersions < 0 {
+			return result, errors.New("'NewerNoncurrentVersions' for NoncurrentVersionExpiration action must be a positive integer")
+		}
+		result.NoncurrentVersionExpirationDays = nve.NoncurrentDays
+		result.NewerNoncurrentVersions = nve.NewerNoncurrentVersions
+	}
+
+	if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+		if abort.DaysAfterInitiation <= 0 {
+			return result, errors.New("'DaysAfterInitiation' for AbortIncompleteMultipartUpload action must be a positive integer")
+		}
+		if len(result.Tags) > 0 {
+			return result, errors.New("AbortIncompleteMultipartUpload cannot be specified with Tags.")
+		}
+		result.AbortIncompleteMultipartUploadDays = abort.DaysAfterInitiation
+	}
+
+	if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		return result, errors.New("At least one action needs to be specified in a rule")
+	}
+
+	return result, nil
+}
+
+// formatLifecycleRule converts a stored rule back to its XML form
+func formatLifecycleRule(rule storage.LifecycleRule) LifecycleRule {
+	result := LifecycleRule{ID: rule.ID, Status: "Disabled"}
+	if rule.Enabled {
+		result.Status = "Enabled"
+	}
+
+	prefix := rule.Prefix
+	switch {
+	case len(rule.Tags) == 0:
+		result.Filter = &LifecycleFilter{Prefix: &prefix}
+	case len(rule.Tags) == 1 && rule.Prefix == "":
+		for k, v := range rule.Tags {
+			result.Filter = &LifecycleFilter{Tag: &Tag{Key: k, Value: v}}
+		}
+	default:
+		and := &LifecycleAnd{Prefix: rule.Prefix}
+		for k, v := range rule.Tags {
+			and.Tags = append(and.Tags, Tag{Key: k, Value: v})
+		}
+		sort.Slice(and.Tags, func(i, j int) bool { return and.Tags[i].Key < and.Tags[j].Key })
+		result.Filter = &LifecycleFilter{And: and}
+	}
+
+	switch {
+	case rule.ExpirationDays > 0:
+		result.Expiration = &LifecycleExpiration{Days: rule.ExpirationDays}
+	case rule.ExpirationDate != nil:
+		result.Expiration = &LifecycleExpiration{Date: rule.ExpirationDate.UTC().Format(time.RFC3339)}
+	case rule.ExpiredObjectDeleteMarker:
+		result.Expiration = &LifecycleExpiration{ExpiredObjectDeleteMarker: true}
+	}
+
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		result.NoncurrentVersionExpiration = &NoncurrentVersionExpiration{
+			NoncurrentDays:          rule.NoncurrentVersionExpirationDays,
+			NewerNoncurrentVersions: rule.NewerNoncurrentVersions,
+		}
+	}
+
+	if rule.AbortIncompleteMultipartUploadDays > 0 {
+		result.AbortIncompleteMultipartUpload = &AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: rule.AbortIncompleteMultipartUploadDays,
+		}
+	}
+
+	return result
+}
+
+// handlePutBucketLifecycle handles PUT /{bucket}?lifecycle
+func (s *Server) handlePutBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config LifecycleConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(config.Rules) == 0 || len(config.Rules) > maxLifecycleRules {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules := make([]storage.LifecycleRule, 0, len(config.Rules))
+	ids := make(map[string]bool, len(config.Rules))
+	for _, xmlRule := range config.Rules {
+		rule, err := parseLifecycleRule(xmlRule)
+		if errors.Is(err, errMalformedXML) {
+			s.sendError(w, r, "MalformedXML", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rule.ID == "" {
+			rule.ID = generateRuleID()
+		}
+		if len(rule.ID) > 255 {
+			s.sendError(w, r, "InvalidArgument", "ID length should not exceed allowed limit of 255", http.StatusBadRequest)
+			return
+		}
+		if ids[rule.ID] {
+			s.sendError(w, r, "InvalidArgument", "Rule ID must be unique. Found same ID for more than one rule", http.StatusBadRequest)
+			return
+		}
+		ids[rule.ID] = true
+		rules = append(rules, rule)
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.LifecycleRules = rules
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketLifecycle handles GET /{bucket}?lifecycle
+func (s *Server) handleGetBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if len(info.LifecycleRules) == 0 {
+		s.sendError(w, r, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist", http.StatusNotFound)
+		return
+	}
+
+	result := LifecycleConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	for _, rule := range info.LifecycleRules {
+		result.Rules = append(result.Rules, formatLifecycleRule(rule))
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteBucketLifecycle handles DELETE /{bucket}?lifecycle
+func (s *Server) handleDeleteBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.LifecycleRules = nil
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// generateRuleID returns an ID for a rule submitted without one
+func generateRuleID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("rule-%x", b)
+}
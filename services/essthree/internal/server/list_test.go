@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestListMaxKeys(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("keys-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := store.PutObject("keys-bucket", key, strings.NewReader(key), nil, "text/plain", storage.PutOptions{}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+
+	listObjects := func(t *testing.T, query string) ListBucketResult {
+		t.Helper()
+		rec := do(handler, http.MethodGet, "/keys-bucket?"+query, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListBucketResult
+		decodeBody(t, rec, &result)
+		return result
+	}
+
+	listVersions := func(t *testing.T, query string) ListVersionsResult {
+		t.Helper()
+		rec := do(handler, http.MethodGet, "/keys-bucket?versions&"+query, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListVersionsResult
+		decodeBody(t, rec, &result)
+		return result
+	}
+
+	t.Run("Zero", func(t *testing.T) {
+		if result := listObjects(t, "max-keys=0"); len(result.Contents) != 0 || !result.IsTruncated || result.MaxKeys != 0 {
+			t.Errorf("Expected an empty truncated page, got %+v", result)
+		}
+		if result := listObjects(t, "list-type=2&max-keys=0&start-after=a.txt"); len(result.Contents) != 0 || !result.IsTruncated || result.NextContinuationToken == "" {
+			t.Errorf("Expected an empty truncated page with a continuation token, got %+v", result)
+		}
+		if result := listVersions(t, "max-keys=0"); len(result.Versions) != 0 || !result.IsTruncated || result.MaxKeys != 0 {
+			t.Errorf("Expected an empty truncated page, got %+v", result)
+		}
+	})
+
+	t.Run("ZeroWithoutMatches", func(t *testing.T) {
+		if result := listObjects(t, "max-keys=0&prefix=missing/"); result.IsTruncated {
+			t.Errorf("Expected a page without matches not to be truncated, got %+v", result)
+		}
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		if result := listObjects(t, "list-type=2&max-keys=5000"); result.MaxKeys != 1000 || len(result.Contents) != 3 {
+			t.Errorf("Expected MaxKeys 1000 and 3 keys, got %d and %d", result.MaxKeys, len(result.Contents))
+		}
+		if result := listVersions(t, "max-keys=5000"); result.MaxKeys != 1000 || len(result.Versions) != 3 {
+			t.Errorf("Expected MaxKeys 1000 and 3 versions, got %d and %d", result.MaxKeys, len(result.Versions))
+		}
+	})
+
+	for _, value := range []string{"-1", "abc"} {
+		t.Run("Invalid"+value, func(t *testing.T) {
+			for _, target := range []string{"/keys-bucket?", "/keys-bucket?list-type=2&", "/keys-bucket?versions&"} {
+				expectError(t, do(handler, http.MethodGet, target+"max-keys="+value, nil, nil), http.StatusBadRequest, "InvalidArgument")
+			}
+		})
+	}
+}
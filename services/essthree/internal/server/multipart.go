@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxPartNumber is the highest part number S3 accepts
+const maxPartNumber = 10000
+
+// maxListPage is the most entries a listing returns in one page
+const maxListPage = 1000
+
+type ListMultipartUploadsResult struct {
+	XMLName            xml.Name       `xml:"ListMultipartUploadsResult"`
+	Xmlns              string         `xml:"xmlns,attr"`
+	Bucket             string         `xml:"Bucket"`
+	KeyMarker          string         `xml:"KeyMarker"`
+	UploadIdMarker     string         `xml:"UploadIdMarker"`
+	NextKeyMarker      string         `xml:"NextKeyMarker,omitempty"`
+	NextUploadIdMarker string         `xml:"NextUploadIdMarker,omitempty"`
+	Prefix             string         `xml:"Prefix"`
+	Delimiter          string         `xml:"Delimiter,omitempty"`
+	MaxUploads         int            `xml:"MaxUploads"`
+	EncodingType       string         `xml:"EncodingType,omitempty"`
+	IsTruncated        bool           `xml:"IsTruncated"`
+	Uploads            []UploadResult `xml:"Upload"`
+	CommonPrefixes     []CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type UploadResult struct {
+	Key               string    `xml:"Key"`
+	UploadId          string    `xml:"UploadId"`
+	Initiator         Owner     `xml:"Initiator"`
+	Owner             Owner     `xml:"Owner"`
+	StorageClass      string    `xml:"StorageClass"`
+	Initiated         time.Time `xml:"Initiated"`
+	ChecksumAlgorithm string    `xml:"ChecksumAlgorithm,omitempty"`
+	ChecksumType      string    `xml:"ChecksumType,omitempty"`
+}
+
+type ListPartsResult struct {
+	XMLName              xml.Name     `xml:"ListPartsResult"`
+	Xmlns                string       `xml:"xmlns,attr"`
+	Bucket               string       `xml:"Bucket"`
+	Key                  string       `xml:"Key"`
+	UploadId             string       `xml:"UploadId"`
+	Initiator            Owner        `xml:"Initiator"`
+	Owner                Owner        `xml:"Owner"`
+	StorageClass         string       `xml:"StorageClass"`
+	PartNumberMarker     int          `xml:"PartNumberMarker"`
+	NextPartNumberMarker int          `xml:"NextPartNumberMarker,omitempty"`
+	MaxParts             int          `xml:"MaxParts"`
+	IsTruncated          bool         `xml:"IsTruncated"`
+	ChecksumAlgorithm    string       `xml:"ChecksumAlgorithm,omitempty"`
+	ChecksumType         string       `xml:"ChecksumType,omitempty"`
+	Parts                []PartResult `xml:"Part"`
+}
+
+type PartResult struct {
+	PartNumber   int       `xml:"PartNumber"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	Checksums
+}
+
+// maxListEntries reads the page size of a listing from the query parameter
+// name, which defaults to and is capped at maxListPage. Values that are not
+// non-negative integers are rejected with InvalidArgument.
+func (s *Server) maxListEntries(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return maxListPage, true
+	}
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n < 0 {
+		s.sendError(w, r, "InvalidArgument", fmt.Sprintf("Argument %s must be an integer between 0 and 2147483647", name), http.StatusBadRequest)
+		return 0, false
+	}
+	return min(int(n), maxListPage), true
+}
+
+// handleListMultipartUploads handles GET /{bucket}?uploads
+func (s *Server) handleListMultipartUploads(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	keyMarker := query.Get("key-marker")
+	uploadIDMarker := query.Get("upload-id-marker")
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s.sendError(w, r, "InvalidArgument", "Invalid Encoding Method specified in Request", http.StatusBadRequest)
+		return
+	}
+
+	maxUploads, ok := s.maxListEntries(w, r, "max-uploads")
+	if !ok {
+		return
+	}
+
+	result, err := s.storage.ListMultipartUploads(bucket, prefix, delimiter, keyMarker, uploadIDMarker, maxUploads)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	encode := func(value string) string {
+		return encodeListValue(value, encodingType)
+	}
+	owner := Owner{ID: ownerID, DisplayName: ownerDisplayName}
+
+	response := ListMultipartUploadsResult{
+		Xmlns:          "http://s3.amazonaws.com/doc/2006-03-01/",
+		Bucket:         bucket,
+		KeyMarker:      encode(keyMarker),
+		UploadIdMarker: uploadIDMarker,
+		Prefix:         encode(prefix),
+		Delimiter:      encode(delimiter),
+		MaxUploads:     maxUploads,
+		EncodingType:   encodingType,
+		IsTruncated:    result.IsTruncated,
+	}
+	if result.IsTruncated {
+		response.NextKeyMarker = encode(result.NextKeyMarker)
+		response.NextUploadIdMarker = result.NextUploadIDMarker
+	}
+
+	for _, upload := range result.Uploads {
+		entry := UploadResult{
+			Key:          encode(upload.Key),
+			UploadId:     upload.UploadID,
+			Initiator:    owner,
+			Owner:        owner,
+			StorageClass: storageClass(upload.StorageClass),
+			Initiated:    upload.Created,
+		}
+		if upload.Checksum != nil {
+			entry.ChecksumAlgorithm = upload.Checksum.Algorithm
+			entry.ChecksumType = upload.Checksum.Type
+		}
+		response.Uploads = append(response.Uploads, entry)
+	}
+
+	for _, commonPrefix := range result.CommonPrefixes {
+		response.CommonPrefixes = append(response.CommonPrefixes, CommonPrefix{Prefix: encode(commonPrefix)})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
+
+// handleListParts handles GET /{bucket}/{key}?uploadId=X
+func (s *Server) handleListParts(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	partNumberMarker := 0
+	if markerStr := query.Get("part-number-marker"); markerStr != "" {
+		marker, err := strconv.Atoi(markerStr)
+		if err != nil || marker < 0 {
+			s.sendError(w, r, "InvalidArgument", "Invalid part number marker", http.StatusBadRequest)
+			return
+		}
+		partNumberMarker = marker
+	}
+
+	maxParts, ok := s.maxListEntries(w, r, "max-parts")
+	if !ok {
+		return
+	}
+
+	upload, err := s.storage.GetMultipartUpload(bucket, key, uploadID)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	result, err := s.storage.ListParts(bucket, key, uploadID, partNumberMarker, maxParts)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	owner := Owner{ID: ownerID, DisplayName: ownerDisplayName}
+	response := ListPartsResult{
+		Xmlns:            "http://s3.amazonaws.com/doc/2006-03-01/",
+		Bucket:           bucket,
+		Key:              key,
+		UploadId:         uploadID,
+		Initiator:        owner,
+		Owner:            owner,
+		StorageClass:     storageClass(upload.StorageClass),
+		PartNumberMarker: partNumberMarker,
+		MaxParts:         maxParts,
+		IsTruncated:      result.IsTruncated,
+	}
+	if result.IsTruncated {
+		response.NextPartNumberMarker = result.NextPartNumberMarker
+	}
+
+	algorithm := ""
+	if upload.Checksum != nil {
+		algorithm = upload.Checksum.Algorithm
+		response.ChecksumAlgorithm = algorithm
+		response.ChecksumType = upload.Checksum.Type
+	}
+	for _, part := range result.Parts {
+		response.Parts = append(response.Parts, PartResult{
+			PartNumber:   part.PartNumber,
+			LastModified: part.LastModified,
+			ETag:         fmt.Sprintf("\"%s\"", part.ETag),
+			Size:         part.Size,
+			Checksums:    newChecksums(algorithm, part.Checksum),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestListMultipartUploadsPagination(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("uploads-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	for _, key := range []string{"a.bin", "b.bin", "b.bin"} {
+		if _, err := store.CreateMultipartUpload("uploads-bucket", key, "", nil, storage.PutOptions{}); err != nil {
+			t.Fatalf("CreateMultipartUpload failed: %v", err)
+		}
+	}
+
+	list := func(t *testing.T, query string) ListMultipartUploadsResult {
+		t.Helper()
+		rec := do(handler, http.MethodGet, "/uploads-bucket?uploads&"+query, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListMultipartUploadsResult
+		decodeBody(t, rec, &result)
+		return result
+	}
+
+	t.Run("Markers", func(t *testing.T) {
+		first := list(t, "max-uploads=2")
+		if len(first.Uploads) != 2 || !first.IsTruncated || first.NextKeyMarker != "b.bin" || first.NextUploadIdMarker != first.Uploads[1].UploadId {
+			t.Fatalf("Expected 2 uploads ending at b.bin, got %+v", first)
+		}
+
+		query := url.Values{"key-marker": {first.NextKeyMarker}, "upload-id-marker": {first.NextUploadIdMarker}}
+		second := list(t, query.Encode())
+		if len(second.Uploads) != 1 || second.IsTruncated || second.Uploads[0].Key != "b.bin" || second.Uploads[0].UploadId == first.NextUploadIdMarker {
+			t.Errorf("Expected the other upload of b.bin, got %+v", second.Uploads)
+		}
+		if second.KeyMarker != "b.bin" || second.UploadIdMarker != first.NextUploadIdMarker {
+			t.Errorf("Expected the markers to be echoed, got %q and %q", second.KeyMarker, second.UploadIdMarker)
+		}
+	})
+
+	t.Run("Zero", func(t *testing.T) {
+		result := list(t, "max-uploads=0")
+		if len(result.Uploads) != 0 || !result.IsTruncated || result.MaxUploads != 0 {
+			t.Errorf("Expected an empty truncated page, got %+v", result)
+		}
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		if result := list(t, "max-uploads=5000"); result.MaxUploads != 1000 || len(result.Uploads) != 3 {
+			t.Errorf("Expected MaxUploads 1000 and 3 uploads, got %d and %d", result.MaxUploads, len(result.Uploads))
+		}
+	})
+
+	for _, value := range []string{"-5", "abc", "1.5"} {
+		t.Run("Invalid"+value, func(t *testing.T) {
+			rec := do(handler, http.MethodGet, "/uploads-bucket?uploads&max-uploads="+value, nil, nil)
+			expectError(t, rec, http.StatusBadRequest, "InvalidArgument")
+		})
+	}
+}
+
+func TestListPartsPagination(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("parts-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	upload, err := store.CreateMultipartUpload("parts-bucket", "mp.bin", "", nil, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	for partNumber := 1; partNumber <= 3; partNumber++ {
+		if _, err := store.UploadPart("parts-bucket", "mp.bin", upload.UploadID, partNumber, strings.NewReader("part")); err != nil {
+			t.Fatalf("UploadPart failed: %v", err)
+		}
+	}
+
+	target := "/parts-bucket/mp.bin?uploadId=" + upload.UploadID
+	list := func(t *testing.T, query string) ListPartsResult {
+		t.Helper()
+		rec := do(handler, http.MethodGet, target+"&"+query, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListPartsResult
+		decodeBody(t, rec, &result)
+		return result
+	}
+
+	t.Run("Markers", func(t *testing.T) {
+		first := list(t, "max-parts=2")
+		if len(first.Parts) != 2 || !first.IsTruncated || first.NextPartNumberMarker != 2 {
+			t.Fatalf("Expected parts 1 and 2 with marker 2, got %+v", first)
+		}
+
+		second := list(t, "part-number-marker="+strconv.Itoa(first.NextPartNumberMarker))
+		if len(second.Parts) != 1 || second.Parts[0].PartNumber != 3 || second.IsTruncated || second.PartNumberMarker != 2 {
+			t.Errorf("Expected only part 3 after marker 2, got %+v", second)
+		}
+	})
+
+	t.Run("Zero", func(t *testing.T) {
+		result := list(t, "max-parts=0&part-number-marker=1")
+		if len(result.Parts) != 0 || !result.IsTruncated || result.NextPartNumberMarker != 1 {
+			t.Errorf("Expected an empty truncated page resuming at 1, got %+v", result)
+		}
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		if result := list(t, "max-parts=5000"); result.MaxParts != 1000 || len(result.Parts) != 3 {
+			t.Errorf("Expected MaxParts 1000 and 3 parts, got %d and %d", result.MaxParts, len(result.Parts))
+		}
+	})
+
+	for _, value := range []string{"-5", "abc"} {
+		t.Run("Invalid"+value, func(t *testing.T) {
+			expectError(t, do(handler, http.MethodGet, target+"&max-parts="+value, nil, nil), http.StatusBadRequest, "InvalidArgument")
+		})
+	}
+
+	t.Run("NoSuchUpload", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodGet, "/parts-bucket/mp.bin?uploadId=missing", nil, nil), http.StatusNotFound, "NoSuchUpload")
+	})
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("abort-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	upload, err := store.CreateMultipartUpload("abort-bucket", "mp.bin", "", nil, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	for _, target := range []string{
+		"/abort-bucket/mp.bin?uploadId=",
+		"/abort-bucket/mp.bin?uploadId=..%2F..%2Fabort-bucket",
+		"/abort-bucket/mp.bin?uploadId=missing",
+		"/abort-bucket/other.bin?uploadId=" + upload.UploadID,
+	} {
+		expectError(t, do(handler, http.MethodDelete, target, nil, nil), http.StatusNotFound, "NoSuchUpload")
+	}
+
+	rec := do(handler, http.MethodDelete, "/abort-bucket/mp.bin?uploadId="+upload.UploadID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	expectError(t, do(handler, http.MethodDelete, "/abort-bucket/mp.bin?uploadId="+upload.UploadID, nil, nil), http.StatusNotFound, "NoSuchUpload")
+}
+
+func TestUploadPartNumber(t *testing.T) {
+	handler, store := newTestServer(t, Config{})
+	if err := store.CreateBucket("part-bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	upload, err := store.CreateMultipartUpload("part-bucket", "mp.bin", "", nil, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+	target := "/part-bucket/mp.bin?uploadId=" + upload.UploadID + "&partNumber="
+
+	for _, partNumber := range []string{"0", "-1", "10001", "20000", "abc", ""} {
+		t.Run("Invalid"+partNumber, func(t *testing.T) {
+			expectError(t, do(handler, http.MethodPut, target+partNumber, strings.NewReader("part"), nil), http.StatusBadRequest, "InvalidArgument")
+		})
+	}
+
+	for _, partNumber := range []string{"1", "10000"} {
+		t.Run("Valid"+partNumber, func(t *testing.T) {
+			if rec := do(handler, http.MethodPut, target+partNumber, strings.NewReader("part"), nil); rec.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	parts, err := store.ListParts("part-bucket", "mp.bin", upload.UploadID, 0, 1000)
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(parts.Parts) != 2 {
+		t.Errorf("Expected only the valid parts to be stored, got %+v", parts.Parts)
+	}
+}
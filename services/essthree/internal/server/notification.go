@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tony/ess-three/internal/notify"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// supportedEvents are the event types a notification configuration may name
+var supportedEvents = map[string]bool{
+	"s3:ObjectCreated:*":                       true,
+	"s3:ObjectCreated:Put":                     true,
+	"s3:ObjectCreated:Post":                    true,
+	"s3:ObjectCreated:Copy":                    true,
+	"s3:ObjectCreated:CompleteMultipartUpload": true,
+	"s3:ObjectRemoved:*":                       true,
+	"s3:ObjectRemoved:Delete":                  true,
+	"s3:ObjectRemoved:DeleteMarkerCreated":     true,
+}
+
+type NotificationConfiguration struct {
+	XMLName             xml.Name             `xml:"NotificationConfiguration"`
+	Xmlns               string               `xml:"xmlns,attr,omitempty"`
+	TopicConfigurations []TopicConfiguration `xml:"TopicConfiguration"`
+	QueueConfigurations []QueueConfiguration `xml:"QueueConfiguration"`
+
+	// Lambda and EventBridge destinations are only parsed to be rejected
+	LambdaConfigurations []struct{} `xml:"CloudFunctionConfiguration"`
+	EventBridge          *struct{}  `xml:"EventBridgeConfiguration"`
+}
+
+type TopicConfiguration struct {
+	ID     string              `xml:"Id,omitempty"`
+	Topic  string              `xml:"Topic"`
+	Events []string            `xml:"Event"`
+	Filter *NotificationFilter `xml:"Filter"`
+}
+
+type QueueConfiguration struct {
+	ID     string              `xml:"Id,omitempty"`
+	Queue  string              `xml:"Queue"`
+	Events []string            `xml:"Event"`
+	Filter *NotificationFilter `xml:"Filter"`
+}
+
+type NotificationFilter struct {
+	Rules []FilterRule `xml:"S3Key>FilterRule"`
+}
+
+type FilterRule struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
+}
+
+// parseNotificationTarget validates one queue or topic configuration and
+// converts it to its stored form
+func parseNotificationTarget(id, targetType, arn string, events []string, filter *NotificationFilter) (storage.NotificationTarget, error) {
+	target := storage.NotificationTarget{ID: id, Type: targetType, ARN: arn}
+
+	service := "sqs"
+	if targetType == storage.NotificationTopic {
+		service = "sns"
+	}
+	if _, err := notify.ResourceName(arn); err != nil || !strings.HasPrefix(arn, "arn:aws:"+service+":") {
+		return target, fmt.Errorf("The ARN is not well formed: %s", arn)
+	}
+
+	if len(events) == 0 {
+		return target, errors.New("At least one event must be specified")
+	}
+	for _, event := range events {
+		if !supportedEvents[event] {
+			return target, fmt.Errorf("The event is not supported for notifications: %s", event)
+		}
+	}
+	target.Events = events
+
+	if filter != nil {
+		seen := make(map[string]bool)
+		for _, rule := range filter.Rules {
+			name := strings.ToLower(rule.Name)
+			if seen[name] {
+				return target, fmt.Errorf("Cannot specify more than one %s rule in a filter.", name)
+			}
+			seen[name] = true
+			switch name {
+			case "prefix":
+				target.Prefix = rule.Value
+			case "suffix":
+				target.Suffix = rule.Value
+			default:
+				return target, errors.New("filter rule name must be either prefix or suffix")
+			}
+		}
+	}
+
+	if target.ID == "" {
+		target.ID = generateRuleID()
+	}
+	return target, nil
+}
+
+// formatNotificationFilter converts a stored key filter back to its XML form
+func formatNotificationFilter(target storage.NotificationTarget) *NotificationFilter {
+	var rules []FilterRule
+	if target.Prefix != "" {
+		rules = append(rules, FilterRule{Name: "Prefix", Value: target.Prefix})
+	}
+	if target.Suffix != "" {
+		rules = append(rules, FilterRule{Name: "Suffix", Value: target.Suffix})
+	}
+	if rules == nil {
+		return nil
+	}
+	return &NotificationFilter{Rules: rules}
+}
+
+// handlePutBucketNotification handles PUT /{bucket}?notification
+func (s *Server) handlePutBucketNotification(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config NotificationConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+
+	if len(config.LambdaConfigurations) > 0 || config.EventBridge != nil {
+		s.sendError(w, r, "InvalidArgument", "Only queue and topic destinations are supported", http.StatusBadRequest)
+		return
+	}
+
+	var targets []storage.NotificationTarget
+	for _, c := range config.QueueConfigurations {
+		target, err := parseNotificationTarget(c.ID, storage.NotificationQueue, c.Queue, c.Events, c.Filter)
+		if err != nil {
+			s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+			return
+		}
+		targets = append(targets, target)
+	}
+	for _, c := range config.TopicConfigurations {
+		target, err := parseNotificationTarget(c.ID, storage.NotificationTopic, c.Topic, c.Events, c.Filter)
+		if err != nil {
+			s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+			return
+		}
+		targets = append(targets, target)
+	}
+
+	if _, err := s.storage.HeadBucket(bucket); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	// Like S3, validate each destination by sending it a test event
+	test := notify.NewTestEvent(bucket, s.requestInfo(r))
+	var unreachable []string
+	for _, target := range targets {
+		if err := s.notifier.Deliver(r.Context(), target, test); err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", target.ARN, err))
+		}
+	}
+	if len(unreachable) > 0 {
+		s.sendError(w, r, "InvalidArgument", "Unable to validate the following destination configurations: "+strings.Join(unreachable, ", "), http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Notifications = targets
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketNotification handles GET /{bucket}?notification
+func (s *Server) handleGetBucketNotification(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	result := NotificationConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	for _, target := range info.Notifications {
+		switch target.Type {
+		case storage.NotificationQueue:
+			result.QueueConfigurations = append(result.QueueConfigurations, QueueConfiguration{
+				ID:     target.ID,
+				Queue:  target.ARN,
+				Events: target.Events,
+				Filter: formatNotificationFilter(target),
+			})
+		case storage.NotificationTopic:
+			result.TopicConfigurations = append(result.TopicConfigurations, TopicConfiguration{
+				ID:     target.ID,
+				Topic:  target.ARN,
+				Events: target.Events,
+				Filter: formatNotificationFilter(target),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// notifyEvent sends an event, named like ObjectCreated:Put, to every
+// destination of the bucket that subscribes to it
+func (s *Server) notifyEvent(r *http.Request, bucket, eventName string, object notify.ObjectInfo) {
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil || len(info.Notifications) == 0 {
+		return
+	}
+
+	req := s.requestInfo(r)
+	for _, target := range info.Notifications {
+		if !target.Matches("s3:"+eventName, object.Key) {
+			continue
+		}
+		record := notify.NewRecord(eventName, target.ID, bucket, object, req)
+		s.notifier.Publish(target, notify.Event{Records: []notify.Record{record}})
+	}
+}
+
+// notifyDeleted sends the ObjectRemoved event for a completed delete. When a
+// delete marker was created, versionID is the marker's version.
+func (s *Server) notifyDeleted(r *http.Request, bucket, key, versionID string, deleteMarker bool) {
+	eventName := "ObjectRemoved:Delete"
+	if deleteMarker {
+		eventName = "ObjectRemoved:DeleteMarkerCreated"
+	}
+	s.notifyEvent(r, bucket, eventName, notify.ObjectInfo{Key: key, VersionID: versionID})
+}
+
+// objectInfo describes a stored object for an event record
+func objectInfo(meta *storage.ObjectMetadata) notify.ObjectInfo {
+	return notify.ObjectInfo{
+		Key:       meta.Key,
+		Size:      meta.Size,
+		ETag:      meta.ETag,
+		VersionID: meta.VersionID,
+	}
+}
+
+// requestInfo collects the request details reported in event records
+func (s *Server) requestInfo(r *http.Request) notify.RequestInfo {
+	principal := "anonymous"
+	if auth := authFromContext(r.Context()); auth != nil {
+		principal = auth.AccessKeyID
+	}
+
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+
+	return notify.RequestInfo{
+		Region:      s.config.Region,
+		PrincipalID: principal,
+		SourceIP:    sourceIP,
+		RequestID:   middleware.GetReqID(r.Context()),
+		Time:        time.Now(),
+	}
+}
@@ -0,0 +1,354 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// Object Lock request headers
+const (
+	lockModeHeader         = "x-amz-object-lock-mode"
+	lockRetainUntilHeader  = "x-amz-object-lock-retain-until-date"
+	lockLegalHoldHeader    = "x-amz-object-lock-legal-hold"
+	bypassGovernanceHeader = "x-amz-bypass-governance-retention"
+)
+
+var (
+	// errLockRequiresVersioning rejects an Object Lock configuration on a
+	// bucket without versioning enabled
+	errLockRequiresVersioning = errors.New("Versioning must be 'Enabled' on the bucket to apply a Object Lock configuration")
+
+	// errLockedVersioning rejects suspending versioning on a bucket with
+	// Object Lock enabled
+	errLockedVersioning = errors.New("An Object Lock configuration is present on this bucket, so the versioning state cannot be changed.")
+)
+
+type ObjectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	Xmlns             string          `xml:"xmlns,attr,omitempty"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled"`
+	Rule              *ObjectLockRule `xml:"Rule,omitempty"`
+}
+
+type ObjectLockRule struct {
+	DefaultRetention *DefaultRetention `xml:"DefaultRetention"`
+}
+
+type DefaultRetention struct {
+	Mode  string `xml:"Mode"`
+	Days  int    `xml:"Days,omitempty"`
+	Years int    `xml:"Years,omitempty"`
+}
+
+type Retention struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Xmlns           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode,omitempty"`
+	RetainUntilDate string   `xml:"RetainUntilDate,omitempty"`
+}
+
+type LegalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"`
+}
+
+// validRetentionMode reports whether mode is an Object Lock retention mode
+func validRetentionMode(mode string) bool {
+	return mode == storage.RetentionGovernance || mode == storage.RetentionCompliance
+}
+
+// parseRetainUntil parses a retain-until date, which must lie in the future
+func parseRetainUntil(value string) (time.Time, error) {
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("The retain until date must be in ISO 8601 format")
+	}
+	if !until.After(time.Now()) {
+		return time.Time{}, errors.New("The retain until date must be in the future!")
+	}
+	return until.UTC(), nil
+}
+
+// bucketObjectLock returns a bucket's Object Lock configuration, writing an
+// error and returning false when the bucket does not have Object Lock
+func (s *Server) bucketObjectLock(w http.ResponseWriter, r *http.Request, bucket string) (*storage.ObjectLockConfig, bool) {
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return nil, false
+	}
+	if info.ObjectLock == nil {
+		s.sendError(w, r, "InvalidRequest", "Bucket is missing Object Lock Configuration", http.StatusBadRequest)
+		return nil, false
+	}
+	return info.ObjectLock, true
+}
+
+// requestObjectLock returns the retention and legal hold a write asks for
+// through its Object Lock headers, falling back to the bucket's default
+// retention. It writes an error and returns false when the headers are
+// invalid or the bucket does not have Object Lock.
+func (s *Server) requestObjectLock(w http.ResponseWriter, r *http.Request, bucket string) (*storage.Retention, bool, bool) {
+	mode := r.Header.Get(lockModeHeader)
+	retainUntil := r.Header.Get(lockRetainUntilHeader)
+	legalHold := r.Header.Get(lockLegalHoldHeader)
+
+	if mode == "" && retainUntil == "" && legalHold == "" {
+		info, err := s.storage.HeadBucket(bucket)
+		if err != nil || info.ObjectLock == nil || info.ObjectLock.DefaultRetention == nil {
+			return nil, false, true
+		}
+		def := info.ObjectLock.DefaultRetention
+		return &storage.Retention{Mode: def.Mode, RetainUntil: def.RetainUntil(time.Now().UTC())}, false, true
+	}
+
+	config, ok := s.bucketObjectLock(w, r, bucket)
+	if !ok {
+		return nil, false, false
+	}
+
+	switch {
+	case (mode == "") != (retainUntil == ""):
+		s.sendError(w, r, "InvalidArgument", "x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied", http.StatusBadRequest)
+		return nil, false, false
+	case mode != "" && !validRetentionMode(mode):
+		s.sendError(w, r, "InvalidArgument", "Unknown wormMode directive.", http.StatusBadRequest)
+		return nil, false, false
+	case legalHold != "" && legalHold != "ON" && legalHold != "OFF":
+		s.sendError(w, r, "InvalidArgument", "Legal Hold must be either of 'ON' or 'OFF'", http.StatusBadRequest)
+		return nil, false, false
+	}
+
+	var retention *storage.Retention
+	if mode != "" {
+		until, err := parseRetainUntil(retainUntil)
+		if err != nil {
+			s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+			return nil, false, false
+		}
+		retention = &storage.Retention{Mode: mode, RetainUntil: until}
+	} else if def := config.DefaultRetention; def != nil {
+		retention = &storage.Retention{Mode: def.Mode, RetainUntil: def.RetainUntil(time.Now().UTC())}
+	}
+
+	return retention, legalHold == "ON", true
+}
+
+// bypassGovernance reports whether a request asks to bypass GOVERNANCE
+// retention and is allowed to. Without s3:BypassGovernanceRetention the
+// header is ignored, leaving the retention to deny the request.
+func (s *Server) bypassGovernance(r *http.Request, bucket, key string) bool {
+	if !strings.EqualFold(r.Header.Get(bypassGovernanceHeader), "true") {
+		return false
+	}
+	return s.checkAccess(r, "s3:BypassGovernanceRetention", bucket, key)
+}
+
+// setObjectLockHeaders reports an object's retention and legal hold
+func setObjectLockHeaders(w http.ResponseWriter, meta *storage.ObjectMetadata) {
+	if meta.Retention != nil {
+		w.Header().Set(lockModeHeader, meta.Retention.Mode)
+		w.Header().Set(lockRetainUntilHeader, meta.Retention.RetainUntil.UTC().Format(time.RFC3339))
+	}
+	if meta.LegalHold {
+		w.Header().Set(lockLegalHoldHeader, "ON")
+	}
+}
+
+// handlePutBucketObjectLock handles PUT /{bucket}?object-lock
+func (s *Server) handlePutBucketObjectLock(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config ObjectLockConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil || config.ObjectLockEnabled != "Enabled" {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var defaultRetention *storage.DefaultRetention
+	if config.Rule != nil {
+		def := config.Rule.DefaultRetention
+		switch {
+		case def == nil || !validRetentionMode(def.Mode):
+			s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+			return
+		case (def.Days > 0) == (def.Years > 0) || def.Days < 0 || def.Years < 0:
+			s.sendError(w, r, "InvalidArgument", "Default retention period must be a positive number of either days or years", http.StatusBadRequest)
+			return
+		}
+		defaultRetention = &storage.DefaultRetention{Mode: def.Mode, Days: def.Days, Years: def.Years}
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		if info.Versioning != storage.VersioningEnabled {
+			return errLockRequiresVersioning
+		}
+		info.ObjectLock = &storage.ObjectLockConfig{DefaultRetention: defaultRetention}
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketObjectLock handles GET /{bucket}?object-lock
+func (s *Server) handleGetBucketObjectLock(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if info.ObjectLock == nil {
+		s.sendError(w, r, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket", http.StatusNotFound)
+		return
+	}
+
+	result := ObjectLockConfiguration{
+		Xmlns:             "http://s3.amazonaws.com/doc/2006-03-01/",
+		ObjectLockEnabled: "Enabled",
+	}
+	if def := info.ObjectLock.DefaultRetention; def != nil {
+		result.Rule = &ObjectLockRule{DefaultRetention: &DefaultRetention{Mode: def.Mode, Days: def.Days, Years: def.Years}}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handlePutObjectRetention handles PUT /{bucket}/{key}?retention
+func (s *Server) handlePutObjectRetention(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	var config Retention
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.bucketObjectLock(w, r, bucket); !ok {
+		return
+	}
+
+	// An empty retention removes it, which only GOVERNANCE bypass allows
+	var retention *storage.Retention
+	if config.Mode != "" || config.RetainUntilDate != "" {
+		if !validRetentionMode(config.Mode) || config.RetainUntilDate == "" {
+			s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+			return
+		}
+		until, err := parseRetainUntil(config.RetainUntilDate)
+		if err != nil {
+			s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+			return
+		}
+		retention = &storage.Retention{Mode: config.Mode, RetainUntil: until}
+	}
+
+	meta, err := s.storage.PutObjectRetention(bucket, key, r.URL.Query().Get("versionId"), retention, s.bypassGovernance(r, bucket, key))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetObjectRetention handles GET /{bucket}/{key}?retention
+func (s *Server) handleGetObjectRetention(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	if _, ok := s.bucketObjectLock(w, r, bucket); !ok {
+		return
+	}
+
+	meta, err := s.storage.HeadObject(bucket, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if meta.Retention == nil {
+		s.sendError(w, r, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration", http.StatusNotFound)
+		return
+	}
+
+	result := Retention{
+		Xmlns:           "http://s3.amazonaws.com/doc/2006-03-01/",
+		Mode:            meta.Retention.Mode,
+		RetainUntilDate: meta.Retention.RetainUntil.UTC().Format(time.RFC3339),
+	}
+
+	setVersionHeaders(w, meta)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handlePutObjectLegalHold handles PUT /{bucket}/{key}?legal-hold
+func (s *Server) handlePutObjectLegalHold(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	var config LegalHold
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil || (config.Status != "ON" && config.Status != "OFF") {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.bucketObjectLock(w, r, bucket); !ok {
+		return
+	}
+
+	meta, err := s.storage.PutObjectLegalHold(bucket, key, r.URL.Query().Get("versionId"), config.Status == "ON")
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetObjectLegalHold handles GET /{bucket}/{key}?legal-hold
+func (s *Server) handleGetObjectLegalHold(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	if _, ok := s.bucketObjectLock(w, r, bucket); !ok {
+		return
+	}
+
+	meta, err := s.storage.HeadObject(bucket, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	result := LegalHold{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		Status: "OFF",
+	}
+	if meta.LegalHold {
+		result.Status = "ON"
+	}
+
+	setVersionHeaders(w, meta)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
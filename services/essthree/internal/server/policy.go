@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/policy"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// errPublicPolicyBlocked rejects a public policy on a bucket whose public
+// access block sets BlockPublicPolicy
+var errPublicPolicyBlocked = errors.New("public policies are blocked by the BlockPublicPolicy setting")
+
+type PolicyStatus struct {
+	XMLName  xml.Name `xml:"PolicyStatus"`
+	Xmlns    string   `xml:"xmlns,attr,omitempty"`
+	IsPublic bool     `xml:"IsPublic"`
+}
+
+type PublicAccessBlockConfiguration struct {
+	XMLName               xml.Name `xml:"PublicAccessBlockConfiguration"`
+	Xmlns                 string   `xml:"xmlns,attr,omitempty"`
+	BlockPublicAcls       bool     `xml:"BlockPublicAcls"`
+	IgnorePublicAcls      bool     `xml:"IgnorePublicAcls"`
+	BlockPublicPolicy     bool     `xml:"BlockPublicPolicy"`
+	RestrictPublicBuckets bool     `xml:"RestrictPublicBuckets"`
+}
+
+// handlePutBucketPolicy handles PUT /{bucket}?policy
+func (s *Server) handlePutBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	document, err := io.ReadAll(io.LimitReader(r.Body, policy.MaxSize+1))
+	if err != nil {
+		s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p, err := policy.Parse(document, bucket)
+	if err != nil {
+		s.sendError(w, r, "MalformedPolicy", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		if block := info.PublicAccessBlock; block != nil && block.BlockPublicPolicy && p.IsPublic() {
+			return errPublicPolicyBlocked
+		}
+		info.Policy = string(document)
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetBucketPolicy handles GET /{bucket}?policy
+func (s *Server) handleGetBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if info.Policy == "" {
+		s.sendError(w, r, "NoSuchBucketPolicy", "The bucket policy does not exist", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, info.Policy)
+}
+
+// handleDeleteBucketPolicy handles DELETE /{bucket}?policy
+func (s *Server) handleDeleteBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Policy = ""
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetBucketPolicyStatus handles GET /{bucket}?policyStatus
+func (s *Server) handleGetBucketPolicyStatus(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if info.Policy == "" {
+		s.sendError(w, r, "NoSuchBucketPolicy", "The bucket policy does not exist", http.StatusNotFound)
+		return
+	}
+
+	result := PolicyStatus{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	if p, err := policy.Parse([]byte(info.Policy), bucket); err == nil {
+		result.IsPublic = p.IsPublic()
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handlePutPublicAccessBlock handles PUT /{bucket}?publicAccessBlock
+func (s *Server) handlePutPublicAccessBlock(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config PublicAccessBlockConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.PublicAccessBlock = &storage.PublicAccessBlock{
+			BlockPublicAcls:       config.BlockPublicAcls,
+			IgnorePublicAcls:      config.IgnorePublicAcls,
+			BlockPublicPolicy:     config.BlockPublicPolicy,
+			RestrictPublicBuckets: config.RestrictPublicBuckets,
+		}
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetPublicAccessBlock handles GET /{bucket}?publicAccessBlock
+func (s *Server) handleGetPublicAccessBlock(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	block := info.PublicAccessBlock
+	if block == nil {
+		s.sendError(w, r, "NoSuchPublicAccessBlockConfiguration", "The public access block configuration was not found", http.StatusNotFound)
+		return
+	}
+
+	result := PublicAccessBlockConfiguration{
+		Xmlns:                 "http://s3.amazonaws.com/doc/2006-03-01/",
+		BlockPublicAcls:       block.BlockPublicAcls,
+		IgnorePublicAcls:      block.IgnorePublicAcls,
+		BlockPublicPolicy:     block.BlockPublicPolicy,
+		RestrictPublicBuckets: block.RestrictPublicBuckets,
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleDeletePublicAccessBlock handles DELETE /{bucket}?publicAccessBlock
+func (s *Server) handleDeletePublicAccessBlock(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.PublicAccessBlock = nil
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
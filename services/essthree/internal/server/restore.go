@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+const (
+	storageClassHeader = "x-amz-storage-class"
+	restoreHeader      = "x-amz-restore"
+)
+
+type RestoreRequest struct {
+	XMLName              xml.Name              `xml:"RestoreRequest"`
+	Days                 int                   `xml:"Days"`
+	Type                 string                `xml:"Type"`
+	Tier                 string                `xml:"Tier"`
+	GlacierJobParameters *GlacierJobParameters `xml:"GlacierJobParameters"`
+}
+
+type GlacierJobParameters struct {
+	Tier string `xml:"Tier"`
+}
+
+// restoreTiers are the retrieval tiers a restore may ask for. ess-three
+// restores every tier after the same --restore-delay.
+var restoreTiers = map[string]bool{"": true, "Expedited": true, "Standard": true, "Bulk": true}
+
+// requestStorageClass reads x-amz-storage-class, writing an
+// InvalidStorageClass error and returning false when it is not a storage
+// class. STANDARD is returned as empty, as objects store it.
+func (s *Server) requestStorageClass(w http.ResponseWriter, r *http.Request) (string, bool) {
+	class := r.Header.Get(storageClassHeader)
+	if class != "" && !storage.StorageClasses[class] {
+		s.sendError(w, r, "InvalidStorageClass", "The storage class you specified is not valid", http.StatusBadRequest)
+		return "", false
+	}
+	if class == storage.StorageClassStandard {
+		class = ""
+	}
+	return class, true
+}
+
+// storageClass returns the storage class listings report, STANDARD when
+// none is stored
+func storageClass(class string) string {
+	if class == "" {
+		return storage.StorageClassStandard
+	}
+	return class
+}
+
+// setStorageClassHeaders reports an object's storage class, unless it is
+// STANDARD, and the status of its restore
+func setStorageClassHeaders(w http.ResponseWriter, meta *storage.ObjectMetadata) {
+	if meta.StorageClass != "" {
+		w.Header().Set(storageClassHeader, meta.StorageClass)
+	}
+
+	now := time.Now()
+	switch {
+	case meta.Restore.Ongoing(now):
+		w.Header().Set(restoreHeader, `ongoing-request="true"`)
+	case meta.Restore.Available(now):
+		w.Header().Set(restoreHeader, fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, meta.Restore.Expiry.UTC().Format(http.TimeFormat)))
+	}
+}
+
+// handleRestoreObject handles POST /{bucket}/{key}?restore - RestoreObject.
+// The restored copy becomes readable after the configured restore delay.
+func (s *Server) handleRestoreObject(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+	versionID := r.URL.Query().Get("versionId")
+
+	var req RestoreRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+	if req.Type != "" {
+		s.sendError(w, r, "NotImplemented", "Select restores are not supported.", http.StatusNotImplemented)
+		return
+	}
+	tier := req.Tier
+	if req.GlacierJobParameters != nil {
+		tier = req.GlacierJobParameters.Tier
+	}
+	if !restoreTiers[tier] {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+	if req.Days < 1 {
+		s.sendError(w, r, "InvalidArgument", "The restore request must specify a number of days of at least 1.", http.StatusBadRequest)
+		return
+	}
+
+	restored, err := s.storage.RestoreObject(bucket, key, versionID, req.Days, time.Now().Add(s.config.RestoreDelay))
+	switch {
+	case errors.Is(err, storage.ErrInvalidObjectState):
+		s.sendError(w, r, "InvalidObjectState", "Restore is not allowed for the object's current storage class", http.StatusForbidden)
+		return
+	case err != nil:
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	// A new restore is accepted; extending a restored copy succeeds at once
+	if restored {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
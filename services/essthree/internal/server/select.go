@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/s3select"
+)
+
+type SelectObjectContentRequest struct {
+	XMLName             xml.Name                     `xml:"SelectObjectContentRequest"`
+	Expression          string                       `xml:"Expression"`
+	ExpressionType      string                       `xml:"ExpressionType"`
+	InputSerialization  s3select.InputSerialization  `xml:"InputSerialization"`
+	OutputSerialization s3select.OutputSerialization `xml:"OutputSerialization"`
+	RequestProgress     struct {
+		Enabled bool `xml:"Enabled"`
+	} `xml:"RequestProgress"`
+	ScanRange *struct{} `xml:"ScanRange"`
+}
+
+// flushWriter flushes every event stream message to the client as soon as
+// it is written
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
+
+// handleSelectObjectContent filters a CSV or JSON object with an SQL
+// expression and streams the matching records as an event stream
+func (s *Server) handleSelectObjectContent(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	if r.URL.Query().Get("select-type") != "2" {
+		s.sendError(w, r, "InvalidArgument", "The select-type parameter must be 2.", http.StatusBadRequest)
+		return
+	}
+
+	var req SelectObjectContentRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+	if req.InputSerialization.Parquet != nil {
+		s.sendError(w, r, "NotImplemented", "Parquet input is not supported.", http.StatusNotImplemented)
+		return
+	}
+	if req.ScanRange != nil {
+		s.sendError(w, r, "NotImplemented", "ScanRange is not supported.", http.StatusNotImplemented)
+		return
+	}
+
+	sel, err := s3select.Prepare(s3select.Request{
+		Expression:     req.Expression,
+		ExpressionType: req.ExpressionType,
+		Input:          req.InputSerialization,
+		Output:         req.OutputSerialization,
+		Progress:       req.RequestProgress.Enabled,
+	})
+	if err != nil {
+		var selectErr *s3select.Error
+		if !errors.As(err, &selectErr) {
+			s.sendError(w, r, "InternalError", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.sendError(w, r, selectErr.Code, selectErr.Message, http.StatusBadRequest)
+		return
+	}
+
+	reader, metadata, err := s.storage.GetObject(bucket, key, "")
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	defer reader.Close()
+
+	if !s.checkCustomerKey(w, r, metadata.Encryption, false) {
+		return
+	}
+
+	w.Header().Set("Server", "ess-three")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	sel.Run(&flushWriter{w: w, flusher: flusher}, reader)
+}
@@ -5,21 +5,69 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tony/ess-three/internal/notify"
 	"github.com/tony/ess-three/internal/storage"
 )
 
+// Config holds optional server settings
+type Config struct {
+	// Credentials maps access key IDs to secret access keys. When set, S3
+	// requests must be signed with AWS Signature Version 4.
+	Credentials map[string]string
+
+	// Region is the region requests are signed for and buckets report
+	Region string
+
+	// Identities maps access key IDs to the IAM principal ARNs bucket
+	// policies see. Keys without an identity act as the account root.
+	Identities map[string]string
+
+	// BaseDomains enables virtual-hosted-style addressing for hosts of the
+	// form <bucket>.<base domain>, e.g. mybucket.localhost
+	BaseDomains []string
+
+	// SQSEndpoint and SNSEndpoint receive bucket event notifications
+	SQSEndpoint string
+	SNSEndpoint string
+
+	// RestoreDelay is how long a restore of an archived object takes
+	RestoreDelay time.Duration
+}
+
 // Server represents the S3 API server
 type Server struct {
-	storage storage.Storage
+	storage  storage.Storage
+	config   Config
+	notifier *notify.Dispatcher
 }
 
 // NewServer creates a new S3 API server
-func NewServer(storage storage.Storage) *Server {
+func NewServer(storage storage.Storage, config Config) *Server {
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+
+	// Match the most specific base domain first, so s3.localhost wins over localhost
+	domains := make([]string, 0, len(config.BaseDomains))
+	for _, domain := range config.BaseDomains {
+		if domain = strings.ToLower(strings.Trim(domain, ". ")); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return len(domains[i]) > len(domains[j]) })
+	config.BaseDomains = domains
+
 	return &Server{
-		storage: storage,
+		storage:  storage,
+		config:   config,
+		notifier: notify.NewDispatcher(config.SQSEndpoint, config.SNSEndpoint),
 	}
 }
 
@@ -31,16 +79,101 @@ func (s *Server) Router() http.Handler {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(s.cors)
+	r.Use(s.authenticate)
+	r.Use(s.virtualHostedStyle)
+	r.Use(s.authorize)
 
-	// Health check
+	// Health check and admin API, see serviceRoutes
 	r.Get("/health", s.handleHealth)
 	r.Get("/admin/api/buckets", s.handleAdminBuckets)
+	r.Post("/admin/api/presign", s.handleAdminPresign)
 
 	// S3 API routes
+	// Service operations
+	r.Get("/", s.handleListBuckets)
+
 	// Bucket operations
 	r.Route("/{bucket}", func(r chi.Router) {
-		// List objects (supports both V1 and V2)
-		r.Get("/", s.handleListObjects)
+		r.Put("/", func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case hasQuery(req, "acl"):
+				s.handlePutBucketAcl(w, req)
+			case hasQuery(req, "policy"):
+				s.handlePutBucketPolicy(w, req)
+			case hasQuery(req, "publicAccessBlock"):
+				s.handlePutPublicAccessBlock(w, req)
+			case hasQuery(req, "encryption"):
+				s.handlePutBucketEncryption(w, req)
+			case hasQuery(req, "versioning"):
+				s.handlePutBucketVersioning(w, req)
+			case hasQuery(req, "lifecycle"):
+				s.handlePutBucketLifecycle(w, req)
+			case hasQuery(req, "cors"):
+				s.handlePutBucketCors(w, req)
+			case hasQuery(req, "notification"):
+				s.handlePutBucketNotification(w, req)
+			case hasQuery(req, "object-lock"):
+				s.handlePutBucketObjectLock(w, req)
+			case hasQuery(req, "website"):
+				s.handlePutBucketWebsite(w, req)
+			default:
+				s.handleCreateBucket(w, req)
+			}
+		})
+		r.Head("/", s.handleHeadBucket)
+		r.Delete("/", func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case hasQuery(req, "policy"):
+				s.handleDeleteBucketPolicy(w, req)
+			case hasQuery(req, "publicAccessBlock"):
+				s.handleDeletePublicAccessBlock(w, req)
+			case hasQuery(req, "encryption"):
+				s.handleDeleteBucketEncryption(w, req)
+			case hasQuery(req, "lifecycle"):
+				s.handleDeleteBucketLifecycle(w, req)
+			case hasQuery(req, "cors"):
+				s.handleDeleteBucketCors(w, req)
+			case hasQuery(req, "website"):
+				s.handleDeleteBucketWebsite(w, req)
+			default:
+				s.handleDeleteBucket(w, req)
+			}
+		})
+
+		r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case hasQuery(req, "acl"):
+				s.handleGetBucketAcl(w, req)
+			case hasQuery(req, "policy"):
+				s.handleGetBucketPolicy(w, req)
+			case hasQuery(req, "policyStatus"):
+				s.handleGetBucketPolicyStatus(w, req)
+			case hasQuery(req, "publicAccessBlock"):
+				s.handleGetPublicAccessBlock(w, req)
+			case hasQuery(req, "encryption"):
+				s.handleGetBucketEncryption(w, req)
+			case hasQuery(req, "versioning"):
+				s.handleGetBucketVersioning(w, req)
+			case hasQuery(req, "lifecycle"):
+				s.handleGetBucketLifecycle(w, req)
+			case hasQuery(req, "cors"):
+				s.handleGetBucketCors(w, req)
+			case hasQuery(req, "notification"):
+				s.handleGetBucketNotification(w, req)
+			case hasQuery(req, "object-lock"):
+				s.handleGetBucketObjectLock(w, req)
+			case hasQuery(req, "website"):
+				s.handleGetBucketWebsite(w, req)
+			case hasQuery(req, "versions"):
+				s.handleListObjectVersions(w, req)
+			case hasQuery(req, "uploads"):
+				s.handleListMultipartUploads(w, req)
+			default:
+				// List objects (supports both V1 and V2)
+				s.handleListObjects(w, req)
+			}
+		})
 
 		// Batch delete
 		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
@@ -51,50 +184,118 @@ func (s *Server) Router() http.Handler {
 			}
 		})
 
-		// Object operations
-		r.Route("/{key:.*}", func(r chi.Router) {
-			r.Head("/", s.handleHeadObject)
-
-			r.Get("/", s.handleGetObject)
-
-			r.Put("/", func(w http.ResponseWriter, req *http.Request) {
-				// Check if this is a multipart operation
-				_, hasPartNumber := req.URL.Query()["partNumber"]
-				_, hasUploadId := req.URL.Query()["uploadId"]
-				if hasPartNumber && hasUploadId {
-					s.handleUploadPart(w, req)
-				} else {
-					s.handlePutObject(w, req)
-				}
-			})
-
-			r.Post("/", func(w http.ResponseWriter, req *http.Request) {
-				// Check what type of POST this is
-				_, hasUploads := req.URL.Query()["uploads"]
-				_, hasUploadId := req.URL.Query()["uploadId"]
-
-				if hasUploads {
-					s.handleCreateMultipartUpload(w, req)
-				} else if hasUploadId {
-					s.handleCompleteMultipartUpload(w, req)
-				} else {
-					http.Error(w, "Not Found", http.StatusNotFound)
-				}
-			})
-
-			r.Delete("/", func(w http.ResponseWriter, req *http.Request) {
-				if _, ok := req.URL.Query()["uploadId"]; ok {
-					s.handleAbortMultipartUpload(w, req)
-				} else {
-					s.handleDeleteObject(w, req)
-				}
-			})
+		// Object operations. The wildcard matches keys containing slashes.
+		r.Head("/*", s.handleHeadObject)
+
+		r.Get("/*", func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case hasQuery(req, "tagging"):
+				s.handleGetObjectTagging(w, req)
+			case hasQuery(req, "acl"):
+				s.handleGetObjectAcl(w, req)
+			case hasQuery(req, "retention"):
+				s.handleGetObjectRetention(w, req)
+			case hasQuery(req, "legal-hold"):
+				s.handleGetObjectLegalHold(w, req)
+			case hasQuery(req, "uploadId"):
+				s.handleListParts(w, req)
+			default:
+				s.handleGetObject(w, req)
+			}
+		})
+
+		r.Put("/*", func(w http.ResponseWriter, req *http.Request) {
+			// Check if this is a multipart operation or a server-side copy
+			_, hasPartNumber := req.URL.Query()["partNumber"]
+			_, hasUploadId := req.URL.Query()["uploadId"]
+			isCopy := req.Header.Get("x-amz-copy-source") != ""
+			switch {
+			case hasQuery(req, "tagging"):
+				s.handlePutObjectTagging(w, req)
+			case hasQuery(req, "acl"):
+				s.handlePutObjectAcl(w, req)
+			case hasQuery(req, "retention"):
+				s.handlePutObjectRetention(w, req)
+			case hasQuery(req, "legal-hold"):
+				s.handlePutObjectLegalHold(w, req)
+			case hasPartNumber && hasUploadId && isCopy:
+				s.handleUploadPartCopy(w, req)
+			case hasPartNumber && hasUploadId:
+				s.handleUploadPart(w, req)
+			case isCopy:
+				s.handleCopyObject(w, req)
+			default:
+				s.handlePutObject(w, req)
+			}
+		})
+
+		r.Post("/*", func(w http.ResponseWriter, req *http.Request) {
+			// Check what type of POST this is
+			_, hasUploads := req.URL.Query()["uploads"]
+			_, hasUploadId := req.URL.Query()["uploadId"]
+
+			if hasQuery(req, "select") {
+				s.handleSelectObjectContent(w, req)
+			} else if hasQuery(req, "restore") {
+				s.handleRestoreObject(w, req)
+			} else if hasUploads {
+				s.handleCreateMultipartUpload(w, req)
+			} else if hasUploadId {
+				s.handleCompleteMultipartUpload(w, req)
+			} else {
+				http.Error(w, "Not Found", http.StatusNotFound)
+			}
+		})
+
+		r.Delete("/*", func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case hasQuery(req, "tagging"):
+				s.handleDeleteObjectTagging(w, req)
+			case hasQuery(req, "uploadId"):
+				s.handleAbortMultipartUpload(w, req)
+			default:
+				s.handleDeleteObject(w, req)
+			}
 		})
 	})
 
 	return r
 }
 
+// serviceRoutes are the health and admin endpoints registered by Router.
+// They are not S3 operations, so authentication and authorization skip them.
+var serviceRoutes = map[string]bool{
+	http.MethodGet + " /health":             true,
+	http.MethodGet + " /admin/api/buckets":  true,
+	http.MethodPost + " /admin/api/presign": true,
+}
+
+// isServiceRoute reports whether r is for a health or admin endpoint. Paths
+// on a virtual-hosted bucket, and other methods on the same paths, are
+// object and bucket requests like any other.
+func (s *Server) isServiceRoute(r *http.Request) bool {
+	return serviceRoutes[r.Method+" "+r.URL.Path] && s.bucketFromHost(r.Host) == ""
+}
+
+// hasQuery reports whether a subresource or parameter is present in the
+// query string, with or without a value
+func hasQuery(r *http.Request, name string) bool {
+	_, ok := r.URL.Query()[name]
+	return ok
+}
+
+// objectKey returns the object key captured by the wildcard route. chi reads
+// the escaped path when it contains encoded slashes, so unescape it here.
+func objectKey(r *http.Request) string {
+	key := chi.URLParam(r, "*")
+	if r.URL.RawPath != "" {
+		if unescaped, err := url.PathUnescape(key); err == nil {
+			return unescaped
+		}
+	}
+	return key
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
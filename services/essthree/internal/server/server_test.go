@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// newTestServer returns the router of a server over a fresh in-memory
+// backend, and the backend so tests can set up state directly
+func newTestServer(t *testing.T, config Config) (http.Handler, storage.Storage) {
+	t.Helper()
+	store, err := storage.NewMemoryStorage(0, storage.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return NewServer(store, config).Router(), store
+}
+
+// do sends a request through handler and returns the recorded response
+func do(handler http.Handler, method, target string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBody decodes the XML body of rec into v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := xml.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode %s: %v", rec.Body.String(), err)
+	}
+}
+
+// expectError checks that rec is an S3 error with status and code
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("Expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	var errResp Error
+	decodeBody(t, rec, &errResp)
+	if errResp.Code != code {
+		t.Errorf("Expected error %s, got %s", code, errResp.Code)
+	}
+}
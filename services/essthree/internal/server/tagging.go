@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// S3 limits on object tag sets
+const (
+	maxObjectTags  = 10
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+)
+
+type Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []Tag    `xml:"TagSet>Tag"`
+}
+
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// validateTags checks a tag set against the S3 limits
+func validateTags(tags []Tag) (map[string]string, error) {
+	if len(tags) > maxObjectTags {
+		return nil, fmt.Errorf("Object tags cannot be greater than %d", maxObjectTags)
+	}
+
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		switch {
+		case tag.Key == "" || len(tag.Key) > maxTagKeyLen:
+			return nil, errors.New("The TagKey you have provided is invalid")
+		case len(tag.Value) > maxTagValueLen:
+			return nil, errors.New("The TagValue you have provided is invalid")
+		case strings.HasPrefix(tag.Key, "aws:"):
+			return nil, errors.New("Your TagKey cannot be prefixed with aws:")
+		}
+		if _, dup := result[tag.Key]; dup {
+			return nil, errors.New("Cannot provide multiple Tags with the same key")
+		}
+		result[tag.Key] = tag.Value
+	}
+	return result, nil
+}
+
+// parseTaggingHeader parses an x-amz-tagging header, a URL-encoded query
+// string such as "project=alpha&tier=hot"
+func parseTaggingHeader(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	values, err := url.ParseQuery(header)
+	if err != nil {
+		return nil, errors.New("The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.")
+	}
+
+	tags := make([]Tag, 0, len(values))
+	for key, vals := range values {
+		if len(vals) > 1 {
+			return nil, errors.New("Cannot provide multiple Tags with the same key")
+		}
+		tags = append(tags, Tag{Key: key, Value: vals[0]})
+	}
+	return validateTags(tags)
+}
+
+// requestTags reads x-amz-tagging, writing an InvalidTag error and returning
+// false when it is invalid
+func (s *Server) requestTags(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	tags, err := parseTaggingHeader(r.Header.Get("x-amz-tagging"))
+	if err != nil {
+		s.sendError(w, r, "InvalidTag", err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return tags, true
+}
+
+// setTaggingCountHeader reports how many tags an object has
+func setTaggingCountHeader(w http.ResponseWriter, meta *storage.ObjectMetadata) {
+	if len(meta.Tags) > 0 {
+		w.Header().Set("x-amz-tagging-count", strconv.Itoa(len(meta.Tags)))
+	}
+}
+
+// handleGetObjectTagging handles GET /{bucket}/{key}?tagging
+func (s *Server) handleGetObjectTagging(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	meta, err := s.storage.HeadObject(bucket, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	result := Tagging{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		TagSet: []Tag{},
+	}
+	for k, v := range meta.Tags {
+		result.TagSet = append(result.TagSet, Tag{Key: k, Value: v})
+	}
+	sort.Slice(result.TagSet, func(i, j int) bool {
+		return result.TagSet[i].Key < result.TagSet[j].Key
+	})
+
+	setVersionHeaders(w, meta)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handlePutObjectTagging handles PUT /{bucket}/{key}?tagging
+func (s *Server) handlePutObjectTagging(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	var tagging Tagging
+	if err := xml.NewDecoder(r.Body).Decode(&tagging); err != nil {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := validateTags(tagging.TagSet)
+	if err != nil {
+		s.sendError(w, r, "InvalidTag", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := s.storage.PutObjectTagging(bucket, key, r.URL.Query().Get("versionId"), tags)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleDeleteObjectTagging handles DELETE /{bucket}/{key}?tagging
+func (s *Server) handleDeleteObjectTagging(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := objectKey(r)
+
+	meta, err := s.storage.PutObjectTagging(bucket, key, r.URL.Query().Get("versionId"), nil)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	setVersionHeaders(w, meta)
+	w.WriteHeader(http.StatusNoContent)
+}
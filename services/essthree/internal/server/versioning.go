@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+type VersioningConfiguration struct {
+	XMLName   xml.Name `xml:"VersioningConfiguration"`
+	Xmlns     string   `xml:"xmlns,attr,omitempty"`
+	Status    string   `xml:"Status,omitempty"`
+	MfaDelete string   `xml:"MfaDelete,omitempty"`
+}
+
+type ListVersionsResult struct {
+	XMLName             xml.Name        `xml:"ListVersionsResult"`
+	Xmlns               string          `xml:"xmlns,attr"`
+	Name                string          `xml:"Name"`
+	Prefix              string          `xml:"Prefix"`
+	Delimiter           string          `xml:"Delimiter,omitempty"`
+	KeyMarker           string          `xml:"KeyMarker"`
+	VersionIdMarker     string          `xml:"VersionIdMarker"`
+	NextKeyMarker       string          `xml:"NextKeyMarker,omitempty"`
+	NextVersionIdMarker string          `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int             `xml:"MaxKeys"`
+	EncodingType        string          `xml:"EncodingType,omitempty"`
+	IsTruncated         bool            `xml:"IsTruncated"`
+	Versions            []ObjectVersion `xml:"Version"`
+	DeleteMarkers       []DeleteMarker  `xml:"DeleteMarker"`
+	CommonPrefixes      []CommonPrefix  `xml:"CommonPrefixes"`
+}
+
+type ObjectVersion struct {
+	Key          string    `xml:"Key"`
+	VersionId    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+	Owner        Owner     `xml:"Owner"`
+}
+
+type DeleteMarker struct {
+	Key          string    `xml:"Key"`
+	VersionId    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+	Owner        Owner     `xml:"Owner"`
+}
+
+// handleGetBucketVersioning handles GET /{bucket}?versioning
+func (s *Server) handleGetBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	result := VersioningConfiguration{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		Status: info.Versioning,
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handlePutBucketVersioning handles PUT /{bucket}?versioning
+func (s *Server) handlePutBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config VersioningConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", http.StatusBadRequest)
+		return
+	}
+
+	if config.Status != storage.VersioningEnabled && config.Status != storage.VersioningSuspended {
+		s.sendError(w, r, "IllegalVersioningConfigurationException", "The Versioning element must be specified", http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		if info.ObjectLock != nil && config.Status != storage.VersioningEnabled {
+			return errLockedVersioning
+		}
+		info.Versioning = config.Status
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleListObjectVersions handles GET /{bucket}?versions
+func (s *Server) handleListObjectVersions(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	keyMarker := query.Get("key-marker")
+	versionIDMarker := query.Get("version-id-marker")
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s.sendError(w, r, "InvalidArgument", "Invalid Encoding Method specified in Request", http.StatusBadRequest)
+		return
+	}
+
+	maxKeys, ok := s.maxListEntries(w, r, "max-keys")
+	if !ok {
+		return
+	}
+
+	result, err := s.storage.ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker, maxKeys)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	encode := func(value string) string {
+		return encodeListValue(value, encodingType)
+	}
+	owner := Owner{ID: ownerID, DisplayName: ownerDisplayName}
+
+	response := ListVersionsResult{
+		Xmlns:           "http://s3.amazonaws.com/doc/2006-03-01/",
+		Name:            bucket,
+		Prefix:          encode(prefix),
+		Delimiter:       encode(delimiter),
+		KeyMarker:       encode(keyMarker),
+		VersionIdMarker: versionIDMarker,
+		MaxKeys:         maxKeys,
+		EncodingType:    encodingType,
+		IsTruncated:     result.IsTruncated,
+	}
+	if result.IsTruncated {
+		response.NextKeyMarker = encode(result.NextKeyMarker)
+		response.NextVersionIdMarker = result.NextVersionIDMarker
+	}
+
+	for _, version := range result.Versions {
+		if version.DeleteMarker {
+			response.DeleteMarkers = append(response.DeleteMarkers, DeleteMarker{
+				Key:          encode(version.Key),
+				VersionId:    version.VersionID,
+				IsLatest:     version.IsLatest,
+				LastModified: version.LastModified,
+				Owner:        owner,
+			})
+			continue
+		}
+		response.Versions = append(response.Versions, ObjectVersion{
+			Key:          encode(version.Key),
+			VersionId:    version.VersionID,
+			IsLatest:     version.IsLatest,
+			LastModified: version.LastModified,
+			ETag:         version.ETag,
+			Size:         version.Size,
+			StorageClass: storageClass(version.StorageClass),
+			Owner:        owner,
+		})
+	}
+
+	for _, commonPrefix := range result.CommonPrefixes {
+		response.CommonPrefixes = append(response.CommonPrefixes, CommonPrefix{Prefix: encode(commonPrefix)})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
+
+// setVersionHeaders reports the version ID and delete marker state of an object
+func setVersionHeaders(w http.ResponseWriter, meta *storage.ObjectMetadata) {
+	if meta.VersionID != "" {
+		w.Header().Set("x-amz-version-id", meta.VersionID)
+	}
+	if meta.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// virtualHostedStyle rewrites virtual-hosted-style requests, where the bucket
+// is the first label of a Host under one of the configured base domains, into
+// path-style requests so the bucket routes can serve them.
+//
+//	GET http://mybucket.localhost:9300/photos/cat.jpg
+//	  -> GET /mybucket/photos/cat.jpg
+func (s *Server) virtualHostedStyle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := s.bucketFromHost(r.Host)
+		if bucket == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		if r.URL.Path == "/" || r.URL.Path == "" {
+			// ListObjects and other bucket operations on the bucket root
+			r.URL.Path = "/" + bucket
+		} else {
+			r.URL.Path = "/" + bucket + r.URL.Path
+		}
+		if r.URL.RawPath != "" {
+			r.URL.RawPath = "/" + bucket + r.URL.RawPath
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bucketFromHost returns the bucket named by a virtual-hosted-style Host
+// header, or "" when the host is not under a configured base domain or is a
+// base domain itself
+func (s *Server) bucketFromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	// Base domains are ordered longest first, so a base domain nested in
+	// another is matched before the outer one can claim its first label
+	for _, domain := range s.config.BaseDomains {
+		if host == domain {
+			return ""
+		}
+		if bucket, found := strings.CutSuffix(host, "."+domain); found && bucket != "" {
+			return bucket
+		}
+	}
+	return ""
+}
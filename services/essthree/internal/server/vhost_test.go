@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestBucketFromHost(t *testing.T) {
+	s := NewServer(nil, Config{BaseDomains: []string{"localhost", "s3.localhost", " S3.Local. "}})
+
+	cases := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"Port", "mybucket.localhost:9300", "mybucket"},
+		{"NoPort", "mybucket.localhost", "mybucket"},
+		{"NestedBaseDomain", "mybucket.s3.localhost:9300", "mybucket"},
+		{"NormalizedBaseDomain", "mybucket.s3.local", "mybucket"},
+		{"BareBaseDomain", "localhost:9300", ""},
+		{"BareNestedBaseDomain", "s3.localhost:9300", ""},
+		{"DottedBucket", "my.dotted.bucket.localhost:9300", "my.dotted.bucket"},
+		{"CaseAndTrailingDot", "MyBucket.LocalHost.", "mybucket"},
+		{"OtherDomain", "mybucket.example.com", ""},
+		{"SuffixWithoutDot", "mybucketlocalhost", ""},
+		{"IPAddress", "127.0.0.1:9300", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := s.bucketFromHost(tc.host); got != tc.want {
+				t.Errorf("Expected bucket %q for %s, got %q", tc.want, tc.host, got)
+			}
+		})
+	}
+}
+
+func TestVirtualHostedStyle(t *testing.T) {
+	handler, store := newTestServer(t, Config{BaseDomains: []string{"localhost", "s3.localhost"}})
+	if err := store.CreateBucket("my.bucket"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if _, err := store.PutObject("my.bucket", "photos/cat.jpg", strings.NewReader("meow"), nil, "image/jpeg", storage.PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		target string
+	}{
+		{"VirtualHosted", "http://my.bucket.localhost:9300/photos/cat.jpg"},
+		{"NestedBaseDomain", "http://my.bucket.s3.localhost:9300/photos/cat.jpg"},
+		{"PathStyle", "http://localhost:9300/my.bucket/photos/cat.jpg"},
+		{"PathStyleNestedBaseDomain", "http://s3.localhost:9300/my.bucket/photos/cat.jpg"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(handler, http.MethodGet, tc.target, nil, nil)
+			if rec.Code != http.StatusOK || rec.Body.String() != "meow" {
+				t.Errorf("Expected the object, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("BucketRoot", func(t *testing.T) {
+		rec := do(handler, http.MethodGet, "http://my.bucket.localhost:9300/", nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result ListBucketResult
+		decodeBody(t, rec, &result)
+		if result.Name != "my.bucket" || len(result.Contents) != 1 || result.Contents[0].Key != "photos/cat.jpg" {
+			t.Errorf("Expected a listing of my.bucket, got %+v", result)
+		}
+	})
+
+	t.Run("NoSuchBucket", func(t *testing.T) {
+		expectError(t, do(handler, http.MethodGet, "http://missing.localhost:9300/photos/cat.jpg", nil, nil), http.StatusNotFound, "NoSuchBucket")
+	})
+}
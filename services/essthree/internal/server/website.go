@@ -0,0 +1,466 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tony/ess-three/internal/storage"
+)
+
+// websiteRedirectHeader sets the location the website endpoint redirects an
+// object's requests to
+const websiteRedirectHeader = "x-amz-website-redirect-location"
+
+type WebsiteConfiguration struct {
+	XMLName               xml.Name               `xml:"WebsiteConfiguration"`
+	Xmlns                 string                 `xml:"xmlns,attr,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty"`
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+type ErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+type IndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+type RedirectAllRequestsTo struct {
+	HostName string `xml:"HostName"`
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+type RoutingRule struct {
+	Condition *RoutingRuleCondition `xml:"Condition,omitempty"`
+	Redirect  *RoutingRuleRedirect  `xml:"Redirect"`
+}
+
+type RoutingRuleCondition struct {
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+	HttpErrorCodeReturnedEquals int    `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+}
+
+type RoutingRuleRedirect struct {
+	HostName             string  `xml:"HostName,omitempty"`
+	HttpRedirectCode     int     `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string  `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith *string `xml:"ReplaceKeyPrefixWith"`
+	ReplaceKeyWith       string  `xml:"ReplaceKeyWith,omitempty"`
+}
+
+// validRedirectProtocol reports whether protocol may be used in a website
+// redirect; empty keeps the protocol of the request
+func validRedirectProtocol(protocol string) bool {
+	return protocol == "" || protocol == "http" || protocol == "https"
+}
+
+// parseWebsiteConfiguration validates a website configuration document and
+// converts it to the stored form
+func parseWebsiteConfiguration(config *WebsiteConfiguration) (*storage.WebsiteConfig, error) {
+	if redirect := config.RedirectAllRequestsTo; redirect != nil {
+		switch {
+		case config.IndexDocument != nil || config.ErrorDocument != nil || len(config.RoutingRules) > 0:
+			return nil, errors.New("RedirectAllRequestsTo cannot be provided in conjunction with other Routing/Redirect configurations.")
+		case redirect.HostName == "":
+			return nil, errors.New("A host name must be provided for RedirectAllRequestsTo")
+		case !validRedirectProtocol(redirect.Protocol):
+			return nil, errors.New("Invalid protocol, protocol can be http or https.")
+		}
+		return &storage.WebsiteConfig{
+			RedirectAllRequestsTo: &storage.WebsiteRedirect{HostName: redirect.HostName, Protocol: redirect.Protocol},
+		}, nil
+	}
+
+	if config.IndexDocument == nil {
+		return nil, errors.New("A value for IndexDocument Suffix must be provided if RedirectAllRequestsTo is empty")
+	}
+	if suffix := config.IndexDocument.Suffix; suffix == "" || strings.Contains(suffix, "/") {
+		return nil, errors.New("The IndexDocument Suffix is not well formed")
+	}
+
+	website := &storage.WebsiteConfig{IndexDocument: config.IndexDocument.Suffix}
+	if config.ErrorDocument != nil {
+		if config.ErrorDocument.Key == "" {
+			return nil, errors.New("The ErrorDocument Key is not well formed")
+		}
+		website.ErrorDocument = config.ErrorDocument.Key
+	}
+
+	for _, rule := range config.RoutingRules {
+		redirect := rule.Redirect
+		switch {
+		case redirect == nil:
+			return nil, errors.New("A Redirect must be provided for each RoutingRule")
+		case redirect.ReplaceKeyWith != "" && redirect.ReplaceKeyPrefixWith != nil:
+			return nil, errors.New("You can only define ReplaceKeyPrefix or ReplaceKey but not both.")
+		case !validRedirectProtocol(redirect.Protocol):
+			return nil, errors.New("Invalid protocol, protocol can be http or https.")
+		case redirect.HttpRedirectCode != 0 && (redirect.HttpRedirectCode < 300 || redirect.HttpRedirectCode > 399):
+			return nil, fmt.Errorf("The provided HTTP redirect code (%d) is not valid. Valid codes are 3XX except 300.", redirect.HttpRedirectCode)
+		}
+
+		stored := storage.RoutingRule{
+			HostName:             redirect.HostName,
+			Protocol:             redirect.Protocol,
+			ReplaceKeyPrefixWith: redirect.ReplaceKeyPrefixWith,
+			ReplaceKeyWith:       redirect.ReplaceKeyWith,
+			HTTPRedirectCode:     redirect.HttpRedirectCode,
+		}
+		if condition := rule.Condition; condition != nil {
+			if code := condition.HttpErrorCodeReturnedEquals; code != 0 && (code < 400 || code > 599) {
+				return nil, fmt.Errorf("The provided HTTP error code (%d) is not valid. Valid codes are 4XX or 5XX.", code)
+			}
+			stored.KeyPrefixEquals = condition.KeyPrefixEquals
+			stored.HTTPErrorCodeReturnedEquals = condition.HttpErrorCodeReturnedEquals
+		}
+		website.RoutingRules = append(website.RoutingRules, stored)
+	}
+
+	return website, nil
+}
+
+// handlePutBucketWebsite handles PUT /{bucket}?website
+func (s *Server) handlePutBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	var config WebsiteConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		s.sendError(w, r, "MalformedXML", errMalformedXML.Error(), http.StatusBadRequest)
+		return
+	}
+
+	website, err := parseWebsiteConfiguration(&config)
+	if err != nil {
+		s.sendError(w, r, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Website = website
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketWebsite handles GET /{bucket}?website
+func (s *Server) handleGetBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	info, err := s.storage.HeadBucket(bucket)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	website := info.Website
+	if website == nil {
+		s.sendError(w, r, "NoSuchWebsiteConfiguration", "The specified bucket does not have a website configuration", http.StatusNotFound)
+		return
+	}
+
+	result := WebsiteConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	if redirect := website.RedirectAllRequestsTo; redirect != nil {
+		result.RedirectAllRequestsTo = &RedirectAllRequestsTo{HostName: redirect.HostName, Protocol: redirect.Protocol}
+	}
+	if website.IndexDocument != "" {
+		result.IndexDocument = &IndexDocument{Suffix: website.IndexDocument}
+	}
+	if website.ErrorDocument != "" {
+		result.ErrorDocument = &ErrorDocument{Key: website.ErrorDocument}
+	}
+	for _, rule := range website.RoutingRules {
+		routingRule := RoutingRule{
+			Redirect: &RoutingRuleRedirect{
+				HostName:             rule.HostName,
+				HttpRedirectCode:     rule.HTTPRedirectCode,
+				Protocol:             rule.Protocol,
+				ReplaceKeyPrefixWith: rule.ReplaceKeyPrefixWith,
+				ReplaceKeyWith:       rule.ReplaceKeyWith,
+			},
+		}
+		if rule.KeyPrefixEquals != "" || rule.HTTPErrorCodeReturnedEquals != 0 {
+			routingRule.Condition = &RoutingRuleCondition{
+				KeyPrefixEquals:             rule.KeyPrefixEquals,
+				HttpErrorCodeReturnedEquals: rule.HTTPErrorCodeReturnedEquals,
+			}
+		}
+		result.RoutingRules = append(result.RoutingRules, routingRule)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteBucketWebsite handles DELETE /{bucket}?website
+func (s *Server) handleDeleteBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	_, err := s.storage.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+		info.Website = nil
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestWebsiteRedirect reads x-amz-website-redirect-location, writing an
+// InvalidRedirectLocation error and returning false when it is invalid
+func (s *Server) requestWebsiteRedirect(w http.ResponseWriter, r *http.Request) (string, bool) {
+	location := r.Header.Get(websiteRedirectHeader)
+	if location != "" && !strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		s.sendError(w, r, "InvalidRedirectLocation", "The website redirect location must have a prefix of 'http://' or 'https://' or '/'.", http.StatusBadRequest)
+		return "", false
+	}
+	return location, true
+}
+
+// setWebsiteRedirectHeader reports an object's website redirect location
+func setWebsiteRedirectHeader(w http.ResponseWriter, meta *storage.ObjectMetadata) {
+	if meta.WebsiteRedirect != "" {
+		w.Header().Set(websiteRedirectHeader, meta.WebsiteRedirect)
+	}
+}
+
+// WebsiteRouter creates the handler of the static website endpoint. It
+// serves buckets with a website configuration to browsers: the bucket is
+// named by a virtual-hosted-style Host, or else by the first path segment.
+func (s *Server) WebsiteRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.RequestID)
+	r.HandleFunc("/*", s.handleWebsite)
+	return r
+}
+
+// websiteRequest is a request to the website endpoint
+type websiteRequest struct {
+	bucket string
+	key    string
+
+	// base is the path the bucket's keys are served under: empty for
+	// virtual-hosted-style requests, or /{bucket}
+	base   string
+	config *storage.WebsiteConfig
+}
+
+// handleWebsite serves GET and HEAD requests on the website endpoint
+func (s *Server) handleWebsite(w http.ResponseWriter, r *http.Request) {
+	req := &websiteRequest{}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if bucket := s.bucketFromHost(r.Host); bucket != "" {
+		req.bucket, req.key = bucket, path
+	} else {
+		req.bucket, req.key, _ = strings.Cut(path, "/")
+		req.base = "/" + req.bucket
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.sendWebsiteError(w, r, req, "MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := s.storage.HeadBucket(req.bucket)
+	if req.bucket == "" || errors.Is(err, storage.ErrBucketNotFound) {
+		s.sendWebsiteError(w, r, req, "NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.sendWebsiteError(w, r, req, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.Website == nil {
+		s.sendWebsiteError(w, r, req, "NoSuchWebsiteConfiguration", "The specified bucket does not have a website configuration", http.StatusNotFound)
+		return
+	}
+	req.config = info.Website
+
+	// Path-style requests for the bucket root need the trailing slash too
+	if req.base != "" && r.URL.Path == req.base {
+		w.Header().Set("Location", (&url.URL{Path: req.base + "/"}).String())
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	if redirect := req.config.RedirectAllRequestsTo; redirect != nil {
+		s.websiteRedirect(w, r, req, &storage.RoutingRule{HostName: redirect.HostName, Protocol: redirect.Protocol})
+		return
+	}
+	if rule := req.config.MatchRoutingRule(req.key, 0); rule != nil {
+		s.websiteRedirect(w, r, req, rule)
+		return
+	}
+
+	// Directory-style paths serve their index document
+	key := req.key
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += req.config.IndexDocument
+	}
+
+	status, code, message := s.serveWebsiteObject(w, r, req, key, http.StatusOK)
+	if status == 0 {
+		return
+	}
+
+	// A path naming a directory without its trailing slash is redirected to
+	// it, so relative links in the index document resolve
+	if status == http.StatusNotFound && !strings.HasSuffix(req.key, "/") {
+		if _, err := s.storage.HeadObject(req.bucket, req.key+"/"+req.config.IndexDocument, ""); err == nil {
+			w.Header().Set("Location", (&url.URL{Path: req.base + "/" + req.key + "/"}).String())
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+	}
+
+	s.sendWebsiteError(w, r, req, code, message, status)
+}
+
+// serveWebsiteObject writes an object to the website endpoint with the given
+// status, or the redirect its x-amz-website-redirect-location asks for. It
+// writes nothing and returns the error status, code and message when the
+// object cannot be served, or a zero status once it has written a response.
+func (s *Server) serveWebsiteObject(w http.ResponseWriter, r *http.Request, req *websiteRequest, key string, status int) (int, string, string) {
+	if !s.checkAccess(r, "s3:GetObject", req.bucket, key) {
+		return http.StatusForbidden, "AccessDenied", "Access Denied"
+	}
+
+	reader, meta, err := s.storage.GetObject(req.bucket, key, "")
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return http.StatusNotFound, "NoSuchKey", "The specified key does not exist."
+	}
+	if errors.Is(err, storage.ErrInvalidObjectState) {
+		return http.StatusForbidden, "InvalidObjectState", "The operation is not valid for the object's storage class"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "InternalError", err.Error()
+	}
+	defer reader.Close()
+
+	// SSE-C objects cannot be read without their key, which browsers do not send
+	if meta.Encryption.IsCustomerKey() {
+		return http.StatusForbidden, "AccessDenied", "Access Denied"
+	}
+
+	// A redirect to a path is relative to the website root
+	if location := meta.WebsiteRedirect; location != "" {
+		if strings.HasPrefix(location, "/") {
+			location = req.base + location
+		}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return 0, "", ""
+	}
+
+	if status == http.StatusOK {
+		if condition := checkReadConditions(r, meta); condition == http.StatusNotModified {
+			w.Header().Set("ETag", meta.ETag)
+			w.Header().Set("Last-Modified", meta.LastModified.Format(http.TimeFormat))
+			w.WriteHeader(http.StatusNotModified)
+			return 0, "", ""
+		} else if condition != 0 {
+			return condition, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold"
+		}
+	}
+
+	w.Header().Set("Content-Type", meta.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	w.Header().Set("ETag", meta.ETag)
+	w.Header().Set("Last-Modified", meta.LastModified.Format(http.TimeFormat))
+	w.Header().Set("Server", "ess-three")
+	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.CopyN(w, reader, meta.Size)
+	}
+	return 0, "", ""
+}
+
+// websiteRedirect redirects a website request as a routing rule asks.
+// Without a host the redirect stays on the website endpoint.
+func (s *Server) websiteRedirect(w http.ResponseWriter, r *http.Request, req *websiteRequest, rule *storage.RoutingRule) {
+	key := rule.RedirectKey(req.key)
+
+	location := &url.URL{Path: req.base + "/" + key}
+	if rule.HostName != "" || rule.Protocol != "" {
+		location.Scheme = rule.Protocol
+		if location.Scheme == "" {
+			location.Scheme = "http"
+		}
+		location.Host = r.Host
+		if rule.HostName != "" {
+			location.Host = rule.HostName
+			location.Path = "/" + key
+		}
+	}
+
+	code := rule.HTTPRedirectCode
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+
+	w.Header().Set("Location", location.String())
+	w.WriteHeader(code)
+}
+
+// sendWebsiteError answers a failed website request. A routing rule for the
+// error status redirects it; otherwise a 4xx error serves the bucket's error
+// document when it has one, or an HTML error page.
+func (s *Server) sendWebsiteError(w http.ResponseWriter, r *http.Request, req *websiteRequest, code, message string, status int) {
+	if req.config != nil {
+		if rule := req.config.MatchRoutingRule(req.key, status); rule != nil {
+			s.websiteRedirect(w, r, req, rule)
+			return
+		}
+		if req.config.ErrorDocument != "" && status >= 400 && status < 500 {
+			if served, _, _ := s.serveWebsiteObject(w, r, req, req.config.ErrorDocument, status); served == 0 {
+				return
+			}
+		}
+	}
+
+	var page strings.Builder
+	fmt.Fprintf(&page, "<html>\n<head><title>%d %s</title></head>\n<body>\n", status, http.StatusText(status))
+	fmt.Fprintf(&page, "<h1>%d %s</h1>\n<ul>\n", status, http.StatusText(status))
+	fmt.Fprintf(&page, "<li>Code: %s</li>\n<li>Message: %s</li>\n", code, html.EscapeString(message))
+	switch code {
+	case "NoSuchKey":
+		fmt.Fprintf(&page, "<li>Key: %s</li>\n", html.EscapeString(req.key))
+	case "NoSuchBucket", "NoSuchWebsiteConfiguration":
+		fmt.Fprintf(&page, "<li>BucketName: %s</li>\n", html.EscapeString(req.bucket))
+	}
+	fmt.Fprintf(&page, "<li>RequestId: %s</li>\n</ul>\n<hr/>\n</body>\n</html>\n", html.EscapeString(middleware.GetReqID(r.Context())))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Server", "ess-three")
+	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, page.String())
+	}
+}
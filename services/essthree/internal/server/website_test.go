@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tony/ess-three/internal/storage"
+)
+
+func TestWebsiteEndpoint(t *testing.T) {
+	store, err := storage.NewMemoryStorage(0, storage.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	handler := NewServer(store, Config{BaseDomains: []string{"localhost"}}).WebsiteRouter()
+
+	put := func(t *testing.T, bucket, key, body string, opts storage.PutOptions) {
+		t.Helper()
+		if _, err := store.PutObject(bucket, key, strings.NewReader(body), nil, "text/html", opts); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	configure := func(t *testing.T, bucket string, website *storage.WebsiteConfig) {
+		t.Helper()
+		if err := store.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+		if _, err := store.UpdateBucket(bucket, func(info *storage.BucketInfo) error {
+			info.Website = website
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
+		}
+	}
+	expectPage := func(t *testing.T, target string, status int, body string) {
+		t.Helper()
+		rec := do(handler, http.MethodGet, target, nil, nil)
+		if rec.Code != status || rec.Body.String() != body {
+			t.Errorf("Expected %d %q for %s, got %d %q", status, body, target, rec.Code, rec.Body.String())
+		}
+	}
+	expectRedirect := func(t *testing.T, target string, status int, location string) {
+		t.Helper()
+		rec := do(handler, http.MethodGet, target, nil, nil)
+		if rec.Code != status || rec.Header().Get("Location") != location {
+			t.Errorf("Expected %d to %s for %s, got %d to %q", status, location, target, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	configure(t, "site", &storage.WebsiteConfig{IndexDocument: "index.html", ErrorDocument: "error.html"})
+	put(t, "site", "index.html", "home", storage.PutOptions{})
+	put(t, "site", "docs/index.html", "docs", storage.PutOptions{})
+	put(t, "site", "error.html", "oops", storage.PutOptions{})
+	put(t, "site", "moved.html", "", storage.PutOptions{WebsiteRedirect: "/docs/"})
+	put(t, "site", "away.html", "", storage.PutOptions{WebsiteRedirect: "https://example.com/away"})
+
+	t.Run("IndexDocument", func(t *testing.T) {
+		expectPage(t, "/site/", http.StatusOK, "home")
+		expectPage(t, "/site/docs/", http.StatusOK, "docs")
+		expectPage(t, "http://site.localhost/", http.StatusOK, "home")
+	})
+
+	t.Run("ErrorDocument", func(t *testing.T) {
+		expectPage(t, "/site/missing.html", http.StatusNotFound, "oops")
+	})
+
+	t.Run("TrailingSlashRedirect", func(t *testing.T) {
+		expectRedirect(t, "/site", http.StatusFound, "/site/")
+		expectRedirect(t, "/site/docs", http.StatusFound, "/site/docs/")
+	})
+
+	t.Run("WebsiteRedirectLocation", func(t *testing.T) {
+		expectRedirect(t, "/site/moved.html", http.StatusMovedPermanently, "/site/docs/")
+		expectRedirect(t, "/site/away.html", http.StatusMovedPermanently, "https://example.com/away")
+	})
+
+	t.Run("RoutingRules", func(t *testing.T) {
+		newPrefix := "new/"
+		configure(t, "routed", &storage.WebsiteConfig{
+			IndexDocument: "index.html",
+			RoutingRules: []storage.RoutingRule{
+				{KeyPrefixEquals: "old/", ReplaceKeyPrefixWith: &newPrefix},
+				{HTTPErrorCodeReturnedEquals: http.StatusNotFound, HostName: "fallback.example.com", Protocol: "https", HTTPRedirectCode: http.StatusTemporaryRedirect},
+			},
+		})
+		put(t, "routed", "new/page.html", "page", storage.PutOptions{})
+
+		expectRedirect(t, "/routed/old/page.html", http.StatusMovedPermanently, "/routed/new/page.html")
+		expectRedirect(t, "/routed/missing.html", http.StatusTemporaryRedirect, "https://fallback.example.com/missing.html")
+		expectPage(t, "/routed/new/page.html", http.StatusOK, "page")
+	})
+
+	t.Run("NoWebsiteConfiguration", func(t *testing.T) {
+		if err := store.CreateBucket("plain"); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+		rec := do(handler, http.MethodGet, "/plain/", nil, nil)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "NoSuchWebsiteConfiguration") {
+			t.Errorf("Expected a NoSuchWebsiteConfiguration page, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		rec := do(handler, http.MethodPut, "/site/index.html", strings.NewReader("x"), nil)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("Expected 405 allowing GET and HEAD, got %d %q", rec.Code, rec.Header().Get("Allow"))
+		}
+	})
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sigv4
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters carried by presigned URLs
+const (
+	QueryAlgorithm     = "X-Amz-Algorithm"
+	QueryCredential    = "X-Amz-Credential"
+	QueryDate          = "X-Amz-Date"
+	QueryExpires       = "X-Amz-Expires"
+	QuerySignedHeaders = "X-Amz-SignedHeaders"
+	QuerySignature     = "X-Amz-Signature"
+	QueryContentSHA256 = "X-Amz-Content-Sha256"
+)
+
+// MaxPresignExpiry is the longest validity S3 accepts for a presigned URL
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// Presigned holds the parsed authentication parameters of a presigned URL
+type Presigned struct {
+	Authorization
+	AmzDate     string
+	RequestTime time.Time
+	Expires     time.Duration
+}
+
+// IsPresigned reports whether a query string carries SigV4 presigned
+// authentication parameters
+func IsPresigned(query url.Values) bool {
+	return query.Has(QueryAlgorithm) || query.Has(QuerySignature)
+}
+
+// ParsePresigned parses the X-Amz-* query parameters of a presigned URL
+func ParsePresigned(query url.Values) (*Presigned, error) {
+	for _, name := range []string{QueryAlgorithm, QueryCredential, QuerySignature, QueryDate, QuerySignedHeaders, QueryExpires} {
+		if query.Get(name) == "" {
+			return nil, fmt.Errorf("%w: Query-string authentication version 4 requires the X-Amz-Algorithm, X-Amz-Credential, X-Amz-Signature, X-Amz-Date, X-Amz-SignedHeaders, and X-Amz-Expires parameters.", ErrMalformedAuthorization)
+		}
+	}
+
+	if query.Get(QueryAlgorithm) != Algorithm {
+		return nil, fmt.Errorf("%w: X-Amz-Algorithm only supports \"%s\"", ErrMalformedAuthorization, Algorithm)
+	}
+
+	auth, err := parseCredential(query.Get(QueryCredential))
+	if err != nil {
+		return nil, err
+	}
+	auth.SignedHeaders = strings.Split(query.Get(QuerySignedHeaders), ";")
+	auth.Signature = query.Get(QuerySignature)
+
+	amzDate := query.Get(QueryDate)
+	requestTime, err := time.Parse(TimeFormat, amzDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: X-Amz-Date must be in the ISO8601 Long Format \"yyyyMMdd'T'HHmmss'Z'\"", ErrMalformedAuthorization)
+	}
+
+	seconds, err := strconv.ParseInt(query.Get(QueryExpires), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: X-Amz-Expires should be a number", ErrMalformedAuthorization)
+	}
+	if seconds < 0 {
+		return nil, fmt.Errorf("%w: X-Amz-Expires must be non-negative", ErrMalformedAuthorization)
+	}
+	expires := time.Duration(seconds) * time.Second
+	if expires > MaxPresignExpiry {
+		return nil, fmt.Errorf("%w: X-Amz-Expires must be less than a week (in seconds) that is 604800", ErrMalformedAuthorization)
+	}
+
+	return &Presigned{
+		Authorization: *auth,
+		AmzDate:       amzDate,
+		RequestTime:   requestTime,
+		Expires:       expires,
+	}, nil
+}
+
+// PresignURL signs u for method with the given credentials, returning a URL
+// that is valid for expires from signTime. Only the host header is signed and
+// the payload is left unsigned.
+func PresignURL(method string, u *url.URL, accessKeyID, secret, region string, signTime time.Time, expires time.Duration) string {
+	signTime = signTime.UTC()
+	auth := Authorization{
+		AccessKeyID:   accessKeyID,
+		Date:          signTime.Format(DateFormat),
+		Region:        region,
+		Service:       "s3",
+		SignedHeaders: []string{"host"},
+	}
+	amzDate := signTime.Format(TimeFormat)
+
+	signed := *u
+	query := signed.Query()
+	query.Set(QueryAlgorithm, Algorithm)
+	query.Set(QueryCredential, auth.AccessKeyID+"/"+auth.Scope())
+	query.Set(QueryDate, amzDate)
+	query.Set(QueryExpires, strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set(QuerySignedHeaders, "host")
+	signed.RawQuery = encodeQuery(query)
+
+	req := &http.Request{Method: method, URL: &signed, Host: signed.Host, Header: http.Header{}}
+	canonical := CanonicalRequest(req, auth.SignedHeaders, UnsignedPayload)
+	signingKey := SigningKey(secret, auth.Date, auth.Region, auth.Service)
+	signature := Sign(signingKey, StringToSign(amzDate, auth.Scope(), canonical))
+
+	signed.RawQuery += "&" + QuerySignature + "=" + signature
+	return signed.String()
+}
+
+// encodeQuery encodes query parameters with the SigV4 rules so the URL
+// matches its canonical form
+func encodeQuery(query url.Values) string {
+	var parts []string
+	for key, values := range query {
+		for _, value := range values {
+			parts = append(parts, URIEncode(key)+"="+URIEncode(value))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
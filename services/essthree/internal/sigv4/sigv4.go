@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sigv4 implements the AWS Signature Version 4 primitives needed to
+// verify S3 requests.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the signing algorithm identifier used in headers and queries
+	Algorithm = "AWS4-HMAC-SHA256"
+
+	// TimeFormat is the layout of X-Amz-Date values
+	TimeFormat = "20060102T150405Z"
+
+	// DateFormat is the layout of the date in a credential scope
+	DateFormat = "20060102"
+
+	// UnsignedPayload marks a request whose body is not covered by the signature
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// EmptyPayloadHash is the SHA-256 of an empty body
+	EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ErrMalformedAuthorization is returned for Authorization headers that cannot be parsed
+var ErrMalformedAuthorization = errors.New("malformed authorization")
+
+// Authorization holds the parsed fields of a SigV4 Authorization header or
+// the equivalent presigned URL query parameters
+type Authorization struct {
+	AccessKeyID   string
+	Date          string
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+}
+
+// Scope returns the credential scope, e.g. 20130524/us-east-1/s3/aws4_request
+func (a *Authorization) Scope() string {
+	return strings.Join([]string{a.Date, a.Region, a.Service, "aws4_request"}, "/")
+}
+
+// ParseAuthorization parses an Authorization header of the form
+// AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=...
+func ParseAuthorization(header string) (*Authorization, error) {
+	if !strings.HasPrefix(header, Algorithm+" ") {
+		return nil, fmt.Errorf("%w: unsupported algorithm", ErrMalformedAuthorization)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(header, Algorithm+" "), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return nil, fmt.Errorf("%w: invalid field %q", ErrMalformedAuthorization, field)
+		}
+		fields[name] = value
+	}
+
+	auth, err := parseCredential(fields["Credential"])
+	if err != nil {
+		return nil, err
+	}
+
+	if fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, fmt.Errorf("%w: missing SignedHeaders or Signature", ErrMalformedAuthorization)
+	}
+	auth.SignedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	auth.Signature = fields["Signature"]
+
+	return auth, nil
+}
+
+// parseCredential parses AKID/date/region/service/aws4_request
+func parseCredential(credential string) (*Authorization, error) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return nil, fmt.Errorf("%w: invalid credential %q", ErrMalformedAuthorization, credential)
+	}
+	if _, err := time.Parse(DateFormat, parts[1]); err != nil {
+		return nil, fmt.Errorf("%w: invalid credential date %q", ErrMalformedAuthorization, parts[1])
+	}
+
+	return &Authorization{
+		AccessKeyID: parts[0],
+		Date:        parts[1],
+		Region:      parts[2],
+		Service:     parts[3],
+	}, nil
+}
+
+// CanonicalRequest builds the canonical request for r. Query parameters named
+// in exclude (such as X-Amz-Signature for presigned URLs) are left out.
+func CanonicalRequest(r *http.Request, signedHeaders []string, payloadHash string, exclude ...string) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL),
+		canonicalQuery(r.URL.RawQuery, exclude),
+		canonicalHeaders(r, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// StringToSign builds the string to sign from the request timestamp, scope
+// and canonical request
+func StringToSign(amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+}
+
+// SigningKey derives the signing key for a secret and credential scope
+func SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// Sign returns the hex signature of stringToSign
+func Sign(signingKey []byte, stringToSign string) string {
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// SignaturesEqual compares two hex signatures in constant time
+func SignaturesEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI re-encodes each path segment with the SigV4 rules. Segments
+// are decoded from the escaped path so encoded slashes inside a key survive.
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if decoded, err := url.PathUnescape(segment); err == nil {
+			segment = decoded
+		}
+		segments[i] = URIEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and re-encodes the raw query string
+func canonicalQuery(rawQuery string, exclude []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type pair struct{ key, value string }
+	var pairs []pair
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(param, "=")
+		if decoded, err := url.PathUnescape(key); err == nil {
+			key = decoded
+		}
+		if decoded, err := url.PathUnescape(value); err == nil {
+			value = decoded
+		}
+		excluded := false
+		for _, name := range exclude {
+			if key == name {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			pairs = append(pairs, pair{URIEncode(key), URIEncode(value)})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.key + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+// canonicalHeaders renders the signed headers as name:value lines
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	var b strings.Builder
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = append(values, r.Header.Values(name)...)
+			if len(values) == 0 {
+				values = []string{strconv.FormatInt(r.ContentLength, 10)}
+			}
+		default:
+			values = append(values, r.Header.Values(name)...)
+		}
+
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(strings.Join(values, ","))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// URIEncode percent-encodes every byte except the unreserved characters
+// A-Z, a-z, 0-9, '-', '.', '_' and '~'
+func URIEncode(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sigv4
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Payload hashes of aws-chunked streaming uploads
+const (
+	// StreamingPayload signs every chunk of the body
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// StreamingPayloadTrailer signs every chunk and the trailer
+	StreamingPayloadTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+
+	// StreamingUnsignedPayloadTrailer leaves the chunks unsigned and ends
+	// with a trailer, usually carrying a checksum
+	StreamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// Algorithms of the strings to sign for chunks and trailers
+const (
+	chunkAlgorithm   = "AWS4-HMAC-SHA256-PAYLOAD"
+	trailerAlgorithm = "AWS4-HMAC-SHA256-TRAILER"
+)
+
+// ChunkStringToSign builds the string to sign for one chunk of a streaming
+// upload from the hex SHA-256 of its data. Each chunk signature chains from
+// the previous one, starting with the request's own signature.
+func ChunkStringToSign(amzDate, scope, previousSignature, chunkHash string) string {
+	return strings.Join([]string{chunkAlgorithm, amzDate, scope, previousSignature, EmptyPayloadHash, chunkHash}, "\n")
+}
+
+// TrailerStringToSign builds the string to sign for the trailer of a
+// streaming upload, chained from the final chunk's signature. trailer holds
+// the trailing headers as name:value lines, each ending in a newline.
+func TrailerStringToSign(amzDate, scope, previousSignature, trailer string) string {
+	hash := sha256.Sum256([]byte(trailer))
+	return strings.Join([]string{trailerAlgorithm, amzDate, scope, previousSignature, hex.EncodeToString(hash[:])}, "\n")
+}
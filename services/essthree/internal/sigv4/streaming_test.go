@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package sigv4
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The chunk signatures come from the streaming PutObject example in the
+// Amazon S3 Signature Version 4 documentation: 66560 bytes of 'a' sent as a
+// 65536-byte chunk, a 1024-byte chunk and the final empty chunk.
+func TestChunkSignatureExample(t *testing.T) {
+	signingKey := SigningKey(exampleSecret, "20130524", "us-east-1", "s3")
+	scope := "20130524/us-east-1/s3/aws4_request"
+	previous := "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+
+	chunks := []struct {
+		size      int
+		signature string
+	}{
+		{65536, "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+		{1024, "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+		{0, "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"},
+	}
+
+	for _, chunk := range chunks {
+		hash := sha256.Sum256([]byte(strings.Repeat("a", chunk.size)))
+		signature := Sign(signingKey, ChunkStringToSign("20130524T000000Z", scope, previous, hex.EncodeToString(hash[:])))
+		if signature != chunk.signature {
+			t.Fatalf("Expected signature %s for the %d-byte chunk, got %s", chunk.signature, chunk.size, signature)
+		}
+		previous = signature
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// tempPrefix starts the names of files being written in place of another
+const tempPrefix = ".tmp-"
+
+// writeFileAtomic writes a file by filling a temp file beside it and renaming
+// it into place, so readers see either the old or the new content and a
+// crash leaves at worst an orphaned temp file
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	w := bufio.NewWriter(file)
+	if err := write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// writeJSONFile atomically writes v to path as JSON
+func writeJSONFile(path string, v any) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+// keyLocks hands out a reader/writer lock per name, created on first use and
+// dropped once no goroutine holds or waits for it. Writers of an object
+// hold its lock exclusively; readers share it while they resolve metadata
+// and open data, so they never pair one write's metadata with another's
+// body.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is one named lock and the number of goroutines using it
+type keyLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// acquire returns the lock for name, counting the caller as a user
+func (l *keyLocks) acquire(name string) *keyLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[name] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// release drops the caller's use of a lock, forgetting it when unused
+func (l *keyLocks) release(name string, lock *keyLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, name)
+	}
+}
+
+// lock locks name for writing and returns the function that unlocks it
+func (l *keyLocks) lock(name string) func() {
+	lock := l.acquire(name)
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.release(name, lock)
+	}
+}
+
+// rlock locks name for reading and returns the function that unlocks it
+func (l *keyLocks) rlock(name string) func() {
+	lock := l.acquire(name)
+	lock.RLock()
+	return func() {
+		lock.RUnlock()
+		l.release(name, lock)
+	}
+}
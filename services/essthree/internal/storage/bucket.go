@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Sentinel errors returned by bucket operations
+var (
+	ErrBucketNotFound      = errors.New("bucket not found")
+	ErrBucketAlreadyExists = errors.New("bucket already exists")
+	ErrBucketNotEmpty      = errors.New("bucket not empty")
+	ErrInvalidBucketName   = errors.New("invalid bucket name")
+)
+
+// bucketNamePattern matches the S3 bucket naming rules for new buckets
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// BucketInfo holds the persisted state of a bucket
+type BucketInfo struct {
+	Name         string    `json:"name"`
+	CreationDate time.Time `json:"creation_date"`
+	Versioning   string    `json:"versioning,omitempty"`
+
+	// LifecycleRules is nil when the bucket has no lifecycle configuration
+	LifecycleRules []LifecycleRule `json:"lifecycle_rules,omitempty"`
+
+	// Notifications are the event notification destinations
+	Notifications []NotificationTarget `json:"notifications,omitempty"`
+
+	// CORSRules is nil when the bucket has no CORS configuration
+	CORSRules []CORSRule `json:"cors_rules,omitempty"`
+
+	// Access control: the bucket policy document as submitted, the canned
+	// ACL and the public access block settings
+	Policy            string             `json:"policy,omitempty"`
+	ACL               string             `json:"acl,omitempty"`
+	PublicAccessBlock *PublicAccessBlock `json:"public_access_block,omitempty"`
+
+	// DefaultEncryption applies to objects written without SSE headers; nil
+	// when the bucket has no encryption configuration
+	DefaultEncryption *BucketEncryption `json:"default_encryption,omitempty"`
+
+	// ObjectLock is nil when Object Lock is not enabled on the bucket
+	ObjectLock *ObjectLockConfig `json:"object_lock,omitempty"`
+
+	// Website is nil when the bucket is not configured as a static website
+	Website *WebsiteConfig `json:"website,omitempty"`
+}
+
+// BucketEncryption is a bucket's default server-side encryption
+type BucketEncryption struct {
+	Algorithm        string `json:"algorithm"`
+	KMSKeyID         string `json:"kms_key_id,omitempty"`
+	BucketKeyEnabled bool   `json:"bucket_key_enabled,omitempty"`
+}
+
+// PublicAccessBlock holds a bucket's public access block settings
+type PublicAccessBlock struct {
+	BlockPublicAcls       bool `json:"block_public_acls"`
+	IgnorePublicAcls      bool `json:"ignore_public_acls"`
+	BlockPublicPolicy     bool `json:"block_public_policy"`
+	RestrictPublicBuckets bool `json:"restrict_public_buckets"`
+}
+
+// ValidateBucketName checks a bucket name against the S3 naming rules
+func ValidateBucketName(bucket string) error {
+	if !bucketNamePattern.MatchString(bucket) {
+		return fmt.Errorf("%w: %s", ErrInvalidBucketName, bucket)
+	}
+	if net.ParseIP(bucket) != nil {
+		return fmt.Errorf("%w: %s must not be formatted as an IP address", ErrInvalidBucketName, bucket)
+	}
+	for i := 1; i < len(bucket); i++ {
+		pair := bucket[i-1 : i+1]
+		if pair == ".." || pair == ".-" || pair == "-." {
+			return fmt.Errorf("%w: %s", ErrInvalidBucketName, bucket)
+		}
+	}
+	return nil
+}
+
+// bucketPath returns the root directory of a bucket
+func (fs *FileSystemStorage) bucketPath(bucket string) string {
+	return filepath.Join(fs.baseDir, bucket)
+}
+
+// bucketMetadataDir returns the directory holding the metadata of current
+// object versions
+func (fs *FileSystemStorage) bucketMetadataDir(bucket string) string {
+	return filepath.Join(fs.bucketPath(bucket), "metadata")
+}
+
+// bucketInfoPath returns the filesystem path for bucket metadata
+func (fs *FileSystemStorage) bucketInfoPath(bucket string) string {
+	return filepath.Join(fs.baseDir, bucket, "bucket.json")
+}
+
+// bucketExists reports whether the bucket directory exists
+func (fs *FileSystemStorage) bucketExists(bucket string) bool {
+	stat, err := os.Stat(fs.bucketPath(bucket))
+	return err == nil && stat.IsDir()
+}
+
+// notFound returns the error for a missing object, distinguishing a missing bucket
+func (fs *FileSystemStorage) notFound(bucket, key string) error {
+	if !fs.bucketExists(bucket) {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+	return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+}
+
+// CreateBucket creates a new, empty bucket
+func (fs *FileSystemStorage) CreateBucket(bucket string) error {
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(fs.bucketPath(bucket), 0755); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrBucketAlreadyExists, bucket)
+		}
+		return fmt.Errorf("failed to create bucket directory: %w", err)
+	}
+
+	info := &BucketInfo{
+		Name:         bucket,
+		CreationDate: time.Now().UTC(),
+	}
+	if err := fs.writeBucketInfo(info); err != nil {
+		os.RemoveAll(fs.bucketPath(bucket))
+		return err
+	}
+
+	return nil
+}
+
+// HeadBucket returns the bucket's metadata if it exists
+func (fs *FileSystemStorage) HeadBucket(bucket string) (*BucketInfo, error) {
+	stat, err := os.Stat(fs.bucketPath(bucket))
+	if err != nil || !stat.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	infoFile, err := os.Open(fs.bucketInfoPath(bucket))
+	if os.IsNotExist(err) {
+		// Buckets created implicitly by a write have no metadata file
+		return &BucketInfo{Name: bucket, CreationDate: stat.ModTime().UTC()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket metadata: %w", err)
+	}
+	defer infoFile.Close()
+
+	var info BucketInfo
+	if err := json.NewDecoder(infoFile).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode bucket metadata: %w", err)
+	}
+	info.Name = bucket
+
+	return &info, nil
+}
+
+// DeleteBucket removes an empty bucket
+func (fs *FileSystemStorage) DeleteBucket(bucket string) error {
+	unlock := fs.buckets.lock(bucket)
+	defer unlock()
+
+	if !fs.bucketExists(bucket) {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	empty, err := fs.bucketEmpty(bucket)
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return fmt.Errorf("%w: %s", ErrBucketNotEmpty, bucket)
+	}
+
+	fs.dropIndex(bucket)
+	if err := os.RemoveAll(fs.bucketPath(bucket)); err != nil {
+		return fmt.Errorf("failed to delete bucket: %w", err)
+	}
+
+	return nil
+}
+
+// bucketEmpty reports whether a bucket holds no keys. Delete markers and
+// noncurrent versions also keep a bucket non-empty. It stops at the first
+// key or version found instead of reading them all.
+func (fs *FileSystemStorage) bucketEmpty(bucket string) (bool, error) {
+	idx, err := fs.bucketIndex(bucket)
+	if err != nil {
+		return false, err
+	}
+	if hasKeys, err := idx.hasKeys(); err != nil || hasKeys {
+		return false, err
+	}
+
+	found := false
+	err = filepath.WalkDir(filepath.Join(fs.baseDir, bucket, "versions"), func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".json" {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read versions directory: %w", err)
+	}
+	return !found, nil
+}
+
+// UpdateBucket applies update to the bucket's metadata and persists it
+func (fs *FileSystemStorage) UpdateBucket(bucket string, update func(*BucketInfo) error) (*BucketInfo, error) {
+	fs.bucketMu.Lock()
+	defer fs.bucketMu.Unlock()
+
+	info, err := fs.HeadBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := update(info); err != nil {
+		return nil, err
+	}
+
+	if err := fs.writeBucketInfo(info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// writeBucketInfo persists bucket metadata
+func (fs *FileSystemStorage) writeBucketInfo(info *BucketInfo) error {
+	if err := writeJSONFile(fs.bucketInfoPath(info.Name), info); err != nil {
+		return fmt.Errorf("failed to write bucket metadata: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"strings"
+)
+
+// Checksum algorithms, as named by x-amz-checksum-algorithm
+const (
+	ChecksumCRC32     = "CRC32"
+	ChecksumCRC32C    = "CRC32C"
+	ChecksumCRC64NVME = "CRC64NVME"
+	ChecksumSHA1      = "SHA1"
+	ChecksumSHA256    = "SHA256"
+)
+
+// Checksum types, as named by x-amz-checksum-type. A full-object checksum
+// covers the whole body; a composite one is the checksum of the part
+// checksums of a multipart object.
+const (
+	ChecksumTypeFullObject = "FULL_OBJECT"
+	ChecksumTypeComposite  = "COMPOSITE"
+)
+
+// ErrInvalidChecksumType is returned when a checksum type cannot be used
+// with the requested algorithm
+var ErrInvalidChecksumType = errors.New("invalid checksum type")
+
+// ChecksumAlgorithms lists the supported checksum algorithms
+var ChecksumAlgorithms = []string{ChecksumCRC32, ChecksumCRC32C, ChecksumCRC64NVME, ChecksumSHA1, ChecksumSHA256}
+
+// crc64NVMETable is the reflected CRC-64/NVME polynomial
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// Checksum is an additional checksum stored with an object or part. Value
+// is base64 encoded; composite checksums end in -<part count>.
+type Checksum struct {
+	Algorithm string `json:"algorithm"`
+	Type      string `json:"type,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// ParseChecksumAlgorithm validates a checksum algorithm name, ignoring case
+func ParseChecksumAlgorithm(name string) (string, error) {
+	algorithm := strings.ToUpper(name)
+	for _, supported := range ChecksumAlgorithms {
+		if algorithm == supported {
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported checksum algorithm: %s", name)
+}
+
+// NewChecksumHash returns a hash computing the given checksum algorithm
+func NewChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case ChecksumCRC64NVME:
+		return crc64.New(crc64NVMETable)
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// ChecksumSize returns the size in bytes of a raw checksum of algorithm
+func ChecksumSize(algorithm string) int {
+	if h := NewChecksumHash(algorithm); h != nil {
+		return h.Size()
+	}
+	return 0
+}
+
+// ResolveChecksumType checks that checksumType can be used with algorithm
+// for a multipart upload, defaulting to the type S3 uses for it. CRC64NVME
+// only supports full-object checksums, and the SHA algorithms only
+// composite ones.
+func ResolveChecksumType(algorithm, checksumType string) (string, error) {
+	fullObject := algorithm == ChecksumCRC32 || algorithm == ChecksumCRC32C || algorithm == ChecksumCRC64NVME
+	composite := algorithm != ChecksumCRC64NVME
+
+	switch checksumType {
+	case "":
+		if composite {
+			return ChecksumTypeComposite, nil
+		}
+		return ChecksumTypeFullObject, nil
+	case ChecksumTypeFullObject:
+		if fullObject {
+			return checksumType, nil
+		}
+	case ChecksumTypeComposite:
+		if composite {
+			return checksumType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s for %s", ErrInvalidChecksumType, checksumType, algorithm)
+}
+
+// compositeChecksum computes the checksum of the concatenated raw part
+// checksums, suffixed with the part count
+func compositeChecksum(algorithm string, partChecksums []string) (string, error) {
+	h := NewChecksumHash(algorithm)
+	for _, value := range partChecksums {
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid part checksum %q: %w", value, err)
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(partChecksums)), nil
+}
+
+// bodyDigests hashes an object or part body as it is written, for its
+// ETag and an additional checksum
+type bodyDigests struct {
+	md5       hash.Hash
+	checksum  hash.Hash
+	algorithm string
+}
+
+// newBodyDigests returns digests computing the MD5 and, unless algorithm is
+// empty, a checksum
+func newBodyDigests(algorithm string) *bodyDigests {
+	d := &bodyDigests{md5: md5.New(), algorithm: algorithm}
+	if algorithm != "" {
+		d.checksum = NewChecksumHash(algorithm)
+	}
+	return d
+}
+
+// newObjectDigests returns the digests to compute for objMeta. A checksum
+// whose value is already known, such as a composite one, is not recomputed.
+func newObjectDigests(objMeta *ObjectMetadata) *bodyDigests {
+	if objMeta.Checksum != nil && objMeta.Checksum.Value == "" {
+		return newBodyDigests(objMeta.Checksum.Algorithm)
+	}
+	return newBodyDigests("")
+}
+
+// newPartDigests returns the digests to compute for a part of upload
+func newPartDigests(upload *MultipartUpload) *bodyDigests {
+	if upload.Checksum != nil {
+		return newBodyDigests(upload.Checksum.Algorithm)
+	}
+	return newBodyDigests("")
+}
+
+func (d *bodyDigests) Write(b []byte) (int, error) {
+	d.md5.Write(b)
+	if d.checksum != nil {
+		d.checksum.Write(b)
+	}
+	return len(b), nil
+}
+
+// md5Hex returns the hex MD5 of the body
+func (d *bodyDigests) md5Hex() string {
+	return hex.EncodeToString(d.md5.Sum(nil))
+}
+
+// checksumValue returns the base64 checksum of the body, or an empty
+// string when none is computed
+func (d *bodyDigests) checksumValue() string {
+	if d.checksum == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(d.checksum.Sum(nil))
+}
+
+// apply sets the ETag, unless one was given, and the computed checksum
+func (d *bodyDigests) apply(objMeta *ObjectMetadata) {
+	if objMeta.ETag == "" {
+		objMeta.ETag = "\"" + d.md5Hex() + "\""
+	}
+	if d.checksum != nil {
+		objMeta.Checksum = &Checksum{Algorithm: d.algorithm, Type: ChecksumTypeFullObject, Value: d.checksumValue()}
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChecksumHashes(t *testing.T) {
+	// Check values of "123456789" from the CRC catalogue and the SHA specs
+	tests := map[string]string{
+		ChecksumCRC32:     "cbf43926",
+		ChecksumCRC32C:    "e3069283",
+		ChecksumCRC64NVME: "ae8b14860a799888",
+		ChecksumSHA1:      "f7c3bc1d808e04732adf679965ccc34ca7ae3441",
+		ChecksumSHA256:    "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225",
+	}
+	for algorithm, want := range tests {
+		t.Run(algorithm, func(t *testing.T) {
+			h := NewChecksumHash(algorithm)
+			h.Write([]byte("123456789"))
+			if got := hex.EncodeToString(h.Sum(nil)); got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestResolveChecksumType(t *testing.T) {
+	tests := []struct {
+		algorithm    string
+		checksumType string
+		want         string
+		wantErr      bool
+	}{
+		{ChecksumCRC32, "", ChecksumTypeComposite, false},
+		{ChecksumCRC64NVME, "", ChecksumTypeFullObject, false},
+		{ChecksumCRC32C, ChecksumTypeFullObject, ChecksumTypeFullObject, false},
+		{ChecksumSHA256, ChecksumTypeFullObject, "", true},
+		{ChecksumCRC64NVME, ChecksumTypeComposite, "", true},
+		{ChecksumSHA1, "PARTIAL", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveChecksumType(tt.algorithm, tt.checksumType)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidChecksumType) {
+				t.Errorf("%s/%s: expected ErrInvalidChecksumType, got %v", tt.algorithm, tt.checksumType, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s/%s: expected %s, got %s (%v)", tt.algorithm, tt.checksumType, tt.want, got, err)
+		}
+	}
+}
+
+func TestObjectChecksums(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+
+		bucket := "test-bucket"
+
+		t.Run("PutObject", func(t *testing.T) {
+			opts := PutOptions{Checksum: &Checksum{Algorithm: ChecksumCRC32}}
+			meta, err := storage.PutObject(bucket, "sum.txt", strings.NewReader("123456789"), nil, "text/plain", opts)
+			if err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+
+			sum := md5.Sum([]byte("123456789"))
+			if want := "\"" + hex.EncodeToString(sum[:]) + "\""; meta.ETag != want {
+				t.Errorf("Expected ETag %s, got %s", want, meta.ETag)
+			}
+			if meta.Checksum == nil || meta.Checksum.Value != "y/Q5Jg==" || meta.Checksum.Type != ChecksumTypeFullObject {
+				t.Errorf("Expected full-object CRC32 y/Q5Jg==, got %+v", meta.Checksum)
+			}
+
+			head, err := storage.HeadObject(bucket, "sum.txt", "")
+			if err != nil {
+				t.Fatalf("HeadObject failed: %v", err)
+			}
+			if head.Checksum == nil || head.Checksum.Value != meta.Checksum.Value {
+				t.Errorf("Expected the checksum to be stored, got %+v", head.Checksum)
+			}
+		})
+
+		t.Run("Composite", func(t *testing.T) {
+			opts := PutOptions{Checksum: &Checksum{Algorithm: ChecksumSHA256}}
+			upload, err := storage.CreateMultipartUpload(bucket, "mp.txt", "text/plain", nil, opts)
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+
+			var parts []Part
+			var raw []byte
+			for i, data := range []string{"first part,", "second part"} {
+				part, err := storage.UploadPart(bucket, "mp.txt", upload.UploadID, i+1, strings.NewReader(data))
+				if err != nil {
+					t.Fatalf("UploadPart failed: %v", err)
+				}
+				h := NewChecksumHash(ChecksumSHA256)
+				h.Write([]byte(data))
+				if want := base64.StdEncoding.EncodeToString(h.Sum(nil)); part.Checksum != want {
+					t.Errorf("Expected part checksum %s, got %s", want, part.Checksum)
+				}
+				raw = append(raw, h.Sum(nil)...)
+				parts = append(parts, Part{PartNumber: part.PartNumber, ETag: part.ETag, Checksum: part.Checksum})
+			}
+
+			meta, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, parts, WriteCondition{})
+			if err != nil {
+				t.Fatalf("CompleteMultipartUpload failed: %v", err)
+			}
+			h := NewChecksumHash(ChecksumSHA256)
+			h.Write(raw)
+			if want := base64.StdEncoding.EncodeToString(h.Sum(nil)) + "-2"; meta.Checksum == nil || meta.Checksum.Value != want {
+				t.Errorf("Expected composite checksum %s, got %+v", want, meta.Checksum)
+			}
+			if meta.Checksum.Type != ChecksumTypeComposite {
+				t.Errorf("Expected type %s, got %s", ChecksumTypeComposite, meta.Checksum.Type)
+			}
+		})
+
+		t.Run("FullObjectMultipart", func(t *testing.T) {
+			opts := PutOptions{Checksum: &Checksum{Algorithm: ChecksumCRC32, Type: ChecksumTypeFullObject}}
+			upload, err := storage.CreateMultipartUpload(bucket, "full.txt", "text/plain", nil, opts)
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			var parts []Part
+			for i, data := range []string{"1234", "56789"} {
+				part, err := storage.UploadPart(bucket, "full.txt", upload.UploadID, i+1, strings.NewReader(data))
+				if err != nil {
+					t.Fatalf("UploadPart failed: %v", err)
+				}
+				parts = append(parts, Part{PartNumber: part.PartNumber, ETag: part.ETag})
+			}
+
+			meta, err := storage.CompleteMultipartUpload(bucket, "full.txt", upload.UploadID, parts, WriteCondition{})
+			if err != nil {
+				t.Fatalf("CompleteMultipartUpload failed: %v", err)
+			}
+			if meta.Checksum == nil || meta.Checksum.Value != "y/Q5Jg==" {
+				t.Errorf("Expected full-object CRC32 y/Q5Jg==, got %+v", meta.Checksum)
+			}
+		})
+
+		t.Run("PartChecksumMismatch", func(t *testing.T) {
+			opts := PutOptions{Checksum: &Checksum{Algorithm: ChecksumCRC32}}
+			upload, err := storage.CreateMultipartUpload(bucket, "bad.txt", "text/plain", nil, opts)
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			part, err := storage.UploadPart(bucket, "bad.txt", upload.UploadID, 1, strings.NewReader("data"))
+			if err != nil {
+				t.Fatalf("UploadPart failed: %v", err)
+			}
+
+			_, err = storage.CompleteMultipartUpload(bucket, "bad.txt", upload.UploadID, []Part{{PartNumber: 1, ETag: part.ETag, Checksum: "AAAAAA=="}}, WriteCondition{})
+			if !errors.Is(err, ErrInvalidPart) {
+				t.Errorf("Expected ErrInvalidPart, got %v", err)
+			}
+			_, err = storage.CompleteMultipartUpload(bucket, "bad.txt", upload.UploadID, []Part{{PartNumber: 2, ETag: part.ETag}}, WriteCondition{})
+			if !errors.Is(err, ErrInvalidPart) {
+				t.Errorf("Expected ErrInvalidPart for a missing part, got %v", err)
+			}
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPreconditionFailed is returned when a conditional write does not hold
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// WriteCondition guards a write on the state of the key's current version.
+// The zero value writes unconditionally.
+type WriteCondition struct {
+	// IfMatch requires the current object to have one of these entity tags
+	IfMatch string
+
+	// IfNoneMatch set to "*" requires the key to have no current object
+	IfNoneMatch string
+}
+
+// isZero reports whether the condition is unconditional
+func (c WriteCondition) isZero() bool {
+	return c.IfMatch == "" && c.IfNoneMatch == ""
+}
+
+// ETagMatches reports whether a comma-separated list of entity tags from a
+// conditional header contains etag or the * wildcard
+func ETagMatches(header, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWriteCondition evaluates cond against the current version of a key.
+// If-Match on a missing key fails with ErrObjectNotFound, as in S3.
+func (fs *FileSystemStorage) checkWriteCondition(bucket, key string, cond WriteCondition) error {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil {
+		current = nil
+	}
+	return checkCondition(current, bucket, key, cond)
+}
+
+// checkCondition evaluates cond against current, the metadata of the
+// current version of a key or nil when there is none
+func checkCondition(current *ObjectMetadata, bucket, key string, cond WriteCondition) error {
+	exists := current != nil && !current.DeleteMarker
+
+	if cond.IfNoneMatch != "" && exists && ETagMatches(cond.IfNoneMatch, current.ETag) {
+		return fmt.Errorf("%w: %s/%s already exists", ErrPreconditionFailed, bucket, key)
+	}
+
+	if cond.IfMatch != "" {
+		if !exists {
+			return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+		}
+		if !ETagMatches(cond.IfMatch, current.ETag) {
+			return fmt.Errorf("%w: %s/%s has ETag %s", ErrPreconditionFailed, bucket, key, current.ETag)
+		}
+	}
+
+	return nil
+}
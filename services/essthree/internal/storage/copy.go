@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CopyObject copies an object, or one version of it, to a new key. The copy
+// gets the given metadata, content type and tags; callers pass the source's
+// values to keep them. The copy is encrypted, and checksummed, as opts
+// asks, whatever the source's encryption and checksum.
+func (fs *FileSystemStorage) CopyObject(srcBucket, srcKey, srcVersionID, dstBucket, dstKey string, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error) {
+	reader, srcMeta, err := fs.GetObject(srcBucket, srcKey, srcVersionID)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var data io.Reader = reader
+	if srcBucket == dstBucket && srcKey == dstKey {
+		// Spool the body first, since writing the destination replaces the source file
+		spool, err := os.CreateTemp(fs.baseDir, ".copy-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create copy buffer: %w", err)
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err := io.Copy(spool, reader); err != nil {
+			return nil, fmt.Errorf("failed to buffer copy source: %w", err)
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind copy buffer: %w", err)
+		}
+		data = spool
+	}
+
+	// The content is unchanged, so the copy keeps the source ETag and part
+	// boundaries
+	objMeta := &ObjectMetadata{
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Encryption:      opts.Encryption,
+		Checksum:        checksumRequest(opts.Checksum),
+		ETag:            srcMeta.ETag,
+		PartSizes:       srcMeta.PartSizes,
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+
+	if err := fs.writeObject(dstBucket, dstKey, data, objMeta, opts.Condition); err != nil {
+		return nil, err
+	}
+
+	return objMeta, nil
+}
+
+// UploadPartCopy uploads a part of a multipart upload from a byte range of
+// an existing object. A negative rangeEnd copies the whole source object.
+func (fs *FileSystemStorage) UploadPartCopy(bucket, key, uploadID string, partNumber int, srcBucket, srcKey, srcVersionID string, rangeStart, rangeEnd int64) (*Part, error) {
+	var reader io.ReadCloser
+	var err error
+	if rangeStart == 0 && rangeEnd < 0 {
+		reader, _, err = fs.GetObject(srcBucket, srcKey, srcVersionID)
+	} else {
+		reader, _, _, _, err = fs.GetObjectRange(srcBucket, srcKey, srcVersionID, rangeStart, rangeEnd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return fs.UploadPart(bucket, key, uploadID, partNumber, reader)
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import "strings"
+
+// CORSRule is one rule of a bucket CORS configuration
+type CORSRule struct {
+	ID             string   `json:"id,omitempty"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	ExposeHeaders  []string `json:"expose_headers,omitempty"`
+	MaxAgeSeconds  int      `json:"max_age_seconds,omitempty"`
+}
+
+// MatchesOrigin reports whether the rule allows requests from origin with
+// method. Origins may contain one '*' wildcard.
+func (r *CORSRule) MatchesOrigin(origin, method string) bool {
+	methodAllowed := false
+	for _, m := range r.AllowedMethods {
+		if m == method {
+			methodAllowed = true
+			break
+		}
+	}
+	if !methodAllowed {
+		return false
+	}
+
+	for _, allowed := range r.AllowedOrigins {
+		if wildcardMatch(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeader reports whether a request header may be sent, compared case
+// insensitively against AllowedHeaders, which may contain one '*' wildcard
+func (r *CORSRule) AllowsHeader(header string) bool {
+	header = strings.ToLower(header)
+	for _, allowed := range r.AllowedHeaders {
+		if wildcardMatch(strings.ToLower(allowed), header) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches value against a pattern with at most one '*'
+func wildcardMatch(pattern, value string) bool {
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return pattern == value
+	}
+	return len(value) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(value, prefix) &&
+		strings.HasSuffix(value, suffix)
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import "testing"
+
+func TestCORSRuleMatching(t *testing.T) {
+	rule := CORSRule{
+		AllowedOrigins: []string{"http://*.example.com", "https://app.test"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"x-amz-*", "Content-Type"},
+	}
+
+	origins := []struct {
+		origin string
+		method string
+		want   bool
+	}{
+		{"http://www.example.com", "GET", true},
+		{"https://app.test", "PUT", true},
+		{"http://example.com", "GET", false},
+		{"https://www.example.com", "GET", false},
+		{"https://app.test", "DELETE", false},
+	}
+	for _, tc := range origins {
+		if got := rule.MatchesOrigin(tc.origin, tc.method); got != tc.want {
+			t.Errorf("MatchesOrigin(%q, %q): expected %v, got %v", tc.origin, tc.method, tc.want, got)
+		}
+	}
+
+	headers := map[string]bool{
+		"content-type":     true,
+		"X-Amz-Meta-Owner": true,
+		"Authorization":    false,
+	}
+	for header, want := range headers {
+		if got := rule.AllowsHeader(header); got != want {
+			t.Errorf("AllowsHeader(%q): expected %v, got %v", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Server-side encryption algorithms, as named by x-amz-server-side-encryption
+const (
+	SSEAlgorithmAES256  = "AES256"
+	SSEAlgorithmKMS     = "aws:kms"
+	SSEAlgorithmKMSDSSE = "aws:kms:dsse"
+)
+
+// masterKeyFile holds the key that seals object data keys, in the storage
+// base directory
+const masterKeyFile = ".master-key"
+
+// masterKey seals the data keys of objects encrypted at rest
+type masterKey []byte
+
+// Encryption describes how an object is encrypted at rest. SSE-S3 and
+// SSE-KMS set Algorithm; SSE-C sets the customer key fields instead.
+type Encryption struct {
+	Algorithm        string `json:"algorithm,omitempty"`
+	KMSKeyID         string `json:"kms_key_id,omitempty"`
+	KMSContext       string `json:"kms_context,omitempty"`
+	BucketKeyEnabled bool   `json:"bucket_key_enabled,omitempty"`
+
+	// CustomerAlgorithm and CustomerKeyMD5 are echoed back for SSE-C. The
+	// key itself is never stored; a salted HMAC of it verifies later
+	// requests.
+	CustomerAlgorithm string `json:"customer_algorithm,omitempty"`
+	CustomerKeyMD5    string `json:"customer_key_md5,omitempty"`
+	CustomerKeySalt   []byte `json:"customer_key_salt,omitempty"`
+	CustomerKeyHMAC   []byte `json:"customer_key_hmac,omitempty"`
+
+	// CustomerKey is the SSE-C key of the current request. It is only used
+	// to derive CustomerKeyHMAC and is never persisted.
+	CustomerKey []byte `json:"-"`
+
+	// DataKey is the object's AES-256 data key sealed with the master key,
+	// and IV the initial AES-CTR counter block
+	DataKey []byte `json:"data_key,omitempty"`
+	IV      []byte `json:"iv,omitempty"`
+}
+
+// IsCustomerKey reports whether the object uses SSE-C
+func (e *Encryption) IsCustomerKey() bool {
+	return e != nil && e.CustomerAlgorithm != ""
+}
+
+// MatchesCustomerKey reports whether key is the SSE-C key the object was
+// written with
+func (e *Encryption) MatchesCustomerKey(key []byte) bool {
+	if !e.IsCustomerKey() {
+		return false
+	}
+	return hmac.Equal(customerKeyHMAC(e.CustomerKeySalt, key), e.CustomerKeyHMAC)
+}
+
+// customerKeyHMAC computes the salted HMAC stored to verify an SSE-C key
+func customerKeyHMAC(salt, key []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// newMasterKey generates a random master key
+func newMasterKey() (masterKey, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate master key: %w", err)
+	}
+	return key, nil
+}
+
+// loadMasterKey reads the master key from the base directory, creating it on
+// first use
+func loadMasterKey(baseDir string) (masterKey, error) {
+	path := filepath.Join(baseDir, masterKeyFile)
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %s has %d bytes, expected 32", path, len(key))
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+
+	generated, err := newMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, generated, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write master key: %w", err)
+	}
+	return generated, nil
+}
+
+// keyEncryptionKey returns the key that seals data keys for enc. Each KMS
+// key ID gets its own key derived from the master key, standing in for a
+// real KMS key.
+func (k masterKey) keyEncryptionKey(enc *Encryption) []byte {
+	if enc.Algorithm != SSEAlgorithmKMS && enc.Algorithm != SSEAlgorithmKMSDSSE {
+		return k
+	}
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte("kms:" + enc.KMSKeyID))
+	return mac.Sum(nil)
+}
+
+// sealEncryption returns a copy of enc with a fresh data key and IV, and
+// for SSE-C the HMAC of the customer key, together with the plain data key
+func (k masterKey) sealEncryption(enc *Encryption) (*Encryption, []byte, error) {
+	sealed := *enc
+	sealed.CustomerKey = nil
+
+	if len(enc.CustomerKey) > 0 {
+		sealed.CustomerKeySalt = make([]byte, 16)
+		if _, err := rand.Read(sealed.CustomerKeySalt); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate key salt: %w", err)
+		}
+		sealed.CustomerKeyHMAC = customerKeyHMAC(sealed.CustomerKeySalt, enc.CustomerKey)
+	}
+
+	dataKey := make([]byte, 32)
+	sealed.IV = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	if _, err := rand.Read(sealed.IV); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	aead, err := newGCM(k.keyEncryptionKey(enc))
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed.DataKey = aead.Seal(nonce, nonce, dataKey, nil)
+
+	return &sealed, dataKey, nil
+}
+
+// unsealed returns a copy of enc without its data key, so the object it
+// describes is encrypted under a new one. It returns nil for nil.
+func unsealed(enc *Encryption) *Encryption {
+	if enc == nil {
+		return nil
+	}
+	copied := *enc
+	copied.DataKey, copied.IV = nil, nil
+	return &copied
+}
+
+// openDataKey recovers the plain data key of an encrypted object
+func (k masterKey) openDataKey(enc *Encryption) ([]byte, error) {
+	aead, err := newGCM(k.keyEncryptionKey(enc))
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.DataKey) < aead.NonceSize() {
+		return nil, errors.New("sealed data key is truncated")
+	}
+	nonce, sealed := enc.DataKey[:aead.NonceSize()], enc.DataKey[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// newGCM creates an AES-GCM cipher for sealing data keys
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// ctrStream returns an AES-CTR key stream positioned at byte offset, so
+// ranges can be decrypted without reading the data before them
+func ctrStream(dataKey, iv []byte, offset int64) (cipher.Stream, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// Advance the big-endian counter by the number of whole blocks
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, iv)
+	carry := uint64(offset / aes.BlockSize)
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(block, counter)
+	if skip := offset % aes.BlockSize; skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	return stream, nil
+}
+
+// encryptReader wraps data so it yields AES-CTR ciphertext
+func encryptReader(data io.Reader, dataKey, iv []byte) (io.Reader, error) {
+	stream, err := ctrStream(dataKey, iv, 0)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: stream, R: data}, nil
+}
+
+// openData opens a stored object body positioned at offset, decrypting it
+// when the object is encrypted at rest
+func (fs *FileSystemStorage) openData(path string, enc *Encryption, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to seek: %w", err)
+		}
+	}
+	if enc == nil {
+		return file, nil
+	}
+
+	dataKey, err := fs.masterKey.openDataKey(enc)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := ctrStream(dataKey, enc.IV, offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &limitedReadCloser{Reader: cipher.StreamReader{S: stream, R: file}, Closer: file}, nil
+}
+
+// partEncryptionPrefix is the size of the random IV that starts each part
+// file of an encrypted multipart upload
+const partEncryptionPrefix = aes.BlockSize
+
+// writePartData writes one part of an upload, encrypted with the upload's
+// data key under a fresh IV stored at the start of the file
+func (fs *FileSystemStorage) writePartData(w io.Writer, data io.Reader, enc *Encryption) (int64, error) {
+	if enc == nil {
+		return io.Copy(w, data)
+	}
+
+	dataKey, err := fs.masterKey.openDataKey(enc)
+	if err != nil {
+		return 0, err
+	}
+	iv := make([]byte, partEncryptionPrefix)
+	if _, err := rand.Read(iv); err != nil {
+		return 0, fmt.Errorf("failed to generate IV: %w", err)
+	}
+	if _, err := w.Write(iv); err != nil {
+		return 0, err
+	}
+	reader, err := encryptReader(data, dataKey, iv)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, reader)
+}
+
+// openPartData opens a part file written by writePartData
+func (fs *FileSystemStorage) openPartData(path string, enc *Encryption) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return file, nil
+	}
+
+	iv := make([]byte, partEncryptionPrefix)
+	if _, err := io.ReadFull(file, iv); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read part IV: %w", err)
+	}
+	dataKey, err := fs.masterKey.openDataKey(enc)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := ctrStream(dataKey, iv, 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &limitedReadCloser{Reader: cipher.StreamReader{S: stream, R: file}, Closer: file}, nil
+}
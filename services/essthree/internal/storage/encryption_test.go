@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ess-three-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	storage, err := NewFileSystemStorage(tempDir, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	bucket := "test-bucket"
+	content := []byte(strings.Repeat("0123456789abcdef", 10) + "tail")
+
+	t.Run("SSE-KMS", func(t *testing.T) {
+		opts := PutOptions{Encryption: &Encryption{Algorithm: SSEAlgorithmKMS, KMSKeyID: "alias/test"}}
+		meta, err := storage.PutObject(bucket, "kms.txt", bytes.NewReader(content), nil, "text/plain", opts)
+		if err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+
+		raw, err := os.ReadFile(storage.dataPath(bucket, "kms.txt", meta))
+		if err != nil {
+			t.Fatalf("Failed to read object file: %v", err)
+		}
+		if bytes.Contains(raw, []byte("0123456789")) {
+			t.Errorf("Expected the body to be encrypted on disk")
+		}
+
+		reader, meta, err := storage.GetObject(bucket, "kms.txt", "")
+		if err != nil {
+			t.Fatalf("GetObject failed: %v", err)
+		}
+		defer reader.Close()
+		got, _ := io.ReadAll(reader)
+		if !bytes.Equal(got, content) {
+			t.Errorf("Expected decrypted content %q, got %q", content, got)
+		}
+		if meta.Encryption.KMSKeyID != "alias/test" {
+			t.Errorf("Expected KMS key alias/test, got %q", meta.Encryption.KMSKeyID)
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		reader, _, start, end, err := storage.GetObjectRange(bucket, "kms.txt", "", 37, 161)
+		if err != nil {
+			t.Fatalf("GetObjectRange failed: %v", err)
+		}
+		defer reader.Close()
+		got, _ := io.ReadAll(reader)
+		if want := content[start : end+1]; !bytes.Equal(got, want) {
+			t.Errorf("Expected range %q, got %q", want, got)
+		}
+	})
+
+	t.Run("SSE-C", func(t *testing.T) {
+		key := bytes.Repeat([]byte{7}, 32)
+		opts := PutOptions{Encryption: &Encryption{CustomerAlgorithm: SSEAlgorithmAES256, CustomerKeyMD5: "md5", CustomerKey: key}}
+		meta, err := storage.PutObject(bucket, "ssec.txt", bytes.NewReader(content), nil, "text/plain", opts)
+		if err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+
+		if len(meta.Encryption.CustomerKey) != 0 {
+			t.Errorf("Expected the customer key not to be kept")
+		}
+		if !meta.Encryption.MatchesCustomerKey(key) {
+			t.Errorf("Expected the customer key to match")
+		}
+		if meta.Encryption.MatchesCustomerKey(bytes.Repeat([]byte{8}, 32)) {
+			t.Errorf("Expected a different key not to match")
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		opts := PutOptions{Encryption: &Encryption{Algorithm: SSEAlgorithmAES256}}
+		upload, err := storage.CreateMultipartUpload(bucket, "mp.txt", "text/plain", nil, opts)
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload failed: %v", err)
+		}
+		var parts []Part
+		for i, data := range []string{"first part,", "second part"} {
+			part, err := storage.UploadPart(bucket, "mp.txt", upload.UploadID, i+1, strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("UploadPart failed: %v", err)
+			}
+			parts = append(parts, Part{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+		if _, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, parts, WriteCondition{}); err != nil {
+			t.Fatalf("CompleteMultipartUpload failed: %v", err)
+		}
+
+		reader, meta, err := storage.GetObject(bucket, "mp.txt", "")
+		if err != nil {
+			t.Fatalf("GetObject failed: %v", err)
+		}
+		defer reader.Close()
+		got, _ := io.ReadAll(reader)
+		if string(got) != "first part,second part" {
+			t.Errorf("Expected combined parts, got %q", got)
+		}
+		if meta.Encryption == nil || meta.Encryption.Algorithm != SSEAlgorithmAES256 {
+			t.Errorf("Expected AES256 encryption, got %+v", meta.Encryption)
+		}
+	})
+}
@@ -0,0 +1,460 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexFileName is the key index kept in each bucket directory
+const indexFileName = "index.db"
+
+// legacyIndexFileName is the journal older versions kept the key index in;
+// it is removed once the index has been rebuilt
+const legacyIndexFileName = "index.log"
+
+// indexBuildBatch is how many keys a rebuild writes per transaction
+const indexBuildBatch = 10000
+
+// indexLockTimeout bounds the wait for another process, such as a running
+// server, to release a bucket's key index
+const indexLockTimeout = 5 * time.Second
+
+var (
+	// indexKeys maps each key to the JSON metadata of its current version
+	indexKeys = []byte("keys")
+	// indexStats holds counters kept in step with indexKeys
+	indexStats = []byte("stats")
+	// indexObjectCount counts the keys whose current version is not a
+	// delete marker
+	indexObjectCount = []byte("objects")
+)
+
+// errIndexMismatch stops a scan of an index that does not match the
+// metadata on disk
+var errIndexMismatch = errors.New("key index does not match metadata")
+
+// keyIndex is an ordered index of the current version of every key in a
+// bucket, delete markers included, so listings and object counts need not
+// walk the metadata directory. It is an embedded on-disk B+tree, so an
+// update costs O(log n), loading it reads nothing up front, and every
+// update is fsynced before the write that made it returns. The number of
+// objects is kept beside the keys, so counting them reads one value.
+type keyIndex struct {
+	db *bolt.DB
+}
+
+// indexCursor walks a key index within a read transaction
+type indexCursor struct {
+	cursor *bolt.Cursor
+	key    []byte
+	value  []byte
+}
+
+func (c *indexCursor) seek(key string) {
+	c.key, c.value = c.cursor.Seek([]byte(key))
+}
+
+func (c *indexCursor) next() (*ObjectMetadata, bool) {
+	for c.key != nil {
+		var meta ObjectMetadata
+		err := json.Unmarshal(c.value, &meta)
+		c.key, c.value = c.cursor.Next()
+		if err == nil {
+			return &meta, true
+		}
+	}
+	return nil, false
+}
+
+// openIndex opens the key index at path, creating it when it is missing
+func openIndex(path string) (*keyIndex, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: indexLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key index: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(indexKeys); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(indexStats)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize key index: %w", err)
+	}
+	return &keyIndex{db: db}, nil
+}
+
+// loadIndex opens the key index at path. It reports false when there is no
+// usable index and it must be rebuilt.
+func loadIndex(path string) (*keyIndex, bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	idx, err := openIndex(path)
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, false, err
+		}
+		// A torn or corrupt index cannot be trusted
+		return nil, false, nil
+	}
+	return idx, true, nil
+}
+
+// buildIndex builds a key index from the metadata files under metadataDir
+// into a fresh file that replaces the one at path
+func buildIndex(path, metadataDir string) (*keyIndex, error) {
+	entries := make(map[string]*ObjectMetadata)
+	err := filepath.WalkDir(metadataDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		meta, err := readMetadata(path)
+		if err != nil {
+			return nil // Skip unreadable or invalid metadata
+		}
+		entries[meta.Key] = meta
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read object metadata: %w", err)
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key index: %w", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	idx, err := openIndex(file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys arrive in order, so pages can be filled completely
+	objects := uint64(0)
+	for start := 0; start < len(keys); start += indexBuildBatch {
+		batch := keys[start:min(start+indexBuildBatch, len(keys))]
+		err := idx.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(indexKeys)
+			b.FillPercent = 1.0
+			for _, key := range batch {
+				value, err := json.Marshal(entries[key])
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte(key), value); err != nil {
+					return err
+				}
+				if !entries[key].DeleteMarker {
+					objects++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			idx.close()
+			return nil, fmt.Errorf("failed to write key index: %w", err)
+		}
+	}
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexStats).Put(indexObjectCount, binary.BigEndian.AppendUint64(nil, objects))
+	})
+	idx.close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write key index: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to replace key index: %w", err)
+	}
+	os.Remove(filepath.Join(filepath.Dir(path), legacyIndexFileName))
+	return openIndex(path)
+}
+
+// isObject reports whether an indexed value is an object rather than a
+// delete marker
+func isObject(value []byte) bool {
+	var entry struct {
+		DeleteMarker bool `json:"delete_marker"`
+	}
+	return value != nil && json.Unmarshal(value, &entry) == nil && !entry.DeleteMarker
+}
+
+// addObjects adjusts the object count by delta within tx
+func addObjects(tx *bolt.Tx, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	stats := tx.Bucket(indexStats)
+	count := int64(0)
+	if value := stats.Get(indexObjectCount); len(value) == 8 {
+		count = int64(binary.BigEndian.Uint64(value))
+	}
+	return stats.Put(indexObjectCount, binary.BigEndian.AppendUint64(nil, uint64(max(count+delta, 0))))
+}
+
+// put records meta as the current version of its key
+func (idx *keyIndex) put(meta *ObjectMetadata) error {
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode key index entry: %w", err)
+	}
+
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexKeys)
+		delta := int64(0)
+		if isObject(b.Get([]byte(meta.Key))) {
+			delta--
+		}
+		if !meta.DeleteMarker {
+			delta++
+		}
+		if err := b.Put([]byte(meta.Key), value); err != nil {
+			return err
+		}
+		return addObjects(tx, delta)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write key index: %w", err)
+	}
+	return nil
+}
+
+// remove records that key has no current version
+func (idx *keyIndex) remove(key string) error {
+	err := idx.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexKeys)
+		previous := b.Get([]byte(key))
+		if previous == nil {
+			return nil
+		}
+		delta := int64(0)
+		if isObject(previous) {
+			delta--
+		}
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return addObjects(tx, delta)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write key index: %w", err)
+	}
+	return nil
+}
+
+// close releases the index file
+func (idx *keyIndex) close() {
+	idx.db.Close()
+}
+
+// objectCount returns the number of indexed keys whose current version is
+// not a delete marker
+func (idx *keyIndex) objectCount() (int, error) {
+	count := 0
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(indexStats).Get(indexObjectCount); len(value) == 8 {
+			count = int(binary.BigEndian.Uint64(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read key index: %w", err)
+	}
+	return count, nil
+}
+
+// hasKeys reports whether the index holds any key, delete markers included
+func (idx *keyIndex) hasKeys() (bool, error) {
+	found := false
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(indexKeys).Cursor().First()
+		found = key != nil
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read key index: %w", err)
+	}
+	return found, nil
+}
+
+// matches reports whether the index holds exactly the given keys
+func (idx *keyIndex) matches(keys map[string]time.Time) (bool, error) {
+	matched := false
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		indexed := 0
+		err := tx.Bucket(indexKeys).ForEach(func(key, _ []byte) error {
+			if _, ok := keys[string(key)]; !ok {
+				return errIndexMismatch
+			}
+			indexed++
+			return nil
+		})
+		if err == errIndexMismatch {
+			return nil
+		}
+		matched = err == nil && indexed == len(keys)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read key index: %w", err)
+	}
+	return matched, nil
+}
+
+// scan calls fn with a cursor over the index within one read transaction
+func (idx *keyIndex) scan(fn func(cursor *indexCursor) error) error {
+	return idx.db.View(func(tx *bolt.Tx) error {
+		return fn(&indexCursor{cursor: tx.Bucket(indexKeys).Cursor()})
+	})
+}
+
+// paginate builds one page of a listing straight from the index
+func (idx *keyIndex) paginate(prefix, delimiter, marker string, maxKeys int) (*ListResult, error) {
+	var result *ListResult
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		result = paginateCursor(&indexCursor{cursor: tx.Bucket(indexKeys).Cursor()}, prefix, delimiter, marker, maxKeys)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key index: %w", err)
+	}
+	return result, nil
+}
+
+// indexPath returns the path of a bucket's key index
+func (fs *FileSystemStorage) indexPath(bucket string) string {
+	return filepath.Join(fs.bucketPath(bucket), indexFileName)
+}
+
+// bucketIndex returns the key index of a bucket, opening it on first use.
+// A bucket without a usable index has it rebuilt from disk.
+func (fs *FileSystemStorage) bucketIndex(bucket string) (*keyIndex, error) {
+	fs.indexMu.Lock()
+	defer fs.indexMu.Unlock()
+
+	if idx, ok := fs.indexes[bucket]; ok {
+		return idx, nil
+	}
+	if !fs.bucketExists(bucket) {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	idx, ok, err := loadIndex(fs.indexPath(bucket))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if idx, err = buildIndex(fs.indexPath(bucket), fs.bucketMetadataDir(bucket)); err != nil {
+			return nil, err
+		}
+	}
+
+	fs.indexes[bucket] = idx
+	return idx, nil
+}
+
+// dropIndex closes and forgets the key index of a bucket
+func (fs *FileSystemStorage) dropIndex(bucket string) {
+	fs.indexMu.Lock()
+	defer fs.indexMu.Unlock()
+
+	if idx, ok := fs.indexes[bucket]; ok {
+		idx.close()
+		delete(fs.indexes, bucket)
+	}
+}
+
+// Close releases the key index of every bucket, so another storage may
+// open the data directory
+func (fs *FileSystemStorage) Close() error {
+	fs.indexMu.Lock()
+	defer fs.indexMu.Unlock()
+
+	for bucket, idx := range fs.indexes {
+		idx.close()
+		delete(fs.indexes, bucket)
+	}
+	return nil
+}
+
+// indexPut records meta as the current version of key in the bucket index
+func (fs *FileSystemStorage) indexPut(bucket string, meta *ObjectMetadata) error {
+	idx, err := fs.bucketIndex(bucket)
+	if err != nil {
+		return err
+	}
+	return idx.put(meta)
+}
+
+// indexRemove records that key has no current version in the bucket index
+func (fs *FileSystemStorage) indexRemove(bucket, key string) error {
+	idx, err := fs.bucketIndex(bucket)
+	if err != nil {
+		return err
+	}
+	return idx.remove(key)
+}
+
+// RebuildIndexes rebuilds the key index of every bucket from the metadata
+// on disk, for data directories written before the index existed or edited
+// by hand. It returns the buckets with their object counts.
+func (fs *FileSystemStorage) RebuildIndexes() ([]BucketSummary, error) {
+	entries, err := os.ReadDir(fs.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage base directory: %w", err)
+	}
+
+	var buckets []BucketSummary
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		bucket := entry.Name()
+
+		// The open index holds a lock on the file being replaced
+		fs.dropIndex(bucket)
+		idx, err := buildIndex(fs.indexPath(bucket), fs.bucketMetadataDir(bucket))
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild key index of %s: %w", bucket, err)
+		}
+
+		fs.indexMu.Lock()
+		fs.indexes[bucket] = idx
+		fs.indexMu.Unlock()
+
+		count, err := idx.objectCount()
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, BucketSummary{Name: bucket, ObjectCount: count})
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	tempDir := t.TempDir()
+
+	storage, err := NewFileSystemStorage(tempDir, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	bucket := "indexed-bucket"
+	for _, key := range []string{"b.txt", "a/1.txt", "a/2.txt", "c.txt"} {
+		if _, err := storage.PutObject(bucket, key, strings.NewReader(key), nil, "text/plain", PutOptions{}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	if _, err := storage.DeleteObject(bucket, "c.txt", "", DeleteOptions{}); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+
+	listKeys := func(t *testing.T, s *FileSystemStorage) []string {
+		result, err := s.ListObjectsV2(bucket, "", "", "", "", 1000)
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		var keys []string
+		for _, obj := range result.Objects {
+			keys = append(keys, obj.Key)
+		}
+		return keys
+	}
+
+	// reopen closes the storage and opens the data directory again
+	reopen := func(t *testing.T) {
+		storage.Close()
+		if storage, err = NewFileSystemStorage(tempDir, Config{}); err != nil {
+			t.Fatalf("Failed to reopen storage: %v", err)
+		}
+	}
+	defer func() { storage.Close() }()
+
+	t.Run("Reopen", func(t *testing.T) {
+		reopen(t)
+		if got := strings.Join(listKeys(t, storage), ","); got != "a/1.txt,a/2.txt,b.txt" {
+			t.Errorf("Expected a/1.txt,a/2.txt,b.txt, got %s", got)
+		}
+	})
+
+	t.Run("CorruptIndex", func(t *testing.T) {
+		storage.Close()
+		if err := os.WriteFile(filepath.Join(tempDir, bucket, indexFileName), []byte("not an index"), 0644); err != nil {
+			t.Fatalf("Failed to corrupt index: %v", err)
+		}
+
+		reopen(t)
+		if got := strings.Join(listKeys(t, storage), ","); got != "a/1.txt,a/2.txt,b.txt" {
+			t.Errorf("Expected the index to be rebuilt from disk, got %s", got)
+		}
+	})
+
+	t.Run("LegacyJournal", func(t *testing.T) {
+		storage.Close()
+		legacy := filepath.Join(tempDir, bucket, legacyIndexFileName)
+		if err := os.WriteFile(legacy, []byte(`{"put":{"key":"a/1.txt"}}`+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write journal: %v", err)
+		}
+		if err := os.Remove(filepath.Join(tempDir, bucket, indexFileName)); err != nil {
+			t.Fatalf("Failed to remove index: %v", err)
+		}
+
+		reopen(t)
+		if got := strings.Join(listKeys(t, storage), ","); got != "a/1.txt,a/2.txt,b.txt" {
+			t.Errorf("Expected the index to be rebuilt from disk, got %s", got)
+		}
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Errorf("Expected the old journal to be removed, got %v", err)
+		}
+	})
+
+	t.Run("RebuildIndexes", func(t *testing.T) {
+		// Metadata added behind the index's back is only seen after a rebuild
+		meta := &ObjectMetadata{Key: "d.txt", ETag: `"d"`}
+		if err := writeMetadata(storage.metadataPath(bucket, "d.txt"), meta); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+
+		buckets, err := storage.RebuildIndexes()
+		if err != nil {
+			t.Fatalf("RebuildIndexes failed: %v", err)
+		}
+		if len(buckets) != 1 || buckets[0].Name != bucket || buckets[0].ObjectCount != 4 {
+			t.Errorf("Expected %s with 4 objects, got %+v", bucket, buckets)
+		}
+		if got := strings.Join(listKeys(t, storage), ","); got != "a/1.txt,a/2.txt,b.txt,d.txt" {
+			t.Errorf("Expected a/1.txt,a/2.txt,b.txt,d.txt, got %s", got)
+		}
+	})
+
+	t.Run("Overwrites", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("churn-%d", i%4)
+			if _, err := storage.PutObject(bucket, key, strings.NewReader("x"), nil, "text/plain", PutOptions{}); err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+		}
+
+		buckets, err := storage.ListBuckets()
+		if err != nil {
+			t.Fatalf("ListBuckets failed: %v", err)
+		}
+		if len(buckets) != 1 || buckets[0].ObjectCount != 8 {
+			t.Errorf("Expected 8 objects, got %+v", buckets)
+		}
+	})
+}
+
+func TestObjectCountSkipsDeleteMarkers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "versioned-bucket"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+		if _, err := storage.UpdateBucket(bucket, func(info *BucketInfo) error {
+			info.Versioning = VersioningEnabled
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
+		}
+		for _, key := range []string{"kept.txt", "deleted.txt"} {
+			if _, err := storage.PutObject(bucket, key, strings.NewReader(key), nil, "text/plain", PutOptions{}); err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+		}
+		if _, err := storage.DeleteObject(bucket, "deleted.txt", "", DeleteOptions{}); err != nil {
+			t.Fatalf("DeleteObject failed: %v", err)
+		}
+
+		countObjects := func(t *testing.T) int {
+			buckets, err := storage.ListBuckets()
+			if err != nil {
+				t.Fatalf("ListBuckets failed: %v", err)
+			}
+			if len(buckets) != 1 {
+				t.Fatalf("Expected 1 bucket, got %+v", buckets)
+			}
+			return buckets[0].ObjectCount
+		}
+		if count := countObjects(t); count != 1 {
+			t.Errorf("Expected 1 object beside the delete marker, got %d", count)
+		}
+
+		if fs, ok := storage.(*FileSystemStorage); ok {
+			buckets, err := fs.RebuildIndexes()
+			if err != nil {
+				t.Fatalf("RebuildIndexes failed: %v", err)
+			}
+			if len(buckets) != 1 || buckets[0].ObjectCount != 1 {
+				t.Errorf("Expected 1 object after a rebuild, got %+v", buckets)
+			}
+		}
+
+		// Overwriting the delete marker makes the key an object again
+		if _, err := storage.PutObject(bucket, "deleted.txt", strings.NewReader("back"), nil, "text/plain", PutOptions{}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+		if count := countObjects(t); count != 2 {
+			t.Errorf("Expected 2 objects, got %d", count)
+		}
+	})
+}
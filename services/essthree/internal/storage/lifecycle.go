@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// LifecycleRule is one rule of a bucket lifecycle configuration. Zero values
+// leave an action unset.
+type LifecycleRule struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+
+	// Filter; an object must match the prefix and carry every tag
+	Prefix string            `json:"prefix,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+
+	// Expiration of current versions
+	ExpirationDays            int        `json:"expiration_days,omitempty"`
+	ExpirationDate            *time.Time `json:"expiration_date,omitempty"`
+	ExpiredObjectDeleteMarker bool       `json:"expired_object_delete_marker,omitempty"`
+
+	// Expiration of noncurrent versions, keeping the newest
+	// NewerNoncurrentVersions of them regardless of age
+	NoncurrentVersionExpirationDays int `json:"noncurrent_version_expiration_days,omitempty"`
+	NewerNoncurrentVersions         int `json:"newer_noncurrent_versions,omitempty"`
+
+	// Cleanup of multipart uploads that were never completed
+	AbortIncompleteMultipartUploadDays int `json:"abort_incomplete_multipart_upload_days,omitempty"`
+}
+
+// Matches reports whether the rule's filter selects an object
+func (r *LifecycleRule) Matches(key string, tags map[string]string) bool {
+	if !strings.HasPrefix(key, r.Prefix) {
+		return false
+	}
+	for k, v := range r.Tags {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
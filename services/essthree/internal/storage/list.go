@@ -0,0 +1,273 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// objectCursor walks object metadata in key order
+type objectCursor interface {
+	// seek moves to the first entry whose key is at or after key
+	seek(key string)
+	// next returns the entry at the cursor and advances past it
+	next() (*ObjectMetadata, bool)
+}
+
+// sliceCursor walks a slice of objects sorted by key
+type sliceCursor struct {
+	objects []ObjectMetadata
+	pos     int
+}
+
+func (c *sliceCursor) seek(key string) {
+	c.pos = sort.Search(len(c.objects), func(i int) bool {
+		return c.objects[i].Key >= key
+	})
+}
+
+func (c *sliceCursor) next() (*ObjectMetadata, bool) {
+	if c.pos >= len(c.objects) {
+		return nil, false
+	}
+	c.pos++
+	return &c.objects[c.pos-1], true
+}
+
+// prefixEnd returns the smallest key after every key starting with prefix.
+// It reports false when no such key exists.
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+// paginateObjects builds one page of a listing from objects sorted by key.
+// Keys containing the delimiter after the prefix are rolled up into common
+// prefixes, and each common prefix counts as a single entry towards maxKeys.
+// Entries at or before marker are skipped, including every key of a common
+// prefix that was already returned as the last entry of a previous page.
+func paginateObjects(objects []ObjectMetadata, prefix, delimiter, marker string, maxKeys int) *ListResult {
+	return paginateCursor(&sliceCursor{objects: objects}, prefix, delimiter, marker, maxKeys)
+}
+
+// paginateCursor builds one page of a listing as paginateObjects does,
+// walking cursor from the marker and seeking past each common prefix so a
+// page costs time in proportion to its size. Delete markers are skipped.
+func paginateCursor(cursor objectCursor, prefix, delimiter, marker string, maxKeys int) *ListResult {
+	result := &ListResult{}
+	// A page of no keys only reports whether any match
+	maxKeys = max(maxKeys, 0)
+
+	start := prefix
+	if marker != "" && marker >= start {
+		start = marker + "\x00"
+	}
+	cursor.seek(start)
+
+	count := 0
+	lastEntry := marker
+
+	for {
+		obj, ok := cursor.next()
+		// Keys are sorted, so the first key outside the prefix ends the listing
+		if !ok || !strings.HasPrefix(obj.Key, prefix) {
+			break
+		}
+		if obj.DeleteMarker {
+			continue
+		}
+
+		commonPrefix := ""
+		if delimiter != "" {
+			if idx := strings.Index(obj.Key[len(prefix):], delimiter); idx >= 0 {
+				commonPrefix = obj.Key[:len(prefix)+idx+len(delimiter)]
+			}
+		}
+
+		// Skip the rest of a group that a previous page already returned
+		if commonPrefix != "" && strings.HasPrefix(marker, commonPrefix) {
+			end, ok := prefixEnd(commonPrefix)
+			if !ok {
+				break
+			}
+			cursor.seek(end)
+			continue
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+
+		if commonPrefix == "" {
+			result.Objects = append(result.Objects, *obj)
+			lastEntry = obj.Key
+			continue
+		}
+
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix)
+		lastEntry = commonPrefix
+		end, ok := prefixEnd(commonPrefix)
+		if !ok {
+			break
+		}
+		cursor.seek(end)
+	}
+
+	if result.IsTruncated {
+		result.NextMarker = lastEntry
+		result.NextContinuationToken = lastEntry
+	}
+
+	return result
+}
+
+// markerPage is one page of a listing resumed by a key and an ID marker
+type markerPage[T any] struct {
+	entries        []T
+	commonPrefixes []string
+	isTruncated    bool
+	nextKeyMarker  string
+	nextIDMarker   string
+}
+
+// paginateMarkers builds one page of a listing from entries sorted by key
+// and then in ID order, where entryID returns the key and ID of an entry.
+// Common prefixes are rolled up as in paginateObjects. The key and ID
+// markers resume after the last entry of the previous page; a key marker
+// alone skips every entry of its key.
+func paginateMarkers[T any](entries []T, entryID func(T) (string, string), prefix, delimiter, keyMarker, idMarker string, maxEntries int) markerPage[T] {
+	page := markerPage[T]{}
+	// A page of no entries only reports whether any match
+	maxEntries = max(maxEntries, 0)
+
+	count := 0
+	lastKey := keyMarker
+	lastID := idMarker
+	lastPrefix := ""
+	// Entries of the marker key are skipped up to and including the marker ID
+	pastIDMarker := false
+
+	for _, entry := range entries {
+		key, id := entryID(entry)
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if keyMarker != "" {
+			if key < keyMarker {
+				continue
+			}
+			if key == keyMarker && !pastIDMarker {
+				if idMarker == "" || id == idMarker {
+					pastIDMarker = idMarker != ""
+				}
+				continue
+			}
+		}
+
+		commonPrefix := ""
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				commonPrefix = key[:len(prefix)+idx+len(delimiter)]
+			}
+		}
+
+		if commonPrefix != "" {
+			// Skip the rest of a group that was already emitted
+			if commonPrefix == lastPrefix || strings.HasPrefix(keyMarker, commonPrefix) {
+				continue
+			}
+		}
+
+		if count == maxEntries {
+			page.isTruncated = true
+			break
+		}
+
+		if commonPrefix != "" {
+			page.commonPrefixes = append(page.commonPrefixes, commonPrefix)
+			lastPrefix = commonPrefix
+			lastKey = commonPrefix
+			lastID = ""
+		} else {
+			page.entries = append(page.entries, entry)
+			lastKey = key
+			lastID = id
+		}
+		count++
+	}
+
+	if page.isTruncated {
+		page.nextKeyMarker = lastKey
+		page.nextIDMarker = lastID
+	}
+
+	return page
+}
+
+// paginateVersions builds one page of a version listing from versions sorted
+// by key and then newest first
+func paginateVersions(versions []ObjectVersion, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) *VersionListResult {
+	page := paginateMarkers(versions, func(version ObjectVersion) (string, string) {
+		return version.Key, version.VersionID
+	}, prefix, delimiter, keyMarker, versionIDMarker, maxKeys)
+
+	return &VersionListResult{
+		Versions:            page.entries,
+		CommonPrefixes:      page.commonPrefixes,
+		IsTruncated:         page.isTruncated,
+		NextKeyMarker:       page.nextKeyMarker,
+		NextVersionIDMarker: page.nextIDMarker,
+	}
+}
+
+// paginateUploads pages multipart uploads ordered by key and initiation time
+func paginateUploads(uploads []MultipartUpload, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) *UploadListResult {
+	page := paginateMarkers(uploads, func(upload MultipartUpload) (string, string) {
+		return upload.Key, upload.UploadID
+	}, prefix, delimiter, keyMarker, uploadIDMarker, maxUploads)
+
+	return &UploadListResult{
+		Uploads:            page.entries,
+		CommonPrefixes:     page.commonPrefixes,
+		IsTruncated:        page.isTruncated,
+		NextKeyMarker:      page.nextKeyMarker,
+		NextUploadIDMarker: page.nextIDMarker,
+	}
+}
+
+// paginateParts pages parts ordered by part number, starting after
+// partNumberMarker
+func paginateParts(parts []Part, partNumberMarker, maxParts int) *PartListResult {
+	result := &PartListResult{}
+	// A page of no parts only reports whether any follow the marker
+	maxParts = max(maxParts, 0)
+
+	for _, part := range parts {
+		if part.PartNumber <= partNumberMarker {
+			continue
+		}
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+		result.Parts = append(result.Parts, part)
+	}
+
+	if result.IsTruncated {
+		result.NextPartNumberMarker = partNumberMarker
+		if len(result.Parts) > 0 {
+			result.NextPartNumberMarker = result.Parts[len(result.Parts)-1].PartNumber
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaginateObjects(t *testing.T) {
+	keys := []string{
+		"a.txt",
+		"photos/2023/a.jpg",
+		"photos/2023/b.jpg",
+		"photos/2024/c.jpg",
+		"photos/d.jpg",
+		"readme.md",
+		"videos/e.mp4",
+	}
+	objects := make([]ObjectMetadata, len(keys))
+	for i, key := range keys {
+		objects[i] = ObjectMetadata{Key: key}
+	}
+
+	objectKeys := func(result *ListResult) []string {
+		var out []string
+		for _, obj := range result.Objects {
+			out = append(out, obj.Key)
+		}
+		return out
+	}
+
+	t.Run("Delimiter", func(t *testing.T) {
+		result := paginateObjects(objects, "", "/", "", 1000)
+		if got, want := objectKeys(result), []string{"a.txt", "readme.md"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+		if got, want := result.CommonPrefixes, []string{"photos/", "videos/"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected prefixes %v, got %v", want, got)
+		}
+		if result.IsTruncated {
+			t.Error("Expected listing not to be truncated")
+		}
+	})
+
+	t.Run("PrefixAndDelimiter", func(t *testing.T) {
+		result := paginateObjects(objects, "photos/", "/", "", 1000)
+		if got, want := objectKeys(result), []string{"photos/d.jpg"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+		if got, want := result.CommonPrefixes, []string{"photos/2023/", "photos/2024/"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected prefixes %v, got %v", want, got)
+		}
+	})
+
+	t.Run("PageEndsOnCommonPrefix", func(t *testing.T) {
+		first := paginateObjects(objects, "", "/", "", 2)
+		if !first.IsTruncated || first.NextMarker != "photos/" {
+			t.Fatalf("Expected truncated page ending at photos/, got truncated=%v marker=%q", first.IsTruncated, first.NextMarker)
+		}
+
+		second := paginateObjects(objects, "", "/", first.NextMarker, 2)
+		if got, want := objectKeys(second), []string{"readme.md"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+		if got, want := second.CommonPrefixes, []string{"videos/"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected prefixes %v, got %v", want, got)
+		}
+		if second.IsTruncated {
+			t.Error("Expected second page not to be truncated")
+		}
+	})
+
+	t.Run("MarkerPastEnd", func(t *testing.T) {
+		result := paginateObjects(objects, "", "", "zzz", 1000)
+		if len(result.Objects) != 0 {
+			t.Errorf("Expected no objects after final key, got %v", objectKeys(result))
+		}
+	})
+
+	t.Run("ZeroMaxKeys", func(t *testing.T) {
+		result := paginateObjects(objects, "photos/", "", "photos/2023/a.jpg", 0)
+		if len(result.Objects) != 0 || !result.IsTruncated || result.NextMarker != "photos/2023/a.jpg" {
+			t.Errorf("Expected an empty truncated page resuming at the marker, got %+v", result)
+		}
+
+		if result := paginateObjects(objects, "music/", "", "", 0); result.IsTruncated {
+			t.Error("Expected an empty page without matches not to be truncated")
+		}
+	})
+}
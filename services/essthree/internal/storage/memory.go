@@ -0,0 +1,1111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStorageFull is returned when a write would take the memory backend past
+// its cap
+var ErrStorageFull = errors.New("storage is full")
+
+// MemoryStorage implements Storage in process memory. Nothing survives a
+// restart, which suits tests and throwaway environments. Bodies are kept
+// as plain bytes; encryption settings are recorded and SSE-C keys checked
+// as with the filesystem backend.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+
+	// maxBytes caps the object, version and part data held; zero means
+	// unlimited
+	maxBytes  int64
+	usedBytes int64
+
+	config Config
+
+	masterKey masterKey
+}
+
+// memoryBucket holds the state of one bucket
+type memoryBucket struct {
+	info BucketInfo
+
+	// current holds the current version of each key, which may be a delete
+	// marker, and noncurrent the older versions
+	current    map[string]*memoryObject
+	noncurrent map[string][]*memoryObject
+
+	uploads map[string]*memoryUpload
+}
+
+// memoryObject is one stored object version
+type memoryObject struct {
+	meta *ObjectMetadata
+	data []byte
+}
+
+// memoryUpload is an in-progress multipart upload and its parts
+type memoryUpload struct {
+	upload *MultipartUpload
+	parts  map[int]*memoryPart
+}
+
+// memoryPart is one uploaded part
+type memoryPart struct {
+	part Part
+	data []byte
+}
+
+// NewMemoryStorage creates an in-memory storage backend holding at most
+// maxBytes of data, or any amount when maxBytes is zero
+func NewMemoryStorage(maxBytes int64, config Config) (*MemoryStorage, error) {
+	key, err := newMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryStorage{
+		buckets:   make(map[string]*memoryBucket),
+		maxBytes:  maxBytes,
+		config:    config,
+		masterKey: key,
+	}, nil
+}
+
+// cloneJSON returns a deep copy of v, as a fresh read of its persisted form
+// would be, so callers cannot change stored state through returned values
+func cloneJSON[T any](v *T) (*T, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy %T: %w", v, err)
+	}
+	var copied T
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy %T: %w", v, err)
+	}
+	return &copied, nil
+}
+
+// newMemoryBucket returns an empty bucket
+func newMemoryBucket(name string) *memoryBucket {
+	return &memoryBucket{
+		info:       BucketInfo{Name: name, CreationDate: time.Now().UTC()},
+		current:    make(map[string]*memoryObject),
+		noncurrent: make(map[string][]*memoryObject),
+		uploads:    make(map[string]*memoryUpload),
+	}
+}
+
+// ensureBucket returns a bucket, creating it implicitly as a filesystem
+// write would
+func (m *MemoryStorage) ensureBucket(bucket string) *memoryBucket {
+	b, ok := m.buckets[bucket]
+	if !ok {
+		b = newMemoryBucket(bucket)
+		m.buckets[bucket] = b
+	}
+	return b
+}
+
+// reserve checks that size more bytes fit under the cap once credit bytes
+// are released
+func (m *MemoryStorage) reserve(size, credit int64) error {
+	if m.maxBytes > 0 && m.usedBytes-credit+size > m.maxBytes {
+		return fmt.Errorf("%w: %d of %d bytes in use", ErrStorageFull, m.usedBytes, m.maxBytes)
+	}
+	return nil
+}
+
+// readBody reads a body into memory, stopping once it cannot fit under the
+// cap
+func (m *MemoryStorage) readBody(data io.Reader) ([]byte, error) {
+	if m.maxBytes > 0 {
+		data = io.LimitReader(data, m.maxBytes+1)
+	}
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write object data: %w", err)
+	}
+	if m.maxBytes > 0 && int64(len(body)) > m.maxBytes {
+		return nil, fmt.Errorf("%w: the body is larger than the %d-byte cap", ErrStorageFull, m.maxBytes)
+	}
+	return body, nil
+}
+
+// CreateBucket creates a new, empty bucket
+func (m *MemoryStorage) CreateBucket(bucket string) error {
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.buckets[bucket]; ok {
+		return fmt.Errorf("%w: %s", ErrBucketAlreadyExists, bucket)
+	}
+	m.buckets[bucket] = newMemoryBucket(bucket)
+	return nil
+}
+
+// HeadBucket returns the bucket's metadata if it exists
+func (m *MemoryStorage) HeadBucket(bucket string) (*BucketInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+	return cloneJSON(&b.info)
+}
+
+// DeleteBucket removes an empty bucket
+func (m *MemoryStorage) DeleteBucket(bucket string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	// Noncurrent versions and delete markers also keep a bucket non-empty
+	if len(b.current) > 0 || len(b.noncurrent) > 0 {
+		return fmt.Errorf("%w: %s", ErrBucketNotEmpty, bucket)
+	}
+
+	for uploadID := range b.uploads {
+		m.removeUpload(b, uploadID)
+	}
+	delete(m.buckets, bucket)
+	return nil
+}
+
+// UpdateBucket applies update to the bucket's metadata and stores it
+func (m *MemoryStorage) UpdateBucket(bucket string, update func(*BucketInfo) error) (*BucketInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	info, err := cloneJSON(&b.info)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(info); err != nil {
+		return nil, err
+	}
+	info.Name = bucket
+	stored, err := cloneJSON(info)
+	if err != nil {
+		return nil, err
+	}
+	b.info = *stored
+
+	return info, nil
+}
+
+// ListBuckets returns bucket names with object counts
+func (m *MemoryStorage) ListBuckets() ([]BucketSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buckets := make([]BucketSummary, 0, len(m.buckets))
+	for name, b := range m.buckets {
+		objectCount := 0
+		for _, obj := range b.current {
+			if !obj.meta.DeleteMarker {
+				objectCount++
+			}
+		}
+		buckets = append(buckets, BucketSummary{
+			Name:         name,
+			ObjectCount:  objectCount,
+			CreationDate: b.info.CreationDate,
+		})
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+
+	return buckets, nil
+}
+
+// PutObject stores an object with metadata
+func (m *MemoryStorage) PutObject(bucket, key string, data io.Reader, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error) {
+	objMeta := &ObjectMetadata{
+		Key:             key,
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Encryption:      opts.Encryption,
+		Checksum:        checksumRequest(opts.Checksum),
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+
+	if err := m.writeObject(bucket, key, data, objMeta, opts.Condition, ""); err != nil {
+		return nil, err
+	}
+
+	return objMeta, nil
+}
+
+// writeObject stores data as the current version of key, like the
+// filesystem backend's writeObject. A non-empty uploadID names the
+// multipart upload the data was assembled from; it is removed, and its
+// parts released, when the object is stored.
+func (m *MemoryStorage) writeObject(bucket, key string, data io.Reader, objMeta *ObjectMetadata, cond WriteCondition, uploadID string) error {
+	digests := newObjectDigests(objMeta)
+	body, err := m.readBody(io.TeeReader(data, digests))
+	if err != nil {
+		return err
+	}
+
+	if objMeta.Encryption != nil {
+		sealed, _, err := m.masterKey.sealEncryption(objMeta.Encryption)
+		if err != nil {
+			return err
+		}
+		objMeta.Encryption = sealed
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.ensureBucket(bucket)
+	var current *ObjectMetadata
+	if obj, ok := b.current[key]; ok {
+		current = obj.meta
+	}
+	if err := checkCondition(current, bucket, key, cond); err != nil {
+		return err
+	}
+	if err := m.checkReplaceLock(b, key); err != nil {
+		return err
+	}
+
+	credit := m.replacedBytes(b, key)
+	if upload, ok := b.uploads[uploadID]; ok {
+		credit += upload.size()
+	}
+	if err := m.reserve(int64(len(body)), credit); err != nil {
+		return err
+	}
+
+	objMeta.Key = key
+	objMeta.Size = int64(len(body))
+	objMeta.LastModified = time.Now().UTC()
+	objMeta.VersionID = m.prepareNewVersion(b, key)
+	digests.apply(objMeta)
+
+	stored, err := cloneJSON(objMeta)
+	if err != nil {
+		return err
+	}
+	b.current[key] = &memoryObject{meta: stored, data: body}
+	m.usedBytes += int64(len(body))
+	if uploadID != "" {
+		m.removeUpload(b, uploadID)
+	}
+	return nil
+}
+
+// replacedBytes returns how much data a new current version of key frees
+// under the bucket's versioning state
+func (m *MemoryStorage) replacedBytes(b *memoryBucket, key string) int64 {
+	current := b.current[key]
+	switch b.info.Versioning {
+	case VersioningEnabled:
+		return 0
+	case VersioningSuspended:
+		var freed int64
+		if current != nil && versionIDOf(current.meta) == NullVersionID {
+			freed += int64(len(current.data))
+		}
+		for _, version := range b.noncurrent[key] {
+			if version.meta.VersionID == NullVersionID {
+				freed += int64(len(version.data))
+			}
+		}
+		return freed
+	default:
+		if current == nil {
+			return 0
+		}
+		return int64(len(current.data))
+	}
+}
+
+// checkReplaceLock returns ErrObjectLocked when a new current version of key
+// would remove a locked version under the bucket's versioning state
+func (m *MemoryStorage) checkReplaceLock(b *memoryBucket, key string) error {
+	current := b.current[key]
+	switch b.info.Versioning {
+	case VersioningEnabled:
+		return nil
+	case VersioningSuspended:
+		if current != nil && versionIDOf(current.meta) == NullVersionID {
+			return checkObjectLock(current.meta, false)
+		}
+		for _, version := range b.noncurrent[key] {
+			if version.meta.VersionID == NullVersionID {
+				return checkObjectLock(version.meta, false)
+			}
+		}
+		return nil
+	default:
+		if current == nil {
+			return nil
+		}
+		return checkObjectLock(current.meta, false)
+	}
+}
+
+// prepareNewVersion makes room for a new current version of key and returns
+// the version ID it should be written with, as the filesystem backend does
+func (m *MemoryStorage) prepareNewVersion(b *memoryBucket, key string) string {
+	switch b.info.Versioning {
+	case VersioningEnabled:
+		m.archiveCurrent(b, key)
+		return newVersionID()
+	case VersioningSuspended:
+		// Only a non-null current version is kept; the null version is replaced
+		if current := b.current[key]; current != nil && versionIDOf(current.meta) != NullVersionID {
+			m.archiveCurrent(b, key)
+		} else {
+			m.removeCurrent(b, key)
+		}
+		m.removeNoncurrent(b, key, NullVersionID)
+		return NullVersionID
+	default:
+		m.removeCurrent(b, key)
+		return ""
+	}
+}
+
+// archiveCurrent moves the current version of key to its noncurrent versions
+func (m *MemoryStorage) archiveCurrent(b *memoryBucket, key string) {
+	current, ok := b.current[key]
+	if !ok {
+		return
+	}
+	current.meta.VersionID = versionIDOf(current.meta)
+	b.noncurrent[key] = append(b.noncurrent[key], current)
+	delete(b.current, key)
+}
+
+// removeCurrent drops the current version of key
+func (m *MemoryStorage) removeCurrent(b *memoryBucket, key string) {
+	if current, ok := b.current[key]; ok {
+		m.usedBytes -= int64(len(current.data))
+		delete(b.current, key)
+	}
+}
+
+// removeNoncurrent drops a noncurrent version of key, returning it
+func (m *MemoryStorage) removeNoncurrent(b *memoryBucket, key, versionID string) *memoryObject {
+	versions := b.noncurrent[key]
+	for i, version := range versions {
+		if version.meta.VersionID != versionID {
+			continue
+		}
+		m.usedBytes -= int64(len(version.data))
+		versions = append(versions[:i:i], versions[i+1:]...)
+		if len(versions) == 0 {
+			delete(b.noncurrent, key)
+		} else {
+			b.noncurrent[key] = versions
+		}
+		return version
+	}
+	return nil
+}
+
+// newestNoncurrent returns the newest noncurrent version of key, or nil
+func newestNoncurrent(b *memoryBucket, key string) *memoryObject {
+	var newest *memoryObject
+	for _, version := range b.noncurrent[key] {
+		if newest == nil {
+			newest = version
+			continue
+		}
+		versions := []ObjectMetadata{*newest.meta, *version.meta}
+		sortVersionsNewestFirst(versions)
+		if versions[0].VersionID == version.meta.VersionID {
+			newest = version
+		}
+	}
+	return newest
+}
+
+// resolveVersion finds an object version. An empty versionID selects the
+// current version. It must be called with m.mu held.
+func (m *MemoryStorage) resolveVersion(bucket, key, versionID string) (*memoryObject, error) {
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	current := b.current[key]
+	if versionID == "" || (current != nil && versionIDOf(current.meta) == versionID) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+		}
+		if current.meta.DeleteMarker {
+			return nil, &DeleteMarkerError{Bucket: bucket, Key: key, VersionID: current.meta.VersionID}
+		}
+		return current, nil
+	}
+
+	for _, version := range b.noncurrent[key] {
+		if version.meta.VersionID != versionID {
+			continue
+		}
+		if version.meta.DeleteMarker {
+			return nil, &DeleteMarkerError{Bucket: bucket, Key: key, VersionID: versionID}
+		}
+		return version, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, versionID)
+}
+
+// GetObject retrieves an object and its metadata. An empty versionID
+// selects the current version.
+func (m *MemoryStorage) GetObject(bucket, key, versionID string) (io.ReadCloser, *ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, err := m.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkReadable(obj.meta); err != nil {
+		return nil, nil, err
+	}
+
+	// Stored data is never modified in place, so readers need no lock
+	meta, err := cloneJSON(obj.meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), meta, nil
+}
+
+// GetObjectRange retrieves a byte range from an object
+func (m *MemoryStorage) GetObjectRange(bucket, key, versionID string, rangeStart, rangeEnd int64) (io.ReadCloser, *ObjectMetadata, int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, err := m.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if err := checkReadable(obj.meta); err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	size := int64(len(obj.data))
+	if rangeEnd < 0 || rangeEnd >= size {
+		rangeEnd = size - 1
+	}
+	if rangeStart < 0 {
+		rangeStart = 0
+	}
+	if rangeStart > rangeEnd {
+		return nil, nil, 0, 0, fmt.Errorf("invalid range")
+	}
+
+	meta, err := cloneJSON(obj.meta)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	reader := io.NopCloser(bytes.NewReader(obj.data[rangeStart : rangeEnd+1]))
+	return reader, meta, rangeStart, rangeEnd, nil
+}
+
+// HeadObject retrieves only the metadata for an object
+func (m *MemoryStorage) HeadObject(bucket, key, versionID string) (*ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, err := m.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return cloneJSON(obj.meta)
+}
+
+// DeleteObject removes an object, or one version of it, as the filesystem
+// backend's DeleteObject does
+func (m *MemoryStorage) DeleteObject(bucket, key, versionID string, opts DeleteOptions) (*ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	if versionID != "" {
+		return m.deleteVersion(b, key, versionID, opts.BypassGovernance)
+	}
+
+	if b.info.Versioning == "" {
+		if current := b.current[key]; current != nil {
+			if err := checkObjectLock(current.meta, opts.BypassGovernance); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := m.checkReplaceLock(b, key); err != nil {
+		return nil, err
+	}
+
+	if b.info.Versioning != "" {
+		marker := &ObjectMetadata{
+			Key:          key,
+			LastModified: time.Now().UTC(),
+			DeleteMarker: true,
+		}
+		marker.VersionID = m.prepareNewVersion(b, key)
+		b.current[key] = &memoryObject{meta: marker}
+		return cloneJSON(marker)
+	}
+
+	m.removeCurrent(b, key)
+	return &ObjectMetadata{Key: key}, nil
+}
+
+// deleteVersion permanently removes one version of key. Removing the current
+// version promotes the newest noncurrent version in its place. A version
+// under Object Lock is kept unless bypassGovernance lifts its GOVERNANCE
+// retention.
+func (m *MemoryStorage) deleteVersion(b *memoryBucket, key, versionID string, bypassGovernance bool) (*ObjectMetadata, error) {
+	if current := b.current[key]; current != nil && versionIDOf(current.meta) == versionID {
+		if err := checkObjectLock(current.meta, bypassGovernance); err != nil {
+			return nil, err
+		}
+		m.removeCurrent(b, key)
+		if newest := newestNoncurrent(b, key); newest != nil {
+			m.removeNoncurrent(b, key, newest.meta.VersionID)
+			b.current[key] = newest
+			m.usedBytes += int64(len(newest.data))
+		}
+		meta, err := cloneJSON(current.meta)
+		if err != nil {
+			return nil, err
+		}
+		meta.VersionID = versionID
+		return meta, nil
+	}
+
+	for _, version := range b.noncurrent[key] {
+		if version.meta.VersionID == versionID {
+			if err := checkObjectLock(version.meta, bypassGovernance); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if removed := m.removeNoncurrent(b, key, versionID); removed != nil {
+		return cloneJSON(removed.meta)
+	}
+
+	// Deleting a version that does not exist is not an error
+	return &ObjectMetadata{Key: key, VersionID: versionID}, nil
+}
+
+// DeleteObjects removes multiple objects or object versions
+func (m *MemoryStorage) DeleteObjects(bucket string, objects []ObjectIdentifier, opts DeleteOptions) ([]DeletedObject, []DeleteFailure) {
+	return deleteObjects(m, bucket, objects, opts)
+}
+
+// CopyObject copies an object, or one version of it, to a new key, as the
+// filesystem backend's CopyObject does
+func (m *MemoryStorage) CopyObject(srcBucket, srcKey, srcVersionID, dstBucket, dstKey string, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error) {
+	reader, srcMeta, err := m.GetObject(srcBucket, srcKey, srcVersionID)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// The content is unchanged, so the copy keeps the source ETag and part
+	// boundaries
+	objMeta := &ObjectMetadata{
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Encryption:      opts.Encryption,
+		Checksum:        checksumRequest(opts.Checksum),
+		ETag:            srcMeta.ETag,
+		PartSizes:       srcMeta.PartSizes,
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+
+	if err := m.writeObject(dstBucket, dstKey, reader, objMeta, opts.Condition, ""); err != nil {
+		return nil, err
+	}
+
+	return objMeta, nil
+}
+
+// listCurrentVersions returns the current version of every key, including
+// delete markers, sorted by key
+func (m *MemoryStorage) listCurrentVersions(bucket, prefix string) ([]ObjectMetadata, error) {
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	var objects []ObjectMetadata
+	for key, obj := range b.current {
+		if strings.HasPrefix(key, prefix) {
+			meta, err := cloneJSON(obj.meta)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, *meta)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// listAllObjects returns the current objects sorted by key, skipping keys
+// whose current version is a delete marker
+func (m *MemoryStorage) listAllObjects(bucket, prefix string) ([]ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.listCurrentVersions(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := entries[:0]
+	for _, meta := range entries {
+		if !meta.DeleteMarker {
+			objects = append(objects, meta)
+		}
+	}
+
+	return objects, nil
+}
+
+// ListObjects lists objects (V1 API) with marker-based pagination
+func (m *MemoryStorage) ListObjects(bucket, prefix, delimiter, marker string, maxKeys int) (*ListResult, error) {
+	allObjects, err := m.listAllObjects(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateObjects(allObjects, prefix, delimiter, marker, maxKeys), nil
+}
+
+// ListObjectsV2 lists objects (V2 API) with continuation token pagination.
+// startAfter is only honoured on the first page, when no token is given.
+func (m *MemoryStorage) ListObjectsV2(bucket, prefix, delimiter, continuationToken, startAfter string, maxKeys int) (*ListResult, error) {
+	allObjects, err := m.listAllObjects(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := continuationToken
+	if marker == "" {
+		marker = startAfter
+	}
+
+	return paginateObjects(allObjects, prefix, delimiter, marker, maxKeys), nil
+}
+
+// ListObjectVersions lists every version of every key, including delete
+// markers, ordered by key and then newest version first
+func (m *MemoryStorage) ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) (*VersionListResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, err := m.listCurrentVersions(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	b := m.buckets[bucket]
+
+	keys := make([]string, 0, len(current)+len(b.noncurrent))
+	latest := make(map[string]ObjectMetadata, len(current))
+	for _, meta := range current {
+		meta.VersionID = versionIDOf(&meta)
+		latest[meta.Key] = meta
+		keys = append(keys, meta.Key)
+	}
+	for key := range b.noncurrent {
+		if _, ok := latest[key]; !ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var versions []ObjectVersion
+	for _, key := range keys {
+		if meta, ok := latest[key]; ok {
+			versions = append(versions, ObjectVersion{ObjectMetadata: meta, IsLatest: true})
+		}
+		older := make([]ObjectMetadata, 0, len(b.noncurrent[key]))
+		for _, version := range b.noncurrent[key] {
+			meta, err := cloneJSON(version.meta)
+			if err != nil {
+				return nil, err
+			}
+			older = append(older, *meta)
+		}
+		sortVersionsNewestFirst(older)
+		for _, meta := range older {
+			versions = append(versions, ObjectVersion{ObjectMetadata: meta})
+		}
+	}
+
+	return paginateVersions(versions, prefix, delimiter, keyMarker, versionIDMarker, maxKeys), nil
+}
+
+// PutObjectTagging replaces the tag set of an object, or of one version of
+// it. A nil tag set removes all tags.
+func (m *MemoryStorage) PutObjectTagging(bucket, key, versionID string, tags map[string]string) (*ObjectMetadata, error) {
+	return m.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.Tags = tags
+		return nil
+	})
+}
+
+// PutObjectACL replaces the canned ACL of an object, or of one version of it
+func (m *MemoryStorage) PutObjectACL(bucket, key, versionID, acl string) (*ObjectMetadata, error) {
+	return m.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.ACL = acl
+		return nil
+	})
+}
+
+// PutObjectRetention replaces the retention of an object, or of one version
+// of it. A nil retention removes it.
+func (m *MemoryStorage) PutObjectRetention(bucket, key, versionID string, retention *Retention, bypassGovernance bool) (*ObjectMetadata, error) {
+	return m.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		return applyRetention(meta, retention, bypassGovernance)
+	})
+}
+
+// PutObjectLegalHold places or lifts the legal hold of an object, or of one
+// version of it
+func (m *MemoryStorage) PutObjectLegalHold(bucket, key, versionID string, hold bool) (*ObjectMetadata, error) {
+	return m.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.LegalHold = hold
+		return nil
+	})
+}
+
+// RestoreObject restores an archived object, or one version of it, as the
+// filesystem backend's RestoreObject does
+func (m *MemoryStorage) RestoreObject(bucket, key, versionID string, days int, ready time.Time) (bool, error) {
+	var restored bool
+	_, err := m.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		var err error
+		restored, err = applyRestore(meta, days, ready)
+		return err
+	})
+	return restored, err
+}
+
+// updateObjectMetadata applies update to the metadata of an object version.
+// An error from update leaves the metadata unchanged.
+func (m *MemoryStorage) updateObjectMetadata(bucket, key, versionID string, update func(*ObjectMetadata) error) (*ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, err := m.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := cloneJSON(obj.meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(meta); err != nil {
+		return nil, err
+	}
+	stored, err := cloneJSON(meta)
+	if err != nil {
+		return nil, err
+	}
+	obj.meta = stored
+	return meta, nil
+}
+
+// size returns the data held by an upload's parts
+func (u *memoryUpload) size() int64 {
+	var size int64
+	for _, part := range u.parts {
+		size += int64(len(part.data))
+	}
+	return size
+}
+
+// removeUpload drops a multipart upload and its parts
+func (m *MemoryStorage) removeUpload(b *memoryBucket, uploadID string) {
+	if upload, ok := b.uploads[uploadID]; ok {
+		m.usedBytes -= upload.size()
+		delete(b.uploads, uploadID)
+	}
+}
+
+// findUpload returns an in-progress upload of key. It must be called with
+// m.mu held.
+func (m *MemoryStorage) findUpload(bucket, key, uploadID string) (*memoryUpload, error) {
+	if b, ok := m.buckets[bucket]; ok {
+		if upload, ok := b.uploads[uploadID]; ok && upload.upload.Key == key {
+			return upload, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+}
+
+// CreateMultipartUpload starts a multipart upload
+func (m *MemoryStorage) CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string, opts PutOptions) (*MultipartUpload, error) {
+	upload := &MultipartUpload{
+		UploadID:        fmt.Sprintf("%d-%s", time.Now().UnixNano(), generateRandomID()),
+		Bucket:          bucket,
+		Key:             key,
+		Created:         time.Now().UTC(),
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+	if opts.Checksum != nil {
+		checksumType, err := ResolveChecksumType(opts.Checksum.Algorithm, opts.Checksum.Type)
+		if err != nil {
+			return nil, err
+		}
+		upload.Checksum = &Checksum{Algorithm: opts.Checksum.Algorithm, Type: checksumType}
+	}
+	if opts.Encryption != nil {
+		sealed, _, err := m.masterKey.sealEncryption(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		upload.Encryption = sealed
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := cloneJSON(upload)
+	if err != nil {
+		return nil, err
+	}
+	b := m.ensureBucket(bucket)
+	b.uploads[upload.UploadID] = &memoryUpload{upload: stored, parts: make(map[int]*memoryPart)}
+
+	return upload, nil
+}
+
+// UploadPart uploads a part of a multipart upload
+func (m *MemoryStorage) UploadPart(bucket, key, uploadID string, partNumber int, data io.Reader) (*Part, error) {
+	m.mu.Lock()
+	upload, err := m.findUpload(bucket, key, uploadID)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	digests := newPartDigests(upload.upload)
+	body, err := m.readBody(io.TeeReader(data, digests))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write part data: %w", err)
+	}
+
+	part := &Part{
+		PartNumber:   partNumber,
+		ETag:         digests.md5Hex(),
+		Size:         int64(len(body)),
+		Checksum:     digests.checksumValue(),
+		LastModified: time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The upload may have been completed or aborted while the part was read
+	if upload, err = m.findUpload(bucket, key, uploadID); err != nil {
+		return nil, err
+	}
+	var credit int64
+	if previous, ok := upload.parts[partNumber]; ok {
+		credit = int64(len(previous.data))
+	}
+	if err := m.reserve(part.Size, credit); err != nil {
+		return nil, err
+	}
+
+	m.usedBytes += part.Size - credit
+	upload.parts[partNumber] = &memoryPart{part: *part, data: body}
+	return part, nil
+}
+
+// UploadPartCopy uploads a part of a multipart upload from a byte range of
+// an existing object. A negative rangeEnd copies the whole source object.
+func (m *MemoryStorage) UploadPartCopy(bucket, key, uploadID string, partNumber int, srcBucket, srcKey, srcVersionID string, rangeStart, rangeEnd int64) (*Part, error) {
+	var reader io.ReadCloser
+	var err error
+	if rangeStart == 0 && rangeEnd < 0 {
+		reader, _, err = m.GetObject(srcBucket, srcKey, srcVersionID)
+	} else {
+		reader, _, _, _, err = m.GetObjectRange(srcBucket, srcKey, srcVersionID, rangeStart, rangeEnd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return m.UploadPart(bucket, key, uploadID, partNumber, reader)
+}
+
+// CompleteMultipartUpload combines the listed parts into the final object
+func (m *MemoryStorage) CompleteMultipartUpload(bucket, key, uploadID string, parts []Part, cond WriteCondition) (*ObjectMetadata, error) {
+	m.mu.Lock()
+	upload, err := m.findUpload(bucket, key, uploadID)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	objMeta, err := completedObject(upload.upload, parts, m.config.MinPartSize, func(partNumber int) (*Part, error) {
+		stored, ok := upload.parts[partNumber]
+		if !ok {
+			return nil, fmt.Errorf("%w: part %d was not uploaded", ErrInvalidPart, partNumber)
+		}
+		return &stored.part, nil
+	})
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		readers = append(readers, bytes.NewReader(upload.parts[part.PartNumber].data))
+	}
+	m.mu.Unlock()
+
+	if err := m.writeObject(bucket, key, io.MultiReader(readers...), objMeta, cond, uploadID); err != nil {
+		return nil, err
+	}
+
+	return objMeta, nil
+}
+
+// AbortMultipartUpload cancels an in-progress multipart upload of key
+func (m *MemoryStorage) AbortMultipartUpload(bucket, key, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUpload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	m.removeUpload(m.buckets[bucket], uploadID)
+	return nil
+}
+
+// GetMultipartUpload returns the state of an in-progress upload of key
+func (m *MemoryStorage) GetMultipartUpload(bucket, key, uploadID string) (*MultipartUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, err := m.findUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return cloneJSON(upload.upload)
+}
+
+// ListMultipartUploads lists the in-progress multipart uploads of a bucket,
+// ordered by key and then initiation time
+func (m *MemoryStorage) ListMultipartUploads(bucket, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (*UploadListResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	var uploads []MultipartUpload
+	for _, upload := range b.uploads {
+		copied, err := cloneJSON(upload.upload)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *copied)
+	}
+
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		if !uploads[i].Created.Equal(uploads[j].Created) {
+			return uploads[i].Created.Before(uploads[j].Created)
+		}
+		// Upload IDs order uploads started at once, so markers stay stable
+		return uploads[i].UploadID < uploads[j].UploadID
+	})
+
+	return paginateUploads(uploads, prefix, delimiter, keyMarker, uploadIDMarker, maxUploads), nil
+}
+
+// ListParts lists the uploaded parts after partNumberMarker
+func (m *MemoryStorage) ListParts(bucket, key, uploadID string, partNumberMarker, maxParts int) (*PartListResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, err := m.findUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]Part, 0, len(upload.parts))
+	for _, part := range upload.parts {
+		parts = append(parts, part.part)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	return paginateParts(parts, partNumberMarker, maxParts), nil
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorageLimit(t *testing.T) {
+	storage, err := NewMemoryStorage(10, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	bucket := "limited-bucket"
+
+	if _, err := storage.PutObject(bucket, "a.txt", strings.NewReader("12345678"), nil, "text/plain", PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	t.Run("OverLimit", func(t *testing.T) {
+		_, err := storage.PutObject(bucket, "b.txt", strings.NewReader("123"), nil, "text/plain", PutOptions{})
+		if !errors.Is(err, ErrStorageFull) {
+			t.Errorf("Expected ErrStorageFull, got %v", err)
+		}
+		if _, err := storage.HeadObject(bucket, "b.txt", ""); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Expected the rejected object not to be stored, got %v", err)
+		}
+	})
+
+	t.Run("OverwriteReleasesSpace", func(t *testing.T) {
+		if _, err := storage.PutObject(bucket, "a.txt", strings.NewReader("1234567890"), nil, "text/plain", PutOptions{}); err != nil {
+			t.Errorf("Expected an overwrite within the limit to succeed, got %v", err)
+		}
+	})
+
+	t.Run("DeleteReleasesSpace", func(t *testing.T) {
+		if _, err := storage.DeleteObject(bucket, "a.txt", "", DeleteOptions{}); err != nil {
+			t.Fatalf("DeleteObject failed: %v", err)
+		}
+		if _, err := storage.PutObject(bucket, "b.txt", strings.NewReader("123"), nil, "text/plain", PutOptions{}); err != nil {
+			t.Errorf("Expected PutObject after a delete to succeed, got %v", err)
+		}
+	})
+
+	t.Run("MultipartParts", func(t *testing.T) {
+		upload, err := storage.CreateMultipartUpload(bucket, "mp.txt", "text/plain", nil, PutOptions{})
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload failed: %v", err)
+		}
+		if _, err := storage.UploadPart(bucket, "mp.txt", upload.UploadID, 1, strings.NewReader("abcdefgh")); !errors.Is(err, ErrStorageFull) {
+			t.Errorf("Expected ErrStorageFull, got %v", err)
+		}
+		part, err := storage.UploadPart(bucket, "mp.txt", upload.UploadID, 1, strings.NewReader("abcd"))
+		if err != nil {
+			t.Fatalf("UploadPart failed: %v", err)
+		}
+
+		// Completing frees the parts as the object is stored
+		if _, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, []Part{{PartNumber: 1, ETag: part.ETag}}, WriteCondition{}); err != nil {
+			t.Fatalf("CompleteMultipartUpload failed: %v", err)
+		}
+		reader, _, err := storage.GetObject(bucket, "mp.txt", "")
+		if err != nil {
+			t.Fatalf("GetObject failed: %v", err)
+		}
+		defer reader.Close()
+		if data, _ := io.ReadAll(reader); string(data) != "abcd" {
+			t.Errorf("Expected abcd, got %q", data)
+		}
+	})
+}
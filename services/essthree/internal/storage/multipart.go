@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+)
+
+// completedObject checks the parts listed to complete an upload against the
+// uploaded ones and returns the metadata of the object they form. lookup
+// returns an uploaded part, or ErrInvalidPart when it was never uploaded.
+// Parts must be listed in ascending order, any ETag or checksum listed must
+// match the uploaded part, and every part but the last must be at least
+// minPartSize.
+func completedObject(upload *MultipartUpload, parts []Part, minPartSize int64, lookup func(partNumber int) (*Part, error)) (*ObjectMetadata, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no parts listed", ErrInvalidPart)
+	}
+
+	// The ETag is the MD5 of the concatenated part MD5s, suffixed with the
+	// part count, as S3 reports it
+	etags := md5.New()
+	partChecksums := make([]string, 0, len(parts))
+	partSizes := make([]int64, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return nil, fmt.Errorf("%w: part %d follows part %d", ErrInvalidPartOrder, part.PartNumber, parts[i-1].PartNumber)
+		}
+
+		stored, err := lookup(part.PartNumber)
+		if err != nil {
+			return nil, err
+		}
+		if part.ETag == "" {
+			return nil, fmt.Errorf("%w: part %d has no ETag", ErrInvalidPart, part.PartNumber)
+		}
+		if part.ETag != stored.ETag {
+			return nil, fmt.Errorf("%w: ETag of part %d does not match", ErrInvalidPart, part.PartNumber)
+		}
+		if part.Checksum != "" && part.Checksum != stored.Checksum {
+			return nil, fmt.Errorf("%w: checksum of part %d does not match", ErrInvalidPart, part.PartNumber)
+		}
+		if i < len(parts)-1 && stored.Size < minPartSize {
+			return nil, fmt.Errorf("%w: part %d is %d bytes, below the minimum of %d", ErrEntityTooSmall, part.PartNumber, stored.Size, minPartSize)
+		}
+
+		raw, err := hex.DecodeString(stored.ETag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ETag of part %d: %w", part.PartNumber, err)
+		}
+		etags.Write(raw)
+		partChecksums = append(partChecksums, stored.Checksum)
+		partSizes = append(partSizes, stored.Size)
+	}
+
+	objMeta := &ObjectMetadata{
+		ContentType:     upload.ContentType,
+		Metadata:        upload.Metadata,
+		Tags:            upload.Tags,
+		ACL:             upload.ACL,
+		Encryption:      unsealed(upload.Encryption),
+		ETag:            fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(etags.Sum(nil)), len(parts)),
+		PartSizes:       partSizes,
+		Retention:       upload.Retention,
+		LegalHold:       upload.LegalHold,
+		WebsiteRedirect: upload.WebsiteRedirect,
+		StorageClass:    upload.StorageClass,
+	}
+
+	// A full-object checksum is computed as the parts are combined; a
+	// composite one is derived from the part checksums
+	if upload.Checksum != nil {
+		objMeta.Checksum = &Checksum{Algorithm: upload.Checksum.Algorithm, Type: upload.Checksum.Type}
+		if upload.Checksum.Type == ChecksumTypeComposite {
+			value, err := compositeChecksum(upload.Checksum.Algorithm, partChecksums)
+			if err != nil {
+				return nil, err
+			}
+			objMeta.Checksum.Value = value
+		}
+	}
+
+	return objMeta, nil
+}
+
+// PartRange returns the byte range of part partNumber of an object. An
+// object not uploaded in parts is a single part.
+func PartRange(meta *ObjectMetadata, partNumber int) (start, end int64, err error) {
+	sizes := meta.PartSizes
+	if len(sizes) == 0 {
+		sizes = []int64{meta.Size}
+	}
+	if partNumber < 1 || partNumber > len(sizes) {
+		return 0, 0, fmt.Errorf("%w: %d of %d", ErrInvalidPartNumber, partNumber, len(sizes))
+	}
+
+	for _, size := range sizes[:partNumber-1] {
+		start += size
+	}
+	return start, start + sizes[partNumber-1] - 1, nil
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import "strings"
+
+// Notification destination types
+const (
+	NotificationQueue = "queue"
+	NotificationTopic = "topic"
+)
+
+// NotificationTarget is one queue or topic configuration of a bucket's event
+// notifications
+type NotificationTarget struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	ARN  string `json:"arn"`
+
+	// Events lists event types such as s3:ObjectCreated:Put, or wildcards
+	// such as s3:ObjectRemoved:*
+	Events []string `json:"events"`
+
+	// Filter on the object key
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+// Matches reports whether an event, named like s3:ObjectCreated:Put, for key
+// should be sent to the target
+func (t *NotificationTarget) Matches(event, key string) bool {
+	if !strings.HasPrefix(key, t.Prefix) || !strings.HasSuffix(key, t.Suffix) {
+		return false
+	}
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(e, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
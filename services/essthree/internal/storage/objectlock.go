@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Object Lock retention modes
+const (
+	RetentionGovernance = "GOVERNANCE"
+	RetentionCompliance = "COMPLIANCE"
+)
+
+// ErrObjectLocked is returned when a version under retention or legal hold
+// would be removed, or its retention shortened
+var ErrObjectLocked = errors.New("object is locked")
+
+// ObjectLockConfig is a bucket's Object Lock configuration. Once enabled,
+// Object Lock cannot be turned off.
+type ObjectLockConfig struct {
+	// DefaultRetention applies to new objects written without a retention;
+	// nil when the bucket has no default
+	DefaultRetention *DefaultRetention `json:"default_retention,omitempty"`
+}
+
+// DefaultRetention is the retention period given to new objects. Exactly
+// one of Days and Years is set.
+type DefaultRetention struct {
+	Mode  string `json:"mode"`
+	Days  int    `json:"days,omitempty"`
+	Years int    `json:"years,omitempty"`
+}
+
+// RetainUntil returns the end of the default retention for an object
+// written at now
+func (d *DefaultRetention) RetainUntil(now time.Time) time.Time {
+	return now.AddDate(d.Years, 0, d.Days)
+}
+
+// Retention protects an object version from removal until RetainUntil
+type Retention struct {
+	Mode        string    `json:"mode"`
+	RetainUntil time.Time `json:"retain_until"`
+}
+
+// active reports whether the retention still protects its version at now
+func (r *Retention) active(now time.Time) bool {
+	return r != nil && now.Before(r.RetainUntil)
+}
+
+// checkObjectLock returns ErrObjectLocked when a version may not be removed:
+// it is under legal hold, or retained in COMPLIANCE mode, or in GOVERNANCE
+// mode without bypassGovernance. Delete markers are never locked.
+func checkObjectLock(meta *ObjectMetadata, bypassGovernance bool) error {
+	if meta == nil || meta.DeleteMarker {
+		return nil
+	}
+	if meta.LegalHold {
+		return fmt.Errorf("%w: %s is under legal hold", ErrObjectLocked, meta.Key)
+	}
+	if meta.Retention.active(time.Now()) && (meta.Retention.Mode == RetentionCompliance || !bypassGovernance) {
+		return fmt.Errorf("%w: %s is retained until %s", ErrObjectLocked, meta.Key, meta.Retention.RetainUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// applyRetention replaces the retention of a version. An active retention
+// can always be extended in the same mode; a COMPLIANCE one cannot be
+// shortened, removed or changed, and a GOVERNANCE one only with
+// bypassGovernance.
+func applyRetention(meta *ObjectMetadata, retention *Retention, bypassGovernance bool) error {
+	current := meta.Retention
+	if current.active(time.Now()) {
+		extends := retention != nil && retention.Mode == current.Mode && !retention.RetainUntil.Before(current.RetainUntil)
+		if !extends && (current.Mode == RetentionCompliance || !bypassGovernance) {
+			return fmt.Errorf("%w: the %s retention of %s cannot be shortened", ErrObjectLocked, current.Mode, meta.Key)
+		}
+	}
+
+	meta.Retention = retention
+	return nil
+}
+
+// PutObjectRetention replaces the retention of an object, or of one version
+// of it. A nil retention removes it.
+func (fs *FileSystemStorage) PutObjectRetention(bucket, key, versionID string, retention *Retention, bypassGovernance bool) (*ObjectMetadata, error) {
+	return fs.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		return applyRetention(meta, retention, bypassGovernance)
+	})
+}
+
+// PutObjectLegalHold places or lifts the legal hold of an object, or of one
+// version of it
+func (fs *FileSystemStorage) PutObjectLegalHold(bucket, key, versionID string, hold bool) (*ObjectMetadata, error) {
+	return fs.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.LegalHold = hold
+		return nil
+	})
+}
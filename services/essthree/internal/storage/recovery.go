@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// spoolPrefixes start the names of the temp files bodies are spooled to in
+// the base directory before they are committed
+var spoolPrefixes = []string{".upload-", ".copy-", tempPrefix}
+
+// recoverFiles cleans up after writes a crash interrupted. A write stores
+// its data under a new data ID and commits by renaming the metadata naming
+// it, and archiving or promoting a version writes metadata before moving
+// data, so recovery removes orphaned temp files, data no metadata names and
+// metadata of an object whose data is gone. Key indexes that no longer match the metadata are rebuilt. It
+// runs before the storage serves any request.
+func (fs *FileSystemStorage) recoverFiles() error {
+	entries, err := os.ReadDir(fs.baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read storage base directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			if err := fs.recoverBucket(name); err != nil {
+				return fmt.Errorf("failed to recover bucket %s: %w", name, err)
+			}
+			continue
+		}
+		if hasAnyPrefix(name, spoolPrefixes) {
+			if err := os.Remove(filepath.Join(fs.baseDir, name)); err != nil {
+				return fmt.Errorf("failed to remove temp file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// recoverBucket recovers the files of one bucket and loads its key index
+func (fs *FileSystemStorage) recoverBucket(bucket string) error {
+	bucketPath := fs.bucketPath(bucket)
+	if err := removeTempFiles(bucketPath, tempPrefix, ".index-"); err != nil {
+		return err
+	}
+	if err := fs.recoverUploads(bucket); err != nil {
+		return err
+	}
+
+	// Current versions: metadata must have data unless it is a delete
+	// marker, and data no metadata names is an uncommitted write or the
+	// leftover of a replaced version
+	modified := make(map[string]time.Time)
+	referenced := make(map[string]bool)
+	metadataDir := fs.bucketMetadataDir(bucket)
+	err := walkFiles(metadataDir, func(path string, info os.FileInfo) error {
+		rel, _ := filepath.Rel(metadataDir, path)
+		key, ok := strings.CutSuffix(filepath.ToSlash(rel), ".json")
+		if !ok {
+			return removeIfTemp(path)
+		}
+		meta, err := readMetadata(path)
+		if err != nil {
+			meta = &ObjectMetadata{}
+		}
+		if meta.DeleteMarker {
+			modified[key] = info.ModTime()
+			return nil
+		}
+		dataPath := fs.dataPath(bucket, key, meta)
+		if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+			return os.Remove(path)
+		}
+		modified[key] = info.ModTime()
+		referenced[dataPath] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = walkFiles(filepath.Join(bucketPath, "objects"), func(path string, info os.FileInfo) error {
+		if referenced[path] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := fs.recoverVersions(bucket); err != nil {
+		return err
+	}
+
+	return fs.recoverIndex(bucket, modified)
+}
+
+// recoverVersions removes noncurrent version data without metadata, and
+// metadata without data unless it describes a delete marker
+func (fs *FileSystemStorage) recoverVersions(bucket string) error {
+	return walkFiles(filepath.Join(fs.bucketPath(bucket), "versions"), func(path string, info os.FileInfo) error {
+		if base, ok := strings.CutSuffix(path, ".data"); ok {
+			if _, err := os.Stat(base + ".json"); os.IsNotExist(err) {
+				return os.Remove(path)
+			}
+			return nil
+		}
+		base, ok := strings.CutSuffix(path, ".json")
+		if !ok {
+			return removeIfTemp(path)
+		}
+		if _, err := os.Stat(base + ".data"); !os.IsNotExist(err) {
+			return nil
+		}
+		if meta, err := readMetadata(path); err == nil && meta.DeleteMarker {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
+
+// recoverUploads removes temp files from multipart uploads, and uploads
+// whose creation never completed
+func (fs *FileSystemStorage) recoverUploads(bucket string) error {
+	multipartDir := filepath.Join(fs.bucketPath(bucket), "multipart")
+	entries, err := os.ReadDir(multipartDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read multipart uploads: %w", err)
+	}
+
+	for _, entry := range entries {
+		mpPath := filepath.Join(multipartDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(mpPath, "upload.json")); os.IsNotExist(err) {
+			if err := os.RemoveAll(mpPath); err != nil {
+				return fmt.Errorf("failed to remove incomplete upload: %w", err)
+			}
+			continue
+		}
+		if err := removeTempFiles(mpPath, tempPrefix, ".part-"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recoverIndex loads the key index of a bucket, rebuilding it when it is
+// unreadable, its keys differ from the current metadata, or any metadata was
+// written after the index, as happens when a write is interrupted between
+// the two
+func (fs *FileSystemStorage) recoverIndex(bucket string, modified map[string]time.Time) error {
+	path := fs.indexPath(bucket)
+	idx, ok, err := loadIndex(path)
+	if err != nil {
+		return err
+	}
+
+	stale := !ok
+	if !stale {
+		if stale, err = indexStale(idx, path, modified); err != nil {
+			idx.close()
+			return err
+		}
+		if stale {
+			idx.close()
+		}
+	}
+
+	if stale {
+		if idx, err = buildIndex(path, fs.bucketMetadataDir(bucket)); err != nil {
+			return err
+		}
+	}
+
+	fs.indexMu.Lock()
+	fs.indexes[bucket] = idx
+	fs.indexMu.Unlock()
+	return nil
+}
+
+// indexStale reports whether the index at path misses or outdates any of
+// the keys in modified
+func indexStale(idx *keyIndex, path string, modified map[string]time.Time) (bool, error) {
+	matched, err := idx.matches(modified)
+	if err != nil || !matched {
+		return true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read key index: %w", err)
+	}
+	for _, modTime := range modified {
+		if modTime.After(info.ModTime()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// walkFiles calls fn for every regular file under dir. A missing dir has no
+// files.
+func walkFiles(dir string, fn func(path string, info os.FileInfo) error) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(path, info)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeTempFiles removes the files directly in dir whose names start with
+// any of prefixes
+func removeTempFiles(dir string, prefixes ...string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && hasAnyPrefix(entry.Name(), prefixes) {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove temp file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeIfTemp removes path if it is a temp file left by writeFileAtomic
+func removeIfTemp(path string) error {
+	if strings.HasPrefix(filepath.Base(path), tempPrefix) {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// hasAnyPrefix reports whether name starts with any of prefixes
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	tempDir := t.TempDir()
+
+	storage, err := NewFileSystemStorage(tempDir, Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	bucket := "recovered-bucket"
+	if _, err := storage.PutObject(bucket, "kept.txt", strings.NewReader("kept"), nil, "text/plain", PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	lost, err := storage.PutObject(bucket, "lost.txt", strings.NewReader("lost"), nil, "text/plain", PutOptions{})
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	// Simulate writes interrupted at each step
+	bucketPath := filepath.Join(tempDir, bucket)
+	orphans := []string{
+		filepath.Join(tempDir, ".upload-123"),
+		filepath.Join(bucketPath, "metadata", tempPrefix+"456"),
+		filepath.Join(bucketPath, "objects", "orphan.txt"),
+		// A write of kept.txt that stored its data but never committed
+		filepath.Join(bucketPath, "objects", "kept.txt."+newVersionID()),
+		// Data of a version kept.txt replaced, left behind after the commit
+		filepath.Join(bucketPath, "objects", "kept.txt"),
+		filepath.Join(bucketPath, "versions", "kept.txt", "v1.data"),
+	}
+	for _, path := range orphans {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.Remove(storage.dataPath(bucket, "lost.txt", lost)); err != nil {
+		t.Fatalf("Failed to remove data file: %v", err)
+	}
+
+	storage.Close()
+	recovered, err := NewFileSystemStorage(tempDir, Config{})
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer recovered.Close()
+
+	t.Run("OrphansRemoved", func(t *testing.T) {
+		for _, path := range orphans {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed, got %v", path, err)
+			}
+		}
+	})
+
+	t.Run("MetadataWithoutData", func(t *testing.T) {
+		if _, err := recovered.HeadObject(bucket, "lost.txt", ""); err == nil {
+			t.Error("Expected lost.txt to be gone")
+		}
+
+		result, err := recovered.ListObjectsV2(bucket, "", "", "", "", 1000)
+		if err != nil {
+			t.Fatalf("ListObjectsV2 failed: %v", err)
+		}
+		if len(result.Objects) != 1 || result.Objects[0].Key != "kept.txt" {
+			t.Errorf("Expected only kept.txt in the rebuilt index, got %+v", result.Objects)
+		}
+	})
+
+	t.Run("IntactObject", func(t *testing.T) {
+		reader, _, err := recovered.GetObject(bucket, "kept.txt", "")
+		if err != nil {
+			t.Fatalf("GetObject failed: %v", err)
+		}
+		defer reader.Close()
+		if data, _ := io.ReadAll(reader); string(data) != "kept" {
+			t.Errorf("Expected kept, got %q", data)
+		}
+	})
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	storage, err := NewFileSystemStorage(t.TempDir(), Config{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	bucket := "busy-bucket"
+	key := "hot.txt"
+	if _, err := storage.PutObject(bucket, key, strings.NewReader("initial"), nil, "text/plain", PutOptions{}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				body := strings.Repeat(fmt.Sprintf("writer %d write %d;", i, j), 100)
+				if _, err := storage.PutObject(bucket, key, strings.NewReader(body), nil, "text/plain", PutOptions{}); err != nil {
+					t.Errorf("PutObject failed: %v", err)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				reader, meta, err := storage.GetObject(bucket, key, "")
+				if err != nil {
+					t.Errorf("GetObject failed: %v", err)
+					return
+				}
+				data, err := io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Errorf("Failed to read object: %v", err)
+					return
+				}
+				sum := md5.Sum(data)
+				if etag := "\"" + hex.EncodeToString(sum[:]) + "\""; etag != meta.ETag {
+					t.Errorf("Expected the body to match ETag %s, got %s", meta.ETag, etag)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Storage classes. Objects without one are STANDARD.
+const (
+	StorageClassStandard    = "STANDARD"
+	StorageClassGlacier     = "GLACIER"
+	StorageClassDeepArchive = "DEEP_ARCHIVE"
+)
+
+// StorageClasses are the storage classes an object may be written with
+var StorageClasses = map[string]bool{
+	StorageClassStandard:    true,
+	"REDUCED_REDUNDANCY":    true,
+	"STANDARD_IA":           true,
+	"ONEZONE_IA":            true,
+	"INTELLIGENT_TIERING":   true,
+	"GLACIER_IR":            true,
+	"EXPRESS_ONEZONE":       true,
+	StorageClassGlacier:     true,
+	StorageClassDeepArchive: true,
+}
+
+// restoreDay is the length of one day of a restored copy's lifetime
+const restoreDay = 24 * time.Hour
+
+// ErrInvalidObjectState is returned when an archived object is read without
+// a restored copy, or a restore is requested for an object that is not
+// archived
+var ErrInvalidObjectState = errors.New("invalid object state")
+
+// ErrRestoreInProgress is returned when a restore is requested for an
+// object that is already being restored
+var ErrRestoreInProgress = errors.New("restore already in progress")
+
+// Restore is the state of a restore of an archived object: the restored copy
+// is readable from Ready until Expiry
+type Restore struct {
+	Ready  time.Time `json:"ready"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// Ongoing reports whether the restore is still in progress at now
+func (r *Restore) Ongoing(now time.Time) bool {
+	return r != nil && now.Before(r.Ready)
+}
+
+// Available reports whether the restored copy is readable at now
+func (r *Restore) Available(now time.Time) bool {
+	return r != nil && !now.Before(r.Ready) && now.Before(r.Expiry)
+}
+
+// Archived reports whether the object is in a storage class that must be
+// restored before it can be read
+func (m *ObjectMetadata) Archived() bool {
+	return m.StorageClass == StorageClassGlacier || m.StorageClass == StorageClassDeepArchive
+}
+
+// checkReadable fails for archived objects without a restored copy
+func checkReadable(meta *ObjectMetadata) error {
+	if meta.Archived() && !meta.Restore.Available(time.Now()) {
+		return fmt.Errorf("%w: %s is in %s and not restored", ErrInvalidObjectState, meta.Key, meta.StorageClass)
+	}
+	return nil
+}
+
+// applyRestore starts a restore of an archived object that completes at
+// ready and keeps the restored copy for days after. A copy that is already
+// restored has its expiry moved to days from now instead, which is reported
+// by returning true.
+func applyRestore(meta *ObjectMetadata, days int, ready time.Time) (bool, error) {
+	if !meta.Archived() {
+		return false, fmt.Errorf("%w: %s is in %s, which cannot be restored", ErrInvalidObjectState, meta.Key, meta.storageClass())
+	}
+
+	now := time.Now()
+	switch {
+	case meta.Restore.Ongoing(now):
+		return false, fmt.Errorf("%w: %s", ErrRestoreInProgress, meta.Key)
+	case meta.Restore.Available(now):
+		meta.Restore = &Restore{Ready: meta.Restore.Ready, Expiry: now.Add(time.Duration(days) * restoreDay)}
+		return true, nil
+	default:
+		meta.Restore = &Restore{Ready: ready, Expiry: ready.Add(time.Duration(days) * restoreDay)}
+		return false, nil
+	}
+}
+
+// storageClass returns the object's storage class, STANDARD when unset
+func (m *ObjectMetadata) storageClass() string {
+	if m.StorageClass == "" {
+		return StorageClassStandard
+	}
+	return m.StorageClass
+}
+
+// RestoreObject restores an archived object, or one version of it, for
+// days, with the restored copy readable from ready. It returns true when
+// the object was already restored and only its expiry was extended.
+func (fs *FileSystemStorage) RestoreObject(bucket, key, versionID string, days int, ready time.Time) (bool, error) {
+	var restored bool
+	_, err := fs.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		var err error
+		restored, err = applyRestore(meta, days, ready)
+		return err
+	})
+	return restored, err
+}
@@ -3,18 +3,41 @@
 package storage
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ErrObjectNotFound is returned when the requested object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrUploadNotFound is returned when a multipart upload does not exist,
+// or was completed or aborted
+var ErrUploadNotFound = errors.New("upload not found")
+
+// ErrInvalidPart is returned when a part listed to complete a multipart
+// upload was not uploaded or does not match the stored part
+var ErrInvalidPart = errors.New("invalid part")
+
+// ErrInvalidPartOrder is returned when the parts listed to complete a
+// multipart upload are not in ascending order
+var ErrInvalidPartOrder = errors.New("invalid part order")
+
+// ErrEntityTooSmall is returned when a part listed to complete a multipart
+// upload, other than the last, is smaller than the minimum part size
+var ErrEntityTooSmall = errors.New("entity too small")
+
+// ErrInvalidPartNumber is returned when a part requested from an object is
+// beyond its part count
+var ErrInvalidPartNumber = errors.New("invalid part number")
+
 // ObjectMetadata holds metadata about stored objects
 type ObjectMetadata struct {
 	Key          string            `json:"key"`
@@ -23,28 +46,140 @@ type ObjectMetadata struct {
 	ETag         string            `json:"etag"`
 	ContentType  string            `json:"content_type"`
 	Metadata     map[string]string `json:"metadata"`
+	VersionID    string            `json:"version_id,omitempty"`
+	DeleteMarker bool              `json:"delete_marker,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	ACL          string            `json:"acl,omitempty"`
+	Encryption   *Encryption       `json:"encryption,omitempty"`
+	Checksum     *Checksum         `json:"checksum,omitempty"`
+
+	// PartSizes are the sizes of the parts a multipart upload combined, in
+	// order; nil for objects written in one piece
+	PartSizes []int64 `json:"part_sizes,omitempty"`
+
+	// Object Lock: the version's retention, if any, and legal hold
+	Retention *Retention `json:"retention,omitempty"`
+	LegalHold bool       `json:"legal_hold,omitempty"`
+
+	// WebsiteRedirect is where the website endpoint redirects requests for
+	// the object, from x-amz-website-redirect-location
+	WebsiteRedirect string `json:"website_redirect,omitempty"`
+
+	// StorageClass is empty for STANDARD. Archived objects are readable
+	// only while Restore has a restored copy available.
+	StorageClass string   `json:"storage_class,omitempty"`
+	Restore      *Restore `json:"restore,omitempty"`
+
+	// DataID names the current version's data file in the filesystem
+	// backend. Each write picks a new one, so the data lands beside the
+	// version it replaces until the metadata rename commits it.
+	DataID string `json:"data_id,omitempty"`
+}
+
+// PutOptions carries the optional attributes of a new object
+type PutOptions struct {
+	// Tags is the object's tag set
+	Tags map[string]string
+
+	// ACL is the canned ACL from x-amz-acl; empty means private
+	ACL string
+
+	// Encryption requests encryption at rest; nil stores the body as is
+	Encryption *Encryption
+
+	// Checksum names the algorithm of an additional checksum to compute,
+	// and for multipart uploads its type; nil computes none
+	Checksum *Checksum
+
+	// Condition guards PutObject. Multipart uploads take their condition
+	// when they complete instead.
+	Condition WriteCondition
+
+	// Retention and LegalHold lock the new object under Object Lock
+	Retention *Retention
+	LegalHold bool
+
+	// WebsiteRedirect is the new object's x-amz-website-redirect-location
+	WebsiteRedirect string
+
+	// StorageClass is the new object's x-amz-storage-class; empty means
+	// STANDARD
+	StorageClass string
+}
+
+// DeleteOptions carries the optional settings of a delete
+type DeleteOptions struct {
+	// BypassGovernance allows removing a version under GOVERNANCE retention
+	BypassGovernance bool
+}
+
+// ObjectIdentifier names an object, or one version of it, in a batch request
+type ObjectIdentifier struct {
+	Key       string
+	VersionID string
+}
+
+// DeletedObject reports an object or version removed in a batch
+type DeletedObject struct {
+	ObjectIdentifier
+	DeleteMarker          bool
+	DeleteMarkerVersionID string
+}
+
+// DeleteFailure reports an object that could not be deleted in a batch
+type DeleteFailure struct {
+	ObjectIdentifier
+	Err error
 }
 
 // MultipartUpload represents an ongoing multipart upload
 type MultipartUpload struct {
-	UploadID    string            `json:"upload_id"`
-	Bucket      string            `json:"bucket"`
-	Key         string            `json:"key"`
-	Created     time.Time         `json:"created"`
-	ContentType string            `json:"content_type"`
-	Metadata    map[string]string `json:"metadata"`
+	UploadID        string            `json:"upload_id"`
+	Bucket          string            `json:"bucket"`
+	Key             string            `json:"key"`
+	Created         time.Time         `json:"created"`
+	ContentType     string            `json:"content_type"`
+	Metadata        map[string]string `json:"metadata"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	ACL             string            `json:"acl,omitempty"`
+	Encryption      *Encryption       `json:"encryption,omitempty"`
+	Checksum        *Checksum         `json:"checksum,omitempty"`
+	Retention       *Retention        `json:"retention,omitempty"`
+	LegalHold       bool              `json:"legal_hold,omitempty"`
+	WebsiteRedirect string            `json:"website_redirect,omitempty"`
+	StorageClass    string            `json:"storage_class,omitempty"`
 }
 
-// Part represents a single part in a multipart upload
+// Part represents a single part in a multipart upload. Checksum is the
+// part's base64 checksum in the upload's algorithm, if it has one.
 type Part struct {
-	PartNumber int    `json:"part_number"`
-	ETag       string `json:"etag"`
-	Size       int64  `json:"size"`
+	PartNumber   int       `json:"part_number"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// UploadListResult holds paginated multipart upload listing results
+type UploadListResult struct {
+	Uploads            []MultipartUpload
+	CommonPrefixes     []string
+	IsTruncated        bool
+	NextKeyMarker      string
+	NextUploadIDMarker string
+}
+
+// PartListResult holds paginated part listing results
+type PartListResult struct {
+	Parts                []Part
+	IsTruncated          bool
+	NextPartNumberMarker int
 }
 
 // ListResult holds paginated list results
 type ListResult struct {
 	Objects               []ObjectMetadata
+	CommonPrefixes        []string
 	IsTruncated           bool
 	NextMarker            string
 	NextContinuationToken string
@@ -52,28 +187,53 @@ type ListResult struct {
 
 // BucketSummary holds high-level bucket info for admin views
 type BucketSummary struct {
-	Name        string `json:"name"`
-	ObjectCount int    `json:"object_count"`
+	Name         string    `json:"name"`
+	ObjectCount  int       `json:"object_count"`
+	CreationDate time.Time `json:"creation_date"`
 }
 
 // Storage interface defines operations for object storage
 type Storage interface {
-	PutObject(bucket, key string, data io.Reader, metadata map[string]string, contentType string) (*ObjectMetadata, error)
-	GetObject(bucket, key string) (io.ReadCloser, *ObjectMetadata, error)
-	GetObjectRange(bucket, key string, rangeStart, rangeEnd int64) (io.ReadCloser, *ObjectMetadata, int64, int64, error)
-	HeadObject(bucket, key string) (*ObjectMetadata, error)
-	DeleteObject(bucket, key string) error
-	DeleteObjects(bucket string, keys []string) ([]string, []error)
-	ListObjects(bucket, prefix, marker string, maxKeys int) (*ListResult, error)
-	ListObjectsV2(bucket, prefix, continuationToken string, maxKeys int) (*ListResult, error)
+	PutObject(bucket, key string, data io.Reader, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error)
+	GetObject(bucket, key, versionID string) (io.ReadCloser, *ObjectMetadata, error)
+	GetObjectRange(bucket, key, versionID string, rangeStart, rangeEnd int64) (io.ReadCloser, *ObjectMetadata, int64, int64, error)
+	HeadObject(bucket, key, versionID string) (*ObjectMetadata, error)
+	DeleteObject(bucket, key, versionID string, opts DeleteOptions) (*ObjectMetadata, error)
+	DeleteObjects(bucket string, objects []ObjectIdentifier, opts DeleteOptions) ([]DeletedObject, []DeleteFailure)
+	CopyObject(srcBucket, srcKey, srcVersionID, dstBucket, dstKey string, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error)
+	ListObjects(bucket, prefix, delimiter, marker string, maxKeys int) (*ListResult, error)
+	ListObjectsV2(bucket, prefix, delimiter, continuationToken, startAfter string, maxKeys int) (*ListResult, error)
+	ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) (*VersionListResult, error)
+
+	// Object tagging; tags are read through HeadObject
+	PutObjectTagging(bucket, key, versionID string, tags map[string]string) (*ObjectMetadata, error)
+
+	// Object ACLs; the ACL is read through HeadObject
+	PutObjectACL(bucket, key, versionID, acl string) (*ObjectMetadata, error)
+
+	// Object Lock; retention and legal hold are read through HeadObject
+	PutObjectRetention(bucket, key, versionID string, retention *Retention, bypassGovernance bool) (*ObjectMetadata, error)
+	PutObjectLegalHold(bucket, key, versionID string, hold bool) (*ObjectMetadata, error)
+
+	// Archive restores; the restore status is read through HeadObject
+	RestoreObject(bucket, key, versionID string, days int, ready time.Time) (bool, error)
+
+	// Bucket operations
+	CreateBucket(bucket string) error
+	DeleteBucket(bucket string) error
+	HeadBucket(bucket string) (*BucketInfo, error)
+	UpdateBucket(bucket string, update func(*BucketInfo) error) (*BucketInfo, error)
 	ListBuckets() ([]BucketSummary, error)
 
 	// Multipart upload operations
-	CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string) (*MultipartUpload, error)
+	CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string, opts PutOptions) (*MultipartUpload, error)
 	UploadPart(bucket, key, uploadID string, partNumber int, data io.Reader) (*Part, error)
-	CompleteMultipartUpload(bucket, key, uploadID string, parts []Part) (*ObjectMetadata, error)
+	UploadPartCopy(bucket, key, uploadID string, partNumber int, srcBucket, srcKey, srcVersionID string, rangeStart, rangeEnd int64) (*Part, error)
+	CompleteMultipartUpload(bucket, key, uploadID string, parts []Part, cond WriteCondition) (*ObjectMetadata, error)
 	AbortMultipartUpload(bucket, key, uploadID string) error
-	ListParts(bucket, key, uploadID string) ([]Part, error)
+	GetMultipartUpload(bucket, key, uploadID string) (*MultipartUpload, error)
+	ListParts(bucket, key, uploadID string, partNumberMarker, maxParts int) (*PartListResult, error)
+	ListMultipartUploads(bucket, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (*UploadListResult, error)
 }
 
 // ListBuckets returns bucket names with object counts
@@ -90,30 +250,24 @@ func (fs *FileSystemStorage) ListBuckets() ([]BucketSummary, error) {
 		}
 
 		bucketName := entry.Name()
-		metadataDir := filepath.Join(fs.baseDir, bucketName, "metadata")
-		objectCount := 0
-
-		if stat, statErr := os.Stat(metadataDir); statErr == nil && stat.IsDir() {
-			walkErr := filepath.WalkDir(metadataDir, func(path string, d os.DirEntry, walkErr error) error {
-				if walkErr != nil {
-					return walkErr
-				}
-				if d.IsDir() {
-					return nil
-				}
-				if strings.HasSuffix(d.Name(), ".json") {
-					objectCount++
-				}
-				return nil
-			})
-			if walkErr != nil {
-				return nil, fmt.Errorf("failed to inspect bucket metadata for %s: %w", bucketName, walkErr)
-			}
+		idx, err := fs.bucketIndex(bucketName)
+		if err != nil {
+			return nil, err
+		}
+		objectCount, err := idx.objectCount()
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := fs.HeadBucket(bucketName)
+		if err != nil {
+			return nil, err
 		}
 
 		buckets = append(buckets, BucketSummary{
-			Name:        bucketName,
-			ObjectCount: objectCount,
+			Name:         bucketName,
+			ObjectCount:  objectCount,
+			CreationDate: info.CreationDate,
 		})
 	}
 
@@ -124,21 +278,61 @@ func (fs *FileSystemStorage) ListBuckets() ([]BucketSummary, error) {
 	return buckets, nil
 }
 
+// Config holds the settings shared by the storage backends
+type Config struct {
+	// MinPartSize is the smallest size a multipart upload part may have,
+	// except the last; zero accepts parts of any size
+	MinPartSize int64
+}
+
 // FileSystemStorage implements Storage using the local filesystem
 type FileSystemStorage struct {
 	baseDir string
+	config  Config
+
+	// bucketMu serializes read-modify-write updates of bucket metadata
+	bucketMu sync.Mutex
+
+	// keys serializes writers of each object, and lets readers see each
+	// write whole; locks are named by the object's data path
+	keys keyLocks
+
+	// buckets is held shared by writers that add keys to a bucket and
+	// exclusively by DeleteBucket, so no write lands in a bucket between
+	// its emptiness check and its removal; locks are named by bucket
+	buckets keyLocks
+
+	// masterKey seals the data keys of objects encrypted at rest
+	masterKey masterKey
+
+	// indexes holds the key index of each bucket loaded so far
+	indexMu sync.Mutex
+	indexes map[string]*keyIndex
 }
 
 // NewFileSystemStorage creates a new filesystem-based storage backend
-func NewFileSystemStorage(baseDir string) (*FileSystemStorage, error) {
+func NewFileSystemStorage(baseDir string, config Config) (*FileSystemStorage, error) {
 	// Create base directory if it doesn't exist
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 
-	return &FileSystemStorage{
-		baseDir: baseDir,
-	}, nil
+	masterKey, err := loadMasterKey(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileSystemStorage{
+		baseDir:   baseDir,
+		config:    config,
+		masterKey: masterKey,
+		indexes:   make(map[string]*keyIndex),
+	}
+	if err := fs.recoverFiles(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
 }
 
 // objectPath returns the filesystem path for an object
@@ -146,159 +340,355 @@ func (fs *FileSystemStorage) objectPath(bucket, key string) string {
 	return filepath.Join(fs.baseDir, bucket, "objects", key)
 }
 
+// dataPath returns the filesystem path of the current version's data.
+// Objects written before data IDs were introduced use objectPath itself.
+func (fs *FileSystemStorage) dataPath(bucket, key string, meta *ObjectMetadata) string {
+	if meta.DataID == "" {
+		return fs.objectPath(bucket, key)
+	}
+	return fs.objectPath(bucket, key) + "." + meta.DataID
+}
+
 // metadataPath returns the filesystem path for object metadata
 func (fs *FileSystemStorage) metadataPath(bucket, key string) string {
-	return filepath.Join(fs.baseDir, bucket, "metadata", key+".json")
+	return filepath.Join(fs.bucketMetadataDir(bucket), key+".json")
 }
 
 // PutObject stores an object and its metadata
-func (fs *FileSystemStorage) PutObject(bucket, key string, data io.Reader, metadata map[string]string, contentType string) (*ObjectMetadata, error) {
+func (fs *FileSystemStorage) PutObject(bucket, key string, data io.Reader, metadata map[string]string, contentType string, opts PutOptions) (*ObjectMetadata, error) {
+	// Create metadata; size and ETag are filled in once the data is written
+	objMeta := &ObjectMetadata{
+		Key:             key,
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Encryption:      opts.Encryption,
+		Checksum:        checksumRequest(opts.Checksum),
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+
+	if err := fs.writeObject(bucket, key, data, objMeta, opts.Condition); err != nil {
+		return nil, err
+	}
+
+	return objMeta, nil
+}
+
+// writeObject stores data as the current version of key. The previous
+// current version is archived or replaced according to the bucket's
+// versioning state, and objMeta is completed with size, ETag, checksum and
+// version. When objMeta requests encryption the body is encrypted under a
+// new data key. The body is spooled before the current version is touched,
+// so a failed or rejected upload leaves it intact.
+func (fs *FileSystemStorage) writeObject(bucket, key string, data io.Reader, objMeta *ObjectMetadata, cond WriteCondition) error {
+	unlockBucket := fs.buckets.rlock(bucket)
+	defer unlockBucket()
+
 	objPath := fs.objectPath(bucket, key)
 	metaPath := fs.metadataPath(bucket, key)
 
 	// Create directories
 	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create object directory: %w", err)
+		return fmt.Errorf("failed to create object directory: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	// Hash the plain data for the ETag and any full-object checksum
+	digests := newObjectDigests(objMeta)
+	data = io.TeeReader(data, digests)
+
+	if objMeta.Encryption != nil {
+		sealed, dataKey, err := fs.masterKey.sealEncryption(objMeta.Encryption)
+		if err != nil {
+			return err
+		}
+		if data, err = encryptReader(data, dataKey, sealed.IV); err != nil {
+			return err
+		}
+		objMeta.Encryption = sealed
 	}
 
 	// Write object data
-	file, err := os.Create(objPath)
+	spool, err := os.CreateTemp(fs.baseDir, ".upload-*")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create object file: %w", err)
+		return fmt.Errorf("failed to create object file: %w", err)
 	}
-	defer file.Close()
+	defer os.Remove(spool.Name())
+	defer spool.Close()
 
-	size, err := io.Copy(file, data)
+	size, err := io.Copy(spool, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write object data: %w", err)
+		return fmt.Errorf("failed to write object data: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		return fmt.Errorf("failed to write object data: %w", err)
 	}
 
-	// Generate ETag (simplified - just use size and timestamp)
-	etag := fmt.Sprintf("\"%d-%d\"", size, time.Now().Unix())
+	// The metadata rename commits the write. Until then the data sits under
+	// a new data ID, leaving the version it replaces intact.
+	unlock := fs.keys.lock(objPath)
+	defer unlock()
 
-	// Create metadata
-	objMeta := &ObjectMetadata{
-		Key:          key,
-		Size:         size,
-		LastModified: time.Now().UTC(),
-		ETag:         etag,
-		ContentType:  contentType,
-		Metadata:     metadata,
+	if !cond.isZero() {
+		if err := fs.checkWriteCondition(bucket, key, cond); err != nil {
+			return err
+		}
 	}
 
-	// Write metadata
-	metaFile, err := os.Create(metaPath)
+	previous, err := readMetadata(metaPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	versionID, err := fs.prepareNewVersion(bucket, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create metadata file: %w", err)
+		return err
+	}
+
+	objMeta.Key = key
+	objMeta.Size = size
+	objMeta.LastModified = time.Now().UTC()
+	objMeta.VersionID = versionID
+	objMeta.DataID = newVersionID()
+	digests.apply(objMeta)
+
+	if err := os.Rename(spool.Name(), fs.dataPath(bucket, key, objMeta)); err != nil {
+		return fmt.Errorf("failed to store object data: %w", err)
+	}
+	if err := writeMetadata(metaPath, objMeta); err != nil {
+		return err
+	}
+	if err := fs.indexPut(bucket, objMeta); err != nil {
+		return err
+	}
+
+	// Archiving already moved the replaced data unless the write replaced
+	// it outright; recovery removes it if this fails
+	if previous != nil && !previous.DeleteMarker {
+		os.Remove(fs.dataPath(bucket, key, previous))
+	}
+	return nil
+}
+
+// readMetadata loads object metadata from a JSON file
+func readMetadata(path string) (*ObjectMetadata, error) {
+	metaFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
 	defer metaFile.Close()
 
-	if err := json.NewEncoder(metaFile).Encode(objMeta); err != nil {
-		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	var meta ObjectMetadata
+	if err := json.NewDecoder(metaFile).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
 	}
 
-	return objMeta, nil
+	return &meta, nil
 }
 
-// GetObject retrieves an object and its metadata
-func (fs *FileSystemStorage) GetObject(bucket, key string) (io.ReadCloser, *ObjectMetadata, error) {
-	objPath := fs.objectPath(bucket, key)
+// writeMetadata atomically persists object metadata as a JSON file
+func writeMetadata(path string, meta *ObjectMetadata) error {
+	if err := writeJSONFile(path, meta); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// updateObjectMetadata applies update to the stored metadata of an object
+// version without rewriting its data. An error from update leaves the
+// metadata unchanged.
+func (fs *FileSystemStorage) updateObjectMetadata(bucket, key, versionID string, update func(*ObjectMetadata) error) (*ObjectMetadata, error) {
+	unlock := fs.keys.lock(fs.objectPath(bucket, key))
+	defer unlock()
+
+	meta, dataPath, err := fs.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Noncurrent versions keep their metadata next to their data
+	current := dataPath == fs.dataPath(bucket, key, meta)
 	metaPath := fs.metadataPath(bucket, key)
+	if !current {
+		metaPath = fs.versionMetadataPath(bucket, key, versionIDOf(meta))
+	}
 
-	// Check if object exists
-	if _, err := os.Stat(objPath); os.IsNotExist(err) {
-		return nil, nil, fmt.Errorf("object not found: %s/%s", bucket, key)
+	if err := update(meta); err != nil {
+		return nil, err
 	}
+	if err := writeMetadata(metaPath, meta); err != nil {
+		return nil, err
+	}
+	if current {
+		if err := fs.indexPut(bucket, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
 
-	// Read metadata
-	metaFile, err := os.Open(metaPath)
+// GetObject retrieves an object and its metadata. An empty versionID
+// selects the current version.
+func (fs *FileSystemStorage) GetObject(bucket, key, versionID string) (io.ReadCloser, *ObjectMetadata, error) {
+	// Once open, the data stays readable even if a writer replaces it
+	unlock := fs.keys.rlock(fs.objectPath(bucket, key))
+	defer unlock()
+
+	meta, dataPath, err := fs.resolveVersion(bucket, key, versionID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read metadata: %w", err)
+		return nil, nil, err
 	}
-	defer metaFile.Close()
-
-	var meta ObjectMetadata
-	if err := json.NewDecoder(metaFile).Decode(&meta); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode metadata: %w", err)
+	if err := checkReadable(meta); err != nil {
+		return nil, nil, err
 	}
 
 	// Open object file
-	file, err := os.Open(objPath)
+	file, err := fs.openData(dataPath, meta.Encryption, 0)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fs.notFound(bucket, key)
+		}
 		return nil, nil, fmt.Errorf("failed to open object: %w", err)
 	}
 
-	return file, &meta, nil
+	return file, meta, nil
 }
 
 // HeadObject retrieves only the metadata for an object
-func (fs *FileSystemStorage) HeadObject(bucket, key string) (*ObjectMetadata, error) {
-	metaPath := fs.metadataPath(bucket, key)
+func (fs *FileSystemStorage) HeadObject(bucket, key, versionID string) (*ObjectMetadata, error) {
+	unlock := fs.keys.rlock(fs.objectPath(bucket, key))
+	defer unlock()
 
-	metaFile, err := os.Open(metaPath)
+	meta, _, err := fs.resolveVersion(bucket, key, versionID)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("object not found: %s/%s", bucket, key)
-		}
-		return nil, fmt.Errorf("failed to read metadata: %w", err)
+		return nil, err
 	}
-	defer metaFile.Close()
 
-	var meta ObjectMetadata
-	if err := json.NewDecoder(metaFile).Decode(&meta); err != nil {
-		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	return meta, nil
+}
+
+// DeleteObject removes an object. Without a versionID this deletes the
+// current version, which in a versioned bucket means adding a delete marker.
+// With a versionID that version is removed permanently. The returned
+// metadata describes the delete marker created or the version removed.
+func (fs *FileSystemStorage) DeleteObject(bucket, key, versionID string, opts DeleteOptions) (*ObjectMetadata, error) {
+	// Delete markers are keys too, so they must not land in a bucket
+	// being deleted
+	unlockBucket := fs.buckets.rlock(bucket)
+	defer unlockBucket()
+
+	if !fs.bucketExists(bucket) {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
 	}
 
-	return &meta, nil
+	unlock := fs.keys.lock(fs.objectPath(bucket, key))
+	defer unlock()
+
+	if versionID != "" {
+		return fs.deleteVersion(bucket, key, versionID, opts.BypassGovernance)
+	}
+
+	status, err := fs.bucketVersioning(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if status != "" {
+		return fs.putDeleteMarker(bucket, key)
+	}
+
+	if err := fs.checkCurrentLock(bucket, key, opts.BypassGovernance); err != nil {
+		return nil, err
+	}
+	if err := fs.removeCurrent(bucket, key); err != nil {
+		return nil, err
+	}
+
+	return &ObjectMetadata{Key: key}, nil
 }
 
-// DeleteObject removes an object and its metadata
-func (fs *FileSystemStorage) DeleteObject(bucket, key string) error {
-	objPath := fs.objectPath(bucket, key)
-	metaPath := fs.metadataPath(bucket, key)
+// checkCurrentLock returns ErrObjectLocked when the current version of key
+// may not be removed
+func (fs *FileSystemStorage) checkCurrentLock(bucket, key string, bypassGovernance bool) error {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return checkObjectLock(current, bypassGovernance)
+}
+
+// removeCurrent removes the current version's data and metadata files
+func (fs *FileSystemStorage) removeCurrent(bucket, key string) error {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
 
 	// Remove object file
-	if err := os.Remove(objPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete object: %w", err)
+	if current != nil && !current.DeleteMarker {
+		if err := os.Remove(fs.dataPath(bucket, key, current)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
 	}
 
 	// Remove metadata file
-	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(fs.metadataPath(bucket, key)); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
 
-	return nil
+	return fs.indexRemove(bucket, key)
 }
 
-// DeleteObjects removes multiple objects
-func (fs *FileSystemStorage) DeleteObjects(bucket string, keys []string) ([]string, []error) {
-	var deleted []string
-	var errors []error
+// DeleteObjects removes multiple objects or object versions
+func (fs *FileSystemStorage) DeleteObjects(bucket string, objects []ObjectIdentifier, opts DeleteOptions) ([]DeletedObject, []DeleteFailure) {
+	return deleteObjects(fs, bucket, objects, opts)
+}
 
-	for _, key := range keys {
-		err := fs.DeleteObject(bucket, key)
+// deleteObjects deletes each object of a batch through s.DeleteObject
+func deleteObjects(s Storage, bucket string, objects []ObjectIdentifier, opts DeleteOptions) ([]DeletedObject, []DeleteFailure) {
+	var deleted []DeletedObject
+	var failures []DeleteFailure
+
+	for _, obj := range objects {
+		meta, err := s.DeleteObject(bucket, obj.Key, obj.VersionID, opts)
 		if err != nil {
-			errors = append(errors, err)
-		} else {
-			deleted = append(deleted, key)
+			failures = append(failures, DeleteFailure{ObjectIdentifier: obj, Err: err})
+			continue
 		}
+
+		result := DeletedObject{ObjectIdentifier: obj, DeleteMarker: meta.DeleteMarker}
+		if meta.DeleteMarker {
+			result.DeleteMarkerVersionID = meta.VersionID
+		}
+		deleted = append(deleted, result)
 	}
 
-	return deleted, errors
+	return deleted, failures
 }
 
 // GetObjectRange retrieves a byte range from an object
-func (fs *FileSystemStorage) GetObjectRange(bucket, key string, rangeStart, rangeEnd int64) (io.ReadCloser, *ObjectMetadata, int64, int64, error) {
-	objPath := fs.objectPath(bucket, key)
-	metaPath := fs.metadataPath(bucket, key)
+func (fs *FileSystemStorage) GetObjectRange(bucket, key, versionID string, rangeStart, rangeEnd int64) (io.ReadCloser, *ObjectMetadata, int64, int64, error) {
+	unlock := fs.keys.rlock(fs.objectPath(bucket, key))
+	defer unlock()
+
+	meta, dataPath, err := fs.resolveVersion(bucket, key, versionID)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if err := checkReadable(meta); err != nil {
+		return nil, nil, 0, 0, err
+	}
 
 	// Check if object exists
-	fileInfo, err := os.Stat(objPath)
+	fileInfo, err := os.Stat(dataPath)
 	if os.IsNotExist(err) {
-		return nil, nil, 0, 0, fmt.Errorf("object not found: %s/%s", bucket, key)
+		return nil, nil, 0, 0, fs.notFound(bucket, key)
 	}
 
 	fileSize := fileInfo.Size()
@@ -314,36 +704,19 @@ func (fs *FileSystemStorage) GetObjectRange(bucket, key string, rangeStart, rang
 		return nil, nil, 0, 0, fmt.Errorf("invalid range")
 	}
 
-	// Read metadata
-	metaFile, err := os.Open(metaPath)
-	if err != nil {
-		return nil, nil, 0, 0, fmt.Errorf("failed to read metadata: %w", err)
-	}
-	defer metaFile.Close()
-
-	var meta ObjectMetadata
-	if err := json.NewDecoder(metaFile).Decode(&meta); err != nil {
-		return nil, nil, 0, 0, fmt.Errorf("failed to decode metadata: %w", err)
-	}
-
-	// Open file and seek to range start
-	file, err := os.Open(objPath)
+	// Open file at the range start
+	file, err := fs.openData(dataPath, meta.Encryption, rangeStart)
 	if err != nil {
 		return nil, nil, 0, 0, fmt.Errorf("failed to open object: %w", err)
 	}
 
-	if _, err := file.Seek(rangeStart, 0); err != nil {
-		file.Close()
-		return nil, nil, 0, 0, fmt.Errorf("failed to seek: %w", err)
-	}
-
 	// Create limited reader for the range
 	limitedReader := &limitedReadCloser{
 		Reader: io.LimitReader(file, rangeEnd-rangeStart+1),
 		Closer: file,
 	}
 
-	return limitedReader, &meta, rangeStart, rangeEnd, nil
+	return limitedReader, meta, rangeStart, rangeEnd, nil
 }
 
 type limitedReadCloser struct {
@@ -351,141 +724,39 @@ type limitedReadCloser struct {
 	io.Closer
 }
 
-// listAllObjects is a helper to get all objects sorted
-func (fs *FileSystemStorage) listAllObjects(bucket, prefix string) ([]ObjectMetadata, error) {
-	metadataDir := filepath.Join(fs.baseDir, bucket, "metadata")
-
-	var objects []ObjectMetadata
-
-	err := filepath.Walk(metadataDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		if filepath.Ext(path) != ".json" {
-			return nil
-		}
-
-		// Read metadata
-		metaFile, err := os.Open(path)
-		if err != nil {
-			return nil // Skip files we can't read
-		}
-		defer metaFile.Close()
-
-		var meta ObjectMetadata
-		if err := json.NewDecoder(metaFile).Decode(&meta); err != nil {
-			return nil // Skip invalid metadata
-		}
-
-		// Filter by prefix
-		if prefix == "" || strings.HasPrefix(meta.Key, prefix) {
-			objects = append(objects, meta)
-		}
-
-		return nil
-	})
-
-	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to list objects: %w", err)
-	}
-
-	// Sort by key for consistent ordering
-	sort.Slice(objects, func(i, j int) bool {
-		return objects[i].Key < objects[j].Key
-	})
-
-	return objects, nil
-}
-
 // ListObjects lists objects (V1 API) with marker-based pagination
-func (fs *FileSystemStorage) ListObjects(bucket, prefix, marker string, maxKeys int) (*ListResult, error) {
-	if maxKeys <= 0 {
-		maxKeys = 1000
-	}
-
-	allObjects, err := fs.listAllObjects(bucket, prefix)
+func (fs *FileSystemStorage) ListObjects(bucket, prefix, delimiter, marker string, maxKeys int) (*ListResult, error) {
+	idx, err := fs.bucketIndex(bucket)
 	if err != nil {
 		return nil, err
 	}
 
-	// Start from marker if provided
-	startIdx := 0
-	if marker != "" {
-		for i, obj := range allObjects {
-			if obj.Key > marker {
-				startIdx = i
-				break
-			}
-		}
-	}
-
-	// Get slice for this page
-	endIdx := startIdx + maxKeys
-	isTruncated := endIdx < len(allObjects)
-	if endIdx > len(allObjects) {
-		endIdx = len(allObjects)
-	}
-
-	pageObjects := allObjects[startIdx:endIdx]
-
-	nextMarker := ""
-	if isTruncated && len(pageObjects) > 0 {
-		nextMarker = pageObjects[len(pageObjects)-1].Key
-	}
-
-	return &ListResult{
-		Objects:     pageObjects,
-		IsTruncated: isTruncated,
-		NextMarker:  nextMarker,
-	}, nil
+	return idx.paginate(prefix, delimiter, marker, maxKeys)
 }
 
-// ListObjectsV2 lists objects (V2 API) with continuation token pagination
-func (fs *FileSystemStorage) ListObjectsV2(bucket, prefix, continuationToken string, maxKeys int) (*ListResult, error) {
-	if maxKeys <= 0 {
-		maxKeys = 1000
-	}
-
-	allObjects, err := fs.listAllObjects(bucket, prefix)
+// ListObjectsV2 lists objects (V2 API) with continuation token pagination.
+// startAfter is only honoured on the first page, when no token is given.
+func (fs *FileSystemStorage) ListObjectsV2(bucket, prefix, delimiter, continuationToken, startAfter string, maxKeys int) (*ListResult, error) {
+	idx, err := fs.bucketIndex(bucket)
 	if err != nil {
 		return nil, err
 	}
 
-	// Decode continuation token (it's just the last key)
-	startIdx := 0
-	if continuationToken != "" {
-		for i, obj := range allObjects {
-			if obj.Key > continuationToken {
-				startIdx = i
-				break
-			}
-		}
+	// The continuation token is the last key or common prefix returned
+	marker := continuationToken
+	if marker == "" {
+		marker = startAfter
 	}
 
-	// Get slice for this page
-	endIdx := startIdx + maxKeys
-	isTruncated := endIdx < len(allObjects)
-	if endIdx > len(allObjects) {
-		endIdx = len(allObjects)
-	}
-
-	pageObjects := allObjects[startIdx:endIdx]
-
-	nextToken := ""
-	if isTruncated && len(pageObjects) > 0 {
-		nextToken = pageObjects[len(pageObjects)-1].Key
-	}
+	return idx.paginate(prefix, delimiter, marker, maxKeys)
+}
 
-	return &ListResult{
-		Objects:               pageObjects,
-		IsTruncated:           isTruncated,
-		NextContinuationToken: nextToken,
-	}, nil
+// validUploadID reports whether uploadID can name a multipart directory.
+// IDs are generated by CreateMultipartUpload, so anything that could step
+// outside the bucket's multipart directory cannot belong to an upload.
+func validUploadID(uploadID string) bool {
+	return uploadID != "" && uploadID != "." && !strings.Contains(uploadID, "..") &&
+		!strings.ContainsAny(uploadID, `/\`)
 }
 
 // multipartPath returns the directory for multipart upload data
@@ -494,17 +765,40 @@ func (fs *FileSystemStorage) multipartPath(bucket, key, uploadID string) string
 }
 
 // CreateMultipartUpload initiates a multipart upload
-func (fs *FileSystemStorage) CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string) (*MultipartUpload, error) {
+func (fs *FileSystemStorage) CreateMultipartUpload(bucket, key, contentType string, metadata map[string]string, opts PutOptions) (*MultipartUpload, error) {
 	// Generate upload ID (timestamp + random component)
 	uploadID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), generateRandomID())
 
 	upload := &MultipartUpload{
-		UploadID:    uploadID,
-		Bucket:      bucket,
-		Key:         key,
-		Created:     time.Now().UTC(),
-		ContentType: contentType,
-		Metadata:    metadata,
+		UploadID:        uploadID,
+		Bucket:          bucket,
+		Key:             key,
+		Created:         time.Now().UTC(),
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Tags:            opts.Tags,
+		ACL:             opts.ACL,
+		Retention:       opts.Retention,
+		LegalHold:       opts.LegalHold,
+		WebsiteRedirect: opts.WebsiteRedirect,
+		StorageClass:    opts.StorageClass,
+	}
+	if opts.Checksum != nil {
+		checksumType, err := ResolveChecksumType(opts.Checksum.Algorithm, opts.Checksum.Type)
+		if err != nil {
+			return nil, err
+		}
+		upload.Checksum = &Checksum{Algorithm: opts.Checksum.Algorithm, Type: checksumType}
+	}
+
+	// Parts are encrypted with the upload's data key until they are
+	// combined
+	if opts.Encryption != nil {
+		sealed, _, err := fs.masterKey.sealEncryption(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		upload.Encryption = sealed
 	}
 
 	// Create multipart directory
@@ -514,14 +808,7 @@ func (fs *FileSystemStorage) CreateMultipartUpload(bucket, key, contentType stri
 	}
 
 	// Save upload metadata
-	metaPath := filepath.Join(mpPath, "upload.json")
-	metaFile, err := os.Create(metaPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create upload metadata: %w", err)
-	}
-	defer metaFile.Close()
-
-	if err := json.NewEncoder(metaFile).Encode(upload); err != nil {
+	if err := writeJSONFile(filepath.Join(mpPath, "upload.json"), upload); err != nil {
 		return nil, fmt.Errorf("failed to write upload metadata: %w", err)
 	}
 
@@ -530,47 +817,53 @@ func (fs *FileSystemStorage) CreateMultipartUpload(bucket, key, contentType stri
 
 // UploadPart uploads a part of a multipart upload
 func (fs *FileSystemStorage) UploadPart(bucket, key, uploadID string, partNumber int, data io.Reader) (*Part, error) {
-	mpPath := fs.multipartPath(bucket, key, uploadID)
-
-	// Verify upload exists
-	if _, err := os.Stat(filepath.Join(mpPath, "upload.json")); os.IsNotExist(err) {
-		return nil, fmt.Errorf("upload not found: %s", uploadID)
+	upload, err := fs.GetMultipartUpload(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
 	}
+	mpPath := fs.multipartPath(bucket, key, uploadID)
 
-	// Write part data
+	// Write part data beside the part file, replacing it only once the
+	// whole part has been read
 	partPath := filepath.Join(mpPath, fmt.Sprintf("part-%05d", partNumber))
-	partFile, err := os.Create(partPath)
+	partFile, err := os.CreateTemp(mpPath, ".part-*")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create part file: %w", err)
 	}
+	defer os.Remove(partFile.Name())
 	defer partFile.Close()
 
-	// Calculate MD5 hash while writing
-	hasher := md5.New()
-	multiWriter := io.MultiWriter(partFile, hasher)
-
-	size, err := io.Copy(multiWriter, data)
+	// Calculate MD5 hash, and the upload's checksum, of the plain data
+	// while writing
+	digests := newPartDigests(upload)
+	size, err := fs.writePartData(partFile, io.TeeReader(data, digests), upload.Encryption)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write part data: %w", err)
 	}
 
-	etag := hex.EncodeToString(hasher.Sum(nil))
+	if err := partFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write part data: %w", err)
+	}
+
+	// Writers of the same part number commit their data and metadata in turn
+	unlock := fs.keys.lock(partPath)
+	defer unlock()
+
+	if err := os.Rename(partFile.Name(), partPath); err != nil {
+		return nil, fmt.Errorf("failed to store part data: %w", err)
+	}
 
 	part := &Part{
-		PartNumber: partNumber,
-		ETag:       etag,
-		Size:       size,
+		PartNumber:   partNumber,
+		ETag:         digests.md5Hex(),
+		Size:         size,
+		Checksum:     digests.checksumValue(),
+		LastModified: time.Now().UTC(),
 	}
 
 	// Save part metadata
 	partMetaPath := filepath.Join(mpPath, fmt.Sprintf("part-%05d.json", partNumber))
-	partMetaFile, err := os.Create(partMetaPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create part metadata: %w", err)
-	}
-	defer partMetaFile.Close()
-
-	if err := json.NewEncoder(partMetaFile).Encode(part); err != nil {
+	if err := writeJSONFile(partMetaPath, part); err != nil {
 		return nil, fmt.Errorf("failed to write part metadata: %w", err)
 	}
 
@@ -578,102 +871,178 @@ func (fs *FileSystemStorage) UploadPart(bucket, key, uploadID string, partNumber
 }
 
 // CompleteMultipartUpload combines all parts into final object
-func (fs *FileSystemStorage) CompleteMultipartUpload(bucket, key, uploadID string, parts []Part) (*ObjectMetadata, error) {
-	mpPath := fs.multipartPath(bucket, key, uploadID)
-
-	// Load upload metadata
-	metaPath := filepath.Join(mpPath, "upload.json")
-	metaFile, err := os.Open(metaPath)
+func (fs *FileSystemStorage) CompleteMultipartUpload(bucket, key, uploadID string, parts []Part, cond WriteCondition) (*ObjectMetadata, error) {
+	upload, err := fs.GetMultipartUpload(bucket, key, uploadID)
 	if err != nil {
-		return nil, fmt.Errorf("upload not found: %w", err)
-	}
-	var upload MultipartUpload
-	json.NewDecoder(metaFile).Decode(&upload)
-	metaFile.Close()
-
-	// Create final object file
-	objPath := fs.objectPath(bucket, key)
-	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create object directory: %w", err)
+		return nil, err
 	}
+	mpPath := fs.multipartPath(bucket, key, uploadID)
 
-	finalFile, err := os.Create(objPath)
+	objMeta, err := completedObject(upload, parts, fs.config.MinPartSize, func(partNumber int) (*Part, error) {
+		return readPart(mpPath, partNumber)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create final object: %w", err)
+		return nil, err
 	}
-	defer finalFile.Close()
 
-	// Sort parts by part number
-	sort.Slice(parts, func(i, j int) bool {
-		return parts[i].PartNumber < parts[j].PartNumber
-	})
-
-	// Concatenate all parts
-	var totalSize int64
+	// Open all parts so they can be concatenated into the final object
+	readers := make([]io.Reader, 0, len(parts))
 	for _, part := range parts {
 		partPath := filepath.Join(mpPath, fmt.Sprintf("part-%05d", part.PartNumber))
-		partFile, err := os.Open(partPath)
+		partFile, err := fs.openPartData(partPath, upload.Encryption)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open part %d: %w", part.PartNumber, err)
 		}
+		defer partFile.Close()
+		readers = append(readers, partFile)
+	}
 
-		n, err := io.Copy(finalFile, partFile)
-		partFile.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to copy part %d: %w", part.PartNumber, err)
-		}
-		totalSize += n
+	if err := fs.writeObject(bucket, key, io.MultiReader(readers...), objMeta, cond); err != nil {
+		return nil, err
 	}
 
-	// Generate ETag (for multipart, it's different format)
-	etag := fmt.Sprintf("\"%s-%d\"", generateRandomID(), len(parts))
+	// Clean up multipart directory
+	os.RemoveAll(mpPath)
 
-	// Create object metadata
-	objMeta := &ObjectMetadata{
-		Key:          key,
-		Size:         totalSize,
-		LastModified: time.Now().UTC(),
-		ETag:         etag,
-		ContentType:  upload.ContentType,
-		Metadata:     upload.Metadata,
-	}
+	return objMeta, nil
+}
 
-	// Save metadata
-	metaObjPath := fs.metadataPath(bucket, key)
-	if err := os.MkdirAll(filepath.Dir(metaObjPath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+// GetMultipartUpload returns the state of an in-progress upload of key
+func (fs *FileSystemStorage) GetMultipartUpload(bucket, key, uploadID string) (*MultipartUpload, error) {
+	if !validUploadID(uploadID) {
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+	upload, err := readUpload(fs.multipartPath(bucket, key, uploadID))
+	if err != nil {
+		return nil, err
+	}
+	if upload.Key != key {
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
 	}
+	return upload, nil
+}
 
-	objMetaFile, err := os.Create(metaObjPath)
+// readUpload loads the state of a multipart upload from its directory
+func readUpload(mpPath string) (*MultipartUpload, error) {
+	metaFile, err := os.Open(filepath.Join(mpPath, "upload.json"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create object metadata: %w", err)
+		return nil, fmt.Errorf("%w: %s", ErrUploadNotFound, filepath.Base(mpPath))
 	}
-	defer objMetaFile.Close()
+	defer metaFile.Close()
 
-	if err := json.NewEncoder(objMetaFile).Encode(objMeta); err != nil {
-		return nil, fmt.Errorf("failed to write object metadata: %w", err)
+	var upload MultipartUpload
+	if err := json.NewDecoder(metaFile).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload metadata: %w", err)
 	}
+	return &upload, nil
+}
 
-	// Clean up multipart directory
-	os.RemoveAll(mpPath)
+// readPart loads the metadata of an uploaded part
+func readPart(mpPath string, partNumber int) (*Part, error) {
+	data, err := os.ReadFile(filepath.Join(mpPath, fmt.Sprintf("part-%05d.json", partNumber)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: part %d was not uploaded", ErrInvalidPart, partNumber)
+		}
+		return nil, fmt.Errorf("failed to read part metadata: %w", err)
+	}
 
-	return objMeta, nil
+	var part Part
+	if err := json.Unmarshal(data, &part); err != nil {
+		return nil, fmt.Errorf("failed to decode part metadata: %w", err)
+	}
+	return &part, nil
+}
+
+// checksumRequest returns the checksum to compute for a new object
+func checksumRequest(requested *Checksum) *Checksum {
+	if requested == nil {
+		return nil
+	}
+	return &Checksum{Algorithm: requested.Algorithm}
 }
 
-// AbortMultipartUpload cancels a multipart upload
+// AbortMultipartUpload cancels an in-progress multipart upload of key
 func (fs *FileSystemStorage) AbortMultipartUpload(bucket, key, uploadID string) error {
-	mpPath := fs.multipartPath(bucket, key, uploadID)
-	return os.RemoveAll(mpPath)
+	if _, err := fs.GetMultipartUpload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	return os.RemoveAll(fs.multipartPath(bucket, key, uploadID))
 }
 
-// ListParts lists the uploaded parts
-func (fs *FileSystemStorage) ListParts(bucket, key, uploadID string) ([]Part, error) {
-	mpPath := fs.multipartPath(bucket, key, uploadID)
+// ListMultipartUploads lists the in-progress multipart uploads of a bucket,
+// ordered by key and then initiation time
+func (fs *FileSystemStorage) ListMultipartUploads(bucket, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (*UploadListResult, error) {
+	uploads, err := fs.listUploads(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateUploads(uploads, prefix, delimiter, keyMarker, uploadIDMarker, maxUploads), nil
+}
+
+// listUploads returns every in-progress multipart upload of a bucket,
+// ordered by key and then initiation time
+func (fs *FileSystemStorage) listUploads(bucket string) ([]MultipartUpload, error) {
+	if !fs.bucketExists(bucket) {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(fs.baseDir, bucket, "multipart"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read multipart directory: %w", err)
+	}
+
+	var uploads []MultipartUpload
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		metaFile, err := os.Open(filepath.Join(fs.baseDir, bucket, "multipart", entry.Name(), "upload.json"))
+		if err != nil {
+			continue
+		}
+		var upload MultipartUpload
+		if err := json.NewDecoder(metaFile).Decode(&upload); err == nil {
+			uploads = append(uploads, upload)
+		}
+		metaFile.Close()
+	}
+
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		if !uploads[i].Created.Equal(uploads[j].Created) {
+			return uploads[i].Created.Before(uploads[j].Created)
+		}
+		// Upload IDs order uploads started at once, so markers stay stable
+		return uploads[i].UploadID < uploads[j].UploadID
+	})
 
+	return uploads, nil
+}
+
+// ListParts lists the uploaded parts after partNumberMarker
+func (fs *FileSystemStorage) ListParts(bucket, key, uploadID string, partNumberMarker, maxParts int) (*PartListResult, error) {
+	parts, err := fs.listParts(bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateParts(parts, partNumberMarker, maxParts), nil
+}
+
+// listParts returns every uploaded part, ordered by part number
+func (fs *FileSystemStorage) listParts(bucket, key, uploadID string) ([]Part, error) {
 	// Verify upload exists
-	if _, err := os.Stat(filepath.Join(mpPath, "upload.json")); os.IsNotExist(err) {
-		return nil, fmt.Errorf("upload not found: %s", uploadID)
+	if _, err := fs.GetMultipartUpload(bucket, key, uploadID); err != nil {
+		return nil, err
 	}
+	mpPath := fs.multipartPath(bucket, key, uploadID)
 
 	var parts []Part
 
@@ -4,128 +4,922 @@ package storage
 
 import (
 	"bytes"
-	"os"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestFileSystemStorage(t *testing.T) {
-	// Create temporary directory for testing
-	tempDir, err := os.MkdirTemp("", "ess-three-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	storage, err := NewFileSystemStorage(tempDir)
-	if err != nil {
-		t.Fatalf("Failed to create storage: %v", err)
-	}
-
-	bucket := "test-bucket"
-	key := "test-file.txt"
-	content := []byte("Hello, World!")
-	contentType := "text/plain"
-	metadata := map[string]string{
-		"author":  "test",
-		"version": "1.0",
-	}
-
-	t.Run("PutObject", func(t *testing.T) {
-		reader := bytes.NewReader(content)
-		meta, err := storage.PutObject(bucket, key, reader, metadata, contentType)
+func TestStorage(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+
+		bucket := "test-bucket"
+		key := "test-file.txt"
+		content := []byte("Hello, World!")
+		contentType := "text/plain"
+		metadata := map[string]string{
+			"author":  "test",
+			"version": "1.0",
+		}
+
+		t.Run("PutObject", func(t *testing.T) {
+			reader := bytes.NewReader(content)
+			meta, err := storage.PutObject(bucket, key, reader, metadata, contentType, PutOptions{})
+			if err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+
+			if meta.Key != key {
+				t.Errorf("Expected key %s, got %s", key, meta.Key)
+			}
+			if meta.Size != int64(len(content)) {
+				t.Errorf("Expected size %d, got %d", len(content), meta.Size)
+			}
+			if meta.ContentType != contentType {
+				t.Errorf("Expected content type %s, got %s", contentType, meta.ContentType)
+			}
+			if meta.Metadata["author"] != "test" {
+				t.Errorf("Metadata mismatch")
+			}
+		})
+
+		t.Run("GetObject", func(t *testing.T) {
+			reader, meta, err := storage.GetObject(bucket, key, "")
+			if err != nil {
+				t.Fatalf("GetObject failed: %v", err)
+			}
+			defer reader.Close()
+
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(reader)
+			if !bytes.Equal(buf.Bytes(), content) {
+				t.Errorf("Content mismatch")
+			}
+
+			if meta.ContentType != contentType {
+				t.Errorf("Expected content type %s, got %s", contentType, meta.ContentType)
+			}
+		})
+
+		t.Run("HeadObject", func(t *testing.T) {
+			meta, err := storage.HeadObject(bucket, key, "")
+			if err != nil {
+				t.Fatalf("HeadObject failed: %v", err)
+			}
+
+			if meta.Size != int64(len(content)) {
+				t.Errorf("Expected size %d, got %d", len(content), meta.Size)
+			}
+			if meta.Metadata["version"] != "1.0" {
+				t.Errorf("Metadata mismatch")
+			}
+		})
+
+		t.Run("ListObjects", func(t *testing.T) {
+			// Add more objects
+			storage.PutObject(bucket, "file1.txt", bytes.NewReader([]byte("test1")), nil, "text/plain", PutOptions{})
+			storage.PutObject(bucket, "file2.txt", bytes.NewReader([]byte("test2")), nil, "text/plain", PutOptions{})
+			storage.PutObject(bucket, "dir/file3.txt", bytes.NewReader([]byte("test3")), nil, "text/plain", PutOptions{})
+
+			objects, err := storage.ListObjects(bucket, "", "", "", 10)
+			if err != nil {
+				t.Fatalf("ListObjects failed: %v", err)
+			}
+
+			if len(objects.Objects) < 4 {
+				t.Errorf("Expected at least 4 objects, got %d", len(objects.Objects))
+			}
+
+			// Test with prefix
+			objects, err = storage.ListObjects(bucket, "file", "", "", 10)
+			if err != nil {
+				t.Fatalf("ListObjects with prefix failed: %v", err)
+			}
+
+			if len(objects.Objects) < 2 {
+				t.Errorf("Expected at least 2 objects with prefix 'file', got %d", len(objects.Objects))
+			}
+		})
+
+		t.Run("DeleteObject", func(t *testing.T) {
+			_, err := storage.DeleteObject(bucket, key, "", DeleteOptions{})
+			if err != nil {
+				t.Fatalf("DeleteObject failed: %v", err)
+			}
+
+			// Verify object is gone
+			_, err = storage.HeadObject(bucket, key, "")
+			if err == nil {
+				t.Error("Expected error for deleted object, got nil")
+			}
+		})
+
+		t.Run("NonExistentObject", func(t *testing.T) {
+			_, err := storage.HeadObject(bucket, "nonexistent.txt", "")
+			if err == nil {
+				t.Error("Expected error for nonexistent object, got nil")
+			}
+		})
+	})
+}
+
+func TestVersioning(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+
+		bucket := "versioned-bucket"
+		key := "doc.txt"
+
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+
+		// Written before versioning is enabled, so it becomes the null version
+		storage.PutObject(bucket, key, bytes.NewReader([]byte("v0")), nil, "text/plain", PutOptions{})
+
+		if _, err := storage.UpdateBucket(bucket, func(info *BucketInfo) error {
+			info.Versioning = VersioningEnabled
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
+		}
+
+		v1, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("v1")), nil, "text/plain", PutOptions{})
 		if err != nil {
 			t.Fatalf("PutObject failed: %v", err)
 		}
+		if v1.VersionID == "" || v1.VersionID == NullVersionID {
+			t.Fatalf("Expected a generated version ID, got %q", v1.VersionID)
+		}
 
-		if meta.Key != key {
-			t.Errorf("Expected key %s, got %s", key, meta.Key)
+		readVersion := func(versionID string) string {
+			reader, _, err := storage.GetObject(bucket, key, versionID)
+			if err != nil {
+				t.Fatalf("GetObject(%q) failed: %v", versionID, err)
+			}
+			defer reader.Close()
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(reader)
+			return buf.String()
 		}
-		if meta.Size != int64(len(content)) {
-			t.Errorf("Expected size %d, got %d", len(content), meta.Size)
+
+		t.Run("ReadOlderVersion", func(t *testing.T) {
+			if got := readVersion(NullVersionID); got != "v0" {
+				t.Errorf("Expected null version content v0, got %q", got)
+			}
+			if got := readVersion(""); got != "v1" {
+				t.Errorf("Expected current content v1, got %q", got)
+			}
+		})
+
+		t.Run("DeleteMarker", func(t *testing.T) {
+			marker, err := storage.DeleteObject(bucket, key, "", DeleteOptions{})
+			if err != nil {
+				t.Fatalf("DeleteObject failed: %v", err)
+			}
+			if !marker.DeleteMarker {
+				t.Fatal("Expected a delete marker to be created")
+			}
+
+			_, err = storage.HeadObject(bucket, key, "")
+			var markerErr *DeleteMarkerError
+			if !errors.As(err, &markerErr) || !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Expected delete marker error, got %v", err)
+			}
+
+			versions, err := storage.ListObjectVersions(bucket, "", "", "", "", 100)
+			if err != nil {
+				t.Fatalf("ListObjectVersions failed: %v", err)
+			}
+			if len(versions.Versions) != 3 {
+				t.Fatalf("Expected 3 versions, got %d", len(versions.Versions))
+			}
+			if !versions.Versions[0].DeleteMarker || !versions.Versions[0].IsLatest {
+				t.Error("Expected the delete marker to be the latest version")
+			}
+
+			// Removing the marker restores the previous version
+			if _, err := storage.DeleteObject(bucket, key, marker.VersionID, DeleteOptions{}); err != nil {
+				t.Fatalf("DeleteObject(marker) failed: %v", err)
+			}
+			if got := readVersion(""); got != "v1" {
+				t.Errorf("Expected restored content v1, got %q", got)
+			}
+		})
+
+		t.Run("BucketNotEmpty", func(t *testing.T) {
+			if err := storage.DeleteBucket(bucket); !errors.Is(err, ErrBucketNotEmpty) {
+				t.Errorf("Expected ErrBucketNotEmpty, got %v", err)
+			}
+		})
+	})
+}
+
+func TestListObjectVersionsPages(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "paged-versions"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
 		}
-		if meta.ContentType != contentType {
-			t.Errorf("Expected content type %s, got %s", contentType, meta.ContentType)
+		if _, err := storage.UpdateBucket(bucket, func(info *BucketInfo) error {
+			info.Versioning = VersioningEnabled
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
 		}
-		if meta.Metadata["author"] != "test" {
-			t.Errorf("Metadata mismatch")
+		for key, count := range map[string]int{"a.txt": 3, "dir/x": 2, "dir/y": 1, "z.txt": 2} {
+			for i := 0; i < count; i++ {
+				if _, err := storage.PutObject(bucket, key, strings.NewReader(key), nil, "text/plain", PutOptions{}); err != nil {
+					t.Fatalf("PutObject failed: %v", err)
+				}
+			}
 		}
+
+		// listAll pages through the listing, returning key@version entries
+		// and common prefixes in the order they were listed
+		listAll := func(delimiter string, maxKeys int) []string {
+			var listed []string
+			keyMarker, versionIDMarker := "", ""
+			for page := 0; page < 20; page++ {
+				result, err := storage.ListObjectVersions(bucket, "", delimiter, keyMarker, versionIDMarker, maxKeys)
+				if err != nil {
+					t.Fatalf("ListObjectVersions failed: %v", err)
+				}
+				for _, version := range result.Versions {
+					listed = append(listed, version.Key+"@"+version.VersionID)
+				}
+				listed = append(listed, result.CommonPrefixes...)
+				if !result.IsTruncated {
+					return listed
+				}
+				keyMarker, versionIDMarker = result.NextKeyMarker, result.NextVersionIDMarker
+			}
+			t.Fatal("Expected the listing to end")
+			return nil
+		}
+
+		t.Run("Markers", func(t *testing.T) {
+			all := listAll("", 1000)
+			if len(all) != 8 {
+				t.Fatalf("Expected 8 versions, got %v", all)
+			}
+			for _, maxKeys := range []int{1, 2, 3} {
+				if paged := listAll("", maxKeys); strings.Join(paged, ",") != strings.Join(all, ",") {
+					t.Errorf("Expected pages of %d to list %v, got %v", maxKeys, all, paged)
+				}
+			}
+		})
+
+		t.Run("Delimiter", func(t *testing.T) {
+			paged := listAll("/", 1)
+			if len(paged) != 6 || paged[3] != "dir/" {
+				t.Errorf("Expected dir/ rolled up between a.txt and z.txt, got %v", paged)
+			}
+		})
 	})
+}
+
+func TestConditionalWrites(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
 
-	t.Run("GetObject", func(t *testing.T) {
-		reader, meta, err := storage.GetObject(bucket, key)
+		bucket := "conditional-bucket"
+		key := "lock.json"
+		createOnly := PutOptions{Condition: WriteCondition{IfNoneMatch: "*"}}
+
+		first, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("v1")), nil, "application/json", createOnly)
 		if err != nil {
-			t.Fatalf("GetObject failed: %v", err)
+			t.Fatalf("First create-only PutObject failed: %v", err)
 		}
-		defer reader.Close()
 
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(reader)
-		if !bytes.Equal(buf.Bytes(), content) {
-			t.Errorf("Content mismatch")
-		}
+		t.Run("IfNoneMatchExisting", func(t *testing.T) {
+			_, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("v2")), nil, "application/json", createOnly)
+			if !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+			}
+		})
 
-		if meta.ContentType != contentType {
-			t.Errorf("Expected content type %s, got %s", contentType, meta.ContentType)
-		}
+		t.Run("IfMatchStale", func(t *testing.T) {
+			_, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("v2")), nil, "application/json", PutOptions{Condition: WriteCondition{IfMatch: `"stale"`}})
+			if !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+			}
+		})
+
+		t.Run("IfMatchCurrent", func(t *testing.T) {
+			if _, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("v2")), nil, "application/json", PutOptions{Condition: WriteCondition{IfMatch: first.ETag}}); err != nil {
+				t.Errorf("Expected If-Match with current ETag to succeed, got %v", err)
+			}
+		})
+
+		t.Run("IfMatchMissingKey", func(t *testing.T) {
+			_, err := storage.PutObject(bucket, "missing.json", bytes.NewReader([]byte("v1")), nil, "application/json", PutOptions{Condition: WriteCondition{IfMatch: first.ETag}})
+			if !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Expected ErrObjectNotFound, got %v", err)
+			}
+		})
 	})
+}
 
-	t.Run("HeadObject", func(t *testing.T) {
-		meta, err := storage.HeadObject(bucket, key)
+func TestObjectTagging(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+
+		bucket := "tagged-bucket"
+		key := "report.csv"
+
+		if _, err := storage.PutObject(bucket, key, bytes.NewReader([]byte("a,b")), nil, "text/csv", PutOptions{
+			Tags: map[string]string{"project": "alpha"},
+		}); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+
+		meta, err := storage.HeadObject(bucket, key, "")
 		if err != nil {
 			t.Fatalf("HeadObject failed: %v", err)
 		}
+		if meta.Tags["project"] != "alpha" {
+			t.Errorf("Expected tag project=alpha, got %v", meta.Tags)
+		}
+
+		if _, err := storage.PutObjectTagging(bucket, key, "", map[string]string{"tier": "cold"}); err != nil {
+			t.Fatalf("PutObjectTagging failed: %v", err)
+		}
+		meta, _ = storage.HeadObject(bucket, key, "")
+		if len(meta.Tags) != 1 || meta.Tags["tier"] != "cold" {
+			t.Errorf("Expected tag set to be replaced with tier=cold, got %v", meta.Tags)
+		}
 
-		if meta.Size != int64(len(content)) {
-			t.Errorf("Expected size %d, got %d", len(content), meta.Size)
+		if _, err := storage.PutObjectTagging(bucket, key, "", nil); err != nil {
+			t.Fatalf("Removing tags failed: %v", err)
+		}
+		meta, _ = storage.HeadObject(bucket, key, "")
+		if len(meta.Tags) != 0 {
+			t.Errorf("Expected no tags, got %v", meta.Tags)
 		}
-		if meta.Metadata["version"] != "1.0" {
-			t.Errorf("Metadata mismatch")
+
+		if _, err := storage.PutObjectTagging(bucket, "missing.csv", "", nil); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("Expected ErrObjectNotFound, got %v", err)
 		}
 	})
+}
 
-	t.Run("ListObjects", func(t *testing.T) {
-		// Add more objects
-		storage.PutObject(bucket, "file1.txt", bytes.NewReader([]byte("test1")), nil, "text/plain")
-		storage.PutObject(bucket, "file2.txt", bytes.NewReader([]byte("test2")), nil, "text/plain")
-		storage.PutObject(bucket, "dir/file3.txt", bytes.NewReader([]byte("test3")), nil, "text/plain")
+// forEachBackend runs test against a fresh instance of each storage backend
+func forEachBackend(t *testing.T, test func(t *testing.T, storage Storage)) {
+	forEachBackendConfig(t, Config{}, test)
+}
 
-		objects, err := storage.ListObjects(bucket, "", 10)
+// forEachBackendConfig runs test against a fresh instance of each storage
+// backend created with config
+func forEachBackendConfig(t *testing.T, config Config, test func(t *testing.T, storage Storage)) {
+	t.Run("FileSystem", func(t *testing.T) {
+		storage, err := NewFileSystemStorage(t.TempDir(), config)
 		if err != nil {
-			t.Fatalf("ListObjects failed: %v", err)
+			t.Fatalf("Failed to create storage: %v", err)
 		}
+		defer storage.Close()
+		test(t, storage)
+	})
 
-		if len(objects) < 4 {
-			t.Errorf("Expected at least 4 objects, got %d", len(objects))
+	t.Run("Memory", func(t *testing.T) {
+		storage, err := NewMemoryStorage(0, config)
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
 		}
+		test(t, storage)
+	})
+}
 
-		// Test with prefix
-		objects, err = storage.ListObjects(bucket, "file", 10)
-		if err != nil {
-			t.Fatalf("ListObjects with prefix failed: %v", err)
+func TestMultipartListing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "multipart-bucket"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
 		}
 
-		if len(objects) < 2 {
-			t.Errorf("Expected at least 2 objects with prefix 'file', got %d", len(objects))
+		var uploadIDs []string
+		for _, key := range []string{"a.bin", "logs/1.bin", "logs/2.bin", "z.bin", "z.bin"} {
+			upload, err := storage.CreateMultipartUpload(bucket, key, "application/octet-stream", nil, PutOptions{})
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			uploadIDs = append(uploadIDs, upload.UploadID)
 		}
+
+		t.Run("Delimiter", func(t *testing.T) {
+			result, err := storage.ListMultipartUploads(bucket, "", "/", "", "", 1000)
+			if err != nil {
+				t.Fatalf("ListMultipartUploads failed: %v", err)
+			}
+			if len(result.Uploads) != 3 || len(result.CommonPrefixes) != 1 || result.CommonPrefixes[0] != "logs/" {
+				t.Errorf("Expected 3 uploads and logs/, got %+v and %v", result.Uploads, result.CommonPrefixes)
+			}
+		})
+
+		t.Run("UploadIDMarker", func(t *testing.T) {
+			var keys []string
+			keyMarker, uploadIDMarker := "", ""
+			for {
+				page, err := storage.ListMultipartUploads(bucket, "", "", keyMarker, uploadIDMarker, 2)
+				if err != nil {
+					t.Fatalf("ListMultipartUploads failed: %v", err)
+				}
+				for _, upload := range page.Uploads {
+					keys = append(keys, upload.Key)
+				}
+				if !page.IsTruncated {
+					break
+				}
+				keyMarker, uploadIDMarker = page.NextKeyMarker, page.NextUploadIDMarker
+			}
+			if got := strings.Join(keys, ","); got != "a.bin,logs/1.bin,logs/2.bin,z.bin,z.bin" {
+				t.Errorf("Expected every upload once, got %s", got)
+			}
+		})
+
+		t.Run("PartNumberMarker", func(t *testing.T) {
+			uploadID := uploadIDs[0]
+			for partNumber := 1; partNumber <= 3; partNumber++ {
+				if _, err := storage.UploadPart(bucket, "a.bin", uploadID, partNumber, strings.NewReader("part")); err != nil {
+					t.Fatalf("UploadPart failed: %v", err)
+				}
+			}
+
+			first, err := storage.ListParts(bucket, "a.bin", uploadID, 0, 2)
+			if err != nil {
+				t.Fatalf("ListParts failed: %v", err)
+			}
+			if len(first.Parts) != 2 || !first.IsTruncated || first.NextPartNumberMarker != 2 {
+				t.Fatalf("Expected 2 parts with marker 2, got %d parts, truncated=%v marker=%d", len(first.Parts), first.IsTruncated, first.NextPartNumberMarker)
+			}
+
+			second, err := storage.ListParts(bucket, "a.bin", uploadID, first.NextPartNumberMarker, 2)
+			if err != nil {
+				t.Fatalf("ListParts failed: %v", err)
+			}
+			if len(second.Parts) != 1 || second.Parts[0].PartNumber != 3 || second.IsTruncated {
+				t.Errorf("Expected only part 3, got %+v", second.Parts)
+			}
+		})
+
+		t.Run("GetMultipartUpload", func(t *testing.T) {
+			created, err := storage.CreateMultipartUpload(bucket, "sum.bin", "application/octet-stream", nil, PutOptions{Checksum: &Checksum{Algorithm: "CRC32"}})
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			upload, err := storage.GetMultipartUpload(bucket, "sum.bin", created.UploadID)
+			if err != nil {
+				t.Fatalf("GetMultipartUpload failed: %v", err)
+			}
+			if upload.Key != "sum.bin" || upload.Checksum == nil || upload.Checksum.Algorithm != "CRC32" {
+				t.Errorf("Expected the upload of sum.bin with CRC32, got %+v", upload)
+			}
+			if _, err := storage.GetMultipartUpload(bucket, "a.bin", created.UploadID); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected ErrUploadNotFound for another key, got %v", err)
+			}
+			storage.AbortMultipartUpload(bucket, "sum.bin", created.UploadID)
+		})
+
+		t.Run("UploadNotFound", func(t *testing.T) {
+			if _, err := storage.ListParts(bucket, "a.bin", "missing", 0, 1000); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected ErrUploadNotFound, got %v", err)
+			}
+			if _, err := storage.GetMultipartUpload(bucket, "a.bin", "missing"); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected ErrUploadNotFound, got %v", err)
+			}
+		})
+		t.Run("AbortMultipartUpload", func(t *testing.T) {
+			upload, err := storage.CreateMultipartUpload(bucket, "abort.bin", "", nil, PutOptions{})
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			for _, uploadID := range []string{"", ".", "..", "../../" + bucket, "../multipart", "missing", upload.UploadID + "/.."} {
+				if err := storage.AbortMultipartUpload(bucket, "abort.bin", uploadID); !errors.Is(err, ErrUploadNotFound) {
+					t.Errorf("Expected ErrUploadNotFound for %q, got %v", uploadID, err)
+				}
+			}
+			if err := storage.AbortMultipartUpload(bucket, "a.bin", upload.UploadID); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected ErrUploadNotFound for another key, got %v", err)
+			}
+			if _, err := storage.HeadBucket(bucket); err != nil {
+				t.Fatalf("Expected the bucket to survive, got %v", err)
+			}
+			if _, err := storage.ListParts(bucket, "a.bin", uploadIDs[0], 0, 1000); err != nil {
+				t.Errorf("Expected other uploads to survive, got %v", err)
+			}
+
+			if err := storage.AbortMultipartUpload(bucket, "abort.bin", upload.UploadID); err != nil {
+				t.Fatalf("AbortMultipartUpload failed: %v", err)
+			}
+			if _, err := storage.GetMultipartUpload(bucket, "abort.bin", upload.UploadID); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected the upload to be gone, got %v", err)
+			}
+			if err := storage.AbortMultipartUpload(bucket, "abort.bin", upload.UploadID); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Expected ErrUploadNotFound on a second abort, got %v", err)
+			}
+		})
 	})
+}
+
+func TestCompleteMultipartUpload(t *testing.T) {
+	forEachBackendConfig(t, Config{MinPartSize: 11}, func(t *testing.T, storage Storage) {
+		bucket := "complete-bucket"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
 
-	t.Run("DeleteObject", func(t *testing.T) {
-		err := storage.DeleteObject(bucket, key)
+		upload, err := storage.CreateMultipartUpload(bucket, "mp.txt", "text/plain", nil, PutOptions{})
 		if err != nil {
-			t.Fatalf("DeleteObject failed: %v", err)
+			t.Fatalf("CreateMultipartUpload failed: %v", err)
+		}
+		var parts []Part
+		var digests []byte
+		for i, data := range []string{"first part,", "second part"} {
+			part, err := storage.UploadPart(bucket, "mp.txt", upload.UploadID, i+1, strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("UploadPart failed: %v", err)
+			}
+			sum := md5.Sum([]byte(data))
+			digests = append(digests, sum[:]...)
+			parts = append(parts, Part{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+
+		t.Run("InvalidPartOrder", func(t *testing.T) {
+			reversed := []Part{parts[1], parts[0]}
+			if _, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, reversed, WriteCondition{}); !errors.Is(err, ErrInvalidPartOrder) {
+				t.Errorf("Expected ErrInvalidPartOrder, got %v", err)
+			}
+		})
+
+		t.Run("ETagMismatch", func(t *testing.T) {
+			wrong := []Part{{PartNumber: 1, ETag: parts[1].ETag}, parts[1]}
+			if _, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, wrong, WriteCondition{}); !errors.Is(err, ErrInvalidPart) {
+				t.Errorf("Expected ErrInvalidPart, got %v", err)
+			}
+		})
+
+		t.Run("MissingETag", func(t *testing.T) {
+			missing := []Part{{PartNumber: 1}, parts[1]}
+			if _, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, missing, WriteCondition{}); !errors.Is(err, ErrInvalidPart) {
+				t.Errorf("Expected ErrInvalidPart, got %v", err)
+			}
+		})
+
+		t.Run("EntityTooSmall", func(t *testing.T) {
+			small, err := storage.CreateMultipartUpload(bucket, "small.txt", "text/plain", nil, PutOptions{})
+			if err != nil {
+				t.Fatalf("CreateMultipartUpload failed: %v", err)
+			}
+			var smallParts []Part
+			for i, data := range []string{"tiny", "end"} {
+				part, err := storage.UploadPart(bucket, "small.txt", small.UploadID, i+1, strings.NewReader(data))
+				if err != nil {
+					t.Fatalf("UploadPart failed: %v", err)
+				}
+				smallParts = append(smallParts, Part{PartNumber: part.PartNumber, ETag: part.ETag})
+			}
+
+			if _, err := storage.CompleteMultipartUpload(bucket, "small.txt", small.UploadID, smallParts, WriteCondition{}); !errors.Is(err, ErrEntityTooSmall) {
+				t.Errorf("Expected ErrEntityTooSmall, got %v", err)
+			}
+			// Only the last part may be smaller than the minimum
+			if _, err := storage.CompleteMultipartUpload(bucket, "small.txt", small.UploadID, smallParts[1:], WriteCondition{}); err != nil {
+				t.Errorf("Expected a small last part to be accepted, got %v", err)
+			}
+		})
+
+		t.Run("CompositeETag", func(t *testing.T) {
+			meta, err := storage.CompleteMultipartUpload(bucket, "mp.txt", upload.UploadID, parts, WriteCondition{})
+			if err != nil {
+				t.Fatalf("CompleteMultipartUpload failed: %v", err)
+			}
+			sum := md5.Sum(digests)
+			if want := `"` + hex.EncodeToString(sum[:]) + `-2"`; meta.ETag != want {
+				t.Errorf("Expected ETag %s, got %s", want, meta.ETag)
+			}
+		})
+
+		t.Run("PartRange", func(t *testing.T) {
+			meta, err := storage.HeadObject(bucket, "mp.txt", "")
+			if err != nil {
+				t.Fatalf("HeadObject failed: %v", err)
+			}
+			if start, end, err := PartRange(meta, 2); err != nil || start != 11 || end != 21 {
+				t.Errorf("Expected part 2 at 11-21, got %d-%d (%v)", start, end, err)
+			}
+			if _, _, err := PartRange(meta, 3); !errors.Is(err, ErrInvalidPartNumber) {
+				t.Errorf("Expected ErrInvalidPartNumber, got %v", err)
+			}
+		})
+	})
+}
+
+func TestObjectLock(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "locked-bucket"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
+		}
+		if _, err := storage.UpdateBucket(bucket, func(info *BucketInfo) error {
+			info.Versioning = VersioningEnabled
+			info.ObjectLock = &ObjectLockConfig{}
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateBucket failed: %v", err)
 		}
 
-		// Verify object is gone
-		_, err = storage.HeadObject(bucket, key)
-		if err == nil {
-			t.Error("Expected error for deleted object, got nil")
+		until := time.Now().Add(time.Hour)
+		put := func(key, mode string) *ObjectMetadata {
+			meta, err := storage.PutObject(bucket, key, bytes.NewReader([]byte(key)), nil, "text/plain", PutOptions{
+				Retention: &Retention{Mode: mode, RetainUntil: until},
+			})
+			if err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+			return meta
 		}
+
+		t.Run("Governance", func(t *testing.T) {
+			meta := put("governance.txt", RetentionGovernance)
+
+			if _, err := storage.DeleteObject(bucket, meta.Key, meta.VersionID, DeleteOptions{}); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected ErrObjectLocked, got %v", err)
+			}
+
+			// A delete marker leaves the locked version in place
+			marker, err := storage.DeleteObject(bucket, meta.Key, "", DeleteOptions{})
+			if err != nil || !marker.DeleteMarker {
+				t.Fatalf("Expected a delete marker, got %v", err)
+			}
+
+			if _, err := storage.PutObjectRetention(bucket, meta.Key, meta.VersionID, nil, false); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected removing the retention to fail, got %v", err)
+			}
+			if _, err := storage.DeleteObject(bucket, meta.Key, meta.VersionID, DeleteOptions{BypassGovernance: true}); err != nil {
+				t.Errorf("Expected bypass to delete the version, got %v", err)
+			}
+		})
+
+		t.Run("Compliance", func(t *testing.T) {
+			meta := put("compliance.txt", RetentionCompliance)
+
+			if _, err := storage.DeleteObject(bucket, meta.Key, meta.VersionID, DeleteOptions{BypassGovernance: true}); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected ErrObjectLocked despite bypass, got %v", err)
+			}
+
+			shorter := &Retention{Mode: RetentionCompliance, RetainUntil: until.Add(-time.Minute)}
+			if _, err := storage.PutObjectRetention(bucket, meta.Key, meta.VersionID, shorter, true); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected shortening to fail, got %v", err)
+			}
+
+			longer := &Retention{Mode: RetentionCompliance, RetainUntil: until.Add(time.Hour)}
+			updated, err := storage.PutObjectRetention(bucket, meta.Key, meta.VersionID, longer, false)
+			if err != nil {
+				t.Fatalf("Expected extending to succeed, got %v", err)
+			}
+			if !updated.Retention.RetainUntil.Equal(longer.RetainUntil) {
+				t.Errorf("Expected retain until %v, got %v", longer.RetainUntil, updated.Retention.RetainUntil)
+			}
+		})
+
+		t.Run("LegalHold", func(t *testing.T) {
+			meta, err := storage.PutObject(bucket, "held.txt", bytes.NewReader([]byte("held")), nil, "text/plain", PutOptions{LegalHold: true})
+			if err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+
+			_, failures := storage.DeleteObjects(bucket, []ObjectIdentifier{{Key: meta.Key, VersionID: meta.VersionID}}, DeleteOptions{BypassGovernance: true})
+			if len(failures) != 1 || !errors.Is(failures[0].Err, ErrObjectLocked) {
+				t.Errorf("Expected the held version to fail with ErrObjectLocked, got %v", failures)
+			}
+
+			if _, err := storage.PutObjectLegalHold(bucket, meta.Key, meta.VersionID, false); err != nil {
+				t.Fatalf("PutObjectLegalHold failed: %v", err)
+			}
+			if _, err := storage.DeleteObject(bucket, meta.Key, meta.VersionID, DeleteOptions{}); err != nil {
+				t.Errorf("Expected the released version to be deleted, got %v", err)
+			}
+		})
+
+		t.Run("Overwrite", func(t *testing.T) {
+			unversioned := "unversioned-lock"
+			if err := storage.CreateBucket(unversioned); err != nil {
+				t.Fatalf("CreateBucket failed: %v", err)
+			}
+			storage.PutObject(unversioned, "a.txt", bytes.NewReader([]byte("a")), nil, "text/plain", PutOptions{LegalHold: true})
+
+			if _, err := storage.PutObject(unversioned, "a.txt", bytes.NewReader([]byte("b")), nil, "text/plain", PutOptions{}); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected overwrite to fail with ErrObjectLocked, got %v", err)
+			}
+			if _, err := storage.DeleteObject(unversioned, "a.txt", "", DeleteOptions{}); !errors.Is(err, ErrObjectLocked) {
+				t.Errorf("Expected delete to fail with ErrObjectLocked, got %v", err)
+			}
+		})
 	})
+}
 
-	t.Run("NonExistentObject", func(t *testing.T) {
-		_, err := storage.HeadObject(bucket, "nonexistent.txt")
-		if err == nil {
-			t.Error("Expected error for nonexistent object, got nil")
+func TestRestoreObject(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "archive-bucket"
+		if err := storage.CreateBucket(bucket); err != nil {
+			t.Fatalf("CreateBucket failed: %v", err)
 		}
+
+		put := func(key, class string) {
+			if _, err := storage.PutObject(bucket, key, bytes.NewReader([]byte(key)), nil, "text/plain", PutOptions{StorageClass: class}); err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+		}
+
+		t.Run("Ongoing", func(t *testing.T) {
+			put("slow.txt", StorageClassGlacier)
+
+			if _, _, err := storage.GetObject(bucket, "slow.txt", ""); !errors.Is(err, ErrInvalidObjectState) {
+				t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+			}
+			meta, err := storage.HeadObject(bucket, "slow.txt", "")
+			if err != nil || meta.StorageClass != StorageClassGlacier {
+				t.Fatalf("Expected HeadObject to report GLACIER, got %v", err)
+			}
+
+			restored, err := storage.RestoreObject(bucket, "slow.txt", "", 1, time.Now().Add(time.Hour))
+			if err != nil || restored {
+				t.Fatalf("Expected a new restore, got %v, %v", restored, err)
+			}
+			if _, err := storage.RestoreObject(bucket, "slow.txt", "", 1, time.Now()); !errors.Is(err, ErrRestoreInProgress) {
+				t.Errorf("Expected ErrRestoreInProgress, got %v", err)
+			}
+			if _, _, _, _, err := storage.GetObjectRange(bucket, "slow.txt", "", 0, 1); !errors.Is(err, ErrInvalidObjectState) {
+				t.Errorf("Expected ErrInvalidObjectState during the restore, got %v", err)
+			}
+		})
+
+		t.Run("Restored", func(t *testing.T) {
+			put("fast.txt", StorageClassDeepArchive)
+
+			if _, err := storage.RestoreObject(bucket, "fast.txt", "", 2, time.Now()); err != nil {
+				t.Fatalf("RestoreObject failed: %v", err)
+			}
+			reader, meta, err := storage.GetObject(bucket, "fast.txt", "")
+			if err != nil {
+				t.Fatalf("Expected the restored copy to be readable, got %v", err)
+			}
+			reader.Close()
+			if want := meta.Restore.Ready.Add(2 * restoreDay); !meta.Restore.Expiry.Equal(want) {
+				t.Errorf("Expected expiry %v, got %v", want, meta.Restore.Expiry)
+			}
+
+			restored, err := storage.RestoreObject(bucket, "fast.txt", "", 5, time.Now())
+			if err != nil || !restored {
+				t.Errorf("Expected the restore to be extended, got %v, %v", restored, err)
+			}
+
+			// A copy out of the archive is readable without a restore
+			if _, err := storage.CopyObject(bucket, "fast.txt", "", bucket, "copy.txt", nil, "text/plain", PutOptions{}); err != nil {
+				t.Fatalf("CopyObject failed: %v", err)
+			}
+			reader, meta, err = storage.GetObject(bucket, "copy.txt", "")
+			if err != nil || meta.StorageClass != "" || meta.Restore != nil {
+				t.Fatalf("Expected a STANDARD copy, got %v", err)
+			}
+			reader.Close()
+		})
+
+		t.Run("NotArchived", func(t *testing.T) {
+			put("standard.txt", "STANDARD_IA")
+			if _, err := storage.RestoreObject(bucket, "standard.txt", "", 1, time.Now()); !errors.Is(err, ErrInvalidObjectState) {
+				t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+			}
+		})
+	})
+}
+
+func TestBucketOperations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage) {
+		bucket := "bucket-ops"
+
+		t.Run("CreateBucket", func(t *testing.T) {
+			if err := storage.CreateBucket(bucket); err != nil {
+				t.Fatalf("CreateBucket failed: %v", err)
+			}
+			if err := storage.CreateBucket("Invalid_Bucket"); !errors.Is(err, ErrInvalidBucketName) {
+				t.Errorf("Expected ErrInvalidBucketName, got %v", err)
+			}
+		})
+
+		t.Run("BucketAlreadyOwnedByYou", func(t *testing.T) {
+			if err := storage.CreateBucket(bucket); !errors.Is(err, ErrBucketAlreadyExists) {
+				t.Errorf("Expected ErrBucketAlreadyExists, got %v", err)
+			}
+		})
+
+		t.Run("HeadBucket", func(t *testing.T) {
+			info, err := storage.HeadBucket(bucket)
+			if err != nil {
+				t.Fatalf("HeadBucket failed: %v", err)
+			}
+			if info.Name != bucket || info.CreationDate.IsZero() {
+				t.Errorf("Expected %s with a creation date, got %+v", bucket, info)
+			}
+			if _, err := storage.HeadBucket("missing-bucket"); !errors.Is(err, ErrBucketNotFound) {
+				t.Errorf("Expected ErrBucketNotFound, got %v", err)
+			}
+		})
+
+		t.Run("BucketNotEmpty", func(t *testing.T) {
+			if _, err := storage.PutObject(bucket, "keep.txt", strings.NewReader("data"), nil, "text/plain", PutOptions{}); err != nil {
+				t.Fatalf("PutObject failed: %v", err)
+			}
+			if err := storage.DeleteBucket(bucket); !errors.Is(err, ErrBucketNotEmpty) {
+				t.Errorf("Expected ErrBucketNotEmpty, got %v", err)
+			}
+			if _, err := storage.HeadBucket(bucket); err != nil {
+				t.Errorf("Expected the bucket to survive, got %v", err)
+			}
+		})
+
+		t.Run("DeleteBucket", func(t *testing.T) {
+			if _, err := storage.DeleteObject(bucket, "keep.txt", "", DeleteOptions{}); err != nil {
+				t.Fatalf("DeleteObject failed: %v", err)
+			}
+			if err := storage.DeleteBucket(bucket); err != nil {
+				t.Fatalf("DeleteBucket failed: %v", err)
+			}
+			if _, err := storage.HeadBucket(bucket); !errors.Is(err, ErrBucketNotFound) {
+				t.Errorf("Expected ErrBucketNotFound after delete, got %v", err)
+			}
+			if err := storage.DeleteBucket(bucket); !errors.Is(err, ErrBucketNotFound) {
+				t.Errorf("Expected ErrBucketNotFound, got %v", err)
+			}
+
+			buckets, err := storage.ListBuckets()
+			if err != nil {
+				t.Fatalf("ListBuckets failed: %v", err)
+			}
+			for _, summary := range buckets {
+				if summary.Name == bucket {
+					t.Errorf("Expected %s to be gone from ListBuckets", bucket)
+				}
+			}
+		})
+
+		t.Run("DeleteMarkersAndVersions", func(t *testing.T) {
+			if err := storage.CreateBucket(bucket); err != nil {
+				t.Fatalf("CreateBucket failed: %v", err)
+			}
+			if _, err := storage.UpdateBucket(bucket, func(info *BucketInfo) error {
+				info.Versioning = VersioningEnabled
+				return nil
+			}); err != nil {
+				t.Fatalf("UpdateBucket failed: %v", err)
+			}
+			if _, err := storage.DeleteObject(bucket, "marker.txt", "", DeleteOptions{}); err != nil {
+				t.Fatalf("DeleteObject failed: %v", err)
+			}
+			if err := storage.DeleteBucket(bucket); !errors.Is(err, ErrBucketNotEmpty) {
+				t.Errorf("Expected ErrBucketNotEmpty with a delete marker, got %v", err)
+			}
+
+			versions, err := storage.ListObjectVersions(bucket, "", "", "", "", 1000)
+			if err != nil {
+				t.Fatalf("ListObjectVersions failed: %v", err)
+			}
+			for _, version := range versions.Versions {
+				if _, err := storage.DeleteObject(bucket, version.Key, version.VersionID, DeleteOptions{}); err != nil {
+					t.Fatalf("DeleteObject failed: %v", err)
+				}
+			}
+			if err := storage.DeleteBucket(bucket); err != nil {
+				t.Errorf("DeleteBucket failed: %v", err)
+			}
+		})
+
+		t.Run("ConcurrentPut", func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if err := storage.CreateBucket(bucket); err != nil {
+					t.Fatalf("CreateBucket failed: %v", err)
+				}
+
+				putErr := make(chan error, 1)
+				go func() {
+					_, err := storage.PutObject(bucket, "race.txt", strings.NewReader("data"), nil, "text/plain", PutOptions{})
+					putErr <- err
+				}()
+				deleteErr := storage.DeleteBucket(bucket)
+				if err := <-putErr; err != nil {
+					t.Fatalf("PutObject failed: %v", err)
+				}
+
+				// Whichever ran first, an acknowledged write must survive
+				if _, err := storage.HeadObject(bucket, "race.txt", ""); err != nil {
+					t.Fatalf("Expected race.txt to survive DeleteBucket (%v), got %v", deleteErr, err)
+				}
+				if _, err := storage.DeleteObject(bucket, "race.txt", "", DeleteOptions{}); err != nil {
+					t.Fatalf("DeleteObject failed: %v", err)
+				}
+				if err := storage.DeleteBucket(bucket); err != nil {
+					t.Fatalf("DeleteBucket failed: %v", err)
+				}
+			}
+		})
 	})
 }
@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+// PutObjectTagging replaces the tag set of an object, or of one version of
+// it. A nil tag set removes all tags.
+func (fs *FileSystemStorage) PutObjectTagging(bucket, key, versionID string, tags map[string]string) (*ObjectMetadata, error) {
+	return fs.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.Tags = tags
+		return nil
+	})
+}
+
+// PutObjectACL replaces the canned ACL of an object, or of one version of it
+func (fs *FileSystemStorage) PutObjectACL(bucket, key, versionID, acl string) (*ObjectMetadata, error) {
+	return fs.updateObjectMetadata(bucket, key, versionID, func(meta *ObjectMetadata) error {
+		meta.ACL = acl
+		return nil
+	})
+}
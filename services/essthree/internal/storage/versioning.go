@@ -0,0 +1,450 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bucket versioning states. A bucket that never had versioning configured
+// has an empty status.
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+// NullVersionID is the version ID of objects written while versioning was
+// not enabled
+const NullVersionID = "null"
+
+// ErrVersionNotFound is returned when the requested version does not exist
+var ErrVersionNotFound = errors.New("version not found")
+
+// DeleteMarkerError reports that the resolved version of an object is a
+// delete marker. It matches ErrObjectNotFound with errors.Is.
+type DeleteMarkerError struct {
+	Bucket    string
+	Key       string
+	VersionID string
+}
+
+func (e *DeleteMarkerError) Error() string {
+	return fmt.Sprintf("object not found: %s/%s is a delete marker", e.Bucket, e.Key)
+}
+
+func (e *DeleteMarkerError) Unwrap() error {
+	return ErrObjectNotFound
+}
+
+// ObjectVersion is one entry of a version listing
+type ObjectVersion struct {
+	ObjectMetadata
+	IsLatest bool
+}
+
+// VersionListResult holds paginated version listing results
+type VersionListResult struct {
+	Versions            []ObjectVersion
+	CommonPrefixes      []string
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIDMarker string
+}
+
+// newVersionID generates a unique, roughly time-ordered version ID
+func newVersionID() string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), hex.EncodeToString(random))
+}
+
+// versionIDOf returns the version ID of stored metadata, treating objects
+// written before versioning was enabled as the null version
+func versionIDOf(meta *ObjectMetadata) string {
+	if meta.VersionID == "" {
+		return NullVersionID
+	}
+	return meta.VersionID
+}
+
+// versionsDir returns the directory holding noncurrent versions of a key
+func (fs *FileSystemStorage) versionsDir(bucket, key string) string {
+	return filepath.Join(fs.baseDir, bucket, "versions", key)
+}
+
+// versionDataPath returns the filesystem path for a noncurrent version's data
+func (fs *FileSystemStorage) versionDataPath(bucket, key, versionID string) string {
+	return filepath.Join(fs.versionsDir(bucket, key), versionID+".data")
+}
+
+// versionMetadataPath returns the filesystem path for a noncurrent version's metadata
+func (fs *FileSystemStorage) versionMetadataPath(bucket, key, versionID string) string {
+	return filepath.Join(fs.versionsDir(bucket, key), versionID+".json")
+}
+
+// bucketVersioning returns the versioning status of a bucket
+func (fs *FileSystemStorage) bucketVersioning(bucket string) (string, error) {
+	if !fs.bucketExists(bucket) {
+		// Buckets created implicitly by this write start out unversioned
+		return "", nil
+	}
+	info, err := fs.HeadBucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	return info.Versioning, nil
+}
+
+// resolveVersion finds the metadata and data path of an object version.
+// An empty versionID selects the current version.
+func (fs *FileSystemStorage) resolveVersion(bucket, key, versionID string) (*ObjectMetadata, string, error) {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if versionID == "" || (current != nil && versionIDOf(current) == versionID) {
+		if current == nil {
+			return nil, "", fs.notFound(bucket, key)
+		}
+		if current.DeleteMarker {
+			return nil, "", &DeleteMarkerError{Bucket: bucket, Key: key, VersionID: current.VersionID}
+		}
+		return current, fs.dataPath(bucket, key, current), nil
+	}
+
+	if strings.ContainsAny(versionID, `/\`) || strings.Contains(versionID, "..") {
+		return nil, "", fmt.Errorf("%w: %s", ErrVersionNotFound, versionID)
+	}
+
+	meta, err := readMetadata(fs.versionMetadataPath(bucket, key, versionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			if !fs.bucketExists(bucket) {
+				return nil, "", fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+			}
+			return nil, "", fmt.Errorf("%w: %s", ErrVersionNotFound, versionID)
+		}
+		return nil, "", fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if meta.DeleteMarker {
+		return nil, "", &DeleteMarkerError{Bucket: bucket, Key: key, VersionID: versionID}
+	}
+
+	return meta, fs.versionDataPath(bucket, key, versionID), nil
+}
+
+// prepareNewVersion makes room for a new current version of key and returns
+// the version ID it should be written with. With versioning enabled the
+// current version is archived; when suspended only a non-null current
+// version is archived and any existing null version is replaced.
+func (fs *FileSystemStorage) prepareNewVersion(bucket, key string) (string, error) {
+	status, err := fs.bucketVersioning(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	switch status {
+	case VersioningEnabled:
+		if err := fs.archiveCurrent(bucket, key); err != nil {
+			return "", err
+		}
+		return newVersionID(), nil
+	case VersioningSuspended:
+		if err := fs.replaceNullVersion(bucket, key); err != nil {
+			return "", err
+		}
+		return NullVersionID, nil
+	default:
+		// The write replaces the current object outright
+		if err := fs.checkCurrentLock(bucket, key, false); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+}
+
+// replaceNullVersion archives a non-null current version and removes the
+// null version, which a write in a suspended bucket replaces. A locked null
+// version cannot be replaced.
+func (fs *FileSystemStorage) replaceNullVersion(bucket, key string) error {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	null := current
+	if current == nil || versionIDOf(current) != NullVersionID {
+		null, err = readMetadata(fs.versionMetadataPath(bucket, key, NullVersionID))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read metadata: %w", err)
+		}
+	}
+	if err := checkObjectLock(null, false); err != nil {
+		return err
+	}
+
+	if current != nil && versionIDOf(current) != NullVersionID {
+		if err := fs.archiveCurrent(bucket, key); err != nil {
+			return err
+		}
+	} else if err := fs.removeCurrent(bucket, key); err != nil {
+		return err
+	}
+
+	return fs.removeVersionFiles(bucket, key, NullVersionID)
+}
+
+// archiveCurrent moves the current version of key into the noncurrent
+// versions directory. The version's metadata is written before its data is
+// moved, so an interrupted archive leaves either the current version intact
+// or the archived one complete, with only dangling metadata to recover.
+func (fs *FileSystemStorage) archiveCurrent(bucket, key string) error {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	versionID := versionIDOf(current)
+	dataPath := fs.dataPath(bucket, key, current)
+	current.VersionID = versionID
+	current.DataID = ""
+
+	if err := os.MkdirAll(fs.versionsDir(bucket, key), 0755); err != nil {
+		return fmt.Errorf("failed to create versions directory: %w", err)
+	}
+
+	if err := writeMetadata(fs.versionMetadataPath(bucket, key, versionID), current); err != nil {
+		return err
+	}
+	if !current.DeleteMarker {
+		if err := os.Rename(dataPath, fs.versionDataPath(bucket, key, versionID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to archive object version: %w", err)
+		}
+	}
+
+	return fs.removeCurrent(bucket, key)
+}
+
+// putDeleteMarker makes a delete marker the current version of key
+func (fs *FileSystemStorage) putDeleteMarker(bucket, key string) (*ObjectMetadata, error) {
+	metaPath := fs.metadataPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	versionID, err := fs.prepareNewVersion(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := &ObjectMetadata{
+		Key:          key,
+		LastModified: time.Now().UTC(),
+		VersionID:    versionID,
+		DeleteMarker: true,
+	}
+	if err := writeMetadata(metaPath, marker); err != nil {
+		return nil, err
+	}
+	if err := fs.indexPut(bucket, marker); err != nil {
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+// deleteVersion permanently removes one version of key. Removing the current
+// version promotes the newest noncurrent version in its place. A version
+// under Object Lock is kept unless bypassGovernance lifts its GOVERNANCE
+// retention.
+func (fs *FileSystemStorage) deleteVersion(bucket, key, versionID string, bypassGovernance bool) (*ObjectMetadata, error) {
+	current, err := readMetadata(fs.metadataPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if current != nil && versionIDOf(current) == versionID {
+		if err := checkObjectLock(current, bypassGovernance); err != nil {
+			return nil, err
+		}
+		if err := fs.removeCurrent(bucket, key); err != nil {
+			return nil, err
+		}
+		if err := fs.promoteNewestVersion(bucket, key); err != nil {
+			return nil, err
+		}
+		current.VersionID = versionID
+		return current, nil
+	}
+
+	if strings.ContainsAny(versionID, `/\`) || strings.Contains(versionID, "..") {
+		return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, versionID)
+	}
+
+	meta, err := readMetadata(fs.versionMetadataPath(bucket, key, versionID))
+	if os.IsNotExist(err) {
+		// Deleting a version that does not exist is not an error
+		return &ObjectMetadata{Key: key, VersionID: versionID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := checkObjectLock(meta, bypassGovernance); err != nil {
+		return nil, err
+	}
+
+	if err := fs.removeVersionFiles(bucket, key, versionID); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// removeVersionFiles deletes a noncurrent version's data and metadata files
+func (fs *FileSystemStorage) removeVersionFiles(bucket, key, versionID string) error {
+	if err := os.Remove(fs.versionDataPath(bucket, key, versionID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete object version: %w", err)
+	}
+	if err := os.Remove(fs.versionMetadataPath(bucket, key, versionID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete version metadata: %w", err)
+	}
+	return nil
+}
+
+// promoteNewestVersion makes the newest noncurrent version of key current,
+// writing its metadata before moving its data as archiveCurrent does
+func (fs *FileSystemStorage) promoteNewestVersion(bucket, key string) error {
+	versions, err := fs.listNoncurrentVersions(bucket, key)
+	if err != nil || len(versions) == 0 {
+		return err
+	}
+
+	newest := versions[0]
+	versionID := newest.VersionID
+	newest.DataID = newVersionID()
+
+	if err := writeMetadata(fs.metadataPath(bucket, key), &newest); err != nil {
+		return err
+	}
+	if !newest.DeleteMarker {
+		if err := os.Rename(fs.versionDataPath(bucket, key, versionID), fs.dataPath(bucket, key, &newest)); err != nil {
+			return fmt.Errorf("failed to restore object version: %w", err)
+		}
+	}
+	if err := fs.indexPut(bucket, &newest); err != nil {
+		return err
+	}
+
+	return fs.removeVersionFiles(bucket, key, versionID)
+}
+
+// listNoncurrentVersions returns the noncurrent versions of key, newest first
+func (fs *FileSystemStorage) listNoncurrentVersions(bucket, key string) ([]ObjectMetadata, error) {
+	entries, err := os.ReadDir(fs.versionsDir(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versions directory: %w", err)
+	}
+
+	var versions []ObjectMetadata
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		meta, err := readMetadata(filepath.Join(fs.versionsDir(bucket, key), entry.Name()))
+		if err != nil || meta.Key != key {
+			continue
+		}
+		versions = append(versions, *meta)
+	}
+
+	sortVersionsNewestFirst(versions)
+	return versions, nil
+}
+
+// sortVersionsNewestFirst orders versions of a single key newest first
+func sortVersionsNewestFirst(versions []ObjectMetadata) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		if !versions[i].LastModified.Equal(versions[j].LastModified) {
+			return versions[i].LastModified.After(versions[j].LastModified)
+		}
+		return versions[i].VersionID > versions[j].VersionID
+	})
+}
+
+// ListObjectVersions lists every version of every key, including delete
+// markers, ordered by key and then newest version first. Every key with
+// versions has a current entry in the key index, a delete marker at least,
+// so the index is seeked to the key marker and only the version directories
+// of keys the page may reach are read.
+func (fs *FileSystemStorage) ListObjectVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) (*VersionListResult, error) {
+	idx, err := fs.bucketIndex(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect one entry past the page so paginateVersions can tell whether
+	// the listing is truncated; entries of the marker key may all be skipped
+	maxKeys = max(maxKeys, 0)
+	var versions []ObjectVersion
+	err = idx.scan(func(cursor *indexCursor) error {
+		cursor.seek(max(prefix, keyMarker))
+		count := 0
+		for count <= maxKeys {
+			current, ok := cursor.next()
+			if !ok || !strings.HasPrefix(current.Key, prefix) {
+				return nil
+			}
+			current.VersionID = versionIDOf(current)
+
+			// A group rolled up under a common prefix needs only one entry
+			if delimiter != "" {
+				if i := strings.Index(current.Key[len(prefix):], delimiter); i >= 0 {
+					commonPrefix := current.Key[:len(prefix)+i+len(delimiter)]
+					versions = append(versions, ObjectVersion{ObjectMetadata: *current, IsLatest: true})
+					if !strings.HasPrefix(keyMarker, commonPrefix) {
+						count++
+					}
+					end, ok := prefixEnd(commonPrefix)
+					if !ok {
+						return nil
+					}
+					cursor.seek(end)
+					continue
+				}
+			}
+
+			older, err := fs.listNoncurrentVersions(bucket, current.Key)
+			if err != nil {
+				return err
+			}
+			versions = append(versions, ObjectVersion{ObjectMetadata: *current, IsLatest: true})
+			for _, meta := range older {
+				versions = append(versions, ObjectVersion{ObjectMetadata: meta})
+			}
+			if current.Key != keyMarker {
+				count += 1 + len(older)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list object versions: %w", err)
+	}
+
+	return paginateVersions(versions, prefix, delimiter, keyMarker, versionIDMarker, maxKeys), nil
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import "strings"
+
+// WebsiteConfig is a bucket's static website configuration. Either
+// RedirectAllRequestsTo or IndexDocument is set.
+type WebsiteConfig struct {
+	// IndexDocument is the suffix appended to requests for a directory,
+	// e.g. index.html
+	IndexDocument string `json:"index_document,omitempty"`
+
+	// ErrorDocument is the key of the object returned for 4xx errors
+	ErrorDocument string `json:"error_document,omitempty"`
+
+	// RedirectAllRequestsTo sends every request to another host
+	RedirectAllRequestsTo *WebsiteRedirect `json:"redirect_all_requests_to,omitempty"`
+
+	RoutingRules []RoutingRule `json:"routing_rules,omitempty"`
+}
+
+// WebsiteRedirect is the host, and optionally protocol, requests are
+// redirected to
+type WebsiteRedirect struct {
+	HostName string `json:"host_name"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// RoutingRule redirects website requests whose key or error status matches
+// its condition
+type RoutingRule struct {
+	// Condition; a rule without one matches every request
+	KeyPrefixEquals             string `json:"key_prefix_equals,omitempty"`
+	HTTPErrorCodeReturnedEquals int    `json:"http_error_code_returned_equals,omitempty"`
+
+	// Redirect; at most one of ReplaceKeyPrefixWith and ReplaceKeyWith is
+	// set. An empty ReplaceKeyPrefixWith removes the matched prefix, so it
+	// is a pointer to tell it from an absent one.
+	HostName             string  `json:"host_name,omitempty"`
+	Protocol             string  `json:"protocol,omitempty"`
+	ReplaceKeyPrefixWith *string `json:"replace_key_prefix_with,omitempty"`
+	ReplaceKeyWith       string  `json:"replace_key_with,omitempty"`
+	HTTPRedirectCode     int     `json:"http_redirect_code,omitempty"`
+}
+
+// Matches reports whether the rule applies to a request for key. status is
+// the error the request would otherwise return, or 0 before the object is
+// looked up; rules with an error code condition only match that error.
+func (r *RoutingRule) Matches(key string, status int) bool {
+	if r.HTTPErrorCodeReturnedEquals != 0 && r.HTTPErrorCodeReturnedEquals != status {
+		return false
+	}
+	return strings.HasPrefix(key, r.KeyPrefixEquals)
+}
+
+// RedirectKey returns the key a matching request for key is redirected to
+func (r *RoutingRule) RedirectKey(key string) string {
+	switch {
+	case r.ReplaceKeyWith != "":
+		return r.ReplaceKeyWith
+	case r.ReplaceKeyPrefixWith != nil:
+		return *r.ReplaceKeyPrefixWith + strings.TrimPrefix(key, r.KeyPrefixEquals)
+	default:
+		return key
+	}
+}
+
+// MatchRoutingRule returns the first rule that applies to a request for key,
+// or nil when none does
+func (c *WebsiteConfig) MatchRoutingRule(key string, status int) *RoutingRule {
+	for i := range c.RoutingRules {
+		if c.RoutingRules[i].Matches(key, status) {
+			return &c.RoutingRules[i]
+		}
+	}
+	return nil
+}
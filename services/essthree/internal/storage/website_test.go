@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import "testing"
+
+func TestRoutingRules(t *testing.T) {
+	documents, empty := "documents/", ""
+	config := WebsiteConfig{
+		IndexDocument: "index.html",
+		RoutingRules: []RoutingRule{
+			{KeyPrefixEquals: "docs/", ReplaceKeyPrefixWith: &documents},
+			{HTTPErrorCodeReturnedEquals: 404, ReplaceKeyWith: "missing.html"},
+			{KeyPrefixEquals: "old/", HTTPErrorCodeReturnedEquals: 404, ReplaceKeyPrefixWith: &empty},
+			{KeyPrefixEquals: "moved/", HostName: "example.com"},
+		},
+	}
+
+	cases := []struct {
+		key    string
+		status int
+		want   string
+	}{
+		{"docs/a.html", 0, "documents/a.html"},
+		{"docs/a.html", 404, "documents/a.html"},
+		{"blog/post.html", 404, "missing.html"},
+		{"blog/post.html", 0, ""},
+		{"blog/post.html", 403, ""},
+		{"moved/page.html", 0, "moved/page.html"},
+	}
+	for _, tc := range cases {
+		rule := config.MatchRoutingRule(tc.key, tc.status)
+		got := ""
+		if rule != nil {
+			got = rule.RedirectKey(tc.key)
+		}
+		if got != tc.want {
+			t.Errorf("MatchRoutingRule(%q, %d): expected redirect to %q, got %q", tc.key, tc.status, tc.want, got)
+		}
+	}
+
+	strip := config.RoutingRules[2]
+	if got := strip.RedirectKey("old/page.html"); got != "page.html" {
+		t.Errorf("Expected the prefix to be removed, got %q", got)
+	}
+}
@@ -35,11 +35,12 @@ def test_multipart_upload():
         upload_id = response['UploadId']
         print(f"\n  Created upload: {upload_id}")
         
-        # Upload parts
+        # Upload parts; every part but the last must be at least 5 MiB
         parts = []
+        part_size = 5 * 1024 * 1024
         part_data = [
-            b'This is part 1. ' * 100,
-            b'This is part 2. ' * 100,
+            b'This is part 1. ' * (part_size // 16),
+            b'This is part 2. ' * (part_size // 16),
             b'This is part 3. ' * 100,
         ]
         